@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/sops"
+)
+
+// runCheckout decrypts a file to a working copy for editing with other
+// tools, or lists the outstanding checkouts
+func runCheckout(args []string) int {
+	fs := flag.NewFlagSet("checkout", flag.ContinueOnError)
+	createDir := fs.Bool("create-dir", false, "create the working copy's directory if it does not exist")
+	list := fs.Bool("list", false, "list the outstanding checkouts instead")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *list {
+		return listCheckouts()
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: supper checkout [flags] <encrypted-file> <working-copy>")
+		return 2
+	}
+
+	cfg := loadConfig()
+	opts := scriptOptions(cfg)
+	// The active profile's key may not be where sops looks by default
+	if identity, ok := age.ConfiguredIdentity(cfg.KeyPath); ok {
+		opts = append(opts, sops.WithIdentity(identity))
+	}
+	if *createDir {
+		opts = append(opts, sops.WithCreateOutputDir())
+	}
+
+	warnSymlink(fs.Arg(0))
+	checkout, err := sops.Checkout(fs.Arg(0), fs.Arg(1), opts...)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Checked out %s to %s\n", checkout.Source, checkout.WorkingCopy)
+	fmt.Fprintln(os.Stderr, "WARNING: the working copy is plaintext on disk until you run:")
+	fmt.Fprintf(os.Stderr, "  supper checkin %s\n", checkout.WorkingCopy)
+	return 0
+}
+
+// runCheckin encrypts a working copy back over its encrypted file and
+// securely deletes it
+func runCheckin(args []string) int {
+	fs := flag.NewFlagSet("checkin", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: supper checkin [flags] <working-copy>")
+		return 2
+	}
+
+	cfg := loadConfig()
+	checkout, wiped, err := sops.Checkin(fs.Arg(0), cfg.WipeOptions(), scriptOptions(cfg)...)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Checked in %s to %s; working copy deleted (%s)\n", checkout.WorkingCopy, checkout.Source, wiped)
+	return 0
+}
+
+// listCheckouts prints the outstanding checkouts, one per line, to stdout
+func listCheckouts() int {
+	outstanding := history.Outstanding()
+	if len(outstanding) == 0 {
+		fmt.Fprintln(os.Stderr, "No outstanding checkouts")
+		return 0
+	}
+	for _, c := range outstanding {
+		fmt.Printf("%s\t%s\t%s\n", c.WorkingCopy, c.Source, c.Time.Format(time.RFC3339))
+	}
+	return 0
+}
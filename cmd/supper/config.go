@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+)
+
+// runConfig prints information about the configuration
+func runConfig(args []string) int {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	schema := fs.Bool("schema", false, "print every configuration field with its type, default and environment variable")
+	profiles := fs.Bool("profiles", false, "list the configuration profiles, marking the active one")
+	jsonOutput := fs.Bool("json", false, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *profiles {
+		return listProfiles(*jsonOutput)
+	}
+	if !*schema {
+		fmt.Fprintln(os.Stderr, "Usage: supper config --schema [--json] | --profiles [--json]")
+		return 2
+	}
+
+	fields := config.Schema()
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fields); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode schema: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, group := range config.Groups {
+		fmt.Printf("%s\n", group)
+		for _, field := range fields {
+			if field.Group != group {
+				continue
+			}
+			fmt.Printf("  %s (%s)\n", field.Name, field.Type)
+			fmt.Printf("      %s\n", field.Description)
+			fmt.Printf("      default: %q, env: %s\n", field.Default, field.EnvVar)
+			if field.Validation != "" {
+				fmt.Printf("      valid: %s\n", field.Validation)
+			}
+		}
+		fmt.Println()
+	}
+	return 0
+}
+
+// listProfiles prints the default profile and every saved named profile
+func listProfiles(jsonOutput bool) int {
+	names, err := config.Profiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	names = append([]string{config.DefaultProfile}, names...)
+
+	active := config.ActiveProfile()
+	if active == "" {
+		active = config.DefaultProfile
+	}
+	// A profile exists once it is saved, but the active one is always listed
+	if !slices.Contains(names, active) {
+		names = append(names, active)
+	}
+
+	if jsonOutput {
+		out := struct {
+			Active   string   `json:"active"`
+			Profiles []string `json:"profiles"`
+		}{Active: active, Profiles: names}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode profiles: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, name := range names {
+		marker := "  "
+		if name == active {
+			marker = "* "
+		}
+		fmt.Println(marker + name)
+	}
+	return 0
+}
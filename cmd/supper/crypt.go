@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/sops"
+)
+
+// stdinArg is the file argument meaning "read from stdin, write to stdout"
+const stdinArg = "-"
+
+// runEncrypt encrypts a file, or stdin when the file is "-"
+func runEncrypt(args []string) int {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "age recipient (repeatable or comma-separated, defaults to the configured recipients)")
+	inputType := fs.String("input-type", "", "input format (required when reading stdin): "+fmt.Sprint(sops.Formats))
+	inPlace := fs.Bool("in-place", false, "encrypt the file in place instead of writing to stdout")
+	output := fs.String("output", "", "write the ciphertext to this path and keep the plaintext")
+	sidecar := fs.Bool("sidecar", false, "write the ciphertext beside the file, named by the output_template setting (<file>.enc by default), and keep the plaintext")
+	allowUntrusted := fs.Bool("allow-untrusted", false, "encrypt to recipients missing from the trusted allowlist (ignored in strict mode)")
+	encryptAll := fs.Bool("ignore-encrypted-regex", false, "encrypt every value, ignoring the encrypted_regex of the file's .sops.yaml rule")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: supper encrypt [flags] <file|->")
+		return 2
+	}
+	path := fs.Arg(0)
+	if *sidecar && *output == "" && path != stdinArg {
+		*output = sops.SidecarPath(path)
+	}
+	if *inPlace && *output != "" {
+		fmt.Fprintln(os.Stderr, "--in-place cannot be combined with --output or --sidecar")
+		return 2
+	}
+
+	cfg := loadConfig()
+	if len(recipients) == 0 {
+		recipients.Set(cfg.DefaultRecipients)
+	}
+	if len(recipients) == 0 {
+		fmt.Fprintln(os.Stderr, "No recipients given and no default recipients configured")
+		return 2
+	}
+
+	resolved, err := age.ResolveRecipients(recipients)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	if !checkTrusted(resolved, *allowUntrusted, *jsonOutput) {
+		return 1
+	}
+
+	if path == stdinArg {
+		if *inPlace || *output != "" || *sidecar || *encryptAll {
+			fmt.Fprintln(os.Stderr, "--in-place, --output, --sidecar and --ignore-encrypted-regex cannot be used with stdin")
+			return 2
+		}
+		err = sops.EncryptStream(os.Stdin, *inputType, resolved, os.Stdout, scriptOptions(cfg)...)
+	} else {
+		warnSymlink(path)
+
+		// Ciphertext is of no use on a terminal, so without a destination
+		// follow the encrypt_in_place setting; pipes still get stdout
+		if !*inPlace && *output == "" && isTerminal(os.Stdout) {
+			if cfg.EncryptInPlace {
+				*inPlace = true
+			} else {
+				*output = sops.SidecarPath(path)
+			}
+		}
+
+		opts := scriptOptions(cfg)
+		if *encryptAll {
+			opts = append(opts, sops.WithoutEncryptedRegex())
+		}
+		if *output != "" {
+			if *output == sops.SidecarPath(path) {
+				// The output template may name a subdirectory beside the file
+				opts = append(opts, sops.WithCreateOutputDir())
+			}
+			err = sops.EncryptToFile(path, *output, resolved, opts...)
+		} else {
+			err = sops.EncryptFile(path, resolved, *inPlace, opts...)
+		}
+	}
+
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	return 0
+}
+
+// runDecrypt decrypts a file, or stdin when the file is "-"
+func runDecrypt(args []string) int {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	inputType := fs.String("input-type", "", "input format (required when reading stdin): "+fmt.Sprint(sops.Formats))
+	outputType := fs.String("output-type", "", "output format, if different from the input")
+	output := fs.String("output", "", "write the plaintext to this path instead of stdout")
+	inPlace := fs.Bool("in-place", false, "decrypt the file in place")
+	identityEnv := fs.String("identity-env", "", "read the age secret key from this environment variable instead of the key file")
+	identityFile := fs.String("identity-file", "", "decrypt with the age identity in this file")
+	tryIdentities := fs.Bool("try-identities", false, "try each available age identity on its own and report which one decrypted the file")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: supper decrypt [flags] <file|->")
+		return 2
+	}
+	path := fs.Arg(0)
+	if *tryIdentities && path == stdinArg {
+		fmt.Fprintln(os.Stderr, "--try-identities cannot be used with stdin")
+		return 2
+	}
+
+	opts := scriptOptions(loadConfig())
+	if *outputType != "" {
+		opts = append(opts, sops.WithOutputType(*outputType))
+	}
+
+	// Identities given on the command line are tried before the others
+	var identity *age.Identity
+	switch {
+	case *identityEnv != "" && *identityFile != "":
+		fmt.Fprintln(os.Stderr, "--identity-env and --identity-file cannot be combined")
+		return 2
+	case *identityEnv != "":
+		fromEnv, err := age.IdentityFromEnv(*identityEnv)
+		if err != nil {
+			reportError(err, *jsonOutput)
+			return 1
+		}
+		identity = &fromEnv
+	case *identityFile != "":
+		fromFile := age.WithIdentityFile(*identityFile)
+		if err := fromFile.Validate(); err != nil {
+			reportError(err, *jsonOutput)
+			return 1
+		}
+		identity = &fromFile
+	case !*tryIdentities:
+		// The active profile's key may not be where sops looks by default
+		if configured, ok := age.ConfiguredIdentity(loadConfig().KeyPath); ok {
+			identity = &configured
+		}
+	}
+
+	if *tryIdentities {
+		warnSymlink(path)
+		warnExposed(path, *inPlace, *output)
+		return forceDecrypt(path, *inPlace, *output, identity, opts, *jsonOutput)
+	}
+	if identity != nil {
+		opts = append(opts, sops.WithIdentity(*identity))
+	}
+
+	var err error
+	if path == stdinArg {
+		if *inPlace || *output != "" {
+			fmt.Fprintln(os.Stderr, "--in-place and --output cannot be used with stdin")
+			return 2
+		}
+		err = sops.DecryptStream(os.Stdin, *inputType, os.Stdout, opts...)
+	} else {
+		warnSymlink(path)
+		warnExposed(path, *inPlace, *output)
+		err = sops.DecryptFile(path, *inPlace, *output, opts...)
+	}
+
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	return 0
+}
+
+// forceDecrypt decrypts path trying each available identity in turn, plus
+// the one given on the command line, and tells on stderr which one worked
+func forceDecrypt(path string, inPlace bool, output string, identity *age.Identity, opts []sops.Option, jsonOutput bool) int {
+	var candidates []age.Candidate
+	if identity != nil {
+		given, err := identity.Candidates("command line")
+		if err != nil {
+			reportError(err, jsonOutput)
+			return 1
+		}
+		candidates = given
+	}
+	candidates = age.AppendCandidates(candidates, age.AvailableIdentities(loadConfig().KeyPath)...)
+
+	matched, err := sops.ForceDecrypt(path, inPlace, output, candidates, opts...)
+	if err != nil {
+		reportError(err, jsonOutput)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Decrypted with", matched.Label())
+	return 0
+}
+
+// scriptOptions returns the sops options for a run nobody can answer prompts
+// for, because stdin is not a terminal: prompts fail straight away and
+// sops_timeout stops a sops process that waits regardless
+func scriptOptions(cfg *config.Config) []sops.Option {
+	if isTerminal(os.Stdin) {
+		return nil
+	}
+	return []sops.Option{sops.WithNonInteractive(cfg.SOPSTimeout)}
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// warnSymlink tells the user on stderr how a symlinked path will be handled
+func warnSymlink(path string) {
+	if warning := sops.SymlinkWarning(path); warning != "" {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+}
+
+// warnExposed tells the user on stderr when the plaintext of decrypting path
+// lands in a directory other users can write to; strict mode refuses it later
+func warnExposed(path string, inPlace bool, output string) {
+	if inPlace {
+		output = path
+	}
+	if output == "" || loadConfig().StrictOutputDir {
+		return
+	}
+	if warning := sops.OutputExposure(output); warning != "" {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+}
+
+// checkTrusted checks recipients against the trusted allowlist. There is no
+// one to ask, so untrusted recipients need --allow-untrusted, and strict mode
+// refuses them regardless.
+func checkTrusted(recipients []age.Recipient, allowUntrusted, jsonOutput bool) bool {
+	cfg := loadConfig()
+	if !cfg.TrustCheckEnabled() {
+		return true
+	}
+
+	untrusted := age.UntrustedRecipients(recipients)
+	if len(untrusted) == 0 {
+		return true
+	}
+	if allowUntrusted && !cfg.StrictRecipients {
+		for _, r := range untrusted {
+			fmt.Fprintf(os.Stderr, "Warning: encrypting to untrusted recipient %s\n", age.Fingerprint(r.Key))
+		}
+		return true
+	}
+
+	reportError(age.UntrustedError(untrusted), jsonOutput)
+	if !cfg.StrictRecipients {
+		fmt.Fprintln(os.Stderr, "Pass --allow-untrusted to encrypt to them anyway")
+	}
+	return false
+}
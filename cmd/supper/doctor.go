@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/doctor"
+)
+
+// runDoctor checks the environment and prints the results
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "print results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	checks := doctor.Run()
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode results: %v\n", err)
+			return 1
+		}
+	} else {
+		for _, check := range checks {
+			fmt.Printf("[%s] %s: %s\n", check.Status, check.Name, check.Message)
+			if check.Fix != "" && check.Status != doctor.StatusPass {
+				fmt.Printf("       fix: %s\n", check.Fix)
+			}
+		}
+	}
+
+	if doctor.HasFailures(checks) {
+		return 1
+	}
+	return 0
+}
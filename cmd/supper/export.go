@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/sops"
+)
+
+// runExport decrypts a file once and writes the plaintext to several
+// targets, each in its own format
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	force := fs.Bool("force", false, "overwrite targets that already exist instead of skipping them")
+	createDir := fs.Bool("create-dir", false, "create missing target directories")
+	reportFormat := fs.String("report", "", "print a report to stdout: json or csv")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: supper export [flags] <file> <[format=]target>...")
+		return 2
+	}
+	if *reportFormat != "" && *reportFormat != "json" && *reportFormat != "csv" {
+		fmt.Fprintf(os.Stderr, "Unknown report format %q (want json or csv)\n", *reportFormat)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	var targets []sops.ExportTarget
+	for _, spec := range fs.Args()[1:] {
+		target, err := sops.ParseExportTarget(spec)
+		if err != nil {
+			reportError(err, *jsonOutput)
+			return 2
+		}
+		targets = append(targets, target)
+	}
+
+	cfg := loadConfig()
+	opts := scriptOptions(cfg)
+	if *createDir {
+		opts = append(opts, sops.WithCreateOutputDir())
+	}
+	// The active profile's key may not be where sops looks by default
+	if configured, ok := age.ConfiguredIdentity(cfg.KeyPath); ok {
+		opts = append(opts, sops.WithIdentity(configured))
+	}
+
+	warnSymlink(path)
+	for _, target := range targets {
+		warnExposed(path, false, target.Path)
+	}
+	report, err := sops.ExportFile(path, targets, *force, opts...)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+
+	if *reportFormat != "" {
+		if code := printReport(report, *reportFormat); code != 0 {
+			return code
+		}
+	} else {
+		for _, result := range report.Files {
+			if result.Status == sops.StatusOK {
+				fmt.Fprintf(os.Stderr, "Wrote %s\n", result.Output)
+			} else {
+				fmt.Fprintf(os.Stderr, "[%s] %s: %s\n", result.Status, result.Output, result.Error)
+			}
+		}
+	}
+	if report.Count(sops.StatusFailed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,25 +1,139 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/instance"
 	"github.com/bxtal-lsn/supper/internal/ui/views"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
+	args, err := parseProfile(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Run a CLI subcommand if one was given
+	if len(args) > 0 {
+		os.Exit(runCommand(args[0], args[1:]))
+	}
+
+	// Only one instance may manage a profile's key at a time, otherwise one
+	// instance's auto-delete timer could wipe a key another is using
+	lock, err := instance.Acquire(instance.Path(config.ActiveProfile()), func(holder instance.Holder) {
+		fmt.Fprintf(os.Stderr, "Another supper instance (%s) is running; waiting for it to exit. Press Ctrl+C to give up.\n", holder)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not take the instance lock, other instances will not be detected: %v\n", err)
+	}
+	defer lock.Release()
+
 	// Initialize our application
 	p := tea.NewProgram(
 		views.NewMainView(),
-		tea.WithAltScreen(),       // Use the full terminal window
-		tea.WithMouseCellMotion(), // Enable mouse support
+		tea.WithAltScreen(),        // Use the full terminal window
+		tea.WithMouseCellMotion(),  // Enable mouse support
+		tea.WithoutSignalHandler(), // Signals are handled below so the key gets wiped
 	)
 
+	// Wipe the decrypted key if we are interrupted or terminated. Quitting
+	// normally leaves it to the auto-delete timer as before.
+	exitCode := 0
+	stopSignals := handleSignals(decryptedKeyPath, func(sig os.Signal) {
+		exitCode = signalExitCode(sig)
+		p.Kill()
+	})
+	defer stopSignals()
+
+	// SIGHUP reloads the configuration, like ctrl+r in the TUI
+	stopReload := handleReload(func() { p.Send(views.ReloadConfigMsg{}) })
+	defer stopReload()
+
 	// Start the application
-	if _, err := p.Run(); err != nil {
+	_, err = p.Run()
+
+	// Wipe any passphrase cached for the session before the process exits
+	age.ForgetPassphrase()
+
+	if err != nil {
+		if errors.Is(err, tea.ErrProgramKilled) && exitCode != 0 {
+			stopSignals()
+			lock.Release()
+			os.Exit(exitCode)
+		}
 		fmt.Printf("Error running application: %v\n", err)
+		lock.Release()
 		os.Exit(1)
 	}
 }
 
+// parseProfile handles the global --profile flag, which must come before any
+// subcommand, and returns the remaining arguments. SUPPER_PROFILE is used
+// when the flag is not given.
+func parseProfile(args []string) ([]string, error) {
+	if len(args) > 0 {
+		var name string
+		flagGiven := true
+		switch arg := args[0]; {
+		case arg == "--profile" || arg == "-profile":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("--profile requires a profile name")
+			}
+			name, args = args[1], args[2:]
+		case strings.HasPrefix(arg, "--profile="):
+			name, args = strings.TrimPrefix(arg, "--profile="), args[1:]
+		case strings.HasPrefix(arg, "-profile="):
+			name, args = strings.TrimPrefix(arg, "-profile="), args[1:]
+		default:
+			flagGiven = false
+		}
+		if flagGiven {
+			if err := config.SetProfile(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The flag was validated above, the environment is checked here
+	if err := config.ValidateProfileName(config.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", config.EnvProfile, err)
+	}
+	return args, nil
+}
+
+// runCommand dispatches a CLI subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "doctor":
+		return runDoctor(args)
+	case "encrypt":
+		return runEncrypt(args)
+	case "decrypt":
+		return runDecrypt(args)
+	case "export":
+		return runExport(args)
+	case "checkout":
+		return runCheckout(args)
+	case "checkin":
+		return runCheckin(args)
+	case "policy":
+		return runPolicy(args)
+	case "rekey":
+		return runRekey(args)
+	case "config":
+		return runConfig(args)
+	case "watch":
+		return runWatch(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+		fmt.Fprintln(os.Stderr, "Available commands: doctor, encrypt, decrypt, export, checkout, checkin, policy, rekey, config, watch")
+		return 2
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// reportError prints an error to stderr, as JSON when requested
+func reportError(err error, jsonOutput bool) {
+	if jsonOutput {
+		data, jsonErr := errors.ToJSON(err)
+		if jsonErr == nil {
+			fmt.Fprintln(os.Stderr, string(data))
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+}
+
+// stringList is a flag that can be repeated or given comma-separated values
+type stringList []string
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/sops"
+)
+
+// runPolicy checks encrypted files against the required-recipients policy
+// and exits non-zero when any file violates it
+func runPolicy(args []string) int {
+	fs := flag.NewFlagSet("policy", flag.ContinueOnError)
+	gitScope := fs.String("git-scope", loadConfig().GitScope, "in a git repository, check all files, skip gitignored ones (gitignore) or only tracked ones (tracked)")
+	jsonOutput := fs.Bool("json", false, "print violations as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	required, err := sops.RequiredRecipients()
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	if len(required) == 0 {
+		reportError(errors.New(errors.TypeConfig, "No required recipients are configured").
+			WithCode(errors.CodeConfigInvalid), *jsonOutput)
+		return 2
+	}
+
+	violations := []sops.PolicyViolation{}
+	for _, dir := range dirs {
+		found, err := sops.ScanPolicy(dir, append(scriptOptions(loadConfig()), sops.WithGitScope(*gitScope))...)
+		if err != nil {
+			reportError(err, *jsonOutput)
+			return 1
+		}
+		violations = append(violations, found...)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(violations); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode results: %v\n", err)
+			return 1
+		}
+	} else {
+		for _, v := range violations {
+			if v.Error != "" {
+				fmt.Printf("%s: recipients could not be read: %s\n", v.Path, v.Error)
+				continue
+			}
+			fmt.Printf("%s: missing %d required recipient(s)\n", v.Path, len(v.Missing))
+			for _, r := range v.Missing {
+				fmt.Printf("       %s\n", r)
+			}
+		}
+		if len(violations) == 0 {
+			fmt.Println("All encrypted files include the required recipients")
+		}
+	}
+
+	if len(violations) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/sops"
+)
+
+// runRekey re-encrypts every encrypted file under the given directories to a
+// new set of recipients, optionally printing a report to stdout
+func runRekey(args []string) int {
+	fs := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "age recipient (repeatable or comma-separated, defaults to the configured recipients)")
+	reportFormat := fs.String("report", "", "print a report to stdout: json or csv")
+	allowUntrusted := fs.Bool("allow-untrusted", false, "re-key to recipients missing from the trusted allowlist (ignored in strict mode)")
+	gitScope := fs.String("git-scope", loadConfig().GitScope, "in a git repository, re-key all files, skip gitignored ones (gitignore) or only tracked ones (tracked)")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: supper rekey [flags] <dir>...")
+		return 2
+	}
+	if *reportFormat != "" && *reportFormat != "json" && *reportFormat != "csv" {
+		fmt.Fprintf(os.Stderr, "Unknown report format %q (want json or csv)\n", *reportFormat)
+		return 2
+	}
+
+	if len(recipients) == 0 {
+		recipients.Set(loadConfig().DefaultRecipients)
+	}
+	if len(recipients) == 0 {
+		fmt.Fprintln(os.Stderr, "No recipients given and no default recipients configured")
+		return 2
+	}
+
+	resolved, err := age.ResolveRecipients(recipients)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	if !checkTrusted(resolved, *allowUntrusted, *jsonOutput) {
+		return 1
+	}
+
+	opts := append(scriptOptions(loadConfig()), sops.WithGitScope(*gitScope))
+	exitCode := 0
+	for _, dir := range fs.Args() {
+		report, err := sops.ReEncryptTree(dir, resolved, opts...)
+		if report != nil {
+			if code := printReport(report, *reportFormat); code != 0 {
+				return code
+			}
+			if report.Count(sops.StatusFailed) > 0 {
+				exitCode = 1
+			}
+		}
+		if err != nil {
+			reportError(err, *jsonOutput)
+			return 1
+		}
+	}
+	return exitCode
+}
+
+// printReport writes a batch report to stdout in the requested format, or a
+// summary to stderr when no format was requested
+func printReport(report *sops.Report, format string) int {
+	var err error
+	switch format {
+	case "json":
+		err = report.ToJSON(os.Stdout)
+	case "csv":
+		err = report.ToCSV(os.Stdout)
+	default:
+		for _, f := range report.Files {
+			if f.Status == sops.StatusFailed {
+				fmt.Fprintf(os.Stderr, "[%s] %s: %s\n", f.Status, f.Path, f.Error)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", report.Root, report.Summary())
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+		return 1
+	}
+	return 0
+}
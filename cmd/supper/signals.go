@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// loadConfig loads the configuration, falling back to the defaults
+func loadConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		return config.DefaultConfig()
+	}
+	return cfg
+}
+
+// decryptedKeyPath returns the configured path of the decrypted age key
+func decryptedKeyPath() string {
+	if cfg := loadConfig(); cfg.KeyPath != "" {
+		return cfg.KeyPath
+	}
+	// With no key path at all there is no key to wipe
+	path, _ := age.DefaultKeyPath()
+	return path
+}
+
+// wipeDecryptedKey securely deletes the decrypted key if it is present on disk
+func wipeDecryptedKey(path string) error {
+	if path == "" || !utils.FileExists(path) {
+		return nil
+	}
+	_, err := age.SecurelyDeleteKeyWithOptions(path, loadConfig().WipeOptions())
+	return err
+}
+
+// handleSignals wipes the decrypted key when SIGINT or SIGTERM is received and
+// then calls onSignal so the caller can shut down. keyPath is asked for the
+// path when the signal arrives, since a reload may have changed it. The
+// returned function stops listening for signals.
+func handleSignals(keyPath func() string, onSignal func(os.Signal)) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			path := keyPath()
+			if err := wipeDecryptedKey(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to delete decrypted key %s: %v\n", path, err)
+			}
+			onSignal(sig)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(done)
+		})
+	}
+}
+
+// handleReload calls onReload each time SIGHUP is received, the conventional
+// request to re-read the configuration. The returned function stops listening.
+func handleReload(onReload func()) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				onReload()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(done)
+		})
+	}
+}
+
+// signalExitCode returns the conventional exit code for a terminating signal
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
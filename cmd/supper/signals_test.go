@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempKey writes a stand-in decrypted key and keeps the wipe from reading
+// the user's own configuration
+func tempKey(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+
+	path := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(path, []byte("AGE-SECRET-KEY-1EXAMPLE\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWipeDecryptedKeyRemovesKey(t *testing.T) {
+	path := tempKey(t)
+	if err := wipeDecryptedKey(path); err != nil {
+		t.Fatalf("wipeDecryptedKey: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("key still present after wipe: %v", err)
+	}
+}
+
+func TestWipeDecryptedKeyWithoutKey(t *testing.T) {
+	path := tempKey(t)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"", path} {
+		if err := wipeDecryptedKey(p); err != nil {
+			t.Errorf("wipeDecryptedKey(%q): %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignalsWipesCurrentKeyPath(t *testing.T) {
+	path := tempKey(t)
+
+	// The key path is changed after the handler is installed, as a reload would
+	var current atomic.Value
+	current.Store(filepath.Join(filepath.Dir(path), "old-keys.txt"))
+	received := make(chan os.Signal, 1)
+	stop := handleSignals(func() string { return current.Load().(string) }, func(sig os.Signal) { received <- sig })
+	defer stop()
+	current.Store(path)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-received:
+		if sig != syscall.SIGTERM {
+			t.Errorf("got signal %v, want SIGTERM", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal received")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("key at the current path still present: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/watch"
+)
+
+// runWatch re-encrypts tracked plaintext files whenever they change, until interrupted
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "age recipient (repeatable or comma-separated, defaults to the configured recipients)")
+	debounce := fs.Duration("debounce", watch.DefaultDebounce, "wait this long after the last change before encrypting")
+	jsonOutput := fs.Bool("json", false, "print errors as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: supper watch [flags] <file|dir>...")
+		return 2
+	}
+
+	if len(recipients) == 0 {
+		recipients.Set(loadConfig().DefaultRecipients)
+	}
+	if len(recipients) == 0 {
+		fmt.Fprintln(os.Stderr, "No recipients given and no default recipients configured")
+		return 2
+	}
+
+	resolved, err := age.ResolveRecipients(recipients)
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Watching %d path(s), press Ctrl+C to stop\n", fs.NArg())
+	opts := watch.Options{Recipients: resolved, Debounce: *debounce, SOPS: scriptOptions(loadConfig())}
+	err = watch.Run(ctx, fs.Args(), opts, func(ev watch.Event) {
+		if ev.Err != nil {
+			reportError(ev.Err, *jsonOutput)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s encrypted %s -> %s\n", ev.Time.Format("15:04:05"), ev.Path, ev.Output)
+	})
+	if err != nil {
+		reportError(err, *jsonOutput)
+		return 1
+	}
+	return 0
+}
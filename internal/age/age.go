@@ -2,15 +2,23 @@ package age
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
 )
 
+// KeyAlgorithm describes the keys age-keygen generates: an X25519 key pair
+// whose 32-byte private key is read from the operating system's secure
+// random source
+const KeyAlgorithm = "X25519 (256-bit, from the OS random source)"
+
 // KeyPair represents an age key pair
 type KeyPair struct {
 	PrivateKey  string
@@ -18,45 +26,64 @@ type KeyPair struct {
 	IsEncrypted bool
 }
 
-// DefaultKeyPath returns the default path for the age key
-func DefaultKeyPath() string {
-	home, err := os.UserHomeDir()
+// DefaultKeyPath returns the default path for the age key, under the home
+// directory, or the config directory when there is no home. It fails rather
+// than return a relative path that would put keys in the working directory.
+func DefaultKeyPath() (string, error) {
+	if home, err := utils.HomeDir(); err == nil {
+		return filepath.Join(home, ".config", "sops", "age", "keys.txt"), nil
+	}
+	configDir, err := utils.ConfigDir()
 	if err != nil {
-		return ""
+		return "", errors.Wrap(err, errors.TypeConfig, "No default key path; set key_path and encrypted_key_path").
+			WithCode(errors.CodeConfigInvalid)
 	}
-	return filepath.Join(home, ".config", "sops", "age", "keys.txt")
+	return filepath.Join(configDir, "sops", "age", "keys.txt"), nil
 }
 
 // DefaultEncryptedKeyPath returns the default path for the encrypted age key
-func DefaultEncryptedKeyPath() string {
-	return DefaultKeyPath() + ".encrypted"
+func DefaultEncryptedKeyPath() (string, error) {
+	keyPath, err := DefaultKeyPath()
+	if err != nil {
+		return "", err
+	}
+	return keyPath + ".encrypted", nil
+}
+
+// checkKeyPath rejects an empty key path, which is left when no default
+// could be determined and would otherwise resolve to the working directory
+func checkKeyPath(path string) error {
+	if path == "" {
+		return errors.New(errors.TypeConfig, "No key path configured; set key_path and encrypted_key_path").
+			WithCode(errors.CodeConfigInvalid)
+	}
+	return nil
 }
 
 // GenerateKey generates a new age key pair
 func GenerateKey() (*KeyPair, error) {
 	cmd := exec.Command("age-keygen")
 	var out bytes.Buffer
+	var errOut bytes.Buffer
 	cmd.Stdout = &out
+	cmd.Stderr = &errOut
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("failed to generate age key: %w", err)
 	}
 
-	output := out.String()
-	lines := strings.Split(output, "\n")
+	// Newer versions also print "Public key: ..." to stderr when stdout is not a terminal
+	publicKey, privateKey := parseKeygenOutput(out.String() + "\n" + errOut.String())
 
-	// Extract public key from the output
-	var publicKey string
-	var privateKey string
-	for _, line := range lines {
-		if strings.HasPrefix(line, "# public key: ") {
-			publicKey = strings.TrimPrefix(line, "# public key: ")
-		} else if strings.HasPrefix(line, "AGE-SECRET-KEY-") {
-			privateKey = line
-		}
+	// Derive the public key ourselves if the comment wording is not recognised
+	if privateKey != "" && publicKey == "" {
+		publicKey, _ = publicKeyFromPrivate(privateKey)
 	}
 
 	if publicKey == "" || privateKey == "" {
-		return nil, errors.New("failed to parse age key output")
+		return nil, errors.New(errors.TypeKeyManagement, "Failed to parse age key output").
+			WithCode(errors.CodeAgeKeygenFailed).
+			WithData("stdout", redactSecretKeys(out.String())).
+			WithData("stderr", errOut.String())
 	}
 
 	return &KeyPair{
@@ -66,6 +93,61 @@ func GenerateKey() (*KeyPair, error) {
 	}, nil
 }
 
+var (
+	// publicKeyPattern matches "# public key: age1..." and "Public key: age1..." in any case
+	publicKeyPattern = regexp.MustCompile(`(?i)public\s+key\s*:\s*(age1[0-9a-z]+)`)
+	// secretKeyPattern matches a bare age secret key
+	secretKeyPattern = regexp.MustCompile(`(?i)^AGE-SECRET-KEY-1[0-9A-Z]+$`)
+	// badPassphrasePattern matches what age prints when the passphrase of
+	// a passphrase-encrypted file is wrong
+	badPassphrasePattern = regexp.MustCompile(`(?i)incorrect passphrase`)
+)
+
+// parseKeygenOutput extracts the key pair from age-keygen output. It tolerates
+// comment wording changes, "# created:" lines, CRLF line endings and trailing
+// whitespace.
+func parseKeygenOutput(output string) (publicKey, privateKey string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case secretKeyPattern.MatchString(line):
+			if privateKey == "" {
+				privateKey = strings.ToUpper(line)
+			}
+		case strings.HasPrefix(strings.ToLower(line), "# created"):
+			// Creation timestamp, nothing to extract
+		case publicKey == "":
+			if m := publicKeyPattern.FindStringSubmatch(line); m != nil {
+				publicKey = strings.ToLower(m[1])
+			}
+		}
+	}
+	return publicKey, privateKey
+}
+
+// publicKeyFromPrivate asks age-keygen to derive the public key of a secret key
+func publicKeyFromPrivate(privateKey string) (string, error) {
+	cmd := exec.Command("age-keygen", "-y")
+	cmd.Stdin = strings.NewReader(privateKey + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// redactSecretKeys hides secret keys in output attached to errors
+func redactSecretKeys(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if secretKeyPattern.MatchString(strings.TrimSpace(line)) {
+			lines[i] = "AGE-SECRET-KEY-[redacted]"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // EncryptKey encrypts an age key with a passphrase
 func EncryptKey(key *KeyPair, passphrase string) ([]byte, error) {
 	// Create a temporary file to write the private key
@@ -83,8 +165,10 @@ func EncryptKey(key *KeyPair, passphrase string) ([]byte, error) {
 	}
 	tmpFile.Close()
 
-	// Set up command to encrypt using stdin for passphrase
-	cmd := exec.Command("age", "-p", "-o", "-", tmpPath)
+	// Releases differ in how often they read the passphrase
+	version := InstalledVersion()
+	flow := passphraseFlowFor(version)
+	cmd := exec.Command("age", append(flow.args, tmpPath)...)
 
 	// Connect passphrase to stdin
 	stdin, err := cmd.StdinPipe()
@@ -102,15 +186,14 @@ func EncryptKey(key *KeyPair, passphrase string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to start age command: %w", err)
 	}
 
-	// Write passphrase to stdin twice (age requires confirmation)
-	if _, err := io.WriteString(stdin, passphrase+"\n"+passphrase+"\n"); err != nil {
-		return nil, fmt.Errorf("failed to write passphrase: %w", err)
+	if _, err := io.WriteString(stdin, flow.input(passphrase)); err != nil {
+		return nil, fmt.Errorf("failed to write passphrase%s: %w", versionSuffix(version), err)
 	}
 	stdin.Close()
 
 	// Wait for command to complete
 	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("failed to encrypt key: %s - %w", errOut.String(), err)
+		return nil, fmt.Errorf("failed to encrypt key%s: %s - %w", versionSuffix(version), errOut.String(), err)
 	}
 
 	return out.Bytes(), nil
@@ -118,6 +201,12 @@ func EncryptKey(key *KeyPair, passphrase string) ([]byte, error) {
 
 // DecryptKey decrypts an encrypted age key
 func DecryptKey(encryptedKey []byte, passphrase string) (string, error) {
+	return DecryptKeyWith(encryptedKey, []byte(passphrase))
+}
+
+// DecryptKeyWith decrypts an encrypted age key with a passphrase held in a
+// byte slice, which is written to age without being copied into a string
+func DecryptKeyWith(encryptedKey []byte, passphrase []byte) (string, error) {
 	// Create a temporary file for the encrypted key
 	tmpFile, err := os.CreateTemp("", "age-encrypted-*.key")
 	if err != nil {
@@ -153,21 +242,111 @@ func DecryptKey(encryptedKey []byte, passphrase string) (string, error) {
 	}
 
 	// Write passphrase to stdin and close
-	if _, err := io.WriteString(stdin, passphrase+"\n"); err != nil {
+	if _, err := stdin.Write(passphrase); err != nil {
+		return "", fmt.Errorf("failed to write passphrase: %w", err)
+	}
+	if _, err := io.WriteString(stdin, "\n"); err != nil {
 		return "", fmt.Errorf("failed to write passphrase: %w", err)
 	}
 	stdin.Close()
 
 	// Wait for command to complete
 	if err := cmd.Wait(); err != nil {
-		return "", fmt.Errorf("failed to decrypt key: %s - %w", errOut.String(), err)
+		if badPassphrasePattern.MatchString(errOut.String()) {
+			return "", errors.New(errors.TypeSecurity, "Incorrect passphrase provided").
+				WithCode(errors.CodeAgeBadPassphrase)
+		}
+		return "", fmt.Errorf("failed to decrypt key%s: %s - %w", versionSuffix(InstalledVersion()), errOut.String(), err)
 	}
 
+	// Some age releases exit cleanly on a wrong passphrase with garbage on
+	// stdout, which would otherwise only fail later, inside sops
+	if err := checkDecryptedKey(out.String()); err != nil {
+		utils.WipeBytes(out.Bytes())
+		return "", err
+	}
 	return out.String(), nil
 }
 
+// checkDecryptedKey reports whether output, as age -d printed it, is a key
+// file: comments and blank lines, and at least one well-formed secret key
+func checkDecryptedKey(output string) error {
+	keys := 0
+	for n, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case validSecretKey(line):
+			keys++
+		default:
+			return errors.New(errors.TypeSecurity, "Decryption produced invalid key material").
+				WithCode(errors.CodeAgeInvalidKey).WithData("line", n+1)
+		}
+	}
+	if keys == 0 {
+		return errors.New(errors.TypeSecurity, "Decryption produced invalid key material").
+			WithCode(errors.CodeAgeInvalidKey)
+	}
+	return nil
+}
+
+// bech32Charset holds the characters of the bech32 encoding, in value order
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// validSecretKey reports whether line is an age secret key as age writes
+// it: the bech32 encoding of 32 bytes under the AGE-SECRET-KEY- prefix, with
+// its checksum intact, so a truncated or corrupted key is caught
+func validSecretKey(line string) bool {
+	if !secretKeyPattern.MatchString(line) {
+		return false
+	}
+	lower := strings.ToLower(line)
+	hrp, data := lower[:len("age-secret-key-")], lower[len("age-secret-key-1"):]
+	// 32 bytes take 52 characters, and the checksum another 6
+	if len(data) != 58 {
+		return false
+	}
+
+	values := make([]byte, 0, len(hrp)*2+1+len(data))
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	for i := 0; i < len(data); i++ {
+		v := strings.IndexByte(bech32Charset, data[i])
+		if v < 0 {
+			return false
+		}
+		values = append(values, byte(v))
+	}
+	return bech32Polymod(values) == 1
+}
+
+// bech32Polymod computes the bech32 checksum over values, as defined in
+// BIP 173; a valid string gives 1
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
 // SaveKey saves an age key to the specified file
 func SaveKey(key *KeyPair, path string) error {
+	if err := checkKeyPath(path); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
@@ -181,6 +360,9 @@ func SaveKey(key *KeyPair, path string) error {
 
 // SaveEncryptedKey saves an encrypted age key to the specified file
 func SaveEncryptedKey(encryptedKey []byte, path string) error {
+	if err := checkKeyPath(path); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
@@ -194,6 +376,9 @@ func SaveEncryptedKey(encryptedKey []byte, path string) error {
 
 // LoadEncryptedKey loads an encrypted age key from the specified file
 func LoadEncryptedKey(path string) ([]byte, error) {
+	if err := checkKeyPath(path); err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read encrypted key file: %w", err)
@@ -204,50 +389,53 @@ func LoadEncryptedKey(path string) ([]byte, error) {
 
 // SecurelyDeleteKey securely deletes the decrypted key file
 func SecurelyDeleteKey(path string) error {
-	// Check if shred is available
-	_, err := exec.LookPath("shred")
-	if err == nil {
-		cmd := exec.Command("shred", "-u", path)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to shred key file: %w", err)
-		}
-		return nil
-	}
+	_, err := SecurelyDeleteKeyWithOptions(path, utils.DefaultWipeOptions())
+	return err
+}
 
-	// Fallback: overwrite with zeros before deleting
-	fileInfo, err := os.Stat(path)
-	if err != nil {
-		return fmt.Errorf("failed to stat key file: %w", err)
+// SecurelyDeleteKeyWithOptions securely deletes the decrypted key file using
+// the given wipe options and reports how the deletion was performed
+func SecurelyDeleteKeyWithOptions(path string, opts utils.WipeOptions) (*utils.WipeResult, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to stat key file: %w", err)
 	}
 
-	file, err := os.OpenFile(path, os.O_WRONLY, 0o600)
+	result, err := utils.SecureDelete(path, opts)
 	if err != nil {
-		return fmt.Errorf("failed to open key file for overwriting: %w", err)
-	}
-	defer file.Close()
-
-	// Overwrite file with zeros
-	size := fileInfo.Size()
-	zeros := make([]byte, 1024)
-	for written := int64(0); written < size; {
-		n, err := file.Write(zeros)
-		if err != nil {
-			return fmt.Errorf("failed to overwrite key file: %w", err)
-		}
-		written += int64(n)
+		return nil, fmt.Errorf("failed to securely delete key file: %w", err)
 	}
 
-	// Finally, remove the file
-	if err := os.Remove(path); err != nil {
-		return fmt.Errorf("failed to remove key file: %w", err)
-	}
-
-	return nil
+	return result, nil
 }
 
-// IsKeyDecrypted checks if the age key is decrypted (exists on disk)
+// IsKeyDecrypted checks if the age key is decrypted (exists on disk) at the
+// configured key path
 func IsKeyDecrypted() bool {
-	_, err := os.Stat(DefaultKeyPath())
+	resolverMu.RLock()
+	path := selfKeyPath
+	resolverMu.RUnlock()
+
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
 	return err == nil
 }
 
+// CheckAvailable checks that age and age-keygen are installed and returns
+// the age version, which is recorded for InstalledVersion
+func CheckAvailable() (string, error) {
+	if _, err := exec.LookPath("age"); err != nil {
+		return "", fmt.Errorf("age is not installed: %w", err)
+	}
+	if _, err := exec.LookPath("age-keygen"); err != nil {
+		return "", fmt.Errorf("age-keygen is not installed: %w", err)
+	}
+
+	out, err := exec.Command("age", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get age version: %w", err)
+	}
+
+	return recordVersion(string(out)).String(), nil
+}
@@ -0,0 +1,129 @@
+package age
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	samplePublicKey = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	sampleSecretKey = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+)
+
+func TestParseKeygenOutput(t *testing.T) {
+	cases := []struct {
+		name      string
+		output    string
+		publicKey string
+	}{
+		{
+			// age 1.0 and later writing the key to a file or terminal
+			name:      "public key comment",
+			output:    "# created: 2024-01-01T00:00:00Z\n# public key: " + samplePublicKey + "\n" + sampleSecretKey + "\n",
+			publicKey: samplePublicKey,
+		},
+		{
+			// The form printed to stderr when stdout is not a terminal
+			name:      "public key line",
+			output:    "Public key: " + samplePublicKey + "\n" + sampleSecretKey + "\n",
+			publicKey: samplePublicKey,
+		},
+		{
+			name:      "created line only",
+			output:    "# created: 2024-01-01T00:00:00+01:00\n" + sampleSecretKey + "\n",
+			publicKey: "",
+		},
+		{
+			name:      "CRLF line endings",
+			output:    "# created: 2024-01-01T00:00:00Z\r\n# public key: " + samplePublicKey + "\r\n" + sampleSecretKey + "\r\n",
+			publicKey: samplePublicKey,
+		},
+		{
+			name:      "trailing whitespace",
+			output:    "# created: 2024-01-01T00:00:00Z  \n# public key: " + samplePublicKey + " \t\n" + sampleSecretKey + "   \n\n",
+			publicKey: samplePublicKey,
+		},
+		{
+			// GenerateKey joins stdout and stderr, so the key and its public
+			// key can arrive in separate halves
+			name:      "stdout and stderr split",
+			output:    "# created: 2024-01-01T00:00:00Z\n" + sampleSecretKey + "\n" + "\n" + "Public key: " + samplePublicKey + "\n",
+			publicKey: samplePublicKey,
+		},
+		{
+			name:      "mixed case",
+			output:    "# PUBLIC KEY: " + strings.ToUpper(samplePublicKey) + "\n" + strings.ToLower(sampleSecretKey) + "\n",
+			publicKey: samplePublicKey,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey, privateKey := parseKeygenOutput(tc.output)
+			if publicKey != tc.publicKey {
+				t.Errorf("public key = %q, want %q", publicKey, tc.publicKey)
+			}
+			if privateKey != sampleSecretKey {
+				t.Errorf("private key = %q, want %q", privateKey, sampleSecretKey)
+			}
+		})
+	}
+}
+
+func TestParseKeygenOutputWithoutKey(t *testing.T) {
+	publicKey, privateKey := parseKeygenOutput("# created: 2024-01-01T00:00:00Z\n# public key: " + samplePublicKey + "\n")
+	if privateKey != "" {
+		t.Errorf("private key = %q, want none", privateKey)
+	}
+	if publicKey != samplePublicKey {
+		t.Errorf("public key = %q, want %q", publicKey, samplePublicKey)
+	}
+}
+
+func TestRedactSecretKeys(t *testing.T) {
+	output := "# created: 2024-01-01T00:00:00Z\r\n# public key: " + samplePublicKey + "\r\n  " + sampleSecretKey + " \r\n"
+	redacted := redactSecretKeys(output)
+	if strings.Contains(strings.ToUpper(redacted), sampleSecretKey[len("AGE-SECRET-KEY-"):]) {
+		t.Fatalf("secret key left in %q", redacted)
+	}
+	if !strings.Contains(redacted, "AGE-SECRET-KEY-[redacted]") || !strings.Contains(redacted, samplePublicKey) {
+		t.Errorf("redacted output = %q, want the key replaced and the rest kept", redacted)
+	}
+}
+
+func TestPassphraseFlowFor(t *testing.T) {
+	cases := []struct {
+		raw   string
+		args  []string
+		input string
+	}{
+		{raw: "v1.0.0-beta2", args: []string{"-p"}, input: "pass\n"},
+		{raw: "v1.0.0-rc.3", args: []string{"-p"}, input: "pass\n"},
+		{raw: "v1.0.0", args: []string{"-p", "-o", "-"}, input: "pass\npass\n"},
+		{raw: "1.1.1", args: []string{"-p", "-o", "-"}, input: "pass\npass\n"},
+		{raw: "(devel)", args: []string{"-p", "-o", "-"}, input: "pass\npass\n"},
+		{raw: "", args: []string{"-p", "-o", "-"}, input: "pass\npass\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.raw, func(t *testing.T) {
+			v, _ := ParseVersion(tc.raw)
+			flow := passphraseFlowFor(v)
+			if strings.Join(flow.args, " ") != strings.Join(tc.args, " ") {
+				t.Errorf("args = %q, want %q", flow.args, tc.args)
+			}
+			if input := flow.input("pass"); input != tc.input {
+				t.Errorf("input = %q, want %q", input, tc.input)
+			}
+		})
+	}
+}
+
+func TestVersionSuffix(t *testing.T) {
+	v, _ := ParseVersion("v1.1.1\n")
+	if got := versionSuffix(v); got != " (age v1.1.1)" {
+		t.Errorf("versionSuffix = %q, want %q", got, " (age v1.1.1)")
+	}
+	if got := versionSuffix(Version{}); got != "" {
+		t.Errorf("versionSuffix of an unknown version = %q, want none", got)
+	}
+}
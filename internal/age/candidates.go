@@ -0,0 +1,122 @@
+package age
+
+import (
+	"os"
+	"strings"
+)
+
+// Candidate is a single age secret key that can be tried on its own, with
+// the public key it opens files for and where it was found
+type Candidate struct {
+	Identity  Identity
+	PublicKey string // empty when it could not be derived
+	Source    string
+}
+
+// Label describes the candidate for messages, e.g. "age1... (keys.txt)"
+func (c Candidate) Label() string {
+	publicKey := c.PublicKey
+	if publicKey == "" {
+		publicKey = "unknown public key"
+	}
+	return publicKey + " (" + c.Source + ")"
+}
+
+// Candidates splits the identity into its secret keys, so a key file holding
+// several keys gives one candidate per key
+func (i Identity) Candidates(source string) ([]Candidate, error) {
+	data := i.key
+	if i.file != "" {
+		if err := i.Validate(); err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(i.file)
+		if err != nil {
+			return nil, err
+		}
+		data = string(content)
+	}
+	return splitCandidates(data, source), nil
+}
+
+// splitCandidates reads the secret keys out of age-keygen style content. The
+// "# public key:" comment before a key names its public key; without one the
+// key is derived with age-keygen -y.
+func splitCandidates(data, source string) []Candidate {
+	var candidates []Candidate
+	var publicKey string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if m := publicKeyPattern.FindStringSubmatch(line); m != nil {
+			publicKey = strings.ToLower(m[1])
+			continue
+		}
+		if !secretKeyPattern.MatchString(line) {
+			continue
+		}
+
+		secret := strings.ToUpper(line)
+		if publicKey == "" {
+			publicKey, _ = publicKeyFromPrivate(secret)
+		}
+		candidates = append(candidates, Candidate{
+			Identity:  WithInlineIdentity(secret),
+			PublicKey: publicKey,
+			Source:    source,
+		})
+		publicKey = ""
+	}
+	return candidates
+}
+
+// AvailableIdentities lists every age secret key sops could be given: those
+// in SOPS_AGE_KEY and SOPS_AGE_KEY_FILE, in the configured key at keyPath
+// and in sops' default key file. A key found in several places is listed
+// once, under the first; sources that cannot be read are skipped.
+func AvailableIdentities(keyPath string) []Candidate {
+	type source struct {
+		identity Identity
+		name     string
+	}
+	var sources []source
+	if key := os.Getenv(EnvSOPSAgeKey); strings.TrimSpace(key) != "" {
+		sources = append(sources, source{WithInlineIdentity(key), EnvSOPSAgeKey})
+	}
+	if path := os.Getenv(EnvSOPSAgeKeyFile); path != "" {
+		sources = append(sources, source{WithIdentityFile(path), path})
+	}
+	if keyPath != "" {
+		sources = append(sources, source{WithIdentityFile(keyPath), keyPath})
+	}
+	if path, err := DefaultKeyPath(); err == nil {
+		sources = append(sources, source{WithIdentityFile(path), path})
+	}
+
+	var candidates []Candidate
+	for _, s := range sources {
+		found, err := s.identity.Candidates(s.name)
+		if err != nil {
+			continue
+		}
+		candidates = AppendCandidates(candidates, found...)
+	}
+	return candidates
+}
+
+// AppendCandidates adds to list the candidates whose secret key it does not
+// hold yet
+func AppendCandidates(list []Candidate, candidates ...Candidate) []Candidate {
+	for _, c := range candidates {
+		duplicate := false
+		for _, existing := range list {
+			if existing.Identity.key == c.Identity.key {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			list = append(list, c)
+		}
+	}
+	return list
+}
@@ -0,0 +1,109 @@
+package age
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// githubKeysURL is the endpoint serving a user's public ssh keys
+const githubKeysURL = "https://github.com/%s.keys"
+
+// githubTimeout bounds how long a key lookup may take
+const githubTimeout = 10 * time.Second
+
+// githubCacheTTL is how long fetched keys are reused before fetching again
+const githubCacheTTL = 5 * time.Minute
+
+// githubUsername matches valid GitHub usernames
+var githubUsername = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})$`)
+
+// fetchedKeys holds recently fetched keys, of a GitHub user or a URL
+type fetchedKeys struct {
+	recipients []Recipient
+	fetched    time.Time
+}
+
+var (
+	githubCacheMu sync.Mutex
+	githubCache   = make(map[string]fetchedKeys)
+)
+
+// RecipientsFromGitHub fetches a user's public ssh keys from GitHub and
+// returns the ones age can encrypt to
+func RecipientsFromGitHub(username string) ([]Recipient, error) {
+	if !githubUsername.MatchString(username) {
+		return nil, errors.New(errors.TypeConfig, "Invalid GitHub username").WithCode(errors.CodeGitHubInvalidUser).WithData("username", username)
+	}
+
+	key := strings.ToLower(username)
+	githubCacheMu.Lock()
+	entry, ok := githubCache[key]
+	githubCacheMu.Unlock()
+	if ok && time.Since(entry.fetched) < githubCacheTTL {
+		return append([]Recipient(nil), entry.recipients...), nil
+	}
+
+	client := &http.Client{Timeout: githubTimeout}
+	url := fmt.Sprintf(githubKeysURL, username)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeNetwork, "Failed to fetch GitHub keys").WithCode(errors.CodeNetworkFailed).WithData("url", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(errors.TypeNetwork, "GitHub returned an unexpected status").
+			WithCode(errors.CodeNetworkBadResponse).
+			WithData("url", url).
+			WithData("status", resp.Status)
+	}
+
+	// Users publish a handful of keys at most, so cap the response size
+	recipients, err := parseSSHKeys(io.LimitReader(resp.Body, 1<<20), githubPrefix+username)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeNetwork, "Failed to read GitHub keys").WithCode(errors.CodeNetworkFailed).WithData("url", url)
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New(errors.TypeKeyManagement, "GitHub user has no age-compatible ssh keys").
+			WithCode(errors.CodeGitHubNoKeys).
+			WithData("username", username)
+	}
+
+	githubCacheMu.Lock()
+	githubCache[key] = fetchedKeys{recipients: recipients, fetched: time.Now()}
+	githubCacheMu.Unlock()
+
+	return append([]Recipient(nil), recipients...), nil
+}
+
+// parseSSHKeys parses authorized_keys style lines into age ssh recipients,
+// skipping key types age does not support
+func parseSSHKeys(r io.Reader, source string) ([]Recipient, error) {
+	var recipients []Recipient
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "ssh-ed25519", "ssh-rsa":
+			recipients = append(recipients, Recipient{
+				Key:    fields[0] + " " + fields[1],
+				Source: source,
+			})
+		}
+	}
+
+	return recipients, scanner.Err()
+}
@@ -0,0 +1,100 @@
+package age
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// Environment variables sops reads age identities from
+const (
+	EnvSOPSAgeKey     = "SOPS_AGE_KEY"
+	EnvSOPSAgeKeyFile = "SOPS_AGE_KEY_FILE"
+)
+
+// Identity is an age identity handed to a child sops or age process through
+// its environment, so an inline secret key never has to be written to disk
+type Identity struct {
+	key  string
+	file string
+}
+
+// WithInlineIdentity uses the given AGE-SECRET-KEY-... directly
+func WithInlineIdentity(key string) Identity {
+	return Identity{key: strings.TrimSpace(key)}
+}
+
+// WithIdentityFile uses the identity stored in the file at path
+func WithIdentityFile(path string) Identity {
+	return Identity{file: path}
+}
+
+// ConfiguredIdentity returns the decrypted key at keyPath as an identity
+// when sops would not find it by itself, because it is not at the default
+// location. ok is false when the key is missing, when sops' own lookup finds
+// it, or when the environment already names an identity for sops.
+func ConfiguredIdentity(keyPath string) (identity Identity, ok bool) {
+	if keyPath == "" || os.Getenv(EnvSOPSAgeKey) != "" || os.Getenv(EnvSOPSAgeKeyFile) != "" {
+		return Identity{}, false
+	}
+	if defaultPath, err := DefaultKeyPath(); err == nil && filepath.Clean(keyPath) == defaultPath {
+		return Identity{}, false
+	}
+	if _, err := os.Stat(keyPath); err != nil {
+		return Identity{}, false
+	}
+	return WithIdentityFile(keyPath), true
+}
+
+// Validate checks that the identity looks usable before running a command
+func (i Identity) Validate() error {
+	switch {
+	case i.key != "":
+		for _, line := range strings.Split(i.key, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !secretKeyPattern.MatchString(line) {
+				return errors.New(errors.TypeKeyManagement, "Inline identity is not an age secret key").
+					WithCode(errors.CodeAgeInvalidIdentity)
+			}
+		}
+		return nil
+	case i.file != "":
+		if _, err := os.Stat(i.file); err != nil {
+			return errors.Wrap(err, errors.TypeKeyManagement, "Identity file not found").
+				WithCode(errors.CodeAgeInvalidIdentity).WithData("path", i.file)
+		}
+		return nil
+	}
+	return errors.New(errors.TypeKeyManagement, "No identity given").WithCode(errors.CodeAgeInvalidIdentity)
+}
+
+// Env returns the environment entries that pass the identity to sops
+func (i Identity) Env() []string {
+	if i.key != "" {
+		return []string{EnvSOPSAgeKey + "=" + i.key}
+	}
+	if i.file != "" {
+		return []string{EnvSOPSAgeKeyFile + "=" + i.file}
+	}
+	return nil
+}
+
+// IdentityFromEnv reads an inline identity from the named environment
+// variable and removes it from this process's environment so it is not
+// inherited by unrelated child processes
+func IdentityFromEnv(name string) (Identity, error) {
+	key, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(key) == "" {
+		return Identity{}, errors.New(errors.TypeKeyManagement, "Identity environment variable is not set").
+			WithCode(errors.CodeAgeInvalidIdentity).WithData("variable", name)
+	}
+	os.Unsetenv(name)
+
+	identity := WithInlineIdentity(key)
+	return identity, identity.Validate()
+}
@@ -0,0 +1,224 @@
+//go:build integration
+
+package age_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	apperrors "github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// Run with: make test-integration
+
+// validSecretKey is a well-formed age secret key, checksum included
+const validSecretKey = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+
+// fakeAge puts an age on PATH that reads the passphrase and prints output,
+// as a release that exits cleanly on a wrong passphrase might
+func fakeAge(t *testing.T, output string) {
+	t.Helper()
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output")
+	if err := os.WriteFile(outputPath, []byte(output), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncat >/dev/null\ncat '" + outputPath + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "age"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestIntegrationDecryptKeyRejectsInvalidOutput(t *testing.T) {
+	cases := map[string]string{
+		"empty":            "",
+		"comments only":    "# created: 2024-01-01T00:00:00Z\n# public key: age1abc\n",
+		"truncated":        validSecretKey[:40] + "\n",
+		"bad checksum":     validSecretKey[:len(validSecretKey)-1] + "Y\n",
+		"garbage":          "\x8f\x1b\x00\xe2 not a key\n",
+		"key with garbage": validSecretKey + "\n\x8f\x1b\x00\n",
+		"extra character":  validSecretKey + "Q\n",
+	}
+	for name, output := range cases {
+		t.Run(name, func(t *testing.T) {
+			fakeAge(t, output)
+			key, err := age.DecryptKey([]byte("encrypted"), "passphrase")
+			if err == nil {
+				t.Fatalf("DecryptKey accepted %q", output)
+			}
+			if code := apperrors.Code(err); code != apperrors.CodeAgeInvalidKey {
+				t.Errorf("code = %s, want %s (%v)", code, apperrors.CodeAgeInvalidKey, err)
+			}
+			if key != "" {
+				t.Errorf("DecryptKey returned key material %q alongside the error", key)
+			}
+		})
+	}
+}
+
+func TestIntegrationDecryptKeyAcceptsKeyFile(t *testing.T) {
+	output := "# created: 2024-01-01T00:00:00Z\r\n# public key: age1abc\r\n" + validSecretKey + "\r\n"
+	fakeAge(t, output)
+
+	key, err := age.DecryptKey([]byte("encrypted"), "passphrase")
+	if err != nil {
+		t.Fatalf("DecryptKey: %v", err)
+	}
+	if key != output {
+		t.Errorf("DecryptKey = %q, want the output unchanged", key)
+	}
+}
+
+func TestIntegrationGenerateKeyRedactsErrorData(t *testing.T) {
+	// An age-keygen whose public key wording is not recognised and that
+	// cannot derive it either
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = \"-y\" ] && exit 1\necho '# created: 2024-01-01T00:00:00Z'\necho '" + validSecretKey + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "age-keygen"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := age.GenerateKey()
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("GenerateKey error = %v, want an AppError", err)
+	}
+	stdout, _ := appErr.Data["stdout"].(string)
+	if strings.Contains(stdout, validSecretKey) || strings.Contains(err.Error(), validSecretKey) {
+		t.Fatalf("secret key left in the error: %q", stdout)
+	}
+	if !strings.Contains(stdout, "AGE-SECRET-KEY-[redacted]") {
+		t.Errorf("stdout data = %q, want the key redacted", stdout)
+	}
+}
+
+// fakeAgeRelease puts an age and age-keygen on PATH that report version,
+// record the arguments and stdin of each run and fail when fail is set,
+// and has CheckAvailable detect them. It returns the recorded arguments and
+// stdin.
+func fakeAgeRelease(t *testing.T, version string, fail bool) (argsPath, inputPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsPath = filepath.Join(dir, "args")
+	inputPath = filepath.Join(dir, "input")
+
+	status := "echo encrypted"
+	if fail {
+		status = "echo 'bad passphrase' >&2; exit 1"
+	}
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"--version\" ]; then echo '" + version + "'; exit 0; fi\n" +
+		"echo \"$@\" >'" + argsPath + "'\n" +
+		"cat >'" + inputPath + "'\n" +
+		status + "\n"
+	for _, name := range []string{"age", "age-keygen"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if _, err := age.CheckAvailable(); err != nil {
+		t.Fatalf("CheckAvailable: %v", err)
+	}
+	return argsPath, inputPath
+}
+
+func TestIntegrationEncryptKeyPassphraseFlows(t *testing.T) {
+	cases := []struct {
+		version string
+		args    string
+		input   string
+	}{
+		{version: "v1.0.0-beta2", args: "-p", input: "pass\n"},
+		{version: "v1.0.0-rc.3", args: "-p", input: "pass\n"},
+		{version: "v1.1.1", args: "-p -o -", input: "pass\npass\n"},
+		{version: "(devel)", args: "-p -o -", input: "pass\npass\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.version, func(t *testing.T) {
+			argsPath, inputPath := fakeAgeRelease(t, tc.version, false)
+
+			out, err := age.EncryptKey(&age.KeyPair{PrivateKey: validSecretKey}, "pass")
+			if err != nil {
+				t.Fatalf("EncryptKey: %v", err)
+			}
+			if string(out) != "encrypted\n" {
+				t.Errorf("EncryptKey = %q, want the output of age", out)
+			}
+
+			args, err := os.ReadFile(argsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The key file comes last and has a random name
+			if got := strings.Fields(string(args)); strings.Join(got[:len(got)-1], " ") != tc.args {
+				t.Errorf("age was run with %q, want %q before the key file", args, tc.args)
+			}
+			input, err := os.ReadFile(inputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(input) != tc.input {
+				t.Errorf("age read %q, want %q", input, tc.input)
+			}
+		})
+	}
+}
+
+func TestIntegrationAgeFailuresNameVersion(t *testing.T) {
+	fakeAgeRelease(t, "v1.1.1", true)
+
+	_, err := age.EncryptKey(&age.KeyPair{PrivateKey: validSecretKey}, "pass")
+	if err == nil || !strings.Contains(err.Error(), "(age v1.1.1)") {
+		t.Errorf("EncryptKey error = %v, want the age version", err)
+	}
+	_, err = age.DecryptKey([]byte("encrypted"), "pass")
+	if err == nil || !strings.Contains(err.Error(), "(age v1.1.1)") {
+		t.Errorf("DecryptKey error = %v, want the age version", err)
+	}
+}
+
+// fakeAgeFailing puts an age on PATH that fails with stderr, as age does on
+// a wrong passphrase or a damaged file
+func fakeAgeFailing(t *testing.T, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat >/dev/null\necho '" + stderr + "' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "age"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestIntegrationDecryptKeyWrongPassphrase(t *testing.T) {
+	fakeAgeFailing(t, "age: error: incorrect passphrase")
+
+	_, err := age.DecryptKey([]byte("encrypted"), "wrong")
+	if code := apperrors.Code(err); code != apperrors.CodeAgeBadPassphrase {
+		t.Errorf("code = %s, want %s (%v)", code, apperrors.CodeAgeBadPassphrase, err)
+	}
+}
+
+func TestIntegrationDecryptKeyCorruptFile(t *testing.T) {
+	stderr := "age: error: failed to read header: parsing age header: unexpected intro"
+	fakeAgeFailing(t, stderr)
+
+	// A damaged key file is not a wrong passphrase, and retrying would not help
+	_, err := age.DecryptKey([]byte("age-encryption.org/v1\n-> scr"), "passphrase")
+	if err == nil {
+		t.Fatal("DecryptKey accepted a corrupt key file")
+	}
+	if code := apperrors.Code(err); code == apperrors.CodeAgeBadPassphrase {
+		t.Errorf("a corrupt key file was reported as a wrong passphrase: %v", err)
+	}
+	if !strings.Contains(err.Error(), stderr) {
+		t.Errorf("error = %v, want age's own message", err)
+	}
+}
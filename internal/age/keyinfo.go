@@ -0,0 +1,82 @@
+package age
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// PublicKey returns the public key of an age identity. The "# public key:"
+// comment written by age-keygen is used when present, otherwise the key is
+// derived with age-keygen -y.
+func PublicKey(privateKey string) (string, error) {
+	publicKey, secret := parseKeygenOutput(privateKey)
+	if publicKey != "" {
+		return publicKey, nil
+	}
+	if secret == "" {
+		return "", errors.New(errors.TypeKeyManagement, "No age secret key found").
+			WithCode(errors.CodeAgeInvalidIdentity)
+	}
+
+	publicKey, err := publicKeyFromPrivate(secret)
+	if err != nil || publicKey == "" {
+		return "", errors.Wrap(err, errors.TypeKeyManagement, "Failed to derive public key").
+			WithCode(errors.CodeAgeKeygenFailed)
+	}
+	return publicKey, nil
+}
+
+// PublicKeyFromFile returns the public key of the identity stored at path
+func PublicKeyFromFile(path string) (string, error) {
+	if err := checkKeyPath(path); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation, "Failed to read key file").
+			WithCode(errors.CodeFileNotFound).WithData("path", path)
+	}
+	return PublicKey(string(data))
+}
+
+// PublicKeyPath returns where the public key of an encrypted key is kept, so
+// it can be shown without decrypting the key
+func PublicKeyPath(encryptedPath string) string {
+	return encryptedPath + ".pub"
+}
+
+// SavePublicKey stores the public key next to the encrypted key
+func SavePublicKey(encryptedPath, publicKey string) error {
+	if err := checkKeyPath(encryptedPath); err != nil {
+		return err
+	}
+	return os.WriteFile(PublicKeyPath(encryptedPath), []byte(publicKey+"\n"), 0o644)
+}
+
+// LoadPublicKey reads the public key stored next to an encrypted key
+func LoadPublicKey(encryptedPath string) (string, error) {
+	if err := checkKeyPath(encryptedPath); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(PublicKeyPath(encryptedPath))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Fingerprint returns a short, stable identifier for a public key in the
+// SHA256:<base64> form used by ssh-keygen. The comment of an ssh key is
+// ignored, so relabelling a key does not change its fingerprint.
+func Fingerprint(publicKey string) string {
+	publicKey = strings.TrimSpace(publicKey)
+	if fields := strings.Fields(publicKey); len(fields) > 2 && strings.HasPrefix(fields[0], "ssh-") {
+		publicKey = fields[0] + " " + fields[1]
+	}
+	sum := sha256.Sum256([]byte(publicKey))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
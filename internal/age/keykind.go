@@ -0,0 +1,125 @@
+package age
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kinds of master key a recipient can be. sops can encrypt a file's data key
+// to several kinds at once, so a file stays readable if one of them is lost.
+const (
+	KindAge     = "age" // age and ssh public keys
+	KindPGP     = "pgp"
+	KindKMS     = "kms"
+	KindGCPKMS  = "gcp_kms"
+	KindAzureKV = "azure_kv"
+	KindHCVault = "hc_vault"
+)
+
+// kindPrefixes are the token prefixes that name a key of another kind, e.g.
+// pgp:85D77543B3D624B63CEA9E6DBC17301B491B3F21
+var kindPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"pgp:", KindPGP},
+	{"kms:", KindKMS},
+	{"gcp-kms:", KindGCPKMS},
+	{"azure-kv:", KindAzureKV},
+	{"hc-vault:", KindHCVault},
+}
+
+// kindNames are the names of each kind shown to the user
+var kindNames = map[string]string{
+	KindAge:     "age",
+	KindPGP:     "PGP",
+	KindKMS:     "AWS KMS",
+	KindGCPKMS:  "GCP KMS",
+	KindAzureKV: "Azure Key Vault",
+	KindHCVault: "HashiCorp Vault",
+}
+
+// pgpFingerprintPattern matches a bare PGP key fingerprint
+var pgpFingerprintPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+
+// Kinds returns the kinds of master key in the order sops lists them
+func Kinds() []string {
+	return []string{KindAge, KindPGP, KindKMS, KindGCPKMS, KindAzureKV, KindHCVault}
+}
+
+// KindName returns the name of a kind of key as shown to the user
+func KindName(kind string) string {
+	if name, ok := kindNames[kind]; ok {
+		return name
+	}
+	return kind
+}
+
+// ParseMasterKey reads a token naming a key of a kind other than age: one
+// with a kind prefix such as pgp: or kms:, a bare AWS KMS ARN or a bare PGP
+// fingerprint. ok is false for any other token.
+func ParseMasterKey(token string) (r Recipient, ok bool) {
+	for _, p := range kindPrefixes {
+		if key, found := strings.CutPrefix(token, p.prefix); found && key != "" {
+			return Recipient{Key: key, Kind: p.kind}, true
+		}
+	}
+	switch {
+	case strings.HasPrefix(token, "arn:aws:kms:"):
+		return Recipient{Key: token, Kind: KindKMS}, true
+	case pgpFingerprintPattern.MatchString(token):
+		return Recipient{Key: strings.ToUpper(token), Kind: KindPGP}, true
+	}
+	return Recipient{}, false
+}
+
+// KeysOfKind returns the keys of the recipients of one kind
+func KeysOfKind(recipients []Recipient, kind string) []string {
+	var keys []string
+	for _, r := range recipients {
+		if r.KindOrAge() == kind {
+			keys = append(keys, r.Key)
+		}
+	}
+	return keys
+}
+
+// FromKeys wraps age or ssh public keys as recipients
+func FromKeys(keys []string) []Recipient {
+	recipients := make([]Recipient, len(keys))
+	for i, key := range keys {
+		recipients[i] = Recipient{Key: key}
+	}
+	return recipients
+}
+
+// RecipientTokens returns tokens that resolve back to the given recipients,
+// keeping the kind of each key
+func RecipientTokens(recipients []Recipient) []string {
+	tokens := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		tokens = append(tokens, r.String())
+	}
+	return tokens
+}
+
+// SummarizeKinds counts recipients by kind, e.g. "2 age, 1 PGP, 1 AWS KMS"
+func SummarizeKinds(recipients []Recipient) string {
+	if len(recipients) == 0 {
+		return "none"
+	}
+
+	counts := make(map[string]int)
+	for _, r := range recipients {
+		counts[r.KindOrAge()]++
+	}
+
+	var parts []string
+	for _, kind := range Kinds() {
+		if n := counts[kind]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, KindName(kind)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,110 @@
+package age
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// UnprotectedKeyAge reports how long the plaintext key at keyPath has been
+// on disk, going by its modification time, when there is no encrypted copy
+// at encryptedPath. ok is false when there is no plaintext key or it has an
+// encrypted copy.
+func UnprotectedKeyAge(keyPath, encryptedPath string) (age time.Duration, ok bool) {
+	info, err := os.Stat(keyPath)
+	if err != nil || info.IsDir() {
+		return 0, false
+	}
+	if _, err := os.Stat(encryptedPath); err == nil {
+		return 0, false
+	}
+	return time.Since(info.ModTime()), true
+}
+
+// ProtectKey encrypts the plaintext key at keyPath with passphrase to
+// encryptedPath, with its public key alongside, and then securely deletes
+// the plaintext. The encrypted copy is decrypted again and compared first,
+// both before it is saved and as read back from disk, so the plaintext is
+// only deleted once the copy is known to open; when it does not, the copy is
+// removed and the plaintext kept. An existing file at encryptedPath is never
+// replaced.
+func ProtectKey(keyPath, encryptedPath, passphrase string, wipe utils.WipeOptions) (*utils.WipeResult, error) {
+	if _, err := os.Stat(encryptedPath); err == nil {
+		return nil, errors.New(errors.TypeKeyManagement, "An encrypted key already exists; move it away first").
+			WithCode(errors.CodeFileExists).WithData("path", encryptedPath)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to read the plaintext key").
+			WithCode(errors.CodeFileNotFound).WithData("path", keyPath)
+	}
+	privateKey := string(data)
+	utils.WipeBytes(data)
+
+	publicKey, err := PublicKey(privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeKeyManagement, "The file does not hold an age key").
+			WithCode(errors.CodeAgeInvalidIdentity).WithData("path", keyPath)
+	}
+
+	encrypted, err := EncryptKey(&KeyPair{PrivateKey: privateKey, PublicKey: publicKey}, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeKeyManagement, "Failed to encrypt key").
+			WithCode(errors.CodeAgeEncryptFailed)
+	}
+
+	decrypted, err := DecryptKey(encrypted, passphrase)
+	if err != nil || strings.TrimSpace(decrypted) != strings.TrimSpace(privateKey) {
+		return nil, errors.New(errors.TypeKeyManagement,
+			"The encrypted key did not decrypt back to the original; the plaintext key was kept").
+			WithCode(errors.CodeAgeEncryptFailed)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(encryptedPath), 0o700); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to create directory").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", encryptedPath)
+	}
+	if err := SaveEncryptedKey(encrypted, encryptedPath); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to save encrypted key").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", encryptedPath)
+	}
+	if err := verifySavedKey(encryptedPath, passphrase, privateKey); err != nil {
+		os.Remove(encryptedPath)
+		return nil, err
+	}
+	if err := SavePublicKey(encryptedPath, publicKey); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to save public key").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", PublicKeyPath(encryptedPath))
+	}
+
+	result, err := SecurelyDeleteKeyWithOptions(keyPath, wipe)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"The key is now encrypted, but deleting the plaintext failed; delete it by hand").
+			WithCode(errors.CodeFileDeleteFailed).WithData("path", keyPath)
+	}
+	return result, nil
+}
+
+// verifySavedKey checks that the encrypted key saved at encryptedPath opens
+// with passphrase to privateKey
+func verifySavedKey(encryptedPath, passphrase, privateKey string) error {
+	saved, err := LoadEncryptedKey(encryptedPath)
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read back the encrypted key; the plaintext key was kept").
+			WithCode(errors.CodeFileNotFound).WithData("path", encryptedPath)
+	}
+	decrypted, err := DecryptKey(saved, passphrase)
+	if err != nil || strings.TrimSpace(decrypted) != strings.TrimSpace(privateKey) {
+		return errors.New(errors.TypeKeyManagement,
+			"The saved encrypted key did not decrypt back to the original; it was removed and the plaintext key kept").
+			WithCode(errors.CodeAgeEncryptFailed).WithData("path", encryptedPath)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package age
+
+import (
+	"strings"
+)
+
+// Recipient is a public key that files can be encrypted to
+type Recipient struct {
+	Key    string `json:"key"`              // age1... public key, an ssh-ed25519/ssh-rsa public key or the ID of a key of Kind
+	Source string `json:"source,omitempty"` // Where the recipient came from, e.g. "gh:username"
+	Kind   string `json:"kind,omitempty"`   // Kind of master key, KindAge when empty
+}
+
+// KindOrAge returns the kind of the recipient's key, KindAge when unset
+func (r Recipient) KindOrAge() string {
+	if r.Kind == "" {
+		return KindAge
+	}
+	return r.Kind
+}
+
+// IsAge reports whether the recipient is an age or ssh public key
+func (r Recipient) IsAge() bool {
+	return r.KindOrAge() == KindAge
+}
+
+// String returns the public key of the recipient, prefixed with its kind
+// when it is not an age key, so it can be entered again as a token
+func (r Recipient) String() string {
+	for _, p := range kindPrefixes {
+		if p.kind == r.Kind {
+			return p.prefix + r.Key
+		}
+	}
+	return r.Key
+}
+
+// githubPrefix marks a recipient token that expands to a GitHub user's ssh keys
+const githubPrefix = "gh:"
+
+// SplitRecipientInput splits a comma or whitespace separated list of recipients
+func SplitRecipientInput(input string) []string {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ','
+	})
+
+	var tokens []string
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		// ssh keys contain spaces, so only split on whitespace for age keys
+		if strings.HasPrefix(field, "age1") || strings.HasPrefix(field, githubPrefix) {
+			tokens = append(tokens, strings.Fields(field)...)
+		} else if field != "" {
+			tokens = append(tokens, field)
+		}
+	}
+
+	return tokens
+}
+
+// NeedsFetch reports whether any token requires a network lookup to
+// resolve, including gh:username tokens and URLs inside aliases
+func NeedsFetch(tokens []string) bool {
+	expanded, err := expandAliases(tokens)
+	if err != nil {
+		// Let ResolveRecipients report the error
+		return false
+	}
+	for _, t := range expanded {
+		if strings.HasPrefix(t.token, githubPrefix) || IsRecipientsURL(t.token) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveRecipients expands recipient tokens into concrete recipients.
+// Names and @names from the address book are replaced by their members, self
+// by the current identity's public key, and gh:username by that user's GitHub
+// ssh keys, and an https:// URL by the recipients listed in the file it
+// serves (see FetchRecipients). Keys of other kinds, such as pgp:FINGERPRINT or a KMS ARN, keep
+// their kind. Each recipient's Source records the token it was resolved from.
+func ResolveRecipients(tokens []string) ([]Recipient, error) {
+	expanded, err := expandAliases(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []Recipient
+	for _, t := range expanded {
+		username, github := strings.CutPrefix(t.token, githubPrefix)
+		if github || IsRecipientsURL(t.token) {
+			var fetched []Recipient
+			if github {
+				fetched, err = RecipientsFromGitHub(username)
+			} else {
+				fetched, err = FetchRecipients(t.token)
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Keep the alias that pulled the keys in, if there was one
+			if t.source != t.token {
+				for i := range fetched {
+					fetched[i].Source = t.source + " (" + fetched[i].Source + ")"
+				}
+			}
+			recipients = append(recipients, fetched...)
+			continue
+		}
+
+		if r, ok := ParseMasterKey(t.token); ok {
+			r.Source = t.source
+			recipients = append(recipients, r)
+			continue
+		}
+		recipients = append(recipients, Recipient{Key: t.token, Source: t.source})
+	}
+
+	return recipients, nil
+}
+
+// RecipientKeys returns the public keys of the given recipients
+func RecipientKeys(recipients []Recipient) []string {
+	keys := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
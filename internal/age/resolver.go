@@ -0,0 +1,157 @@
+package age
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// Special recipient tokens
+const (
+	selfToken   = "self" // The public key of the current identity
+	aliasPrefix = "@"    // @name must be a defined alias, usually a team
+)
+
+// maxAliasDepth bounds alias expansion so a cycle cannot loop forever
+const maxAliasDepth = 8
+
+var (
+	resolverMu sync.RWMutex
+	// aliases maps a name from the address book to recipient tokens
+	aliases = map[string][]string{}
+	// selfEncryptedKeyPath and selfKeyPath locate the key self resolves to;
+	// they are empty when there is no default and none is configured
+	selfEncryptedKeyPath, _ = DefaultEncryptedKeyPath()
+	selfKeyPath, _          = DefaultKeyPath()
+)
+
+// SetAliases replaces the address book used to resolve recipient tokens.
+// Each name expands to recipient tokens, which may be keys, gh:username,
+// self or other names.
+func SetAliases(book map[string][]string) {
+	set := make(map[string][]string, len(book))
+	for name, tokens := range book {
+		name = strings.TrimPrefix(strings.TrimSpace(name), aliasPrefix)
+		if name != "" {
+			set[name] = tokens
+		}
+	}
+
+	resolverMu.Lock()
+	aliases = set
+	resolverMu.Unlock()
+}
+
+// SetSelfKeyPaths sets where the public key that self resolves to is read
+// from: the public key saved next to the encrypted key, which is available
+// while the key is locked, then the decrypted key
+func SetSelfKeyPaths(encryptedKeyPath, keyPath string) {
+	resolverMu.Lock()
+	selfEncryptedKeyPath = encryptedKeyPath
+	selfKeyPath = keyPath
+	resolverMu.Unlock()
+}
+
+// AliasNames returns the names in the address book, sorted
+func AliasNames() []string {
+	resolverMu.RLock()
+	defer resolverMu.RUnlock()
+
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelfPublicKey returns the public key of the current identity, the one the
+// self recipient resolves to
+func SelfPublicKey() (string, error) {
+	resolverMu.RLock()
+	encryptedKeyPath, keyPath := selfEncryptedKeyPath, selfKeyPath
+	resolverMu.RUnlock()
+
+	if key, err := LoadPublicKey(encryptedKeyPath); err == nil && key != "" {
+		return key, nil
+	}
+	if key, err := PublicKeyFromFile(keyPath); err == nil {
+		return key, nil
+	}
+	return "", errors.New(errors.TypeKeyManagement, "Cannot resolve self: no key found; generate a key first").
+		WithCode(errors.CodeRecipientUnknown)
+}
+
+// expandedToken is a concrete recipient token and the alias it came from
+type expandedToken struct {
+	token  string
+	source string
+}
+
+// expandAliases replaces names, @names and self with the tokens they stand
+// for. gh:username tokens and URLs are kept for ResolveRecipients to fetch.
+func expandAliases(tokens []string) ([]expandedToken, error) {
+	// SetAliases replaces the map rather than changing it, so a snapshot is safe
+	resolverMu.RLock()
+	book := aliases
+	resolverMu.RUnlock()
+
+	var out []expandedToken
+	var expand func(token, source string, depth int) error
+	expand = func(token, source string, depth int) error {
+		switch {
+		case IsPublicKey(token) || IsMasterKey(token) || strings.HasPrefix(token, githubPrefix) || IsRecipientsURL(token):
+			out = append(out, expandedToken{token: token, source: source})
+			return nil
+
+		case token == selfToken:
+			key, err := SelfPublicKey()
+			if err != nil {
+				return err
+			}
+			out = append(out, expandedToken{token: key, source: source})
+			return nil
+		}
+
+		name := strings.TrimPrefix(token, aliasPrefix)
+		members, ok := book[name]
+		if !ok {
+			return errors.New(errors.TypeConfig, "Unknown recipient "+token+"; add it to recipient_aliases or use a public key").
+				WithCode(errors.CodeRecipientUnknown).WithData("recipient", token)
+		}
+		if depth >= maxAliasDepth {
+			return errors.New(errors.TypeConfig, "Recipient alias "+token+" is nested too deeply; check for a cycle").
+				WithCode(errors.CodeConfigInvalid).WithData("recipient", token)
+		}
+		for _, member := range members {
+			if err := expand(member, source, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, token := range tokens {
+		source := token
+		if IsPublicKey(token) || IsMasterKey(token) {
+			source = "input"
+		}
+		if err := expand(token, source, 0); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// IsPublicKey reports whether token is a literal age or ssh public key
+func IsPublicKey(token string) bool {
+	return strings.HasPrefix(token, "age1") || strings.HasPrefix(token, "ssh-")
+}
+
+// IsMasterKey reports whether token names a key of a kind other than age
+func IsMasterKey(token string) bool {
+	_, ok := ParseMasterKey(token)
+	return ok
+}
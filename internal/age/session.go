@@ -0,0 +1,123 @@
+package age
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/secure"
+)
+
+// DefaultPassphraseIdleTimeout is how long an unused cached passphrase is kept
+const DefaultPassphraseIdleTimeout = 10 * time.Minute
+
+// The session cache keeps the passphrase of the encrypted key in memory, when
+// enabled, so each operation can unlock the key without it ever being written
+// to disk. The passphrase is wiped after going unused for the idle timeout.
+var session struct {
+	mu         sync.Mutex
+	enabled    bool
+	idle       time.Duration
+	passphrase *secure.Buffer
+	timer      *time.Timer
+}
+
+// SetPassphraseCaching turns the session cache on or off and sets its idle
+// timeout. Turning it off wipes any cached passphrase.
+func SetPassphraseCaching(enabled bool, idle time.Duration) {
+	if idle <= 0 {
+		idle = DefaultPassphraseIdleTimeout
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	changed := idle != session.idle
+	session.enabled = enabled
+	session.idle = idle
+	if !enabled {
+		forgetLocked()
+	} else if changed && session.timer != nil {
+		// Count the new timeout from now rather than from the last use
+		session.timer.Reset(idle)
+	}
+}
+
+// PassphraseCachingEnabled reports whether the session cache is turned on
+func PassphraseCachingEnabled() bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.enabled
+}
+
+// CachePassphrase keeps passphrase for the session, taking ownership of the
+// slice. It is wiped straight away when caching is turned off.
+func CachePassphrase(passphrase []byte) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	forgetLocked()
+	buf := secure.NewBuffer(passphrase)
+	if !session.enabled {
+		buf.Wipe()
+		return
+	}
+	session.passphrase = buf
+	session.timer = time.AfterFunc(session.idle, ForgetPassphrase)
+}
+
+// PassphraseCached reports whether a passphrase is cached
+func PassphraseCached() bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.passphrase != nil
+}
+
+// ForgetPassphrase wipes the cached passphrase
+func ForgetPassphrase() {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	forgetLocked()
+}
+
+// forgetLocked wipes the cached passphrase; session.mu must be held
+func forgetLocked() {
+	if session.timer != nil {
+		session.timer.Stop()
+		session.timer = nil
+	}
+	if session.passphrase != nil {
+		session.passphrase.Wipe()
+		session.passphrase = nil
+	}
+}
+
+// SessionIdentity unlocks the encrypted key at encryptedKeyPath with the
+// cached passphrase and returns it as an inline identity, restarting the idle
+// timeout. The key only ever exists in memory.
+func SessionIdentity(encryptedKeyPath string) (Identity, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.passphrase == nil {
+		return Identity{}, errors.New(errors.TypeKeyManagement, "The cached passphrase has expired; unlock the key again in the Key Manager").
+			WithCode(errors.CodePassphraseExpired)
+	}
+	session.timer.Reset(session.idle)
+
+	encryptedKey, err := LoadEncryptedKey(encryptedKeyPath)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, errors.TypeFileOperation, "Failed to load encrypted key").
+			WithCode(errors.CodeAgeNoEncryptedKey).WithData("path", encryptedKeyPath)
+	}
+
+	var key string
+	err = session.passphrase.Use(func(passphrase []byte) error {
+		key, err = DecryptKeyWith(encryptedKey, passphrase)
+		return err
+	})
+	if err != nil {
+		return Identity{}, errors.Wrap(err, errors.TypeSecurity, "Failed to unlock key with the cached passphrase").
+			WithCode(errors.CodeAgeDecryptFailed)
+	}
+	return WithInlineIdentity(key), nil
+}
@@ -0,0 +1,69 @@
+package age
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+var (
+	trustMu sync.RWMutex
+	// trusted holds the allowlisted fingerprints
+	trusted = map[string]bool{}
+)
+
+// SetTrustedFingerprints replaces the allowlist consulted by
+// IsTrustedRecipient. Entries may omit the "SHA256:" prefix.
+func SetTrustedFingerprints(fingerprints []string) {
+	set := make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		if fp = normalizeFingerprint(fp); fp != "" {
+			set[fp] = true
+		}
+	}
+
+	trustMu.Lock()
+	trusted = set
+	trustMu.Unlock()
+}
+
+// IsTrustedRecipient reports whether the fingerprint of key is on the allowlist
+func IsTrustedRecipient(key string) bool {
+	trustMu.RLock()
+	defer trustMu.RUnlock()
+	return trusted[Fingerprint(key)]
+}
+
+// UntrustedRecipients returns the recipients whose fingerprints are not on the allowlist
+func UntrustedRecipients(recipients []Recipient) []Recipient {
+	var untrusted []Recipient
+	for _, r := range recipients {
+		if !IsTrustedRecipient(r.Key) {
+			untrusted = append(untrusted, r)
+		}
+	}
+	return untrusted
+}
+
+// UntrustedError describes an encryption refused because of untrusted recipients
+func UntrustedError(untrusted []Recipient) *errors.AppError {
+	fingerprints := make([]string, len(untrusted))
+	for i, r := range untrusted {
+		fingerprints[i] = Fingerprint(r.Key)
+	}
+	return errors.New(errors.TypeSecurity,
+		fmt.Sprintf("%d recipient(s) are not in the trusted allowlist", len(untrusted))).
+		WithCode(errors.CodeRecipientUntrusted).
+		WithData("fingerprints", strings.Join(fingerprints, ", "))
+}
+
+// normalizeFingerprint adds the "SHA256:" prefix to a bare fingerprint
+func normalizeFingerprint(fp string) string {
+	fp = strings.TrimSpace(fp)
+	if fp == "" || strings.HasPrefix(fp, "SHA256:") {
+		return fp
+	}
+	return "SHA256:" + fp
+}
@@ -0,0 +1,155 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// urlPrefix marks a recipient token that is the address of a recipients file
+const urlPrefix = "https://"
+
+// recipientsURLTimeout bounds how long fetching a recipients file may take,
+// redirects included
+const recipientsURLTimeout = 10 * time.Second
+
+// recipientsURLMaxSize caps the size of a recipients file; team lists hold a
+// few dozen keys at most
+const recipientsURLMaxSize = 1 << 20
+
+// recipientsURLCacheTTL is how long a fetched list is reused before fetching
+// it again
+const recipientsURLCacheTTL = 5 * time.Minute
+
+// agePublicKey matches a bech32 age public key
+var agePublicKey = regexp.MustCompile(`^age1[0-9a-z]{58}$`)
+
+var (
+	urlCacheMu sync.Mutex
+	urlCache   = make(map[string]fetchedKeys)
+)
+
+// IsRecipientsURL reports whether token is the address of a recipients file,
+// or looks like one that is not served over https
+func IsRecipientsURL(token string) bool {
+	lower := strings.ToLower(token)
+	return strings.HasPrefix(lower, urlPrefix) || strings.HasPrefix(lower, "http://")
+}
+
+// FetchRecipients fetches the recipients file at rawURL, in the format age -R
+// reads: one recipient per line, with blank lines and # comments ignored.
+// Each line must be an age or ssh public key, or a key of another kind such
+// as pgp:FINGERPRINT; a single line that is not fails the whole list. Only
+// https URLs are fetched, and redirects to anything else are not followed.
+// Network failures have type TypeNetwork.
+func FetchRecipients(rawURL string) ([]Recipient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(parsed.Scheme, "https") || parsed.Host == "" {
+		return nil, errors.New(errors.TypeConfig, "Recipients can only be fetched from an https:// URL").
+			WithCode(errors.CodeInsecureURL).WithData("url", rawURL)
+	}
+
+	urlCacheMu.Lock()
+	entry, ok := urlCache[rawURL]
+	urlCacheMu.Unlock()
+	if ok && time.Since(entry.fetched) < recipientsURLCacheTTL {
+		return append([]Recipient(nil), entry.recipients...), nil
+	}
+
+	client := &http.Client{
+		Timeout: recipientsURLTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing to follow a redirect to %s", req.URL.Redacted())
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			return nil
+		},
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeNetwork, "Failed to fetch the recipients file").
+			WithCode(errors.CodeNetworkFailed).WithData("url", rawURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(errors.TypeNetwork, "The recipients URL returned an unexpected status").
+			WithCode(errors.CodeNetworkBadResponse).
+			WithData("url", rawURL).
+			WithData("status", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, recipientsURLMaxSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeNetwork, "Failed to read the recipients file").
+			WithCode(errors.CodeNetworkFailed).WithData("url", rawURL)
+	}
+	if len(data) > recipientsURLMaxSize {
+		return nil, errors.New(errors.TypeNetwork, fmt.Sprintf("The recipients file is larger than %d bytes", recipientsURLMaxSize)).
+			WithCode(errors.CodeNetworkBadResponse).WithData("url", rawURL)
+	}
+
+	recipients, err := parseRecipientsFile(data, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	urlCacheMu.Lock()
+	urlCache[rawURL] = fetchedKeys{recipients: recipients, fetched: time.Now()}
+	urlCacheMu.Unlock()
+
+	return append([]Recipient(nil), recipients...), nil
+}
+
+// parseRecipientsFile reads a recipients file fetched from source
+func parseRecipientsFile(data []byte, source string) ([]Recipient, error) {
+	var recipients []Recipient
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case agePublicKey.MatchString(line):
+			recipients = append(recipients, Recipient{Key: line, Source: source})
+		case (fields[0] == "ssh-ed25519" || fields[0] == "ssh-rsa") && len(fields) >= 2:
+			// The comment after an ssh key is not part of it
+			recipients = append(recipients, Recipient{Key: fields[0] + " " + fields[1], Source: source})
+		default:
+			r, ok := ParseMasterKey(line)
+			if !ok {
+				return nil, errors.New(errors.TypeConfig, fmt.Sprintf("Line %d of the recipients file is not a public key", n)).
+					WithCode(errors.CodeRecipientUnknown).WithData("url", source).WithData("line", n)
+			}
+			r.Source = source
+			recipients = append(recipients, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, errors.TypeNetwork, "Failed to read the recipients file").
+			WithCode(errors.CodeNetworkBadResponse).WithData("url", source)
+	}
+
+	if len(recipients) == 0 {
+		return nil, errors.New(errors.TypeKeyManagement, "The recipients file lists no recipients").
+			WithCode(errors.CodeRecipientUnknown).WithData("url", source)
+	}
+	return recipients, nil
+}
+
@@ -0,0 +1,122 @@
+package age
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is a release of the age binary as reported by age --version
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // Pre-release suffix, such as beta2
+	Raw                 string // The output of age --version
+}
+
+// versionPattern finds the release in age --version output, e.g. v1.1.1 or
+// v1.0.0-rc.3
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.]+))?`)
+
+// ParseVersion reads the release from age --version output. ok is false
+// for development builds, which print "(devel)" instead.
+func ParseVersion(output string) (v Version, ok bool) {
+	v.Raw = strings.TrimSpace(output)
+	m := versionPattern.FindStringSubmatch(v.Raw)
+	if m == nil {
+		return v, false
+	}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	v.Pre = m[4]
+	return v, true
+}
+
+// String returns the version as age printed it
+func (v Version) String() string {
+	return v.Raw
+}
+
+// Before reports whether v is older than major.minor.patch. A pre-release
+// comes before the release it leads up to.
+func (v Version) Before(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major < major
+	}
+	if v.Minor != minor {
+		return v.Minor < minor
+	}
+	if v.Patch != patch {
+		return v.Patch < patch
+	}
+	return v.Pre != ""
+}
+
+var (
+	versionMu sync.Mutex
+	// installed is the version last detected, valid once detected is set
+	installed Version
+	detected  bool
+)
+
+// recordVersion remembers the installed version so later prompts and errors
+// can use it without running age --version again
+func recordVersion(output string) Version {
+	v, _ := ParseVersion(output)
+	versionMu.Lock()
+	installed, detected = v, true
+	versionMu.Unlock()
+	return v
+}
+
+// InstalledVersion returns the version of the age binary, as detected by
+// CheckAvailable or on first use. Raw is empty when age could not be run.
+func InstalledVersion() Version {
+	versionMu.Lock()
+	v, ok := installed, detected
+	versionMu.Unlock()
+	if ok {
+		return v
+	}
+
+	out, err := exec.Command("age", "--version").Output()
+	if err != nil {
+		return Version{}
+	}
+	return recordVersion(string(out))
+}
+
+// passphraseFlow describes how an age release reads a passphrase for -p
+type passphraseFlow struct {
+	// entries is how often the passphrase is read: once, or again to confirm it
+	entries int
+	// args are the arguments before the input file
+	args []string
+}
+
+// passphraseFlowFor returns the prompt flow of v. Pre-releases of 1.0.0 read
+// the passphrase once and write to stdout without being told to; released
+// versions ask for a confirmation. Unknown and development builds are
+// treated as current releases.
+func passphraseFlowFor(v Version) passphraseFlow {
+	if _, ok := ParseVersion(v.Raw); ok && v.Before(1, 0, 0) {
+		return passphraseFlow{entries: 1, args: []string{"-p"}}
+	}
+	return passphraseFlow{entries: 2, args: []string{"-p", "-o", "-"}}
+}
+
+// input returns what to write to age's stdin for the passphrase
+func (f passphraseFlow) input(passphrase string) string {
+	return strings.Repeat(passphrase+"\n", f.entries)
+}
+
+// versionSuffix describes the installed age release for error messages
+func versionSuffix(v Version) string {
+	if v.Raw == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (age %s)", v.Raw)
+}
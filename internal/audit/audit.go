@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Entry is a single line of the audit log
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Path   string    `json:"path,omitempty"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// mu serialises writes from concurrent operations
+var mu sync.Mutex
+
+// Path returns the location of the audit log
+func Path() string {
+	configDir, err := utils.ConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "supper-audit.log")
+	}
+	return filepath.Join(configDir, "supper", "audit.log")
+}
+
+// Record appends an action and its outcome to the audit log
+func Record(action, path string, opErr error, detail string) error {
+	entry := Entry{
+		Time:   time.Now(),
+		Action: action,
+		Path:   path,
+		Result: "ok",
+		Detail: detail,
+	}
+	if opErr != nil {
+		entry.Result = "failed"
+		entry.Error = opErr.Error()
+	}
+	return write(entry)
+}
+
+// write appends an entry as a JSON line
+func write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	path := Path()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
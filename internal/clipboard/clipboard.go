@@ -0,0 +1,109 @@
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Method describes how text reached the clipboard
+type Method string
+
+const (
+	MethodTool  Method = "tool"  // A system clipboard tool
+	MethodOSC52 Method = "osc52" // The terminal, via an OSC 52 escape sequence
+)
+
+// ErrUnavailable is returned when no clipboard can be reached; callers
+// should show the value so it can be copied by hand
+var ErrUnavailable = errors.New("no clipboard available")
+
+// commands are the clipboard tools tried in order
+var commands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// Copy places text on the clipboard. A system clipboard tool is preferred;
+// over SSH, or when no tool works, the text is sent to the terminal with
+// OSC 52. ErrUnavailable wraps the reasons when neither is possible.
+func Copy(text string) (Method, error) {
+	var failures []string
+
+	// Over SSH a local tool would fill the remote machine's clipboard
+	if !sshSession() {
+		err := copyWithTool(text)
+		if err == nil {
+			return MethodTool, nil
+		}
+		failures = append(failures, err.Error())
+	}
+
+	err := copyWithOSC52(text)
+	if err == nil {
+		return MethodOSC52, nil
+	}
+	failures = append(failures, err.Error())
+
+	return "", fmt.Errorf("%w: %s", ErrUnavailable, strings.Join(failures, "; "))
+}
+
+// copyWithTool uses the first available system clipboard tool
+func copyWithTool(text string) error {
+	for _, command := range commands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", command[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (install xclip, xsel or wl-copy)")
+}
+
+// copyWithOSC52 asks the terminal to set its clipboard. Whether the terminal
+// honours the request cannot be detected.
+func copyWithOSC52(text string) error {
+	if os.Getenv("TERM") == "dumb" || os.Getenv("TERM") == "" {
+		return fmt.Errorf("terminal does not support OSC 52")
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal to send OSC 52 to: %w", err)
+	}
+	defer tty.Close()
+
+	if _, err := tty.WriteString(osc52Sequence(text)); err != nil {
+		return fmt.Errorf("failed to write OSC 52 sequence: %w", err)
+	}
+	return nil
+}
+
+// osc52Sequence builds the escape sequence, wrapped for tmux and screen so
+// the multiplexer passes it on to the outer terminal
+func osc52Sequence(text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+
+	switch {
+	case os.Getenv("TMUX") != "":
+		return "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		return "\x1bP" + seq + "\x1b\\"
+	}
+	return seq
+}
+
+// sshSession reports whether the program runs in an SSH session
+func sshSession() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+}
@@ -4,35 +4,212 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/utils"
 )
 
 // Config represents the application configuration
 type Config struct {
-	KeyPath            string        `json:"key_path"`
-	EncryptedKeyPath   string        `json:"encrypted_key_path"`
-	AutoDeleteInterval time.Duration `json:"auto_delete_interval"`
-	EditorCommand      string        `json:"editor_command"`
-	DefaultRecipients  string        `json:"default_recipients"`
+	KeyPath            string              `json:"key_path"`
+	EncryptedKeyPath   string              `json:"encrypted_key_path"`
+	AutoDeleteInterval time.Duration       `json:"auto_delete_interval"`
+	AutoDeleteWarning  time.Duration       `json:"auto_delete_warning"`
+	CachePassphrase    bool                `json:"cache_passphrase"`
+	PassphraseIdle     time.Duration       `json:"passphrase_idle_timeout"`
+	PlaintextReminder  time.Duration       `json:"plaintext_key_reminder"`
+	EditorCommand      string              `json:"editor_command"`
+	EditorFallback     bool                `json:"editor_fallback"`
+	DefaultRecipients  string              `json:"default_recipients"`
+	RequiredRecipients string              `json:"required_recipients"`
+	VerifyRoot         string              `json:"verify_root"`
+	SearchRoot         string              `json:"search_root"`
+	BackgroundSweep    time.Duration       `json:"background_sweep"`
+	GitScope           string              `json:"git_scope"`
+	NotifyOnCompletion string              `json:"notify_on_completion"`
+	NotifyThreshold    time.Duration       `json:"notify_threshold"`
+	HelpMode           string              `json:"help_mode"`
+	CompactWidth       int                 `json:"compact_width"`
+	RecentDirs         int                 `json:"recent_dirs"`
+	ShowHiddenFiles    bool                `json:"show_hidden_files"`
+	EncryptedMarker    string              `json:"encrypted_marker"`
+	EncryptedColor     string              `json:"encrypted_color"`
+	EnableBackups      bool                `json:"enable_backups"`
+	MaxFileSizeWarning int64               `json:"max_file_size_warning"`
+	NoBackupPatterns   []string            `json:"no_backup_patterns"`
+	SecureDeletePasses int                 `json:"secure_delete_passes"`
+	SecureDeleteMode   string              `json:"secure_delete_mode"`
+	SecureDeleteVerify bool                `json:"secure_delete_verify"`
+	SymlinkMode        string              `json:"symlink_mode"`
+	SOPSTimeout        time.Duration       `json:"sops_timeout"`
+	SkipConfirmations  bool                `json:"skip_confirmations"`
+	EncryptInPlace     bool                `json:"encrypt_in_place"`
+	OutputTemplate     string              `json:"output_template"`
+	TrustedRecipients  []string            `json:"trusted_recipients"`
+	StrictRecipients   bool                `json:"strict_recipients"`
+	StrictOutputDir    bool                `json:"strict_output_dir"`
+	RecipientAliases   map[string][]string `json:"recipient_aliases"`
+	ProtectedPaths     []string            `json:"protected_paths"`
+	ChooseIdentity     bool                `json:"choose_identity"`
+}
+
+// How operations treat a symlinked file
+const (
+	SymlinkTarget = "target" // Operate on the file the link points to (default)
+	SymlinkLink   = "link"   // Keep the link's own path for backups and output names
+	SymlinkRefuse = "refuse" // Refuse to operate on symlinks
+)
+
+// Which files of a git repository directory scans and batch operations
+// cover. Outside a repository every file is covered whatever the scope.
+const (
+	GitScopeAll       = "all"       // Every file, whatever git thinks of it (default)
+	GitScopeGitignore = "gitignore" // Skip the files .gitignore excludes
+	GitScopeTracked   = "tracked"   // Only the files git tracks
+)
+
+// MinBackgroundSweep is the shortest interval between background integrity
+// sweeps, so a sweep of a large tree does not run back to back with the next
+const MinBackgroundSweep = time.Minute
+
+// How the user is told that a long operation has finished
+const (
+	NotifyOff     = "off"     // Stay quiet (default)
+	NotifyBell    = "bell"    // Ring the terminal bell
+	NotifyDesktop = "desktop" // Ring the bell and show a desktop notification
+)
+
+// How much help is shown below the views, cycled with ?
+const (
+	HelpHidden = "hidden" // No help
+	HelpShort  = "short"  // A one-line hint bar for the current view (default)
+	HelpFull   = "full"   // Every key of the current view, grouped
+)
+
+// How the file browser marks encrypted files. Every style but none uses a
+// glyph, so encrypted files stand out without relying on color.
+const (
+	MarkerLock   = "lock"   // A lock before encrypted files (default)
+	MarkerShapes = "shapes" // A filled square before encrypted files, an empty one before plaintext
+	MarkerASCII  = "ascii"  // [enc] before encrypted files, for terminals without these glyphs
+	MarkerNone   = "none"   // No glyph, only the color
+)
+
+// DefaultOutputTemplate names the separate encrypted copy of a file
+// <file>.enc, beside it
+const DefaultOutputTemplate = "{name}{ext}.enc"
+
+// outputPlaceholder matches a placeholder of an output template
+var outputPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// DefaultEditorCommand is the editor command that leaves the choice of
+// editor to sops, which uses $SOPS_EDITOR or $EDITOR
+const DefaultEditorCommand = "default"
+
+// BuiltinEditorCommand edits files in supper's own editor instead, in memory,
+// so no plaintext is written to disk on the way
+const BuiltinEditorCommand = "builtin"
+
+// DefaultCompactWidth is the terminal width, in columns, below which the
+// views stack their boxes in a single column: the width of the dashboard's
+// two columns side by side
+const DefaultCompactWidth = 124
+
+// NextHelpMode returns the help mode ? switches to from mode
+func NextHelpMode(mode string) string {
+	switch mode {
+	case HelpHidden:
+		return HelpShort
+	case HelpShort:
+		return HelpFull
+	default:
+		return HelpHidden
+	}
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
+	// Without a home directory there are no default key paths. They are left
+	// empty, which Validate reports, rather than made relative.
+	keyPath, _ := age.DefaultKeyPath()
+	encryptedKeyPath, _ := age.DefaultEncryptedKeyPath()
+	if name := ActiveProfile(); ValidateProfileName(name) == nil {
+		keyPath = profileKeyPath(keyPath, name)
+		encryptedKeyPath = profileKeyPath(encryptedKeyPath, name)
+	}
+
 	return &Config{
-		KeyPath:            age.DefaultKeyPath(),
-		EncryptedKeyPath:   age.DefaultEncryptedKeyPath(),
+		KeyPath:            keyPath,
+		EncryptedKeyPath:   encryptedKeyPath,
 		AutoDeleteInterval: 30 * time.Minute,
-		EditorCommand:      "default", // Uses EDITOR environment variable if available
+		AutoDeleteWarning:  0,     // Delete when the interval is up, without a warning first
+		CachePassphrase:    false, // Opt-in: trades a key on disk for a passphrase in memory
+		PassphraseIdle:     age.DefaultPassphraseIdleTimeout,
+		PlaintextReminder:  7 * 24 * time.Hour,
+		EditorCommand:      DefaultEditorCommand, // Uses EDITOR environment variable if available
+		EditorFallback:     false,                // A missing editor is an error rather than a surprise
 		DefaultRecipients:  "",
+		RequiredRecipients: "",                // Recipients every encrypted file must include
+		VerifyRoot:         "",                // The integrity sweep checks the working directory
+		SearchRoot:         "",                // Key searches cover the file browser's directory
+		BackgroundSweep:    0,                 // Opt-in: sweeps run only when asked for
+		GitScope:           GitScopeAll,       // Opt-in: ignored build artifacts may hold secrets too
+		NotifyOnCompletion: NotifyOff,         // Opt-in: bells annoy some users
+		NotifyThreshold:    10 * time.Second,  // Operations finishing sooner are still being watched
+		HelpMode:           HelpShort,         // A hint bar until ? asks for more or less
+		EncryptedMarker:    MarkerLock,        // A glyph, so encrypted files do not stand out by color alone
+		EncryptedColor:     "#00AA00",         // Empty leaves encrypted files in the terminal's color
+		MaxFileSizeWarning: 100 * 1024 * 1024, // Warn before operating on files over 100 MB
+		NoBackupPatterns:   []string{},
+		EnableBackups:      true,
+		CompactWidth:       DefaultCompactWidth,
+		RecentDirs:         10,
+		ShowHiddenFiles:    false,
+		SecureDeletePasses: 1,
+		SecureDeleteMode:   string(utils.WipeZeros),
+		SecureDeleteVerify: true,
+		SymlinkMode:        SymlinkTarget,
+		SOPSTimeout:        5 * time.Minute,
+		SkipConfirmations:  false, // Destructive operations are always confirmed
+		EncryptInPlace:     true,  // Otherwise write <file>.enc next to the plaintext
+		OutputTemplate:     DefaultOutputTemplate,
+		TrustedRecipients:  []string{},
+		StrictRecipients:   false,
+		StrictOutputDir:    false,      // Exposed output directories are warned about, not refused
+		ProtectedPaths:     []string{}, // The key paths are always protected as well
+		ChooseIdentity:     false,      // Otherwise sops picks among the loaded identities
+		RecipientAliases:   map[string][]string{},
 	}
 }
 
-// ConfigPath returns the path to the configuration file
+// ConfigPath returns the path to the configuration file of the active
+// profile. Named profiles are stored in profiles/<name>.json beside the
+// default config.json.
 func ConfigPath() (string, error) {
-	configDir, err := os.UserConfigDir()
+	path, err := basePath()
+	if err != nil {
+		return "", err
+	}
+
+	name := ActiveProfile()
+	if name == "" {
+		return path, nil
+	}
+	if err := ValidateProfileName(name); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", EnvProfile, err)
+	}
+	return filepath.Join(profilesDir(filepath.Dir(path)), name+".json"), nil
+}
+
+// basePath returns the path to the default profile's configuration file
+func basePath() (string, error) {
+	configDir, err := utils.ConfigDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user config directory: %w", err)
 	}
@@ -47,9 +224,14 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	// If the config file doesn't exist, return the default config
+	// If the config file doesn't exist, start from the default config
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return DefaultConfig(), nil
+		config := DefaultConfig()
+		if err := applyEnv(config); err != nil {
+			return nil, err
+		}
+		config.apply()
+		return config, nil
 	}
 
 	// Read the config file
@@ -58,13 +240,64 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Parse the JSON
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Parse the JSON on top of the defaults so missing fields keep their default values
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	return &config, nil
+	// Paths written by hand may be relative or use ~ and $VARS
+	if err := config.normalizeKeyPaths(); err != nil {
+		return nil, err
+	}
+
+	// Environment variables take precedence over the file
+	if err := applyEnv(config); err != nil {
+		return nil, err
+	}
+
+	config.apply()
+
+	return config, nil
+}
+
+// normalizeKeyPaths makes the key paths absolute, see utils.NormalizePath
+func (c *Config) normalizeKeyPaths() error {
+	for _, path := range []*string{&c.KeyPath, &c.EncryptedKeyPath} {
+		normalized, err := utils.NormalizePath(*path)
+		if err != nil {
+			return fmt.Errorf("invalid key path %q: %w", *path, err)
+		}
+		*path = normalized
+	}
+	return nil
+}
+
+// CheckKeyPaths checks that the key paths changed from before could be
+// written, so a typo is caught when it is saved rather than when a key is
+// first generated or decrypted. Errors are keyed by field name.
+func CheckKeyPaths(before, after *Config) map[string]error {
+	errs := make(map[string]error)
+	if after.KeyPath != before.KeyPath {
+		if err := utils.CheckWritable(after.KeyPath); err != nil {
+			errs["key_path"] = err
+		}
+	}
+	if after.EncryptedKeyPath != before.EncryptedKeyPath {
+		if err := utils.CheckWritable(after.EncryptedKeyPath); err != nil {
+			errs["encrypted_key_path"] = err
+		}
+	}
+	return errs
+}
+
+// apply pushes the settings the age package needs but cannot import, keeping
+// trust checks and recipient resolution in step with the configuration
+func (c *Config) apply() {
+	age.SetTrustedFingerprints(c.TrustedRecipients)
+	age.SetAliases(c.RecipientAliases)
+	age.SetSelfKeyPaths(c.EncryptedKeyPath, c.KeyPath)
+	age.SetPassphraseCaching(c.CachePassphrase, c.PassphraseIdle)
 }
 
 // Save saves the configuration to disk
@@ -91,5 +324,180 @@ func Save(config *Config) error {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
+	// The saved settings take effect without a restart
+	config.apply()
+
 	return nil
 }
+
+// Validate checks the configuration for invalid values
+func Validate(config *Config) error {
+	if config.KeyPath == "" {
+		if _, err := age.DefaultKeyPath(); err != nil {
+			return fmt.Errorf("key path must be set: %w", err)
+		}
+		return fmt.Errorf("key path must not be empty")
+	}
+	if config.EncryptedKeyPath == "" {
+		return fmt.Errorf("encrypted key path must not be empty")
+	}
+	if config.KeyPath == config.EncryptedKeyPath {
+		return fmt.Errorf("key path and encrypted key path must differ")
+	}
+	if config.AutoDeleteInterval <= 0 {
+		return fmt.Errorf("auto-delete interval must be positive, got %s", config.AutoDeleteInterval)
+	}
+	if config.AutoDeleteWarning < 0 || (config.AutoDeleteWarning > 0 && config.AutoDeleteWarning >= config.AutoDeleteInterval) {
+		return fmt.Errorf("auto-delete warning must be 0 or shorter than the auto-delete interval, got %s", config.AutoDeleteWarning)
+	}
+	if config.PassphraseIdle <= 0 {
+		return fmt.Errorf("passphrase idle timeout must be positive, got %s", config.PassphraseIdle)
+	}
+	if config.PlaintextReminder < 0 {
+		return fmt.Errorf("plaintext key reminder must not be negative, got %s", config.PlaintextReminder)
+	}
+	switch config.NotifyOnCompletion {
+	case NotifyOff, NotifyBell, NotifyDesktop:
+	default:
+		return fmt.Errorf("notify on completion must be %q, %q or %q", NotifyOff, NotifyBell, NotifyDesktop)
+	}
+	if config.NotifyThreshold <= 0 {
+		return fmt.Errorf("notify threshold must be positive, got %s", config.NotifyThreshold)
+	}
+	switch config.GitScope {
+	case GitScopeAll, GitScopeGitignore, GitScopeTracked:
+	default:
+		return fmt.Errorf("git scope must be %q, %q or %q", GitScopeAll, GitScopeGitignore, GitScopeTracked)
+	}
+	switch config.HelpMode {
+	case HelpHidden, HelpShort, HelpFull:
+	default:
+		return fmt.Errorf("help mode must be %q, %q or %q", HelpHidden, HelpShort, HelpFull)
+	}
+	switch config.EncryptedMarker {
+	case MarkerLock, MarkerShapes, MarkerASCII, MarkerNone:
+	default:
+		return fmt.Errorf("encrypted marker must be %q, %q, %q or %q", MarkerLock, MarkerShapes, MarkerASCII, MarkerNone)
+	}
+	if !ValidColor(config.EncryptedColor) {
+		return fmt.Errorf("encrypted color must be a hex color such as #00AA00, an ANSI color number from 0 to 255, or empty, got %q", config.EncryptedColor)
+	}
+	if config.MaxFileSizeWarning < 0 {
+		return fmt.Errorf("max file size warning must not be negative")
+	}
+	if config.SecureDeletePasses < 1 {
+		return fmt.Errorf("secure delete passes must be at least 1")
+	}
+	if config.SecureDeleteMode != string(utils.WipeZeros) && config.SecureDeleteMode != string(utils.WipeRandom) {
+		return fmt.Errorf("secure delete mode must be %q or %q", utils.WipeZeros, utils.WipeRandom)
+	}
+	switch config.SymlinkMode {
+	case SymlinkTarget, SymlinkLink, SymlinkRefuse:
+	default:
+		return fmt.Errorf("symlink mode must be %q, %q or %q", SymlinkTarget, SymlinkLink, SymlinkRefuse)
+	}
+	if err := ValidateOutputTemplate(config.OutputTemplate); err != nil {
+		return fmt.Errorf("output template: %w", err)
+	}
+	if config.CompactWidth < 0 {
+		return fmt.Errorf("compact width must not be negative, got %d", config.CompactWidth)
+	}
+	if err := ValidateEditorCommand(config.EditorCommand); err != nil {
+		return fmt.Errorf("editor command: %w", err)
+	}
+	if config.RecentDirs < 0 {
+		return fmt.Errorf("recent dirs must not be negative, got %d", config.RecentDirs)
+	}
+	if config.BackgroundSweep != 0 && config.BackgroundSweep < MinBackgroundSweep {
+		return fmt.Errorf("background sweep must be 0 or at least %s, got %s", MinBackgroundSweep, config.BackgroundSweep)
+	}
+	if config.SOPSTimeout < 0 {
+		return fmt.Errorf("sops timeout must not be negative, got %s", config.SOPSTimeout)
+	}
+	for _, pattern := range config.NoBackupPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid no-backup pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidColor reports whether color is a #RRGGBB hex color, an ANSI color
+// number from 0 to 255 or empty for the terminal's default
+func ValidColor(color string) bool {
+	if color == "" {
+		return true
+	}
+	if strings.HasPrefix(color, "#") {
+		_, err := strconv.ParseUint(color[1:], 16, 32)
+		return len(color) == 7 && err == nil
+	}
+	n, err := strconv.Atoi(color)
+	return err == nil && n >= 0 && n <= 255
+}
+
+// ValidateEditorCommand checks that the program an editor command runs, its
+// first word, is installed. DefaultEditorCommand is always accepted, as sops
+// then picks the editor itself, and so is BuiltinEditorCommand.
+func ValidateEditorCommand(command string) error {
+	if command == DefaultEditorCommand || command == BuiltinEditorCommand {
+		return nil
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return fmt.Errorf("must not be empty; use %q for $EDITOR", DefaultEditorCommand)
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return fmt.Errorf("%q is not installed or not on PATH", fields[0])
+	}
+	return nil
+}
+
+// ValidateOutputTemplate checks that an output template only uses the
+// {name}, {ext} and {dir} placeholders, names a file of its own for every
+// input, and stays within the input's directory: it may name a
+// subdirectory, but must not be absolute or climb out with "..".
+func ValidateOutputTemplate(template string) error {
+	if !strings.Contains(template, "{name}") {
+		return fmt.Errorf("must contain {name}, or every file would get the same output")
+	}
+	for _, placeholder := range outputPlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case "{name}", "{ext}", "{dir}":
+		default:
+			return fmt.Errorf("unknown placeholder %s; use {name}, {ext} or {dir}", placeholder)
+		}
+	}
+
+	plain := outputPlaceholder.ReplaceAllString(template, "x")
+	if filepath.IsAbs(plain) || strings.HasPrefix(plain, "/") || strings.Contains(plain, `\`) {
+		return fmt.Errorf("must be relative to the file's directory")
+	}
+	if strings.HasSuffix(plain, "/") {
+		return fmt.Errorf("must end with a file name")
+	}
+	for _, part := range strings.Split(plain, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("must not contain empty, . or .. path elements")
+		}
+	}
+	if template == "{name}{ext}" || template == "./{name}{ext}" {
+		return fmt.Errorf("must differ from the file's own name")
+	}
+	return nil
+}
+
+// TrustCheckEnabled reports whether recipients are checked against the allowlist
+func (c *Config) TrustCheckEnabled() bool {
+	return c.StrictRecipients || len(c.TrustedRecipients) > 0
+}
+
+// WipeOptions returns the secure deletion options described by the configuration
+func (c *Config) WipeOptions() utils.WipeOptions {
+	return utils.WipeOptions{
+		Passes: c.SecureDeletePasses,
+		Mode:   utils.WipeMode(c.SecureDeleteMode),
+		Verify: c.SecureDeleteVerify,
+	}
+}
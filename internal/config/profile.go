@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvProfile selects the configuration profile when --profile is not given
+const EnvProfile = "SUPPER_PROFILE"
+
+// DefaultProfile is the name of the profile stored in config.json
+const DefaultProfile = "default"
+
+// profileNamePattern keeps profile names usable as file names
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+var (
+	profileMu sync.RWMutex
+	// profile is the profile chosen with SetProfile, overriding EnvProfile
+	profile string
+)
+
+// SetProfile selects the profile that Load, Save and ConfigPath use. An
+// empty name or DefaultProfile selects the default configuration.
+func SetProfile(name string) error {
+	name = strings.TrimSpace(name)
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	profile = name
+	return nil
+}
+
+// ValidateProfileName checks that name can be used as a profile name
+func ValidateProfileName(name string) error {
+	if name == "" || profileNamePattern.MatchString(name) {
+		return nil
+	}
+	return fmt.Errorf("invalid profile name %q: use letters, digits, '-' and '_'", name)
+}
+
+// ActiveProfile returns the name of the selected profile: the one given to
+// SetProfile, else SUPPER_PROFILE. It is empty for the default profile.
+func ActiveProfile() string {
+	profileMu.RLock()
+	name := profile
+	profileMu.RUnlock()
+
+	if name == "" {
+		// An invalid name in the environment is reported by ConfigPath
+		name = strings.TrimSpace(os.Getenv(EnvProfile))
+	}
+	if name == DefaultProfile {
+		return ""
+	}
+	return name
+}
+
+// profilesDir returns the directory holding the named profiles
+func profilesDir(configDir string) string {
+	return filepath.Join(configDir, "profiles")
+}
+
+// Profiles lists the named profiles that have been saved, sorted by name.
+// The default profile is not included.
+func Profiles() ([]string, error) {
+	path, err := basePath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(profilesDir(filepath.Dir(path)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() && profileNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// profileKeyPath places a named profile's default key in its own directory
+// next to the default key, so profiles never share a key by accident
+func profileKeyPath(keyPath, name string) string {
+	if keyPath == "" || name == "" {
+		return keyPath
+	}
+	return filepath.Join(filepath.Dir(keyPath), name, filepath.Base(keyPath))
+}
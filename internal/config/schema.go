@@ -0,0 +1,864 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Setting groups, in display order
+const (
+	GroupKeyPaths = "Key Paths"
+	GroupSecurity = "Security"
+	GroupUI       = "UI"
+	GroupBackups  = "Backups"
+)
+
+// Groups lists the setting groups in the order they are displayed
+var Groups = []string{GroupKeyPaths, GroupSecurity, GroupUI, GroupBackups}
+
+// FieldSpec describes a configuration field
+type FieldSpec struct {
+	Name        string `json:"name"`  // Key in config.json
+	Label       string `json:"label"` // Human-readable name
+	Type        string `json:"type"`  // string, path, duration, int, bool, size, enum, list or map
+	Default     string `json:"default"`
+	Description string `json:"description"`
+	EnvVar      string `json:"env_var"`
+	Validation  string `json:"validation,omitempty"`
+	Group       string `json:"group"`
+
+	// Get formats the field's value
+	Get func(cfg *Config) string `json:"-"`
+	// Set parses value into the field, returning a validation error
+	Set func(cfg *Config, value string) error `json:"-"`
+}
+
+// Schema describes every configuration field, in display order
+func Schema() []FieldSpec {
+	fields := []FieldSpec{
+		{
+			Name:        "key_path",
+			Label:       "Age Key Path",
+			Type:        "path",
+			Description: "Path to the age key file",
+			EnvVar:      "SUPPER_KEY_PATH",
+			Validation:  "non-empty, different from the encrypted key path; ~ and $VARS are expanded and the path made absolute",
+			Group:       GroupKeyPaths,
+			Get:         func(cfg *Config) string { return cfg.KeyPath },
+			Set: func(cfg *Config, value string) error {
+				if value == "" {
+					return fmt.Errorf("path must not be empty")
+				}
+				path, err := utils.NormalizePath(value)
+				if err != nil {
+					return err
+				}
+				cfg.KeyPath = path
+				return nil
+			},
+		},
+		{
+			Name:        "encrypted_key_path",
+			Label:       "Encrypted Key Path",
+			Type:        "path",
+			Description: "Path to the encrypted age key file",
+			EnvVar:      "SUPPER_ENCRYPTED_KEY_PATH",
+			Validation:  "non-empty, different from the key path; ~ and $VARS are expanded and the path made absolute",
+			Group:       GroupKeyPaths,
+			Get:         func(cfg *Config) string { return cfg.EncryptedKeyPath },
+			Set: func(cfg *Config, value string) error {
+				if value == "" {
+					return fmt.Errorf("path must not be empty")
+				}
+				path, err := utils.NormalizePath(value)
+				if err != nil {
+					return err
+				}
+				cfg.EncryptedKeyPath = path
+				return nil
+			},
+		},
+		{
+			Name:        "auto_delete_interval",
+			Label:       "Auto-Delete Interval",
+			Type:        "duration",
+			Description: "Automatically delete decrypted key after this time",
+			EnvVar:      "SUPPER_AUTO_DELETE_INTERVAL",
+			Validation:  "positive Go duration, e.g. 30m",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.AutoDeleteInterval.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration <= 0 {
+					return fmt.Errorf("interval must be positive")
+				}
+				cfg.AutoDeleteInterval = duration
+				return nil
+			},
+		},
+		{
+			Name:        "auto_delete_warning",
+			Label:       "Auto-Delete Warning",
+			Type:        "duration",
+			Description: "Warn this long before the decrypted key is auto-deleted, with the choice to extend the session or delete it now (0 deletes without warning)",
+			EnvVar:      "SUPPER_AUTO_DELETE_WARNING",
+			Validation:  "Go duration shorter than the interval, e.g. 2m; 0 never warns",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.AutoDeleteWarning.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration < 0 {
+					return fmt.Errorf("warning must not be negative")
+				}
+				cfg.AutoDeleteWarning = duration
+				return nil
+			},
+		},
+		{
+			Name:        "cache_passphrase",
+			Label:       "Cache Passphrase",
+			Type:        "bool",
+			Description: "Keep the key's passphrase in memory for the session instead of writing the decrypted key to disk. Convenient, but anything that can read supper's memory can read the passphrase",
+			EnvVar:      "SUPPER_CACHE_PASSPHRASE",
+			Validation:  "true or false",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.CachePassphrase) },
+			Set: func(cfg *Config, value string) error {
+				cache, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.CachePassphrase = cache
+				return nil
+			},
+		},
+		{
+			Name:        "passphrase_idle_timeout",
+			Label:       "Passphrase Idle Timeout",
+			Type:        "duration",
+			Description: "Wipe the cached passphrase after it has gone unused for this long",
+			EnvVar:      "SUPPER_PASSPHRASE_IDLE_TIMEOUT",
+			Validation:  "positive Go duration, e.g. 10m",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.PassphraseIdle.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration <= 0 {
+					return fmt.Errorf("timeout must be positive")
+				}
+				cfg.PassphraseIdle = duration
+				return nil
+			},
+		},
+		{
+			Name:        "plaintext_key_reminder",
+			Label:       "Plaintext Key Reminder",
+			Type:        "duration",
+			Description: "Remind on the dashboard to encrypt a decrypted key that has been on disk this long without an encrypted copy (0 disables)",
+			EnvVar:      "SUPPER_PLAINTEXT_KEY_REMINDER",
+			Validation:  "Go duration, e.g. 168h; 0 never reminds",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.PlaintextReminder.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration < 0 {
+					return fmt.Errorf("reminder must not be negative")
+				}
+				cfg.PlaintextReminder = duration
+				return nil
+			},
+		},
+		{
+			Name:        "default_recipients",
+			Label:       "Default Recipients",
+			Type:        "string",
+			Description: "Default age recipients for new files",
+			EnvVar:      "SUPPER_DEFAULT_RECIPIENTS",
+			Validation:  "comma-separated age keys, gh:username or https:// URLs of recipients files",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.DefaultRecipients },
+			Set: func(cfg *Config, value string) error {
+				cfg.DefaultRecipients = value
+				return nil
+			},
+		},
+		{
+			Name:        "required_recipients",
+			Label:       "Required Recipients",
+			Type:        "string",
+			Description: "Recipients every encrypted file must include (policy check)",
+			EnvVar:      "SUPPER_REQUIRED_RECIPIENTS",
+			Validation:  "comma-separated age keys, gh:username or https:// URLs of recipients files",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.RequiredRecipients },
+			Set: func(cfg *Config, value string) error {
+				cfg.RequiredRecipients = value
+				return nil
+			},
+		},
+		{
+			Name:        "trusted_recipients",
+			Label:       "Trusted Recipients",
+			Type:        "list",
+			Description: "Comma-separated fingerprints (SHA256:...) of recipients that can be encrypted to without an extra confirmation",
+			EnvVar:      "SUPPER_TRUSTED_RECIPIENTS",
+			Validation:  "comma-separated SHA256 fingerprints",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strings.Join(cfg.TrustedRecipients, ", ") },
+			Set: func(cfg *Config, value string) error {
+				fingerprints := []string{}
+				for _, fp := range strings.Split(value, ",") {
+					if fp = strings.TrimSpace(fp); fp != "" {
+						fingerprints = append(fingerprints, fp)
+					}
+				}
+				cfg.TrustedRecipients = fingerprints
+				return nil
+			},
+		},
+		{
+			Name:        "strict_recipients",
+			Label:       "Strict Recipients",
+			Type:        "bool",
+			Description: "Refuse to encrypt to recipients that are not trusted instead of asking",
+			EnvVar:      "SUPPER_STRICT_RECIPIENTS",
+			Validation:  "true or false",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.StrictRecipients) },
+			Set: func(cfg *Config, value string) error {
+				strict, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.StrictRecipients = strict
+				return nil
+			},
+		},
+		{
+			Name:        "strict_output_dir",
+			Label:       "Strict Output Directory",
+			Type:        "bool",
+			Description: "Refuse to decrypt into a directory other users can write to instead of warning",
+			EnvVar:      "SUPPER_STRICT_OUTPUT_DIR",
+			Validation:  "true or false",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.StrictOutputDir) },
+			Set: func(cfg *Config, value string) error {
+				strict, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.StrictOutputDir = strict
+				return nil
+			},
+		},
+		{
+			Name:        "protected_paths",
+			Label:       "Protected Paths",
+			Type:        "list",
+			Description: "Comma-separated files, besides the key paths, that the file operations refuse to encrypt, decrypt over or edit, such as other identities",
+			EnvVar:      "SUPPER_PROTECTED_PATHS",
+			Validation:  "comma-separated paths; ~ and $VARS are expanded",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strings.Join(cfg.ProtectedPaths, ", ") },
+			Set: func(cfg *Config, value string) error {
+				paths := []string{}
+				for _, path := range strings.Split(value, ",") {
+					if path = strings.TrimSpace(path); path != "" {
+						paths = append(paths, path)
+					}
+				}
+				cfg.ProtectedPaths = paths
+				return nil
+			},
+		},
+		{
+			Name:        "choose_identity",
+			Label:       "Choose Identity",
+			Type:        "bool",
+			Description: "Ask which identity to decrypt with when several loaded identities are recipients of a file, and give sops only that one",
+			EnvVar:      "SUPPER_CHOOSE_IDENTITY",
+			Validation:  "true or false",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.ChooseIdentity) },
+			Set: func(cfg *Config, value string) error {
+				choose, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.ChooseIdentity = choose
+				return nil
+			},
+		},
+		{
+			Name:        "recipient_aliases",
+			Label:       "Recipient Aliases",
+			Type:        "map",
+			Description: "Address book of names that can be used in place of recipients, e.g. alice=age1...; team-x=alice, gh:bob",
+			EnvVar:      "SUPPER_RECIPIENT_ALIASES",
+			Validation:  "name=recipients entries separated by semicolons; recipients are comma-separated keys, gh:username, https:// URLs, self or other names",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return formatAliases(cfg.RecipientAliases) },
+			Set: func(cfg *Config, value string) error {
+				aliases, err := parseAliases(value)
+				if err != nil {
+					return err
+				}
+				cfg.RecipientAliases = aliases
+				return nil
+			},
+		},
+		{
+			Name:        "secure_delete_passes",
+			Label:       "Secure Delete Passes",
+			Type:        "int",
+			Description: "Number of overwrite passes when securely deleting (passed to shred -n)",
+			EnvVar:      "SUPPER_SECURE_DELETE_PASSES",
+			Validation:  "integer, at least 1",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.Itoa(cfg.SecureDeletePasses) },
+			Set: func(cfg *Config, value string) error {
+				passes, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid number: %w", err)
+				}
+				if passes < 1 {
+					return fmt.Errorf("must be at least 1")
+				}
+				cfg.SecureDeletePasses = passes
+				return nil
+			},
+		},
+		{
+			Name:        "secure_delete_mode",
+			Label:       "Secure Delete Mode",
+			Type:        "enum",
+			Description: "Overwrite with zeros or random data (zeros, random)",
+			EnvVar:      "SUPPER_SECURE_DELETE_MODE",
+			Validation:  fmt.Sprintf("%s or %s", utils.WipeZeros, utils.WipeRandom),
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.SecureDeleteMode },
+			Set: func(cfg *Config, value string) error {
+				if value != string(utils.WipeZeros) && value != string(utils.WipeRandom) {
+					return fmt.Errorf("must be %q or %q", utils.WipeZeros, utils.WipeRandom)
+				}
+				cfg.SecureDeleteMode = value
+				return nil
+			},
+		},
+		{
+			Name:        "secure_delete_verify",
+			Label:       "Verify Secure Delete",
+			Type:        "bool",
+			Description: "Read files back after overwriting to confirm the bytes changed",
+			EnvVar:      "SUPPER_SECURE_DELETE_VERIFY",
+			Validation:  "true or false",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.SecureDeleteVerify) },
+			Set: func(cfg *Config, value string) error {
+				verify, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.SecureDeleteVerify = verify
+				return nil
+			},
+		},
+		{
+			Name:        "symlink_mode",
+			Label:       "Symlink Handling",
+			Type:        "enum",
+			Description: "Operate on a symlink's target, keep the link's path, or refuse (target, link, refuse)",
+			EnvVar:      "SUPPER_SYMLINK_MODE",
+			Validation:  fmt.Sprintf("%s, %s or %s", SymlinkTarget, SymlinkLink, SymlinkRefuse),
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.SymlinkMode },
+			Set: func(cfg *Config, value string) error {
+				switch value {
+				case SymlinkTarget, SymlinkLink, SymlinkRefuse:
+					cfg.SymlinkMode = value
+					return nil
+				}
+				return fmt.Errorf("must be %q, %q or %q", SymlinkTarget, SymlinkLink, SymlinkRefuse)
+			},
+		},
+		{
+			Name:        "sops_timeout",
+			Label:       "SOPS Timeout",
+			Type:        "duration",
+			Description: "Stop a sops run taking longer than this when there is no terminal to answer a prompt on, such as in scripts and batch operations (0 disables)",
+			EnvVar:      "SUPPER_SOPS_TIMEOUT",
+			Validation:  "Go duration, e.g. 5m; 0 never stops sops",
+			Group:       GroupSecurity,
+			Get:         func(cfg *Config) string { return cfg.SOPSTimeout.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration < 0 {
+					return fmt.Errorf("timeout must not be negative")
+				}
+				cfg.SOPSTimeout = duration
+				return nil
+			},
+		},
+		{
+			Name:        "editor_command",
+			Label:       "Editor Command",
+			Type:        "string",
+			Description: "Command to use for editing files",
+			EnvVar:      "SUPPER_EDITOR_COMMAND",
+			Validation:  "an installed program, with arguments; \"default\" uses $EDITOR, \"builtin\" edits in memory",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.EditorCommand },
+			Set: func(cfg *Config, value string) error {
+				if value == "" {
+					return fmt.Errorf("use \"default\" to use $EDITOR")
+				}
+				cfg.EditorCommand = value
+				return nil
+			},
+		},
+		{
+			Name:        "editor_fallback",
+			Label:       "Editor Fallback",
+			Type:        "bool",
+			Description: "When the editor command is not installed, edit with $EDITOR, or vi, and show a warning instead of failing",
+			EnvVar:      "SUPPER_EDITOR_FALLBACK",
+			Validation:  "true or false",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.EditorFallback) },
+			Set: func(cfg *Config, value string) error {
+				fallback, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("invalid boolean: %w", err)
+				}
+				cfg.EditorFallback = fallback
+				return nil
+			},
+		},
+		{
+			Name:        "skip_confirmations",
+			Label:       "Skip Confirmations",
+			Type:        "bool",
+			Description: "Run decrypt and edit without asking first; encrypting in place, overwriting an existing output and re-keying are always confirmed",
+			EnvVar:      "SUPPER_SKIP_CONFIRMATIONS",
+			Validation:  "true or false",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.SkipConfirmations) },
+			Set: func(cfg *Config, value string) error {
+				skip, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.SkipConfirmations = skip
+				return nil
+			},
+		},
+		{
+			Name:        "encrypt_in_place",
+			Label:       "Encrypt In Place",
+			Type:        "bool",
+			Description: "Replace the plaintext when encrypting; when false the ciphertext is written next to it as <file>.enc",
+			EnvVar:      "SUPPER_ENCRYPT_IN_PLACE",
+			Validation:  "true or false",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.EncryptInPlace) },
+			Set: func(cfg *Config, value string) error {
+				inPlace, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.EncryptInPlace = inPlace
+				return nil
+			},
+		},
+		{
+			Name:        "output_template",
+			Label:       "Output Template",
+			Type:        "string",
+			Description: "Name of the encrypted copy written next to a file when not encrypting in place; {name}, {ext} and {dir} are the file's name without extension, its extension and its directory's name",
+			EnvVar:      "SUPPER_OUTPUT_TEMPLATE",
+			Validation:  "relative name containing {name}, e.g. {name}.sops{ext}; no .. elements",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.OutputTemplate },
+			Set: func(cfg *Config, value string) error {
+				if err := ValidateOutputTemplate(value); err != nil {
+					return err
+				}
+				cfg.OutputTemplate = value
+				return nil
+			},
+		},
+		{
+			Name:        "verify_root",
+			Label:       "Verify Root",
+			Type:        "path",
+			Description: "Directory the dashboard's integrity sweep checks; empty checks the working directory",
+			EnvVar:      "SUPPER_VERIFY_ROOT",
+			Validation:  "directory path, or empty",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.VerifyRoot },
+			Set: func(cfg *Config, value string) error {
+				cfg.VerifyRoot = value
+				return nil
+			},
+		},
+		{
+			Name:        "search_root",
+			Label:       "Search Root",
+			Type:        "path",
+			Description: "Directory a search for a key name covers; empty searches the file browser's directory",
+			EnvVar:      "SUPPER_SEARCH_ROOT",
+			Validation:  "directory path, or empty",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.SearchRoot },
+			Set: func(cfg *Config, value string) error {
+				cfg.SearchRoot = value
+				return nil
+			},
+		},
+		{
+			Name:        "background_sweep",
+			Label:       "Background Sweep",
+			Type:        "duration",
+			Description: "While the app is open, run the integrity sweep of Verify Root this often, one file at a time, and alert when a file fails its MAC check (0 disables)",
+			EnvVar:      "SUPPER_BACKGROUND_SWEEP",
+			Validation:  "Go duration of at least 1m, e.g. 1h; 0 disables",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.BackgroundSweep.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration != 0 && duration < MinBackgroundSweep {
+					return fmt.Errorf("interval must be 0 or at least %s", MinBackgroundSweep)
+				}
+				cfg.BackgroundSweep = duration
+				return nil
+			},
+		},
+		{
+			Name:        "git_scope",
+			Label:       "Git Scope",
+			Type:        "enum",
+			Description: "In a git repository, scan and re-key every file, skip those .gitignore excludes, or only tracked files (all, gitignore, tracked)",
+			EnvVar:      "SUPPER_GIT_SCOPE",
+			Validation:  fmt.Sprintf("%s, %s or %s", GitScopeAll, GitScopeGitignore, GitScopeTracked),
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.GitScope },
+			Set: func(cfg *Config, value string) error {
+				switch value {
+				case GitScopeAll, GitScopeGitignore, GitScopeTracked:
+					cfg.GitScope = value
+					return nil
+				}
+				return fmt.Errorf("must be %q, %q or %q", GitScopeAll, GitScopeGitignore, GitScopeTracked)
+			},
+		},
+		{
+			Name:        "notify_on_completion",
+			Label:       "Notify On Completion",
+			Type:        "enum",
+			Description: "Ring the bell, and with desktop also show a notification, when a long operation finishes (off, bell, desktop)",
+			EnvVar:      "SUPPER_NOTIFY_ON_COMPLETION",
+			Validation:  fmt.Sprintf("%s, %s or %s", NotifyOff, NotifyBell, NotifyDesktop),
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.NotifyOnCompletion },
+			Set: func(cfg *Config, value string) error {
+				switch value {
+				case NotifyOff, NotifyBell, NotifyDesktop:
+					cfg.NotifyOnCompletion = value
+					return nil
+				}
+				return fmt.Errorf("must be %q, %q or %q", NotifyOff, NotifyBell, NotifyDesktop)
+			},
+		},
+		{
+			Name:        "notify_threshold",
+			Label:       "Notify Threshold",
+			Type:        "duration",
+			Description: "Only notify for operations that ran at least this long",
+			EnvVar:      "SUPPER_NOTIFY_THRESHOLD",
+			Validation:  "positive Go duration, e.g. 10s",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.NotifyThreshold.String() },
+			Set: func(cfg *Config, value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration format: %w", err)
+				}
+				if duration <= 0 {
+					return fmt.Errorf("threshold must be positive")
+				}
+				cfg.NotifyThreshold = duration
+				return nil
+			},
+		},
+		{
+			Name:        "help_mode",
+			Label:       "Help",
+			Type:        "enum",
+			Description: "How much help is shown below the views (hidden, short, full); ? cycles it and the choice is saved here",
+			EnvVar:      "SUPPER_HELP_MODE",
+			Validation:  fmt.Sprintf("%s, %s or %s", HelpHidden, HelpShort, HelpFull),
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.HelpMode },
+			Set: func(cfg *Config, value string) error {
+				switch value {
+				case HelpHidden, HelpShort, HelpFull:
+					cfg.HelpMode = value
+					return nil
+				}
+				return fmt.Errorf("must be %q, %q or %q", HelpHidden, HelpShort, HelpFull)
+			},
+		},
+		{
+			Name:        "compact_width",
+			Label:       "Compact Width",
+			Type:        "int",
+			Description: "Terminal width in columns below which the views stack their boxes in a single column (0 never does)",
+			EnvVar:      "SUPPER_COMPACT_WIDTH",
+			Validation:  "integer, 0 or more",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.Itoa(cfg.CompactWidth) },
+			Set: func(cfg *Config, value string) error {
+				width, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid number: %w", err)
+				}
+				if width < 0 {
+					return fmt.Errorf("must be 0 or more")
+				}
+				cfg.CompactWidth = width
+				return nil
+			},
+		},
+		{
+			Name:        "recent_dirs",
+			Label:       "Recent Directories",
+			Type:        "int",
+			Description: "Number of recently visited directories the file browser remembers for its r switcher (0 stops tracking)",
+			EnvVar:      "SUPPER_RECENT_DIRS",
+			Validation:  "integer, 0 or more",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.Itoa(cfg.RecentDirs) },
+			Set: func(cfg *Config, value string) error {
+				count, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid number: %w", err)
+				}
+				if count < 0 {
+					return fmt.Errorf("must be 0 or more")
+				}
+				cfg.RecentDirs = count
+				return nil
+			},
+		},
+		{
+			Name:        "show_hidden_files",
+			Label:       "Show Hidden Files",
+			Type:        "bool",
+			Description: "Whether the file browser lists dotfiles and dot directories such as .config, where sops and age keep their keys; . toggles it for the session",
+			EnvVar:      "SUPPER_SHOW_HIDDEN_FILES",
+			Validation:  "true or false",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.ShowHiddenFiles) },
+			Set: func(cfg *Config, value string) error {
+				show, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.ShowHiddenFiles = show
+				return nil
+			},
+		},
+		{
+			Name:        "encrypted_marker",
+			Label:       "Encrypted Marker",
+			Type:        "enum",
+			Description: "Glyph the file browser puts before encrypted files (lock, shapes, ascii, none); shapes also marks plaintext, so the two differ by shape as well as color",
+			EnvVar:      "SUPPER_ENCRYPTED_MARKER",
+			Validation:  fmt.Sprintf("%s, %s, %s or %s", MarkerLock, MarkerShapes, MarkerASCII, MarkerNone),
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.EncryptedMarker },
+			Set: func(cfg *Config, value string) error {
+				switch value {
+				case MarkerLock, MarkerShapes, MarkerASCII, MarkerNone:
+					cfg.EncryptedMarker = value
+					return nil
+				}
+				return fmt.Errorf("must be %q, %q, %q or %q", MarkerLock, MarkerShapes, MarkerASCII, MarkerNone)
+			},
+		},
+		{
+			Name:        "encrypted_color",
+			Label:       "Encrypted Color",
+			Type:        "string",
+			Description: "Color of encrypted file names in the file browser; empty uses the terminal's color",
+			EnvVar:      "SUPPER_ENCRYPTED_COLOR",
+			Validation:  "hex color such as #00AA00, ANSI color number 0-255, or empty",
+			Group:       GroupUI,
+			Get:         func(cfg *Config) string { return cfg.EncryptedColor },
+			Set: func(cfg *Config, value string) error {
+				if !ValidColor(value) {
+					return fmt.Errorf("must be a hex color such as #00AA00 or an ANSI color number from 0 to 255")
+				}
+				cfg.EncryptedColor = value
+				return nil
+			},
+		},
+		{
+			Name:        "enable_backups",
+			Label:       "Enable Backups",
+			Type:        "bool",
+			Description: "Back up files before modifying them in place; when false no backup directory is created and failed operations cannot be rolled back",
+			EnvVar:      "SUPPER_ENABLE_BACKUPS",
+			Validation:  "true or false",
+			Group:       GroupBackups,
+			Get:         func(cfg *Config) string { return strconv.FormatBool(cfg.EnableBackups) },
+			Set: func(cfg *Config, value string) error {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				cfg.EnableBackups = enabled
+				return nil
+			},
+		},
+		{
+			Name:        "max_file_size_warning",
+			Label:       "Max File Size Warning",
+			Type:        "size",
+			Description: "Warn before encrypting or decrypting larger files, which are also not backed up (0 disables)",
+			EnvVar:      "SUPPER_MAX_FILE_SIZE_WARNING",
+			Validation:  "size such as 100MB, 0 or more",
+			Group:       GroupBackups,
+			Get:         func(cfg *Config) string { return utils.FormatSize(cfg.MaxFileSizeWarning) },
+			Set: func(cfg *Config, value string) error {
+				size, err := utils.ParseSize(value)
+				if err != nil {
+					return err
+				}
+				cfg.MaxFileSizeWarning = size
+				return nil
+			},
+		},
+		{
+			Name:        "no_backup_patterns",
+			Label:       "No-Backup Patterns",
+			Type:        "list",
+			Description: "Comma-separated glob patterns of files that are never backed up",
+			EnvVar:      "SUPPER_NO_BACKUP_PATTERNS",
+			Validation:  "comma-separated glob patterns",
+			Group:       GroupBackups,
+			Get:         func(cfg *Config) string { return strings.Join(cfg.NoBackupPatterns, ", ") },
+			Set: func(cfg *Config, value string) error {
+				patterns := []string{}
+				for _, pattern := range strings.Split(value, ",") {
+					if pattern = strings.TrimSpace(pattern); pattern != "" {
+						patterns = append(patterns, pattern)
+					}
+				}
+				cfg.NoBackupPatterns = patterns
+				return nil
+			},
+		},
+	}
+
+	defaults := DefaultConfig()
+	for i := range fields {
+		fields[i].Default = fields[i].Get(defaults)
+	}
+
+	return fields
+}
+
+// applyEnv overrides configuration fields from their environment variables
+func applyEnv(config *Config) error {
+	for _, field := range Schema() {
+		value, ok := os.LookupEnv(field.EnvVar)
+		if !ok {
+			continue
+		}
+		if err := field.Set(config, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", field.EnvVar, err)
+		}
+	}
+	return nil
+}
+
+// Changes returns the labels of the fields whose values differ between two
+// configurations, in display order
+func Changes(before, after *Config) []string {
+	var changed []string
+	for _, field := range Schema() {
+		if field.Get(before) != field.Get(after) {
+			changed = append(changed, field.Label)
+		}
+	}
+	return changed
+}
+
+// formatAliases renders recipient aliases as name=recipients entries, sorted by name
+func formatAliases(aliases map[string][]string) string {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, name+"="+strings.Join(aliases[name], ", "))
+	}
+	return strings.Join(entries, "; ")
+}
+
+// parseAliases parses the name=recipients entries written by formatAliases
+func parseAliases(value string) (map[string][]string, error) {
+	aliases := map[string][]string{}
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, members, ok := strings.Cut(entry, "=")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q must have the form name=recipients", entry)
+		}
+		if strings.ContainsAny(name, " \t,") || name == "self" ||
+			strings.HasPrefix(name, "gh:") || strings.HasPrefix(name, "age1") || strings.HasPrefix(name, "ssh-") {
+			return nil, fmt.Errorf("%q cannot be used as an alias name", name)
+		}
+
+		tokens := age.SplitRecipientInput(members)
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("alias %q has no recipients", name)
+		}
+		aliases[name] = tokens
+	}
+	return aliases, nil
+}
@@ -0,0 +1,154 @@
+package doctor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Status represents the outcome of a single check
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusWarn
+	StatusFail
+)
+
+// String returns a short label for the status
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// MarshalJSON encodes the status as its label
+func (s Status) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strings.ToLower(s.String()) + `"`), nil
+}
+
+// Check is the result of a single environment check
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// Run performs all environment checks and returns their results
+func Run() []Check {
+	var checks []Check
+
+	// Check sops
+	if version, err := sops.CheckAvailable(); err != nil {
+		checks = append(checks, Check{
+			Name:    "sops",
+			Status:  StatusFail,
+			Code:    errors.Code(err),
+			Message: err.Error(),
+			Fix:     "Install SOPS from https://github.com/getsops/sops",
+		})
+	} else {
+		checks = append(checks, Check{Name: "sops", Status: StatusPass, Message: version})
+	}
+
+	// Check age and age-keygen
+	if version, err := age.CheckAvailable(); err != nil {
+		checks = append(checks, Check{
+			Name:    "age",
+			Status:  StatusFail,
+			Code:    errors.CodeAgeNotInstalled,
+			Message: err.Error(),
+			Fix:     "Install age from https://github.com/FiloSottile/age",
+		})
+	} else {
+		checks = append(checks, Check{Name: "age", Status: StatusPass, Message: version})
+	}
+
+	// Check shred
+	if utils.ShredAvailable() {
+		checks = append(checks, Check{Name: "shred", Status: StatusPass, Message: "available"})
+	} else {
+		checks = append(checks, Check{
+			Name:    "shred",
+			Status:  StatusWarn,
+			Message: "not found, falling back to overwriting with zeros",
+			Fix:     "Install coreutils to get shred",
+		})
+	}
+
+	// Check configuration
+	cfg, err := config.Load()
+	if err != nil {
+		checks = append(checks, Check{
+			Name:    "config",
+			Status:  StatusFail,
+			Code:    errors.CodeConfigInvalid,
+			Message: err.Error(),
+			Fix:     "Fix or remove the configuration file",
+		})
+		cfg = config.DefaultConfig()
+	} else if err := config.Validate(cfg); err != nil {
+		checks = append(checks, Check{
+			Name:    "config",
+			Status:  StatusFail,
+			Code:    errors.CodeConfigInvalid,
+			Message: err.Error(),
+			Fix:     "Correct the setting in the Settings tab",
+		})
+	} else {
+		checks = append(checks, Check{Name: "config", Status: StatusPass, Message: "valid"})
+	}
+
+	// Check key paths are writable
+	for _, path := range []string{cfg.KeyPath, cfg.EncryptedKeyPath} {
+		name := fmt.Sprintf("writable %s", path)
+		if err := utils.CheckWritable(path); err != nil {
+			checks = append(checks, Check{
+				Name:    name,
+				Status:  StatusFail,
+				Code:    errors.CodeFileWriteFailed,
+				Message: err.Error(),
+				Fix:     "Check directory permissions or choose a different key path",
+			})
+		} else {
+			checks = append(checks, Check{Name: name, Status: StatusPass, Message: "ok"})
+		}
+	}
+
+	// Check for an encrypted key
+	if utils.FileExists(cfg.EncryptedKeyPath) {
+		checks = append(checks, Check{Name: "encrypted key", Status: StatusPass, Message: cfg.EncryptedKeyPath})
+	} else {
+		checks = append(checks, Check{
+			Name:    "encrypted key",
+			Status:  StatusWarn,
+			Code:    errors.CodeAgeNoEncryptedKey,
+			Message: "no encrypted key found",
+			Fix:     "Generate a key in the Key Manager tab",
+		})
+	}
+
+	return checks
+}
+
+// HasFailures returns true if any check failed
+func HasFailures(checks []Check) bool {
+	for _, check := range checks {
+		if check.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@
 package errors
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"strings"
 
@@ -21,9 +23,92 @@ const (
 	TypeConfig
 )
 
+// String returns the name of the error type
+func (t ErrorType) String() string {
+	switch t {
+	case TypeSecurity:
+		return "security"
+	case TypeFileOperation:
+		return "file_operation"
+	case TypeKeyManagement:
+		return "key_management"
+	case TypeNetwork:
+		return "network"
+	case TypeConfig:
+		return "config"
+	default:
+		return "general"
+	}
+}
+
+// Stable machine-readable error codes. Type gives the broad category, Code
+// identifies the specific failure so scripts can branch on it.
+const (
+	CodeUnknown = "UNKNOWN"
+
+	CodeSOPSNotInstalled     = "SOPS_NOT_INSTALLED"
+	CodeSOPSDecryptFailed    = "SOPS_DECRYPT_FAILED"
+	CodeSOPSNoKey            = "SOPS_NO_KEY"
+	CodeSOPSAlreadyEncrypted = "SOPS_ALREADY_ENCRYPTED"
+	CodeSOPSNoRegexMatch     = "SOPS_NO_REGEX_MATCH"
+	CodeSOPSNoConfig         = "SOPS_NO_CONFIG"
+	CodeSOPSFailed           = "SOPS_FAILED"
+	CodeSOPSPromptRequired   = "SOPS_PROMPT_REQUIRED"
+	CodeSOPSTimeout          = "SOPS_TIMEOUT"
+	CodeCancelled            = "CANCELLED"
+
+	CodeAgeNotInstalled    = "AGE_NOT_INSTALLED"
+	CodeAgeKeygenFailed    = "AGE_KEYGEN_FAILED"
+	CodeAgeEncryptFailed   = "AGE_ENCRYPT_FAILED"
+	CodeAgeDecryptFailed   = "AGE_DECRYPT_FAILED"
+	CodeAgeBadPassphrase   = "AGE_BAD_PASSPHRASE"
+	CodeAgeNoEncryptedKey  = "AGE_NO_ENCRYPTED_KEY"
+	CodePassphraseExpired  = "PASSPHRASE_EXPIRED"
+	CodeAgeInvalidIdentity = "AGE_INVALID_IDENTITY"
+	CodeAgeInvalidKey      = "AGE_INVALID_KEY"
+	CodeNoIdentityMatched  = "NO_IDENTITY_MATCHED"
+	CodeRecipientUntrusted = "RECIPIENT_UNTRUSTED"
+	CodeRecipientUnknown   = "RECIPIENT_UNKNOWN"
+	CodeGitHubInvalidUser  = "GITHUB_INVALID_USER"
+	CodeGitHubNoKeys       = "GITHUB_NO_KEYS"
+	CodeInsecureURL        = "INSECURE_URL"
+	CodeNetworkFailed      = "NETWORK_FAILED"
+	CodeNetworkBadResponse = "NETWORK_BAD_RESPONSE"
+
+	CodeFileNotFound      = "FILE_NOT_FOUND"
+	CodeDirNotFound       = "DIR_NOT_FOUND"
+	CodeFileExists        = "FILE_EXISTS"
+	CodeFileWriteFailed   = "FILE_WRITE_FAILED"
+	CodeFileDeleteFailed  = "FILE_DELETE_FAILED"
+	CodeFileReadOnly      = "FILE_READ_ONLY"
+	CodeFileNotEncrypted  = "FILE_NOT_ENCRYPTED"
+	CodeFileSymlink       = "FILE_SYMLINK"
+	CodeOutputExposed     = "OUTPUT_EXPOSED"
+	CodeProtectedPath     = "PROTECTED_PATH"
+	CodeLabelInvalid      = "LABEL_INVALID"
+	CodeBackupFailed      = "BACKUP_FAILED"
+	CodeNoBackup          = "BACKUP_NOT_FOUND"
+	CodeRestoreFailed     = "RESTORE_FAILED"
+	CodeRollbackFailed    = "ROLLBACK_FAILED"
+	CodeRollbackMismatch  = "ROLLBACK_MISMATCH"
+	CodeEditFailed        = "EDIT_FAILED"
+	CodeEditorNotFound    = "EDITOR_NOT_FOUND"
+	CodeConfigInvalid     = "CONFIG_INVALID"
+	CodeFormatUnsupported = "FORMAT_UNSUPPORTED"
+	CodeTreePathInvalid   = "TREE_PATH_INVALID"
+	CodeTreePathNotFound  = "TREE_PATH_NOT_FOUND"
+	CodePolicyViolation   = "POLICY_VIOLATION"
+	CodeWatchFailed       = "WATCH_FAILED"
+	CodeGitFailed         = "GIT_FAILED"
+	CodeArchiveFailed     = "ARCHIVE_FAILED"
+	CodeCheckoutFailed    = "CHECKOUT_FAILED"
+	CodeNoCheckout        = "CHECKOUT_NOT_FOUND"
+)
+
 // AppError represents an application error with context
 type AppError struct {
 	Type    ErrorType
+	Code    string
 	Message string
 	Cause   error
 	Data    map[string]interface{}
@@ -51,6 +136,53 @@ func (e *AppError) WithData(key string, value interface{}) *AppError {
 	return e
 }
 
+// WithCode sets the machine-readable error code
+func (e *AppError) WithCode(code string) *AppError {
+	e.Code = code
+	return e
+}
+
+// MarshalJSON encodes the error for machine consumption
+func (e *AppError) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Code    string                 `json:"code"`
+		Type    string                 `json:"type"`
+		Message string                 `json:"message"`
+		Cause   string                 `json:"cause,omitempty"`
+		Data    map[string]interface{} `json:"data,omitempty"`
+	}{
+		Code:    e.Code,
+		Type:    e.Type.String(),
+		Message: e.Message,
+		Data:    e.Data,
+	}
+	if out.Code == "" {
+		out.Code = CodeUnknown
+	}
+	if e.Cause != nil {
+		out.Cause = e.Cause.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Code returns the error code of the first AppError in err's chain
+func Code(err error) string {
+	var appErr *AppError
+	if stderrors.As(err, &appErr) && appErr.Code != "" {
+		return appErr.Code
+	}
+	return CodeUnknown
+}
+
+// ToJSON encodes any error as JSON, wrapping non-application errors
+func ToJSON(err error) ([]byte, error) {
+	var appErr *AppError
+	if !stderrors.As(err, &appErr) {
+		appErr = &AppError{Type: TypeGeneral, Code: CodeUnknown, Message: err.Error()}
+	}
+	return json.Marshal(appErr)
+}
+
 // New creates a new application error
 func New(errType ErrorType, message string) *AppError {
 	return &AppError{
@@ -0,0 +1,73 @@
+package filemanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// ErrUnavailable is returned when no file manager can be opened; callers
+// should show the path so it can be copied by hand
+var ErrUnavailable = errors.New("no file manager available")
+
+// Reveal shows path in the system file manager. A directory is opened; a
+// file is selected in its directory by Finder and Explorer, and its
+// directory is opened elsewhere. The file manager is started in the
+// background and not waited for, so it never takes over the terminal. Over
+// SSH, or without a graphical session, it would open on the remote machine
+// or not at all, so ErrUnavailable is returned instead.
+func Reveal(path string) error {
+	if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+		return fmt.Errorf("%w: running over SSH", ErrUnavailable)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %w", path, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+
+	args := command(runtime.GOOS, abs, info.IsDir())
+	if args[0] == "xdg-open" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("%w: no graphical session", ErrUnavailable)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("%w: install %s", ErrUnavailable, args[0])
+	}
+
+	// With no stdio of its own the file manager cannot write over the TUI
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// command is the file manager invocation that shows path on goos
+func command(goos, path string, isDir bool) []string {
+	switch goos {
+	case "darwin":
+		if isDir {
+			return []string{"open", path}
+		}
+		return []string{"open", "-R", path}
+	case "windows":
+		if isDir {
+			return []string{"explorer", path}
+		}
+		return []string{"explorer", "/select," + path}
+	default:
+		if !isDir {
+			path = filepath.Dir(path)
+		}
+		return []string{"xdg-open", path}
+	}
+}
+
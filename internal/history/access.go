@@ -0,0 +1,101 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// MaxAccesses bounds the decrypt history across all files; the oldest
+// decryptions are dropped first
+const MaxAccesses = 1000
+
+// Access records a successful decryption of a file: when, how, where the
+// plaintext went and the identity that opened it. It never holds any of the
+// plaintext.
+type Access struct {
+	Time     time.Time `json:"time"`
+	Path     string    `json:"path"`
+	Action   string    `json:"action"`             // decrypt, view, extract, export, edit or unpack
+	Output   string    `json:"output,omitempty"`   // The file or directory the plaintext was written to, if any
+	Identity string    `json:"identity,omitempty"` // The public key of the identity used, when it is known
+	Source   string    `json:"source,omitempty"`   // Where that identity was read from
+}
+
+// AccessesPath returns the location of the decrypt history, next to the history
+func AccessesPath() string {
+	return filepath.Join(filepath.Dir(Path()), "accesses.json")
+}
+
+// loadAccesses returns every recorded decryption, oldest first
+func loadAccesses() ([]Access, error) {
+	data, err := os.ReadFile(AccessesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var accesses []Access
+	if err := json.Unmarshal(data, &accesses); err != nil {
+		return nil, err
+	}
+	return accesses, nil
+}
+
+// Accesses returns the recorded decryptions of the file at path, newest first
+func Accesses(path string) ([]Access, error) {
+	all, err := loadAccesses()
+	if err != nil {
+		return nil, err
+	}
+
+	var accesses []Access
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Path == path {
+			accesses = append(accesses, all[i])
+		}
+	}
+	return accesses, nil
+}
+
+// RecordAccess appends a decryption, keeping at most MaxAccesses
+func RecordAccess(access Access) error {
+	if access.Time.IsZero() {
+		access.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	accesses, err := loadAccesses()
+	if err != nil {
+		// Start over rather than failing every decryption on a corrupt file
+		accesses = nil
+	}
+	accesses = append(accesses, access)
+	if len(accesses) > MaxAccesses {
+		accesses = accesses[len(accesses)-MaxAccesses:]
+	}
+
+	data, err := json.MarshalIndent(accesses, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := AccessesPath()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Checkout records an encrypted file decrypted to a working copy, to be
+// edited with other tools and checked back in
+type Checkout struct {
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"`       // The encrypted file
+	WorkingCopy string    `json:"working_copy"` // Where its plaintext was written
+}
+
+// CheckoutsPath returns the location of the outstanding checkouts, next to the history
+func CheckoutsPath() string {
+	return filepath.Join(filepath.Dir(Path()), "checkouts.json")
+}
+
+// Checkouts returns the recorded checkouts, oldest first
+func Checkouts() ([]Checkout, error) {
+	data, err := os.ReadFile(CheckoutsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkouts []Checkout
+	if err := json.Unmarshal(data, &checkouts); err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+// Outstanding returns the checkouts whose working copy is still on disk
+func Outstanding() []Checkout {
+	checkouts, err := Checkouts()
+	if err != nil {
+		return nil
+	}
+
+	var outstanding []Checkout
+	for _, c := range checkouts {
+		if utils.FileExists(c.WorkingCopy) {
+			outstanding = append(outstanding, c)
+		}
+	}
+	return outstanding
+}
+
+// FindCheckout returns the checkout of the working copy at path
+func FindCheckout(path string) (Checkout, bool) {
+	checkouts, _ := Checkouts()
+	for _, c := range checkouts {
+		if c.WorkingCopy == path {
+			return c, true
+		}
+	}
+	return Checkout{}, false
+}
+
+// AddCheckout records a checkout, replacing any earlier one of the same working copy
+func AddCheckout(checkout Checkout) error {
+	if checkout.Time.IsZero() {
+		checkout.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkouts := without(checkout.WorkingCopy)
+	return saveCheckouts(append(checkouts, checkout))
+}
+
+// RemoveCheckout forgets the checkout of the working copy at path
+func RemoveCheckout(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return saveCheckouts(without(path))
+}
+
+// without returns the recorded checkouts other than that of the working copy at path
+func without(path string) []Checkout {
+	// Start over rather than failing on a corrupt file
+	checkouts, _ := Checkouts()
+
+	var kept []Checkout
+	for _, c := range checkouts {
+		if c.WorkingCopy != path {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// saveCheckouts replaces the recorded checkouts
+func saveCheckouts(checkouts []Checkout) error {
+	if checkouts == nil {
+		checkouts = []Checkout{}
+	}
+	data, err := json.MarshalIndent(checkouts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := CheckoutsPath()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
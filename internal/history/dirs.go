@@ -0,0 +1,100 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// RecentDirsPath returns the location of the recently visited directories, next to the history
+func RecentDirsPath() string {
+	return filepath.Join(filepath.Dir(Path()), "recent_dirs.json")
+}
+
+// loadRecentDirs returns the recorded directories, most recent first
+func loadRecentDirs() ([]string, error) {
+	data, err := os.ReadFile(RecentDirsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	if err := json.Unmarshal(data, &dirs); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// RecentDirs returns up to n recently visited directories that still exist,
+// most recent first
+func RecentDirs(n int) []string {
+	dirs, err := loadRecentDirs()
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var existing []string
+	for _, dir := range dirs {
+		if len(existing) >= n {
+			break
+		}
+		if !seen[dir] && utils.DirExists(dir) {
+			seen[dir] = true
+			existing = append(existing, dir)
+		}
+	}
+	return existing
+}
+
+// VisitDir records dir as the most recently visited directory, keeping at
+// most n. Directories that no longer exist are dropped.
+func VisitDir(dir string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Start over rather than failing on a corrupt file
+	dirs, _ := loadRecentDirs()
+	if len(dirs) > 0 && dirs[0] == dir {
+		return nil
+	}
+
+	kept := []string{dir}
+	for _, d := range dirs {
+		if len(kept) >= n {
+			break
+		}
+		if d != dir && utils.DirExists(d) {
+			kept = append(kept, d)
+		}
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := RecentDirsPath()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,126 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// MaxEntries bounds the history; the oldest operations are dropped first
+const MaxEntries = 200
+
+// Operation records the parameters of a sops or age operation so it can be replayed
+type Operation struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`           // encrypt, decrypt, edit or rekey
+	Path       string    `json:"path"`             // The file, or the directory for rekey
+	Output     string    `json:"output,omitempty"` // Where encryption wrote a separate file, if not in place
+	Recipients []string  `json:"recipients,omitempty"`
+	OutputType string    `json:"output_type,omitempty"`
+	SkipBackup bool      `json:"skip_backup,omitempty"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// mu serialises updates from concurrent operations
+var mu sync.Mutex
+
+// Path returns the location of the history file
+func Path() string {
+	configDir, err := utils.ConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "supper-history.json")
+	}
+	return filepath.Join(configDir, "supper", "history.json")
+}
+
+// Load returns the recorded operations, oldest first. A missing history is empty.
+func Load() ([]Operation, error) {
+	data, err := os.ReadFile(Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// Record appends an operation and its outcome, keeping at most MaxEntries
+func Record(op Operation, opErr error) error {
+	if op.Time.IsZero() {
+		op.Time = time.Now()
+	}
+	op.Result = "ok"
+	if opErr != nil {
+		op.Result = "failed"
+		op.Error = opErr.Error()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	ops, err := Load()
+	if err != nil {
+		// Start over rather than failing every operation on a corrupt file
+		ops = nil
+	}
+	ops = append(ops, op)
+	if len(ops) > MaxEntries {
+		ops = ops[len(ops)-MaxEntries:]
+	}
+
+	data, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := Path()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// Replace the file in one step so a crash never leaves it half written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RecentFiles returns up to n distinct files touched by successful operations,
+// most recent first. An encryption that wrote a separate file is listed by
+// its output.
+func RecentFiles(n int) []string {
+	ops, err := Load()
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for i := len(ops) - 1; i >= 0 && len(files) < n; i-- {
+		op := ops[i]
+		if op.Result != "ok" || op.Action == "rekey" {
+			continue
+		}
+		path := op.Path
+		if op.Output != "" {
+			path = op.Output
+		}
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	return files
+}
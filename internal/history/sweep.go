@@ -0,0 +1,64 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Sweep records the outcome of the last integrity sweep of a directory tree
+type Sweep struct {
+	Time       time.Time `json:"time"`
+	Root       string    `json:"root"`
+	Verified   int       `json:"verified"`
+	Failed     int       `json:"failed"`
+	Unreadable int       `json:"unreadable"`
+}
+
+// SweepPath returns the location of the last sweep's record, next to the history
+func SweepPath() string {
+	return filepath.Join(filepath.Dir(Path()), "last-sweep.json")
+}
+
+// LastSweep returns the last recorded sweep, or nil when there has been none
+func LastSweep() (*Sweep, error) {
+	data, err := os.ReadFile(SweepPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sweep Sweep
+	if err := json.Unmarshal(data, &sweep); err != nil {
+		return nil, err
+	}
+	return &sweep, nil
+}
+
+// RecordSweep replaces the record of the last sweep
+func RecordSweep(sweep Sweep) error {
+	if sweep.Time.IsZero() {
+		sweep.Time = time.Now()
+	}
+
+	data, err := json.MarshalIndent(sweep, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := SweepPath()
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,131 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// pollInterval is how often Acquire retries while another instance holds the lock
+const pollInterval = 500 * time.Millisecond
+
+// ErrLocked is returned when another running instance holds the lock
+var ErrLocked = errors.New("another supper instance is running")
+
+// Holder describes the process that holds, or last held, the lock
+type Holder struct {
+	PID     int
+	Started time.Time
+}
+
+// String describes the holder for messages
+func (h Holder) String() string {
+	if h.PID == 0 {
+		return "unknown process"
+	}
+	if h.Started.IsZero() {
+		return fmt.Sprintf("pid %d", h.PID)
+	}
+	return fmt.Sprintf("pid %d, started %s", h.PID, h.Started.Format("15:04:05"))
+}
+
+// Lock is held by the running instance until Release is called. The lock is
+// tied to the open file, so a crashed process never leaves a lock behind;
+// only its pid remains in the file and is overwritten by the next instance.
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// Path returns the location of the lockfile for a configuration profile.
+// Profiles have their own keys, so each gets its own lock; the default
+// profile is the empty name.
+func Path(profile string) string {
+	name := "instance.lock"
+	if profile != "" {
+		name = "instance-" + profile + ".lock"
+	}
+	configDir, err := utils.ConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "supper-"+name)
+	}
+	return filepath.Join(configDir, "supper", name)
+}
+
+// TryAcquire takes the lock at path without waiting. If another instance
+// holds it the error wraps ErrLocked and the holder is returned.
+func TryAcquire(path string) (*Lock, Holder, error) {
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, Holder{}, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, Holder{}, err
+	}
+
+	holder := readHolder(file)
+	if err := tryLock(file, holder); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, holder, fmt.Errorf("%w (%s)", ErrLocked, holder)
+		}
+		return nil, holder, err
+	}
+
+	// Record ourselves for the next instance's messages
+	self := fmt.Sprintf("%d\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(self), 0)
+	}
+
+	return &Lock{file: file, path: path}, Holder{}, nil
+}
+
+// Acquire takes the lock at path, waiting while another instance holds it.
+// onWait is called once, with the holder, if Acquire has to wait.
+func Acquire(path string, onWait func(Holder)) (*Lock, error) {
+	waiting := false
+	for {
+		lock, holder, err := TryAcquire(path)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+		if !waiting && onWait != nil {
+			onWait(holder)
+		}
+		waiting = true
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release gives up the lock. It is safe to call on a nil Lock and more than once.
+func (l *Lock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Truncate(0)
+	unlock(l.file)
+	l.file.Close()
+	l.file = nil
+}
+
+// readHolder parses the pid and start time written by TryAcquire
+func readHolder(file *os.File) Holder {
+	data := make([]byte, 128)
+	n, _ := file.ReadAt(data, 0)
+	lines := strings.Split(string(data[:n]), "\n")
+
+	var h Holder
+	h.PID, _ = strconv.Atoi(strings.TrimSpace(lines[0]))
+	if len(lines) > 1 {
+		h.Started, _ = time.Parse(time.RFC3339, strings.TrimSpace(lines[1]))
+	}
+	return h
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package instance
+
+import "os"
+
+// tryLock treats the lock as held while the recorded process is still
+// running; a lock left by a crashed process is taken over
+func tryLock(_ *os.File, holder Holder) error {
+	if holder.PID == 0 || holder.PID == os.Getpid() {
+		return nil
+	}
+	if _, err := os.FindProcess(holder.PID); err == nil {
+		return ErrLocked
+	}
+	return nil
+}
+
+// unlock has nothing to release; Release clears the recorded pid
+func unlock(_ *os.File) {}
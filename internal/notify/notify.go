@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnavailable is returned when no desktop notification tool can be used
+var ErrUnavailable = errors.New("no desktop notifications available")
+
+// Bell rings the terminal bell. It writes to the terminal directly, so it
+// works while the TUI owns stdout.
+func Bell() error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal to ring: %w", err)
+	}
+	defer tty.Close()
+
+	if _, err := tty.WriteString("\a"); err != nil {
+		return fmt.Errorf("failed to ring the bell: %w", err)
+	}
+	return nil
+}
+
+// Desktop shows a desktop notification with notify-send or, on macOS,
+// osascript. Over SSH the notification would appear on the remote machine,
+// so ErrUnavailable is returned instead.
+func Desktop(title, message string) error {
+	if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+		return fmt.Errorf("%w: running over SSH", ErrUnavailable)
+	}
+
+	for _, args := range commands(title, message) {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: install notify-send", ErrUnavailable)
+}
+
+// commands are the notification tools tried in order
+func commands(title, message string) [][]string {
+	script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+	return [][]string{
+		{"notify-send", "--app-name", "supper", title, message},
+		{"osascript", "-e", script},
+	}
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,138 @@
+//go:build integration
+
+package recovery_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/recovery"
+)
+
+// Run with: make test-integration
+
+func TestIntegrationBackupsWithinOneSecond(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	path := filepath.Join(dir, "secrets.yaml")
+	bm := recovery.NewBackupManager(filepath.Join(dir, "backups"))
+	bm.MaxBackups = 3
+
+	// A legacy backup from a second-resolution name, taken earlier
+	legacy := filepath.Join(bm.BackupDir, "secrets.yaml-"+time.Now().Add(-time.Hour).Format("20060102-150405")+".bak")
+	if err := os.MkdirAll(bm.BackupDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("legacy"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	seen := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("version %d", i)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		backup, err := bm.BackupFile(path)
+		if err != nil {
+			t.Fatalf("BackupFile #%d: %v", i, err)
+		}
+		if seen[backup] {
+			t.Fatalf("BackupFile #%d reused the name %s", i, backup)
+		}
+		seen[backup] = true
+	}
+	if time.Since(start) >= time.Second {
+		t.Skip("the backups took over a second, so they did not share one")
+	}
+
+	// Only the newest MaxBackups survive cleanup, and the legacy one is the oldest
+	entries, err := os.ReadDir(bm.BackupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".bak") {
+			data, err := os.ReadFile(filepath.Join(bm.BackupDir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept = append(kept, string(data))
+		}
+	}
+	want := map[string]bool{"version 3": true, "version 4": true, "version 5": true}
+	if len(kept) != len(want) {
+		t.Fatalf("kept backups %q, want %d", kept, len(want))
+	}
+	for _, content := range kept {
+		if !want[content] {
+			t.Fatalf("kept backups %q, want the last three versions", kept)
+		}
+	}
+
+	// Restoring picks the newest one, not the last name in string order
+	if err := os.WriteFile(path, []byte("damaged"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bm.RestoreFromBackup(path); err != nil {
+		t.Fatalf("RestoreFromBackup: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "version 5" {
+		t.Fatalf("restored %q, want %q", data, "version 5")
+	}
+}
+
+func TestIntegrationRollbackThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	target := filepath.Join(dir, "secrets.yaml")
+	if err := os.WriteFile(target, []byte("original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	tm := recovery.NewTransactionManager()
+	if err := tm.Begin(link); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := os.WriteFile(link, []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s was replaced by a regular file", link)
+	}
+	if dest, err := os.Readlink(link); err != nil || dest != target {
+		t.Fatalf("link points to %q (%v), want %s", dest, err, target)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "original" {
+		t.Fatalf("target holds %q after rollback, want %q", data, "original")
+	}
+}
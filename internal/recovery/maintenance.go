@@ -0,0 +1,194 @@
+package recovery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// metaSuffix is appended to a backup's path to name its metadata file
+const metaSuffix = ".json"
+
+// Backup describes a backup file and the original it was taken from
+type Backup struct {
+	Path     string    `json:"-"`
+	Source   string    `json:"source"`
+	Created  time.Time `json:"created"`
+	Checksum string    `json:"checksum"`
+	Reason   string    `json:"-"` // Why the backup is considered prunable
+}
+
+// metaPath returns the metadata path for a backup
+func metaPath(backupPath string) string {
+	return backupPath + metaSuffix
+}
+
+// writeBackupMeta records the source and checksum of a new backup
+func writeBackupMeta(source, backupPath string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := utils.FileChecksum(backupPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(Backup{
+		Source:   absSource,
+		Created:  time.Now(),
+		Checksum: checksum,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath(backupPath), data, 0o600)
+}
+
+// readBackupMeta loads the metadata of a backup
+func readBackupMeta(backupPath string) (*Backup, error) {
+	data, err := os.ReadFile(metaPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	backup.Path = backupPath
+	return &backup, nil
+}
+
+// ListBackups returns all backups that have metadata, oldest first
+func (bm *BackupManager) ListBackups() ([]Backup, error) {
+	if !utils.DirExists(bm.BackupDir) {
+		return nil, nil
+	}
+
+	files, err := os.ReadDir(bm.BackupDir)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read backup directory").WithCode(errors.CodeBackupFailed).WithData("directory", bm.BackupDir)
+	}
+
+	var backups []Backup
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".bak") {
+			continue
+		}
+
+		// Backups without metadata predate it; their source is unknown so they are left alone
+		backup, err := readBackupMeta(filepath.Join(bm.BackupDir, file.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, *backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.Before(backups[j].Created)
+	})
+
+	return backups, nil
+}
+
+// FindOrphans returns backups that can be pruned: those whose original no
+// longer exists and older duplicates of identical content. When activeRoots is
+// non-empty only originals under those roots are considered. Unless purge is
+// set, the most recent backup of each missing original is kept.
+func (bm *BackupManager) FindOrphans(activeRoots []string, purge bool) ([]Backup, error) {
+	backups, err := bm.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	// Group backups by original, newest first
+	bySource := make(map[string][]Backup)
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		if !underRoots(b.Source, activeRoots) {
+			continue
+		}
+		bySource[b.Source] = append(bySource[b.Source], b)
+	}
+
+	var orphans []Backup
+	for source, group := range bySource {
+		sourceExists := utils.FileExists(source)
+		seen := make(map[string]bool)
+
+		for i, b := range group {
+			switch {
+			case !sourceExists && (purge || i > 0):
+				b.Reason = "original missing"
+				orphans = append(orphans, b)
+			case seen[b.Checksum]:
+				b.Reason = "duplicate of a newer backup"
+				orphans = append(orphans, b)
+			}
+			seen[b.Checksum] = true
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Path < orphans[j].Path
+	})
+
+	return orphans, nil
+}
+
+// RemoveBackups deletes the given backups and their metadata
+func (bm *BackupManager) RemoveBackups(backups []Backup) (int, error) {
+	removed := 0
+	var lastErr error
+
+	for _, b := range backups {
+		if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+			lastErr = errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to remove backup").WithCode(errors.CodeFileDeleteFailed).WithData("backup", b.Path)
+			continue
+		}
+		os.Remove(metaPath(b.Path))
+		removed++
+	}
+
+	return removed, lastErr
+}
+
+// PruneOrphans removes backups whose original no longer exists, keeping the
+// most recent backup of each missing original, and duplicate backups
+func PruneOrphans(activeRoots []string) (removed int, err error) {
+	bm := NewBackupManager("")
+	orphans, err := bm.FindOrphans(activeRoots, false)
+	if err != nil {
+		return 0, err
+	}
+	return bm.RemoveBackups(orphans)
+}
+
+// underRoots reports whether path lies under one of roots (or roots is empty)
+func underRoots(path string, roots []string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absRoot, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
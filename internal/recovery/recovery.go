@@ -5,12 +5,25 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bxtal-lsn/supper/internal/config"
 	"github.com/bxtal-lsn/supper/internal/errors"
 	"github.com/bxtal-lsn/supper/internal/utils"
 )
 
+// Backups are named <file>-<timestamp>.bak. The timestamp has nanoseconds,
+// so backups taken within the same second, as in watch mode, stay apart;
+// backups from before carried whole seconds only. Should two still land on
+// the same instant, the later one gets a -<n> counter before .bak.
+const (
+	backupTimeFormat       = "20060102-150405.000000000"
+	legacyBackupTimeFormat = "20060102-150405"
+)
+
 // BackupManager handles automatic backups and recovery
 type BackupManager struct {
 	BackupDir  string
@@ -21,7 +34,7 @@ type BackupManager struct {
 func NewBackupManager(backupDir string) *BackupManager {
 	if backupDir == "" {
 		// Use default directory in user's config
-		configDir, err := os.UserConfigDir()
+		configDir, err := utils.ConfigDir()
 		if err == nil {
 			backupDir = filepath.Join(configDir, "supper", "backups")
 		} else {
@@ -41,24 +54,36 @@ func (bm *BackupManager) BackupFile(filePath string) (string, error) {
 	// Ensure backup directory exists
 	if err := os.MkdirAll(bm.BackupDir, 0o700); err != nil {
 		return "", errors.Wrap(err, errors.TypeFileOperation,
-			"Failed to create backup directory")
+			"Failed to create backup directory").WithCode(errors.CodeBackupFailed)
 	}
 
 	// Check if original file exists
 	if !utils.FileExists(filePath) {
 		return "", errors.New(errors.TypeFileOperation,
-			"Cannot backup non-existent file").WithData("path", filePath)
+			"Cannot backup non-existent file").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
 	}
 
-	// Create backup filename with timestamp
-	timestamp := time.Now().Format("20060102-150405")
+	// Claim a name no other backup has, even one taken at the same instant
 	fileName := filepath.Base(filePath)
-	backupPath := filepath.Join(bm.BackupDir, fmt.Sprintf("%s-%s.bak", fileName, timestamp))
+	backupPath, err := bm.reserveBackupPath(fileName, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to create backup").WithCode(errors.CodeBackupFailed).WithData("source", filePath)
+	}
 
-	// Copy the file
+	// Copy the file; an interrupted copy is not left behind as a backup
 	if err := utils.CopyFile(filePath, backupPath); err != nil {
+		os.Remove(backupPath)
 		return "", errors.Wrap(err, errors.TypeFileOperation,
-			"Failed to create backup").WithData("source", filePath).WithData("destination", backupPath)
+			"Failed to create backup").WithCode(errors.CodeBackupFailed).WithData("source", filePath).WithData("destination", backupPath)
+	}
+
+	// Record where the backup came from so orphans can be detected later
+	if err := writeBackupMeta(filePath, backupPath); err != nil {
+		os.Remove(backupPath)
+		os.Remove(metaPath(backupPath))
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to record backup metadata").WithCode(errors.CodeBackupFailed).WithData("backup", backupPath)
 	}
 
 	// Clean up old backups
@@ -78,23 +103,82 @@ func (bm *BackupManager) RestoreFromBackup(filePath string) (string, error) {
 
 	if len(backupFiles) == 0 {
 		return "", errors.New(errors.TypeFileOperation,
-			"No backups found for file").WithData("file", fileName)
+			"No backups found for file").WithCode(errors.CodeNoBackup).WithData("file", fileName)
 	}
 
-	// Most recent backup is the last one (due to sorting by name/date)
+	// Most recent backup is the last one (findBackups sorts by time taken)
 	mostRecentBackup := backupFiles[len(backupFiles)-1]
 	backupPath := filepath.Join(bm.BackupDir, mostRecentBackup)
 
 	// Restore the file
 	if err := utils.CopyFile(backupPath, filePath); err != nil {
 		return "", errors.Wrap(err, errors.TypeFileOperation,
-			"Failed to restore from backup").WithData("backup", backupPath).WithData("destination", filePath)
+			"Failed to restore from backup").WithCode(errors.CodeRestoreFailed).WithData("backup", backupPath).WithData("destination", filePath)
 	}
 
 	return backupPath, nil
 }
 
-// findBackups returns a list of backup files for a given filename, sorted by date
+// reserveBackupPath creates an empty file under the first free backup name
+// of fileName for the time now, so concurrent backups of files with the same
+// name cannot overwrite each other
+func (bm *BackupManager) reserveBackupPath(fileName string, now time.Time) (string, error) {
+	for seq := 0; ; seq++ {
+		path := filepath.Join(bm.BackupDir, backupName(fileName, now, seq))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			return path, file.Close()
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// backupName names the seq-th backup of fileName taken at t
+func backupName(fileName string, t time.Time, seq int) string {
+	name := fileName + "-" + t.Format(backupTimeFormat)
+	if seq > 0 {
+		name += "-" + strconv.Itoa(seq)
+	}
+	return name + ".bak"
+}
+
+// parseBackupName reads the time and counter out of the name of a backup of
+// fileName, in the current or the legacy format. ok is false for names that
+// are not backups of fileName, such as those of a longer name it is a
+// prefix of.
+func parseBackupName(fileName, name string) (t time.Time, seq int, ok bool) {
+	rest, found := strings.CutPrefix(name, fileName+"-")
+	if !found {
+		return time.Time{}, 0, false
+	}
+	rest, found = strings.CutSuffix(rest, ".bak")
+	if !found {
+		return time.Time{}, 0, false
+	}
+
+	if t, err := time.ParseInLocation(legacyBackupTimeFormat, rest, time.Local); err == nil {
+		return t, 0, true
+	}
+	if len(rest) < len(backupTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, rest[:len(backupTimeFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if counter := rest[len(backupTimeFormat):]; counter != "" {
+		seq, err = strconv.Atoi(strings.TrimPrefix(counter, "-"))
+		if err != nil || !strings.HasPrefix(counter, "-") || seq < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return t, seq, true
+}
+
+// findBackups returns the backup files of a given filename, oldest first by
+// the time in their names
 func (bm *BackupManager) findBackups(fileName string) ([]string, error) {
 	// Ensure backup directory exists
 	if !utils.DirExists(bm.BackupDir) {
@@ -105,22 +189,36 @@ func (bm *BackupManager) findBackups(fileName string) ([]string, error) {
 	files, err := os.ReadDir(bm.BackupDir)
 	if err != nil {
 		return nil, errors.Wrap(err, errors.TypeFileOperation,
-			"Failed to read backup directory").WithData("directory", bm.BackupDir)
+			"Failed to read backup directory").WithCode(errors.CodeBackupFailed).WithData("directory", bm.BackupDir)
 	}
 
-	// Filter and sort backup files
-	prefix := fileName + "-"
-	suffix := ".bak"
-	var backups []string
-
+	// Filter and sort backup files. Names cannot be compared as strings:
+	// a legacy name sorts after a newer one from the same second.
+	type backup struct {
+		name string
+		time time.Time
+		seq  int
+	}
+	var found []backup
 	for _, file := range files {
-		name := file.Name()
-		if !file.IsDir() && len(name) > len(prefix)+len(suffix) &&
-			name[:len(prefix)] == prefix && name[len(name)-len(suffix):] == suffix {
-			backups = append(backups, name)
+		if file.IsDir() {
+			continue
+		}
+		if t, seq, ok := parseBackupName(fileName, file.Name()); ok {
+			found = append(found, backup{file.Name(), t, seq})
 		}
 	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].time.Equal(found[j].time) {
+			return found[i].time.Before(found[j].time)
+		}
+		return found[i].seq < found[j].seq
+	})
 
+	backups := make([]string, len(found))
+	for i, b := range found {
+		backups[i] = b.name
+	}
 	return backups, nil
 }
 
@@ -136,6 +234,7 @@ func (bm *BackupManager) cleanupOldBackups(fileName string) error {
 		// Delete oldest backups (those at the beginning of the slice)
 		for i := 0; i < len(backups)-bm.MaxBackups; i++ {
 			backupPath := filepath.Join(bm.BackupDir, backups[i])
+			os.Remove(metaPath(backupPath))
 			if err := os.Remove(backupPath); err != nil {
 				// Just log the error but continue
 				fmt.Fprintf(os.Stderr, "Failed to delete old backup %s: %v\n", backupPath, err)
@@ -146,23 +245,63 @@ func (bm *BackupManager) cleanupOldBackups(fileName string) error {
 	return nil
 }
 
+// ShouldBackup reports whether a file should be backed up, given the
+// configured no-backup patterns and maximum backup size (0 means no limit)
+func ShouldBackup(filePath string, noBackupPatterns []string, maxSize int64) bool {
+	name := filepath.Base(filePath)
+	for _, pattern := range noBackupPatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern, filePath); matched {
+			return false
+		}
+	}
+
+	// Oversized files are skipped like files matching a no-backup pattern
+	if maxSize > 0 {
+		if info, err := os.Stat(filePath); err == nil && info.Size() > maxSize {
+			return false
+		}
+	}
+
+	return true
+}
+
 // TransactionManager handles file operations with backup and rollback
 type TransactionManager struct {
-	backupManager *BackupManager
-	backupPaths   map[string]string
+	backupManager    *BackupManager
+	backupPaths      map[string]string
+	enabled          bool
+	noBackupPatterns []string
+	maxBackupSize    int64
 }
 
 // NewTransactionManager creates a new transaction manager
 func NewTransactionManager() *TransactionManager {
+	// Backup policy comes from the configuration, falling back to the defaults
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
 	return &TransactionManager{
-		backupManager: NewBackupManager(""),
-		backupPaths:   make(map[string]string),
+		backupManager:    NewBackupManager(""),
+		backupPaths:      make(map[string]string),
+		enabled:          cfg.EnableBackups,
+		noBackupPatterns: cfg.NoBackupPatterns,
+		maxBackupSize:    cfg.MaxFileSizeWarning,
 	}
 }
 
-// Begin starts a new transaction by backing up files
+// Begin starts a new transaction by backing up files. With backups disabled
+// in the configuration nothing is backed up, the backup directory is not
+// created and Rollback has nothing to restore.
 func (tm *TransactionManager) Begin(filePaths ...string) error {
 	tm.backupPaths = make(map[string]string)
+	if !tm.enabled {
+		return nil
+	}
 
 	for _, path := range filePaths {
 		// Skip non-existent files
@@ -170,6 +309,11 @@ func (tm *TransactionManager) Begin(filePaths ...string) error {
 			continue
 		}
 
+		// Skip files excluded from backups by pattern or size
+		if !ShouldBackup(path, tm.noBackupPatterns, tm.maxBackupSize) {
+			continue
+		}
+
 		// Create backup
 		backupPath, err := tm.backupManager.BackupFile(path)
 		if err != nil {
@@ -189,19 +333,63 @@ func (tm *TransactionManager) Commit() {
 	tm.backupPaths = make(map[string]string)
 }
 
-// Rollback restores files from backups
+// Rollback restores files from backups. Each restored file is checked
+// against the checksum recorded when its backup was taken, so a rollback that
+// reports no error has put back exactly what was there before; otherwise the
+// error names the file whose state is uncertain.
 func (tm *TransactionManager) Rollback() error {
 	var lastErr error
 
 	for path, backupPath := range tm.backupPaths {
-		if utils.FileExists(backupPath) {
-			if err := utils.CopyFile(backupPath, path); err != nil {
-				lastErr = errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to restore file during rollback").WithData("path", path)
-			}
+		if !utils.FileExists(backupPath) {
+			lastErr = errors.New(errors.TypeFileOperation,
+				"Backup disappeared before rollback; the file was not restored").
+				WithCode(errors.CodeRollbackFailed).WithData("path", path).WithData("backup", backupPath)
+			continue
+		}
+
+		// A backup that no longer matches its checksum would only swap one
+		// damaged file for another, so it is left in place for inspection
+		meta, err := readBackupMeta(backupPath)
+		if err != nil {
+			lastErr = errors.Wrap(err, errors.TypeFileOperation,
+				"Cannot verify the backup without its recorded checksum; the file was not restored").
+				WithCode(errors.CodeRollbackFailed).WithData("path", path).WithData("backup", backupPath)
+			continue
+		}
+		if err := verifyChecksum(backupPath, meta.Checksum); err != nil {
+			lastErr = errors.Wrap(err, errors.TypeFileOperation,
+				"Backup is damaged; the file was not restored").
+				WithCode(errors.CodeRollbackMismatch).WithData("path", path).WithData("backup", backupPath)
+			continue
+		}
+
+		// Write through symlinks so a link is never replaced by a regular file
+		target := utils.RealPath(path)
+		if err := utils.CopyFile(backupPath, target); err != nil {
+			lastErr = errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to restore file during rollback").WithCode(errors.CodeRollbackFailed).WithData("path", path)
+			continue
+		}
+		if err := verifyChecksum(target, meta.Checksum); err != nil {
+			lastErr = errors.Wrap(err, errors.TypeFileOperation,
+				"Restored file does not match its backup; its contents are uncertain").
+				WithCode(errors.CodeRollbackMismatch).WithData("path", path).WithData("backup", backupPath)
 		}
 	}
 
 	return lastErr
 }
 
+// verifyChecksum checks that the file at path has the expected checksum
+func verifyChecksum(path, expected string) error {
+	actual, err := utils.FileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum %s, expected %s", actual, expected)
+	}
+	return nil
+}
+
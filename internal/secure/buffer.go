@@ -0,0 +1,46 @@
+package secure
+
+import (
+	"sync"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Buffer holds a secret in memory that can be wiped once it is no longer
+// needed. The bytes are never handed out, only lent to a callback, so no
+// reference outlives Wipe.
+//
+// Wiping only clears this copy: the Go runtime may have left others behind,
+// for example when the secret once lived in a string, and the memory can
+// still be swapped to disk.
+type Buffer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewBuffer takes ownership of data; the caller must not keep using it
+func NewBuffer(data []byte) *Buffer {
+	return &Buffer{data: data}
+}
+
+// Use calls fn with the secret. fn must not retain the slice.
+func (b *Buffer) Use(fn func(secret []byte) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fn(b.data)
+}
+
+// Len returns the length of the secret, zero once wiped
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.data)
+}
+
+// Wipe zeroes the secret and releases it. It is safe to call more than once.
+func (b *Buffer) Wipe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	utils.WipeBytes(b.data)
+	b.data = nil
+}
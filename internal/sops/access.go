@@ -0,0 +1,121 @@
+package sops
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/history"
+)
+
+// untracked keeps a decryption out of the decrypt history, for checks such as
+// an integrity sweep that hand no plaintext to anyone, and for operations
+// that record their own
+func untracked() Option {
+	return func(o *options) {
+		o.untracked = true
+	}
+}
+
+// AccessHistory returns the recorded decryptions of the file at filePath,
+// newest first, so it can be told who last read it with this tool and when
+func AccessHistory(filePath string) ([]history.Access, error) {
+	resolved, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return history.Accesses(accessKey(resolved))
+}
+
+// recordAccess adds a successful decryption of filePath to the decrypt
+// history with the identity that most likely opened it. A history that
+// cannot be written does not fail the decryption.
+func (o *options) recordAccess(filePath, action, output string) {
+	if o.untracked {
+		return
+	}
+	access := history.Access{Path: accessKey(filePath), Action: action}
+	if output != "" {
+		access.Output = accessKey(output)
+	}
+	if c, ok := o.usedIdentity(filePath); ok {
+		access.Identity = c.PublicKey
+		access.Source = c.Source
+	}
+	history.RecordAccess(access)
+}
+
+// usedIdentity returns the identity that decrypted filePath: the first of
+// those the operation gave sops that is a recipient of the file, or the only
+// one when the file's recipients cannot be read, as with a file encrypted
+// with age itself
+func (o *options) usedIdentity(filePath string) (age.Candidate, bool) {
+	var candidates []age.Candidate
+	for _, s := range o.identitySources() {
+		found, err := s.identity().Candidates(s.name)
+		if err == nil {
+			candidates = age.AppendCandidates(candidates, found...)
+		}
+	}
+
+	if matching := MatchingIdentities(filePath, candidates); len(matching) > 0 {
+		return matching[0], true
+	}
+	if len(candidates) == 1 && candidates[0].PublicKey != "" {
+		return candidates[0], true
+	}
+	return age.Candidate{}, false
+}
+
+// identitySource is an identity sops reads, an inline secret key or a key
+// file, and where it comes from
+type identitySource struct {
+	key  string
+	file string
+	name string
+}
+
+// identity returns the source as an identity to hand to a command
+func (s identitySource) identity() age.Identity {
+	if s.key != "" {
+		return age.WithInlineIdentity(s.key)
+	}
+	return age.WithIdentityFile(s.file)
+}
+
+// identitySources lists the age identities sops finds in the operation's
+// environment, in the order it tries them: SOPS_AGE_KEY, SOPS_AGE_KEY_FILE
+// and its default key file, under XDG_CONFIG_HOME when that is set
+func (o *options) identitySources() []identitySource {
+	env := make(map[string]string)
+	for _, entry := range append(o.baseEnv(), o.env...) {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+
+	var sources []identitySource
+	if key := strings.TrimSpace(env[age.EnvSOPSAgeKey]); key != "" {
+		sources = append(sources, identitySource{key: key, name: age.EnvSOPSAgeKey})
+	}
+	if file := env[age.EnvSOPSAgeKeyFile]; file != "" {
+		sources = append(sources, identitySource{file: file, name: file})
+	}
+	path, err := age.DefaultKeyPath()
+	if dir := env["XDG_CONFIG_HOME"]; dir != "" {
+		path, err = filepath.Join(dir, "sops", "age", "keys.txt"), nil
+	}
+	if err == nil {
+		sources = append(sources, identitySource{file: path, name: path})
+	}
+	return sources
+}
+
+// accessKey is the form a path is recorded in, so that every way of naming
+// a file finds the same history
+func accessKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
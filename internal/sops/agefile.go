@@ -0,0 +1,113 @@
+package sops
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// The headers a file encrypted with age itself starts with, in the binary
+// format and in the ASCII armor
+const (
+	ageBinaryHeader = "age-encryption.org/"
+	ageArmorHeader  = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// IsAgeFile reports whether the file at path was encrypted with age directly,
+// by age or another tool writing its format, rather than by sops. Such files
+// have no sops metadata, so sops cannot open them.
+func IsAgeFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 256)
+	n, _ := io.ReadFull(file, header)
+	// The armor may follow leading whitespace
+	header = bytes.TrimLeft(header[:n], " \t\r\n")
+	return bytes.HasPrefix(header, []byte(ageBinaryHeader)) || bytes.HasPrefix(header, []byte(ageArmorHeader))
+}
+
+// decryptAgeFile decrypts a file IsAgeFile accepts by running age -d with the
+// identities sops would use, and writes the plaintext to plaintextPath, which
+// is filePath itself when decrypting in place, or to the operation's stdout
+// when it is empty. The checks DecryptFile makes on the paths come first.
+func decryptAgeFile(filePath, plaintextPath string, o *options) error {
+	if _, err := exec.LookPath("age"); err != nil {
+		return errors.Wrap(err, errors.TypeConfig, "age is not installed, and files encrypted with age itself need it").
+			WithCode(errors.CodeAgeNotInstalled)
+	}
+	identityArgs, inline := o.ageIdentityArgs()
+	if len(identityArgs) == 0 {
+		return errors.New(errors.TypeSecurity, "No age identity to decrypt the file with").
+			WithCode(errors.CodeAgeInvalidIdentity).WithData("path", filePath)
+	}
+
+	tm := recovery.NewTransactionManager()
+	if plaintextPath == filePath {
+		if err := checkWritable(filePath); err != nil {
+			return err
+		}
+		if err := o.begin(tm, filePath); err != nil {
+			return err
+		}
+	}
+
+	cmd := o.commandFor("age", append(append([]string{"-d"}, identityArgs...), filePath)...)
+	if inline != "" {
+		cmd.Stdin = strings.NewReader(inline)
+	}
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	defer func() { utils.WipeBytes(out.Bytes()) }()
+
+	if err := cmd.Run(); err != nil {
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Decryption cancelled").WithCode(errors.CodeCancelled)
+		}
+		if strings.Contains(errOut.String(), "no identity matched") {
+			return errors.New(errors.TypeSecurity, "None of your age identities can decrypt this age-encrypted file").
+				WithCode(errors.CodeAgeDecryptFailed).WithData("path", filePath)
+		}
+		return errors.Wrap(err, errors.TypeSecurity, "age failed to decrypt the file").
+			WithCode(errors.CodeAgeDecryptFailed).WithData("path", filePath).WithData("details", errOut.String())
+	}
+
+	if plaintextPath == "" {
+		_, err := o.stdout.Write(out.Bytes())
+		return err
+	}
+	// writePlaintext replaces the file in one step, so a failed write leaves
+	// the encrypted file as it was and there is nothing to roll back
+	if err := writePlaintext(plaintextPath, out.Bytes()); err != nil {
+		return err
+	}
+	tm.Commit()
+	return nil
+}
+
+// ageIdentityArgs returns the -i arguments that give age the identities sops
+// would use in the operation's environment, and the inline secret key to feed
+// age on stdin when SOPS_AGE_KEY holds one
+func (o *options) ageIdentityArgs() (args []string, inline string) {
+	for _, s := range o.identitySources() {
+		switch {
+		case s.key != "":
+			args = append(args, "-i", "-")
+			inline = s.key + "\n"
+		case utils.FileExists(s.file):
+			args = append(args, "-i", s.file)
+		}
+	}
+	return args, inline
+}
+
@@ -0,0 +1,293 @@
+package sops
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// ArchiveSuffix ends the name of an encrypted directory archive
+const ArchiveSuffix = ".tar.sops"
+
+// ArchiveResult describes a directory sealed into an archive or restored
+// from one
+type ArchiveResult struct {
+	Files   int      // Regular files archived or restored
+	Bytes   int64    // Their total size
+	Skipped []string // Symlinks and special files, which are left out
+}
+
+// Summary describes the result in one line
+func (r *ArchiveResult) Summary() string {
+	summary := fmt.Sprintf("%d file(s), %s", r.Files, utils.FormatSize(r.Bytes))
+	if len(r.Skipped) > 0 {
+		summary += fmt.Sprintf(", %d symlink(s) or special file(s) skipped", len(r.Skipped))
+	}
+	return summary
+}
+
+// IsArchive reports whether path names an encrypted directory archive
+func IsArchive(path string) bool {
+	return strings.HasSuffix(path, ArchiveSuffix) && len(filepath.Base(path)) > len(ArchiveSuffix)
+}
+
+// ArchivePath returns where a directory is archived by default:
+// <dir>.tar.sops beside it
+func ArchivePath(dir string) string {
+	return filepath.Clean(dir) + ArchiveSuffix
+}
+
+// ArchiveDir returns where an archive is restored by default: its path
+// without the suffix
+func ArchiveDir(archivePath string) string {
+	return strings.TrimSuffix(archivePath, ArchiveSuffix)
+}
+
+// DirSize counts the regular files under dir and adds up their sizes, so a
+// large directory can be warned about before it is archived
+func DirSize(dir string) (files int, size int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	return files, size, err
+}
+
+// EncryptDir seals every file under dir into a single encrypted archive at
+// outputPath. The directory is written as a tar stream straight into sops as
+// binary data, so the plaintext archive never touches the disk. Symlinks and
+// special files are skipped and listed in the result. An existing archive is
+// only replaced once the new one is complete.
+func EncryptDir(dir, outputPath string, recipients []age.Recipient, opts ...Option) (*ArchiveResult, error) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, errors.New(errors.TypeFileOperation, "Not a directory").
+			WithCode(errors.CodeFileNotFound).WithData("path", dir)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), ".supper-archive-*")
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to create the archive").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	defer os.Remove(tmp.Name())
+
+	// The archive may be written inside the directory it seals
+	skip := map[string]bool{}
+	for _, path := range []string{outputPath, tmp.Name()} {
+		if abs, err := filepath.Abs(path); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	result := &ArchiveResult{}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := writeTar(dir, skip, pw, result)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	err = EncryptStream(pr, FormatBinary, recipients, tmp, opts...)
+	// Unblock the tar writer if sops stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	tarErr := <-done
+	closeErr := tmp.Close()
+
+	switch {
+	case tarErr != nil:
+		return nil, errors.Wrap(tarErr, errors.TypeFileOperation, "Failed to read the directory").
+			WithCode(errors.CodeArchiveFailed).WithData("path", dir)
+	case err != nil:
+		return nil, err
+	case closeErr != nil:
+		return nil, errors.Wrap(closeErr, errors.TypeFileOperation, "Failed to write the archive").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to write the archive").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	return result, nil
+}
+
+// writeTar writes the files under dir to w as a tar stream, with paths
+// relative to dir
+func writeTar(dir string, skip map[string]bool, w io.Writer, result *ArchiveResult) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			result.Skipped = append(result.Skipped, rel)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		// Owners mean nothing on the machine the archive is restored on
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		n, err := io.Copy(tw, file)
+		if err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// DecryptArchive restores the directory sealed in an archive by EncryptDir
+// into destDir, which must not exist yet. The decrypted tar stream is
+// unpacked as it comes out of sops and never written to disk as a whole.
+// Entries that would land outside destDir are refused, and a restore that
+// fails part way removes what it wrote.
+func DecryptArchive(archivePath, destDir string, opts ...Option) (*ArchiveResult, error) {
+	if _, err := os.Lstat(destDir); err == nil {
+		return nil, errors.New(errors.TypeFileOperation, "The destination already exists; move it away or choose another").
+			WithCode(errors.CodeFileExists).WithData("path", destDir)
+	}
+
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to open the archive").
+			WithCode(errors.CodeFileNotFound).WithData("path", archivePath)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(destDir, 0o700); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to create the destination").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", destDir)
+	}
+
+	result := &ArchiveResult{}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := readTar(pr, destDir, result)
+		// Let sops finish writing if the stream ended early
+		pr.CloseWithError(io.ErrClosedPipe)
+		done <- err
+	}()
+
+	err = DecryptStream(in, FormatBinary, pw, opts...)
+	pw.CloseWithError(err)
+	tarErr := <-done
+
+	if err != nil || tarErr != nil {
+		os.RemoveAll(destDir)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(tarErr, errors.TypeFileOperation, "Failed to restore the archive").
+			WithCode(errors.CodeArchiveFailed).WithData("path", archivePath)
+	}
+
+	newOptions(opts).recordAccess(archivePath, "unpack", destDir)
+	return result, nil
+}
+
+// readTar unpacks a tar stream into destDir
+func readTar(r io.Reader, destDir string, result *ArchiveResult) error {
+	tr := tar.NewReader(r)
+	root := filepath.Clean(destDir) + string(filepath.Separator)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target+string(filepath.Separator), root) {
+			return fmt.Errorf("entry %q lies outside the destination", header.Name)
+		}
+		perm := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, perm|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(file, tr)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+			result.Files++
+			result.Bytes += n
+		default:
+			result.Skipped = append(result.Skipped, header.Name)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package sops
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// ReEncryptTree re-keys every encrypted file under dir so that it is
+// encrypted to exactly the given recipients. Only the kinds of key among
+// recipients are changed: re-keying to age keys alone keeps each file's PGP
+// and KMS keys. Hidden directories, and the files outside a WithGitScope
+// scope, are skipped. A cancelled context stops the walk after the current
+// file.
+func ReEncryptTree(dir string, recipients []age.Recipient, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	git, err := newGitFilter(dir, o.gitScope)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Operation: "rekey", Root: dir, Started: time.Now()}
+
+	// Links and their targets can both be in the tree; re-key each file once
+	seen := make(map[string]bool)
+	queue := NewQueue(1, o.jobs)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if o.ctx.Err() != nil {
+			return o.ctx.Err()
+		}
+		if d.IsDir() {
+			if (path != dir && strings.HasPrefix(d.Name(), ".")) || git.excludes(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if git.excludes(path, false) {
+			return nil
+		}
+
+		info, err := fileInfo(o, path)
+		if err != nil || !info.Encrypted {
+			return nil
+		}
+
+		target, err := ResolvePath(path)
+		if err != nil {
+			current := age.RecipientTokens(info.AllRecipients())
+			report.Files = append(report.Files, FileResult{Path: path, Status: StatusSkipped, OldRecipients: current, NewRecipients: current, Error: err.Error()})
+			return nil
+		}
+		if seen[target] {
+			return nil
+		}
+		seen[target] = true
+
+		// One file at a time, but never while another operation writes it
+		current := info.AllRecipients()
+		result := FileResult{Path: target, Status: StatusSkipped, Error: "cancelled"}
+		queue.Do(o.ctx, Task{Operation: "rekey", Path: target, Run: func(context.Context) error {
+			result = rekeyFile(o, target, current, keepOtherKinds(current, recipients))
+			return resultError(result)
+		}})
+		report.Files = append(report.Files, result)
+		return nil
+	})
+
+	report.Duration = time.Since(report.Started)
+
+	if err != nil {
+		if o.ctx.Err() != nil {
+			return report, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Re-keying cancelled").WithCode(errors.CodeCancelled)
+		}
+		return report, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to scan directory").WithCode(errors.CodeFileNotFound).WithData("directory", dir)
+	}
+
+	return report, nil
+}
+
+// rekeyFile rotates the data key of a file while adding and removing
+// recipients so the file ends up with exactly the wanted set
+func rekeyFile(o *options, path string, oldRecipients, newRecipients []age.Recipient) FileResult {
+	start := time.Now()
+	result := FileResult{Path: path, OldRecipients: age.RecipientTokens(oldRecipients)}
+
+	fail := func(err error) FileResult {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		result.NewRecipients = result.OldRecipients
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Rewriting a file that already has the wanted recipients would only
+	// bump its MAC and lastmodified and leave a noisy diff
+	if SameRecipients(oldRecipients, newRecipients) {
+		result.Status = StatusUnchanged
+		result.NewRecipients = result.OldRecipients
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	add := difference(newRecipients, oldRecipients)
+	remove := difference(oldRecipients, newRecipients)
+	if err := rotateRecipients(o, path, add, remove); err != nil {
+		return fail(err)
+	}
+
+	result.Status = StatusOK
+	result.NewRecipients = age.RecipientTokens(newRecipients)
+	if info, err := fileInfo(o, path); err == nil {
+		result.NewRecipients = age.RecipientTokens(info.AllRecipients())
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// DefaultBatchWorkers is how many files a batch decryption runs at once
+const DefaultBatchWorkers = 4
+
+// DecryptTarget is a file of a batch decryption and where its plaintext
+// goes. An empty Output decrypts the file in place.
+type DecryptTarget struct {
+	Path   string
+	Output string
+}
+
+// DecryptFiles decrypts files concurrently through a Queue, with at most
+// workers sops processes at a time. Files that none of publicKeys can decrypt are reported
+// as StatusNoKey up front without running sops; nil publicKeys tries every
+// file. Each in-place decryption is backed up and rolled back on its own. A
+// cancelled context skips the files that have not started yet.
+func DecryptFiles(targets []DecryptTarget, publicKeys []string, workers int, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	report := &Report{Operation: "decrypt", Root: commonDir(targets), Started: time.Now(), Files: make([]FileResult, len(targets))}
+
+	// Settle the hopeless files first so they never hold up a worker
+	var pending []int
+	for i, t := range targets {
+		if result, ok := precheckDecrypt(t, publicKeys); !ok {
+			report.Files[i] = result
+			o.notify(result)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	queue := NewQueue(workers, o.jobs)
+	for _, i := range pending {
+		t := targets[i]
+		report.Files[i] = FileResult{Path: t.Path, Output: t.Output, Status: StatusSkipped, Error: "cancelled"}
+		queue.Submit(o.ctx, Task{Operation: "decrypt", Path: t.Path, Also: []string{t.Output}, Run: func(context.Context) error {
+			report.Files[i] = decryptTarget(t, opts)
+			o.notify(report.Files[i])
+			return resultError(report.Files[i])
+		}})
+	}
+	queue.Wait()
+
+	report.Duration = time.Since(report.Started)
+
+	if o.ctx.Err() != nil {
+		return report, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Decryption cancelled").WithCode(errors.CodeCancelled)
+	}
+	return report, nil
+}
+
+// runBounded calls work for each of the indexes with at most workers calls
+// running at a time, and returns once they have all finished. After ctx is
+// cancelled, the indexes that have not started are passed to skip instead.
+func runBounded(ctx context.Context, indexes []int, workers int, work, skip func(i int)) {
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			skip(i)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			work(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// precheckDecrypt rules out files that cannot be decrypted without running
+// sops. It reports false, with the file's result, when the file is settled.
+func precheckDecrypt(t DecryptTarget, publicKeys []string) (FileResult, bool) {
+	result := FileResult{Path: t.Path, Output: t.Output}
+
+	if _, err := ResolvePath(t.Path); err != nil {
+		result.Status = StatusSkipped
+		result.Error = err.Error()
+		return result, false
+	}
+
+	// Unreadable metadata is left for sops to report
+	md, err := ReadMetadata(t.Path)
+	if err != nil {
+		return result, true
+	}
+	if len(md.AllRecipients()) == 0 {
+		result.Status = StatusNoKey
+		result.Error = "the file lists no recipients, so no key can decrypt it"
+		return result, false
+	}
+	if publicKeys == nil {
+		return result, true
+	}
+	if !md.CanDecrypt(publicKeys) {
+		result.Status = StatusNoKey
+		result.OldRecipients = age.RecipientTokens(md.AllRecipients())
+		result.Error = "none of your keys can decrypt this file"
+		return result, false
+	}
+	return result, true
+}
+
+// decryptTarget decrypts a single file of a batch
+func decryptTarget(t DecryptTarget, opts []Option) FileResult {
+	start := time.Now()
+	result := FileResult{Path: t.Path, Output: t.Output, Status: StatusOK}
+	if md, err := ReadMetadata(t.Path); err == nil {
+		result.OldRecipients = age.RecipientTokens(md.AllRecipients())
+	}
+
+	if err := DecryptFile(t.Path, t.Output == "", t.Output, opts...); err != nil {
+		result.Error = err.Error()
+		switch errors.Code(err) {
+		case errors.CodeSOPSNoKey:
+			result.Status = StatusNoKey
+		case errors.CodeCancelled:
+			result.Status = StatusSkipped
+		default:
+			result.Status = StatusFailed
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// resultError returns the error recorded in a file's result, for its job
+func resultError(result FileResult) error {
+	if result.Error == "" || result.Status == StatusOK || result.Status == StatusUnchanged {
+		return nil
+	}
+	return errors.New(errors.TypeFileOperation, result.Error).WithData("path", result.Path)
+}
+
+// commonDir returns the deepest directory containing every target
+func commonDir(targets []DecryptTarget) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(targets[0].Path)
+	for _, t := range targets[1:] {
+		for !within(dir, t.Path) && dir != filepath.Dir(dir) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,130 @@
+package sops
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Checkout decrypts the encrypted file at path to workingCopy, to be edited
+// with other tools, and records the pair so Checkin can encrypt the changes
+// back. workingCopy must not exist yet and must have the same extension, so
+// it is read back in the format it was written in. The plaintext stays on
+// disk until it is checked in.
+func Checkout(path, workingCopy string, opts ...Option) (*history.Checkout, error) {
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to resolve path").
+			WithCode(errors.CodeFileNotFound).WithData("path", path)
+	}
+	working, err := filepath.Abs(workingCopy)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to resolve path").
+			WithCode(errors.CodeFileNotFound).WithData("path", workingCopy)
+	}
+
+	if _, err := os.Lstat(working); err == nil {
+		return nil, errors.New(errors.TypeFileOperation, "The working copy already exists; choose another path").
+			WithCode(errors.CodeFileExists).WithData("path", working)
+	}
+	if DetectFormat(working) != DetectFormat(source) {
+		return nil, errors.New(errors.TypeFileOperation, "The working copy must have the same extension as the encrypted file").
+			WithCode(errors.CodeCheckoutFailed).WithData("path", working).WithData("source", source)
+	}
+	if _, err := checkinRecipients(source); err != nil {
+		return nil, err
+	}
+
+	if err := prepareOutputDir(working, newOptions(opts).createDir); err != nil {
+		return nil, err
+	}
+	// Create the working copy first, so sops writes into a file only the
+	// owner can read instead of one with its own permissions
+	file, err := os.OpenFile(working, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to create the working copy").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", working)
+	}
+	file.Close()
+
+	if err := DecryptFile(source, false, working, opts...); err != nil {
+		os.Remove(working)
+		return nil, err
+	}
+
+	checkout := history.Checkout{Source: source, WorkingCopy: working}
+	if err := history.AddCheckout(checkout); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"The file was decrypted, but recording the checkout failed; delete the working copy by hand").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", working)
+	}
+	return &checkout, nil
+}
+
+// Checkin encrypts a working copy made by Checkout back over its encrypted
+// file, to the recipients the file already has, and then securely deletes
+// the working copy. The encrypted file is only replaced once the new
+// ciphertext is complete.
+func Checkin(workingCopy string, wipe utils.WipeOptions, opts ...Option) (*history.Checkout, *utils.WipeResult, error) {
+	working, err := filepath.Abs(workingCopy)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to resolve path").
+			WithCode(errors.CodeFileNotFound).WithData("path", workingCopy)
+	}
+
+	checkout, ok := history.FindCheckout(working)
+	if !ok {
+		return nil, nil, errors.New(errors.TypeFileOperation, "The file is not a checked out working copy").
+			WithCode(errors.CodeNoCheckout).WithData("path", working)
+	}
+	if !utils.FileExists(working) {
+		history.RemoveCheckout(working)
+		return nil, nil, errors.New(errors.TypeFileOperation, "The working copy is gone; there is nothing to check in").
+			WithCode(errors.CodeFileNotFound).WithData("path", working)
+	}
+
+	recipients, err := checkinRecipients(checkout.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := EncryptToFile(working, checkout.Source, recipients, opts...); err != nil {
+		return nil, nil, err
+	}
+
+	result, err := utils.SecureDelete(working, wipe)
+	if err != nil {
+		// The checkout stays recorded, since the plaintext is still on disk
+		return nil, nil, errors.Wrap(err, errors.TypeFileOperation,
+			"The changes are encrypted, but deleting the working copy failed; delete it by hand").
+			WithCode(errors.CodeFileDeleteFailed).WithData("path", working)
+	}
+	if err := history.RemoveCheckout(working); err != nil {
+		return &checkout, result, errors.Wrap(err, errors.TypeFileOperation, "Failed to forget the checkout").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", history.CheckoutsPath())
+	}
+	return &checkout, result, nil
+}
+
+// checkinRecipients returns the recipients a checked out file is encrypted
+// back to. A file with several key groups is refused, since a flat
+// recipient list would change who has to cooperate to decrypt it.
+func checkinRecipients(source string) ([]age.Recipient, error) {
+	md, err := ReadMetadata(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(md.KeyGroups) > 1 {
+		return nil, errors.New(errors.TypeFileOperation, "The file has several key groups and cannot be checked out; edit it in place instead").
+			WithCode(errors.CodeCheckoutFailed).WithData("path", source)
+	}
+	recipients := md.AllRecipients()
+	if len(recipients) == 0 {
+		return nil, errors.New(errors.TypeFileOperation, "The file lists no recipients to encrypt it back to").
+			WithCode(errors.CodeCheckoutFailed).WithData("path", source)
+	}
+	return recipients, nil
+}
@@ -0,0 +1,138 @@
+package sops
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// secretNamePattern matches the names of files that usually hold secrets
+var secretNamePattern = regexp.MustCompile(`(?i)(secret|credential|passw(or)?d|token|private|^\.env|\.env$|\.pem$|\.key$|\.p12$|\.pfx$)`)
+
+// CoverageReport compares the files under root with the creation rules of
+// the .sops.yaml sops would use for them, found in root or one of its
+// parents. covered lists the files matched by some rule's path regex;
+// uncovered lists those no rule matches, which sops would encrypt with only
+// the keys given on its command line, if any. Paths are relative to root and
+// sorted. Hidden directories, supper's own files and the files outside a
+// WithGitScope scope are skipped. Without a .sops.yaml every file is
+// uncovered.
+func CoverageReport(root string, opts ...Option) (covered, uncovered []string, err error) {
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to resolve path").
+			WithCode(errors.CodeFileNotFound).WithData("directory", root)
+	}
+
+	configPath, ok := FindConfig(root)
+	if !ok {
+		return RuleCoverage(root, root, nil, opts...)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	covered, uncovered, err = RuleCoverage(root, filepath.Dir(configPath), cfg.CreationRules, opts...)
+	if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.CodeConfigInvalid {
+		appErr.WithData("path", configPath)
+	}
+	return covered, uncovered, err
+}
+
+// RuleCoverage is CoverageReport for the given rules, such as rules being
+// edited before they are saved, as if they were in a .sops.yaml in
+// configDir, which is root or one of its parents
+func RuleCoverage(root, configDir string, rules []CreationRule, opts ...Option) (covered, uncovered []string, err error) {
+	// sops matches path regexes against the path relative to the config
+	var patterns []*regexp.Regexp
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, errors.TypeConfig, "Invalid path regex").
+				WithCode(errors.CodeConfigInvalid).WithData("path_regex", rule.PathRegex)
+		}
+		patterns = append(patterns, pattern)
+	}
+	git, err := newGitFilter(root, newOptions(opts).gitScope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if (path != root && strings.HasPrefix(d.Name(), ".")) || git.excludes(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isSupperFile(d.Name()) || git.excludes(path, false) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		fromConfig, err := filepath.Rel(configDir, path)
+		if err != nil {
+			return err
+		}
+		if matchesAny(patterns, filepath.ToSlash(fromConfig)) {
+			covered = append(covered, rel)
+		} else {
+			uncovered = append(uncovered, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return covered, uncovered, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to scan directory").WithCode(errors.CodeFileNotFound).WithData("directory", root)
+	}
+
+	sort.Strings(covered)
+	sort.Strings(uncovered)
+	return covered, uncovered, nil
+}
+
+// matchesAny reports whether any of patterns matches path
+func matchesAny(patterns []*regexp.Regexp, path string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSupperFile reports whether name is one of the files sops and supper
+// keep for themselves rather than a file to encrypt
+func isSupperFile(name string) bool {
+	return name == ConfigFileName || name == LabelsFileName || strings.HasPrefix(name, TempPrefix)
+}
+
+// LooksLikeSecret reports whether the file at path is already encrypted or
+// has a name that usually holds secrets, such as .env or credentials.json
+func LooksLikeSecret(path string) bool {
+	if secretNamePattern.MatchString(filepath.Base(path)) {
+		return true
+	}
+	_, err := ReadMetadata(path)
+	return err == nil
+}
+
+// PathsRegex returns a path regex matching exactly the given paths, which
+// are relative to the directory of the .sops.yaml the rule goes in
+func PathsRegex(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = regexp.QuoteMeta(filepath.ToSlash(path))
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
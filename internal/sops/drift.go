@@ -0,0 +1,110 @@
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+)
+
+// MetadataDrift compares the age recipients in a file's sops metadata with
+// those of the .sops.yaml rule that applies to it. Keys of other kinds are
+// not compared, as rules only list age keys here.
+type MetadataDrift struct {
+	ConfigPath string          // The .sops.yaml holding the rule
+	Missing    []age.Recipient // In the rule but not in the file
+	Extra      []age.Recipient // In the file but not in the rule
+}
+
+// Drifted reports whether the file and its rule list different recipients
+func (d *MetadataDrift) Drifted() bool {
+	return len(d.Missing) > 0 || len(d.Extra) > 0
+}
+
+// CheckDrift compares the metadata md read from filePath with the rule that
+// applies to the file. ok is false when no rule applies, so there is
+// nothing to compare against.
+func CheckDrift(filePath string, md *Metadata) (drift *MetadataDrift, ok bool) {
+	rule, _, configPath, ok := MatchingRule(filePath)
+	if !ok {
+		return nil, false
+	}
+	ruleKeys := rule.Recipients()
+	fileKeys := age.FromKeys(md.Recipients())
+	return &MetadataDrift{
+		ConfigPath: configPath,
+		Missing:    difference(ruleKeys, fileKeys),
+		Extra:      difference(fileKeys, ruleKeys),
+	}, true
+}
+
+// RepairMetadata regenerates the key entries of a file's sops metadata from
+// the .sops.yaml rule that applies to it, with sops updatekeys. Recipients
+// added to or removed from the metadata by hand are brought back in line
+// with the rule. sops has to open the data key to do this, so it needs a key
+// that still works; when none does, restore the file from a backup.
+func RepairMetadata(filePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if _, err := ReadMetadata(filePath); err != nil {
+		return err
+	}
+	_, _, configPath, ok := MatchingRule(filePath)
+	if !ok {
+		return errors.New(errors.TypeConfig,
+			fmt.Sprintf("No .sops.yaml rule applies to %s, so there are no recipients to restore; repair its recipients instead", filepath.Base(filePath))).
+			WithCode(errors.CodeSOPSNoConfig).WithData("path", filePath)
+	}
+	if err := checkWritable(filePath); err != nil {
+		return err
+	}
+
+	tm := recovery.NewTransactionManager()
+	if err := o.begin(tm, filePath); err != nil {
+		return err
+	}
+
+	// sops looks for .sops.yaml from the working directory, so name it
+	args := []string{"--config", configPath, "updatekeys", "--yes"}
+	if binaryArgs(filePath) != nil {
+		args = append(args, "--input-type", FormatBinary)
+	}
+	cmd := o.command(append(args, filePath)...)
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		if rollbackErr := tm.Rollback(); rollbackErr != nil {
+			return errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to repair metadata and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
+				WithData("stderr", errOut.String()).
+				WithData("rollbackError", rollbackErr.Error())
+		}
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Repair cancelled").WithCode(errors.CodeCancelled)
+		}
+
+		parsed := o.parseError(err, errOut.String())
+		switch errors.Code(parsed) {
+		case errors.CodeSOPSDecryptFailed, errors.CodeSOPSNoKey:
+			return errors.Wrap(parsed, errors.TypeKeyManagement,
+				"No key can open the data key, so the metadata cannot be regenerated; restore the file from a backup").
+				WithCode(errors.Code(parsed)).WithData("path", filePath)
+		}
+		return parsed
+	}
+
+	tm.Commit()
+	return nil
+}
@@ -0,0 +1,88 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// fallbackEditor is used when neither the configured editor nor $EDITOR is
+// installed and falling back is allowed
+const fallbackEditor = "vi"
+
+// WithEditor makes sops edit files with command, a program and its
+// arguments, instead of the editor named in the environment. An empty
+// command leaves the choice to sops.
+func WithEditor(command string) Option {
+	return func(o *options) {
+		if command == "" {
+			return
+		}
+		o.env = append(o.env, "SOPS_EDITOR="+command, "EDITOR="+command)
+	}
+}
+
+// ResolveEditor returns the editor command to edit files with, for
+// WithEditor. command is the configured editor; config.DefaultEditorCommand
+// uses $SOPS_EDITOR or $EDITOR the way sops does, and "" is returned when
+// neither is set so that sops picks one itself.
+//
+// When the editor's program is not installed, a CodeEditorNotFound error
+// naming it is returned, unless fallback is set: then $EDITOR, or vi, is used
+// instead and warning says so.
+func ResolveEditor(command string, fallback bool) (editor, warning string, err error) {
+	if command == "" || command == config.DefaultEditorCommand {
+		command = os.Getenv("SOPS_EDITOR")
+		if command == "" {
+			command = os.Getenv("EDITOR")
+		}
+		if command == "" {
+			return "", "", nil
+		}
+	}
+
+	program := editorProgram(command)
+	if installed(program) {
+		return command, "", nil
+	}
+	if !fallback {
+		return "", "", editorNotFound(program)
+	}
+
+	for _, candidate := range []string{os.Getenv("EDITOR"), fallbackEditor} {
+		if candidate == "" || candidate == command || !installed(editorProgram(candidate)) {
+			continue
+		}
+		return candidate, fmt.Sprintf("Editor %q is not installed; used %q instead", program, candidate), nil
+	}
+	return "", "", editorNotFound(program)
+}
+
+// editorProgram returns the program an editor command runs, its first word
+func editorProgram(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// installed reports whether program can be found on PATH
+func installed(program string) bool {
+	if program == "" {
+		return false
+	}
+	_, err := exec.LookPath(program)
+	return err == nil
+}
+
+// editorNotFound is the error for an editor whose program is not installed
+func editorNotFound(program string) error {
+	return errors.New(errors.TypeConfig,
+		fmt.Sprintf("Editor %q is not installed or not on PATH; install it, change Editor Command in the settings, or turn on Editor Fallback", program)).
+		WithCode(errors.CodeEditorNotFound).WithData("editor", program)
+}
@@ -0,0 +1,362 @@
+package sops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportTarget is a file ExportFile writes and the format it is written in
+type ExportTarget struct {
+	Path   string
+	Format string
+}
+
+// ParseExportTarget parses a target given as format=path, or as a bare path
+// whose extension names the format, such as out.json or prod.env
+func ParseExportTarget(spec string) (ExportTarget, error) {
+	spec = strings.TrimSpace(spec)
+	target := ExportTarget{Path: spec}
+	if format, path, ok := strings.Cut(spec, "="); ok && isFormat(format) {
+		target = ExportTarget{Path: path, Format: format}
+	}
+	target.Path = utils.ExpandPath(strings.TrimSpace(target.Path))
+	if target.Path == "" {
+		return target, errors.New(errors.TypeConfig, fmt.Sprintf("Export target %q has no path", spec)).
+			WithCode(errors.CodeConfigInvalid).WithData("target", spec)
+	}
+	if target.Format == "" {
+		target.Format = FormatFromPath(target.Path)
+	}
+	return target, nil
+}
+
+// isFormat reports whether name is one of Formats
+func isFormat(name string) bool {
+	for _, format := range Formats {
+		if format == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportFile decrypts filePath once, in memory, and writes the plaintext to
+// every target in the target's format, so that one decryption feeds several
+// tools. YAML and JSON files are decrypted as they are, and dotenv and INI
+// files are converted to JSON by sops on the way; targets in the decrypted
+// format get its output unchanged and the others are converted from it,
+// under the same rules as WithOutputType. Binary files can only be exported
+// as binary.
+//
+// Each target is checked on its own, before anything is decrypted: an
+// existing file is skipped unless overwrite is set, and a target that is
+// protected, cannot be converted to or cannot be written to fails. The
+// report is rooted at the file's directory and has a result per target, with
+// the file as Path and the target as Output. The error is only set when the file itself could not be decrypted.
+func ExportFile(filePath string, targets []ExportTarget, overwrite bool, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	report := &Report{Operation: "export", Root: filepath.Dir(filePath), Started: time.Now()}
+	defer func() { report.Duration = time.Since(report.Started) }()
+
+	source, err := ResolvePath(filePath)
+	if err != nil {
+		return report, err
+	}
+	inputType := DetectFormat(source)
+
+	var pending []int
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		result := FileResult{Path: filePath, Output: target.Path, Status: StatusFailed}
+		key := fileKey(target.Path)
+		switch {
+		case key == fileKey(source):
+			result.Error = "the target is the encrypted file itself"
+		case seen[key]:
+			result.Status = StatusSkipped
+			result.Error = "already a target"
+		case utils.FileExists(target.Path) && !overwrite:
+			result.Status = StatusSkipped
+			result.Error = "exists; allow overwriting to replace it"
+		default:
+			if err := checkExportTarget(inputType, target, o.createDir); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Status = ""
+				pending = append(pending, len(report.Files))
+			}
+		}
+		seen[key] = true
+		report.Files = append(report.Files, result)
+	}
+	if len(pending) == 0 {
+		for _, result := range report.Files {
+			o.notify(result)
+		}
+		return report, nil
+	}
+
+	// dotenv and INI have no nested structure of their own to convert from
+	decryptedType := inputType
+	if inputType == FormatDotenv || inputType == FormatINI {
+		decryptedType = FormatJSON
+	}
+	plaintext, err := DecryptToMemory(source, append(opts, WithOutputType(decryptedType), untracked())...)
+	defer utils.WipeBytes(plaintext)
+	if err != nil {
+		for _, i := range pending {
+			report.Files[i].Status = StatusFailed
+			report.Files[i].Error = "not written, the file could not be decrypted"
+		}
+		return report, err
+	}
+
+	var tree *yaml.Node
+	for _, i := range pending {
+		result := &report.Files[i]
+		start := time.Now()
+		target := targets[i]
+
+		var err error
+		data := plaintext
+		if target.Format != decryptedType {
+			if tree == nil {
+				tree = &yaml.Node{}
+				if err := yaml.Unmarshal(plaintext, tree); err != nil {
+					tree = nil
+					result.Status = StatusFailed
+					result.Error = "the decrypted content could not be parsed: " + err.Error()
+					continue
+				}
+			}
+			data, err = convertTree(tree, target.Format)
+		}
+		if err == nil {
+			err = writePlaintext(target.Path, data)
+		}
+		if target.Format != decryptedType {
+			utils.WipeBytes(data)
+		}
+
+		result.Status = StatusOK
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err.Error()
+		} else {
+			o.recordAccess(source, "export", target.Path)
+		}
+		result.Duration = time.Since(start)
+	}
+
+	for _, result := range report.Files {
+		o.notify(result)
+	}
+	return report, nil
+}
+
+// checkExportTarget reports why plaintext in inputType cannot be written to
+// target, with the checks DecryptFile makes before writing an output
+func checkExportTarget(inputType string, target ExportTarget, createDir bool) error {
+	if !isFormat(target.Format) {
+		return errors.New(errors.TypeConfig, fmt.Sprintf("Unknown format %q", target.Format)).
+			WithCode(errors.CodeFormatUnsupported).WithData("outputType", target.Format)
+	}
+	if err := ValidateOutputType(inputType, target.Format); err != nil {
+		return err
+	}
+	if err := checkProtected(target.Path); err != nil {
+		return err
+	}
+	if err := prepareOutputDir(target.Path, createDir); err != nil {
+		return err
+	}
+	return checkOutputExposure(target.Path)
+}
+
+// writePlaintext replaces the file at path with data, readable by the owner
+// only. The data goes to a temporary file first, so a failed write leaves
+// any earlier file in place, and through a symlink to the file it points to.
+func writePlaintext(path string, data []byte) error {
+	if utils.IsSymlink(path) {
+		path = utils.RealPath(path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), TempPrefix+"*")
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to create the output file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", path)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), DecryptedFileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		utils.SecurelyDeleteFile(tmp.Name())
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to write the output file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", path)
+	}
+	return nil
+}
+
+// convertTree renders decrypted content, parsed into tree, in format
+func convertTree(tree *yaml.Node, format string) ([]byte, error) {
+	root := tree
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		// Content parsed from JSON keeps its flow style and quotes otherwise
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(4)
+		if err := enc.Encode(blockStyle(root)); err != nil {
+			return nil, err
+		}
+		enc.Close()
+	case FormatJSON:
+		if err := writeJSON(&buf, root, ""); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+	case FormatDotenv:
+		if err := writeFlat(&buf, root, "", "="); err != nil {
+			return nil, err
+		}
+	case FormatINI:
+		if root.Kind != yaml.MappingNode {
+			return nil, notFlat(format, "the top level is not a set of sections")
+		}
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			name := root.Content[i].Value
+			fmt.Fprintf(&buf, "[%s]\n", name)
+			if err := writeFlat(&buf, resolveAlias(root.Content[i+1]), name, " = "); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.New(errors.TypeConfig, "Cannot convert to this format").
+			WithCode(errors.CodeFormatUnsupported).WithData("outputType", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle returns a copy of node with every node in the block style and
+// scalars unquoted, leaving the encoder to quote those that need it
+func blockStyle(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "\n") {
+		copied.Style = yaml.LiteralStyle
+	}
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = blockStyle(child)
+	}
+	return &copied
+}
+
+// writeJSON writes node as indented JSON, keeping the order of its keys
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	node = resolveAlias(node)
+	inner := indent + "    "
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, end, step := "{", "}", 2
+		if node.Kind == yaml.SequenceNode {
+			open, end, step = "[", "]", 1
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + end)
+			return nil
+		}
+		buf.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(inner)
+			value := node.Content[i]
+			if step == 2 {
+				name, _ := json.Marshal(node.Content[i].Value)
+				buf.Write(name)
+				buf.WriteString(": ")
+				value = node.Content[i+1]
+			}
+			if err := writeJSON(buf, value, inner); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + indent + end)
+		return nil
+	default:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return errors.Wrap(err, errors.TypeConfig, fmt.Sprintf("The value %q has no JSON equivalent", node.Value)).
+				WithCode(errors.CodeFormatUnsupported).WithData("outputType", FormatJSON)
+		}
+		buf.Write(encoded)
+		return nil
+	}
+}
+
+// writeFlat writes the keys of a mapping of single values as key, sep and
+// value lines, as dotenv files and INI sections hold them. Newlines in
+// values are written as \n, as sops does.
+func writeFlat(buf *bytes.Buffer, node *yaml.Node, section, sep string) error {
+	format, where := FormatDotenv, "the top level"
+	if section != "" {
+		format, where = FormatINI, fmt.Sprintf("section %q", section)
+	}
+	if node.Kind != yaml.MappingNode {
+		return notFlat(format, where+" is not a set of keys")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i].Value, resolveAlias(node.Content[i+1])
+		if value.Kind != yaml.ScalarNode {
+			return notFlat(format, fmt.Sprintf("%q in %s holds a nested value", name, where))
+		}
+		text := value.Value
+		if value.Tag == "!!null" {
+			text = ""
+		}
+		fmt.Fprintf(buf, "%s%s%s\n", name, sep, strings.ReplaceAll(text, "\n", `\n`))
+	}
+	return nil
+}
+
+// resolveAlias returns the node an alias stands for
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// notFlat is the error for content too nested for a dotenv or INI file
+func notFlat(format, reason string) error {
+	return errors.New(errors.TypeConfig, fmt.Sprintf("Cannot convert to %s: %s", format, reason)).
+		WithCode(errors.CodeFormatUnsupported).WithData("outputType", format)
+}
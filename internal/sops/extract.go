@@ -0,0 +1,231 @@
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTreePath splits a path into a structured file, such as db.password,
+// hosts[0].name or ["key.with.dots"], into its keys and list indexes
+func ParseTreePath(treePath string) ([]any, error) {
+	invalid := func(reason string) error {
+		return errors.New(errors.TypeGeneral, fmt.Sprintf("Invalid path %q: %s", treePath, reason)).
+			WithCode(errors.CodeTreePathInvalid).WithData("path", treePath)
+	}
+
+	var parts []any
+	rest := strings.TrimSpace(treePath)
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, `["`):
+			// A quoted key, ended by the first unescaped quote
+			end := 2
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end+1 >= len(rest) || rest[end+1] != ']' {
+				return nil, invalid(`unterminated ["..."]`)
+			}
+			key, err := strconv.Unquote(rest[1 : end+1])
+			if err != nil {
+				return nil, invalid("bad quoted key")
+			}
+			parts = append(parts, key)
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid("unterminated [")
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, invalid("list indexes are whole numbers")
+			}
+			parts = append(parts, index)
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			if len(parts) == 0 || len(rest) == 1 {
+				return nil, invalid("empty key")
+			}
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				return nil, invalid("empty key")
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			parts = append(parts, rest[:end])
+			rest = rest[end:]
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, invalid("empty path")
+	}
+	return parts, nil
+}
+
+// FormatTreePath writes parts in the dotted form ParseTreePath reads. Keys
+// that would not read back as themselves are quoted.
+func FormatTreePath(parts []any) string {
+	var b strings.Builder
+	for i, part := range parts {
+		switch p := part.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		case string:
+			if p == "" || strings.ContainsAny(p, `.[]" `) {
+				b.WriteString("[" + strconv.Quote(p) + "]")
+				continue
+			}
+			if i > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(p)
+		}
+	}
+	return b.String()
+}
+
+// extractArg writes parts in the ["key"][0] form of sops --extract
+func extractArg(parts []any) string {
+	var b strings.Builder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		case string:
+			b.WriteString("[" + strconv.Quote(p) + "]")
+		}
+	}
+	return b.String()
+}
+
+// TreePaths lists the path of every key and list item of an encrypted YAML
+// or JSON file, in file order. Keys are stored in the clear by sops, so
+// nothing is decrypted; the sops metadata section is left out.
+func TreePaths(filePath string) ([]string, error) {
+	format := DetectFormat(filePath)
+	if format != FormatYAML && format != FormatJSON {
+		return nil, errors.New(errors.TypeGeneral, "Only YAML and JSON files have paths to list").
+			WithCode(errors.CodeFormatUnsupported).WithData("format", format)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to read file").
+			WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, errors.Wrap(err, errors.TypeGeneral, "File is not valid "+format).
+			WithCode(errors.CodeFormatUnsupported).WithData("path", filePath)
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	var paths []string
+	var walk func(node *yaml.Node, parts []any)
+	walk = func(node *yaml.Node, parts []any) {
+		if node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+		var children []*yaml.Node
+		var keys []any
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if len(parts) == 0 && key == "sops" {
+					continue
+				}
+				keys = append(keys, key)
+				children = append(children, node.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				keys = append(keys, i)
+				children = append(children, item)
+			}
+		}
+		for i, child := range children {
+			childParts := append(append([]any(nil), parts...), keys[i])
+			paths = append(paths, FormatTreePath(childParts))
+			walk(child, childParts)
+		}
+	}
+	walk(root.Content[0], nil)
+
+	return paths, nil
+}
+
+// containsPath reports whether paths holds path
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract decrypts only the value at treePath of an encrypted YAML or JSON
+// file, using sops --extract, and returns it without writing it to disk. A
+// value is returned as is; a mapping or list comes back in the file's format.
+// Callers should wipe the returned slice with utils.WipeBytes once they are
+// done with it.
+func Extract(filePath, treePath string, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := ParseTreePath(treePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys are readable without decrypting, so a path that is not there
+	// is reported before sops is run
+	paths, err := TreePaths(filePath)
+	if err != nil {
+		return nil, err
+	}
+	canonical := FormatTreePath(parts)
+	if !containsPath(paths, canonical) {
+		return nil, errors.New(errors.TypeGeneral, fmt.Sprintf("No value at %s", canonical)).
+			WithCode(errors.CodeTreePathNotFound).WithData("path", filePath).WithData("treePath", canonical)
+	}
+
+	cmd := o.command("-d", "--extract", extractArg(parts), filePath)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		utils.WipeBytes(out.Bytes())
+		if o.ctx.Err() != nil {
+			return nil, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Decryption cancelled").WithCode(errors.CodeCancelled)
+		}
+		return nil, o.parseError(err, errOut.String())
+	}
+
+	o.recordAccess(filePath, "extract", "")
+	return out.Bytes(), nil
+}
@@ -0,0 +1,162 @@
+package sops
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// Supported SOPS file formats
+const (
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatDotenv = "dotenv"
+	FormatINI    = "ini"
+	FormatBinary = "binary"
+)
+
+// Formats lists the formats SOPS can read and write
+var Formats = []string{FormatYAML, FormatJSON, FormatDotenv, FormatINI, FormatBinary}
+
+// FormatFromPath infers the SOPS format of a file from its extension
+func FormatFromPath(path string) string {
+	// Ignore encryption suffixes such as secrets.yaml.enc
+	path = strings.TrimSuffix(path, ".enc")
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".env":
+		return FormatDotenv
+	case ".ini":
+		return FormatINI
+	default:
+		return FormatBinary
+	}
+}
+
+// sniffSize is how much of a file is read to tell binary content from text
+const sniffSize = 8192
+
+// DetectFormat determines the format SOPS should treat a file as. The
+// extension decides, except that binary content, or an encrypted binary file,
+// is handled as binary whatever the file is called.
+func DetectFormat(path string) string {
+	format := FormatFromPath(path)
+	if format == FormatBinary {
+		return format
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return format
+	}
+	defer file.Close()
+
+	sample := make([]byte, sniffSize)
+	n, _ := io.ReadFull(file, sample)
+	sample = sample[:n]
+	if IsBinary(sample, n == sniffSize) {
+		return FormatBinary
+	}
+
+	// sops stores encrypted binary files as JSON, which only stands out when
+	// the extension promises another format
+	if format != FormatJSON && bytes.HasPrefix(bytes.TrimSpace(sample), []byte("{")) {
+		rest, err := io.ReadAll(file)
+		if err == nil && isBinaryEnvelope(append(sample, rest...)) {
+			return FormatBinary
+		}
+	}
+	return format
+}
+
+// IsBinary reports whether data looks like binary rather than text: it holds
+// a NUL byte or is not valid UTF-8. truncated says data is the start of a
+// longer file, so it may end in the middle of a character.
+func IsBinary(data []byte, truncated bool) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	return !utf8.Valid(data)
+}
+
+// isBinaryEnvelope reports whether data is an encrypted binary file: a JSON
+// object holding just the data and sops keys
+func isBinaryEnvelope(data []byte) bool {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	_, hasData := doc["data"]
+	_, hasSops := doc["sops"]
+	return len(doc) == 2 && hasData && hasSops
+}
+
+// binaryArgs returns the sops flags that make it treat path as binary when
+// its extension would have it parsed as a structured format
+func binaryArgs(path string) []string {
+	if FormatFromPath(path) != FormatBinary && DetectFormat(path) == FormatBinary {
+		return []string{"--input-type", FormatBinary, "--output-type", FormatBinary}
+	}
+	return nil
+}
+
+// FormatExtension returns the file extension conventionally used for a format
+func FormatExtension(format string) string {
+	switch format {
+	case FormatYAML:
+		return ".yaml"
+	case FormatJSON:
+		return ".json"
+	case FormatDotenv:
+		return ".env"
+	case FormatINI:
+		return ".ini"
+	default:
+		return ".bin"
+	}
+}
+
+// ValidateOutputType checks that SOPS can convert inputType into outputType
+func ValidateOutputType(inputType, outputType string) error {
+	if outputType == "" || outputType == inputType {
+		return nil
+	}
+
+	known := false
+	for _, format := range Formats {
+		if format == outputType {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return errors.New(errors.TypeConfig, "Unknown output type").
+			WithCode(errors.CodeFormatUnsupported).
+			WithData("outputType", outputType)
+	}
+
+	// Binary data has no structure to convert to or from
+	if inputType == FormatBinary || outputType == FormatBinary {
+		return errors.New(errors.TypeConfig, "Cannot convert between binary and structured formats").
+			WithCode(errors.CodeFormatUnsupported).
+			WithData("inputType", inputType).
+			WithData("outputType", outputType)
+	}
+
+	return nil
+}
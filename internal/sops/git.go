@@ -0,0 +1,110 @@
+package sops
+
+import (
+	"bytes"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// WithGitScope limits a directory scan or batch operation to part of a git
+// repository: config.GitScopeGitignore skips the files .gitignore excludes
+// and config.GitScopeTracked keeps only the files git tracks. Directories
+// outside a repository are scanned in full whatever the scope, as is every
+// directory with config.GitScopeAll or an empty scope.
+func WithGitScope(scope string) Option {
+	return func(o *options) {
+		o.gitScope = scope
+	}
+}
+
+// gitFilter decides which paths under a directory a walk skips for a git
+// scope. A nil filter skips nothing.
+type gitFilter struct {
+	root    string
+	tracked bool            // Keep only tracked files rather than skip ignored ones
+	paths   map[string]bool // Slash-separated paths relative to root, ignored directories ending in /
+	dirs    map[string]bool // Directories holding tracked files, when tracked
+}
+
+// newGitFilter asks git which files under root the scope covers. It returns
+// nil when the scope covers everything, including when root is not in a git
+// repository.
+func newGitFilter(root, scope string) (*gitFilter, error) {
+	switch scope {
+	case "", config.GitScopeAll:
+		return nil, nil
+	case config.GitScopeGitignore, config.GitScopeTracked:
+	default:
+		return nil, errors.New(errors.TypeConfig, "Unknown git scope").
+			WithCode(errors.CodeConfigInvalid).WithData("git_scope", scope)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.Wrap(err, errors.TypeConfig,
+			"git is not installed, so the files git ignores or tracks are unknown; install it or set Git Scope to all").
+			WithCode(errors.CodeGitFailed).WithData("directory", root)
+	}
+	if err := exec.Command("git", "-C", root, "rev-parse", "--is-inside-work-tree").Run(); err != nil {
+		return nil, nil
+	}
+
+	filter := &gitFilter{root: root, tracked: scope == config.GitScopeTracked, paths: make(map[string]bool)}
+	// Paths are listed relative to root; ignored directories are listed
+	// once, with a trailing slash, rather than file by file
+	args := []string{"-C", root, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory"}
+	if filter.tracked {
+		args = []string{"-C", root, "ls-files", "-z", "--cached"}
+		filter.dirs = map[string]bool{".": true}
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to list the files of the git repository").
+			WithCode(errors.CodeGitFailed).WithData("directory", root)
+	}
+
+	for _, entry := range bytes.Split(out, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		name := string(entry)
+		filter.paths[name] = true
+		if filter.tracked {
+			for dir := path.Dir(name); !filter.dirs[dir]; dir = path.Dir(dir) {
+				filter.dirs[dir] = true
+			}
+		}
+	}
+	return filter, nil
+}
+
+// excludes reports whether the walk should skip path, a directory when dir
+// is set. path is root or below it.
+func (g *gitFilter) excludes(path string, dir bool) bool {
+	if g == nil {
+		return false
+	}
+	rel, err := filepath.Rel(g.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case g.tracked && dir:
+		return !g.dirs[rel]
+	case g.tracked:
+		return !g.paths[rel]
+	case dir && rel == ".":
+		// A root git ignores as a whole is listed as ./
+		return g.paths["./"]
+	case dir:
+		return g.paths[rel+"/"]
+	default:
+		return g.paths[rel]
+	}
+}
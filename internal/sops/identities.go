@@ -0,0 +1,110 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// ForceDecrypt decrypts a file like DecryptFile, but gives sops one of
+// candidates at a time and returns the one that opened the file. Candidates
+// listed as recipients of the file are tried first. An attempt that fails
+// for lack of a key moves on to the next candidate; any other failure, such
+// as a MAC mismatch, is returned straight away. When no candidate opens the
+// file the error has code CodeNoIdentityMatched. opts should not include
+// WithIdentity.
+func ForceDecrypt(filePath string, inPlace bool, outputPath string, candidates []age.Candidate, opts ...Option) (age.Candidate, error) {
+	if len(candidates) == 0 {
+		return age.Candidate{}, errors.New(errors.TypeKeyManagement, "No age identities found to try").
+			WithCode(errors.CodeNoIdentityMatched).WithData("path", filePath)
+	}
+
+	configDir, err := isolatedConfigDir()
+	if err != nil {
+		return age.Candidate{}, err
+	}
+	defer os.RemoveAll(configDir)
+
+	var listed []age.Recipient
+	if md, err := ReadMetadata(filePath); err == nil {
+		listed = md.AllRecipients()
+	}
+
+	for _, c := range orderCandidates(candidates, listed) {
+		attempt := append(append([]Option(nil), opts...), withOnlyIdentity(c.Identity, configDir))
+		err := DecryptFile(filePath, inPlace, outputPath, attempt...)
+		if err == nil {
+			return c, nil
+		}
+		switch errors.Code(err) {
+		case errors.CodeSOPSNoKey, errors.CodeSOPSDecryptFailed:
+			continue
+		}
+		return age.Candidate{}, err
+	}
+
+	return age.Candidate{}, errors.New(errors.TypeKeyManagement,
+		fmt.Sprintf("None of the %d loaded identities could decrypt the file", len(candidates))).
+		WithCode(errors.CodeNoIdentityMatched).WithData("path", filePath).WithData("tried", len(candidates))
+}
+
+// DecryptWithIdentity decrypts a file like DecryptFile, giving sops only the
+// identity of candidate, so the file is opened with that key and no other.
+// opts should not include WithIdentity.
+func DecryptWithIdentity(filePath string, inPlace bool, outputPath string, candidate age.Candidate, opts ...Option) error {
+	configDir, err := isolatedConfigDir()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(configDir)
+
+	opts = append(append([]Option(nil), opts...), withOnlyIdentity(candidate.Identity, configDir))
+	return DecryptFile(filePath, inPlace, outputPath, opts...)
+}
+
+// MatchingIdentities returns the candidates whose public key is a recipient
+// of the encrypted file at path, in the order given. A file whose metadata
+// cannot be read has none.
+func MatchingIdentities(filePath string, candidates []age.Candidate) []age.Candidate {
+	md, err := ReadMetadata(filePath)
+	if err != nil {
+		return nil
+	}
+	listed := md.AllRecipients()
+
+	var matching []age.Candidate
+	for _, c := range candidates {
+		if c.PublicKey != "" && containsRecipient(listed, age.Recipient{Key: c.PublicKey}) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// isolatedConfigDir creates an empty directory to point sops' default key
+// file lookup at, since sops reads that file besides the identities it is
+// given. The caller removes it.
+func isolatedConfigDir() (string, error) {
+	configDir, err := os.MkdirTemp("", "supper-identity-*")
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation, "Failed to create a temporary directory").
+			WithCode(errors.CodeFileWriteFailed)
+	}
+	return configDir, nil
+}
+
+// orderCandidates puts the candidates whose public key is among listed
+// first, keeping the order within each part
+func orderCandidates(candidates []age.Candidate, listed []age.Recipient) []age.Candidate {
+	var first, rest []age.Candidate
+	for _, c := range candidates {
+		if c.PublicKey != "" && containsRecipient(listed, age.Recipient{Key: c.PublicKey}) {
+			first = append(first, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	return append(first, rest...)
+}
@@ -0,0 +1,562 @@
+//go:build integration
+
+package sops_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	apperrors "github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// Run with: make test-integration
+
+const sampleYAML = `database:
+  user: app
+  password: hunter2
+api_keys:
+  - first
+  - second
+`
+
+// requireBinaries skips the test unless the real sops and age tools are installed
+func requireBinaries(t *testing.T) {
+	t.Helper()
+	for _, bin := range []string{"sops", "age", "age-keygen"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+}
+
+// setup isolates the test from the user's configuration and backups, and
+// returns a fresh key pair with its identity file
+func setup(t *testing.T) (dir string, key *age.KeyPair, identity age.Identity) {
+	t.Helper()
+	requireBinaries(t)
+
+	dir = t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	// Only the identity passed to each operation may be used
+	for _, name := range []string{age.EnvSOPSAgeKey, age.EnvSOPSAgeKeyFile} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	key, err := age.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	keyPath := filepath.Join(dir, "keys.txt")
+	if err := age.SaveKey(key, keyPath); err != nil {
+		t.Fatalf("SaveKey: %v", err)
+	}
+	return dir, key, age.WithIdentityFile(keyPath)
+}
+
+// writeSample writes the sample plaintext to a new file in dir
+func writeSample(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(sampleYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIntegrationEncryptDecryptRoundTrip(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "secrets.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("hunter2")) {
+		t.Fatal("encrypted file still contains the plaintext")
+	}
+
+	info, err := sops.GetFileInfo(path)
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if !info.Encrypted {
+		t.Fatal("GetFileInfo reports the file as not encrypted")
+	}
+	if len(info.Recipients) != 1 || info.Recipients[0] != key.PublicKey {
+		t.Fatalf("recipients = %v, want [%s]", info.Recipients, key.PublicKey)
+	}
+
+	output := filepath.Join(dir, "secrets.dec.yaml")
+	if err := sops.DecryptFile(path, false, output, sops.WithIdentity(identity)); err != nil {
+		t.Fatalf("DecryptFile: %v", err)
+	}
+	decrypted, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != sampleYAML {
+		t.Fatalf("round trip mismatch:\ngot:\n%s\nwant:\n%s", decrypted, sampleYAML)
+	}
+}
+
+func TestIntegrationDecryptToMemory(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "memory.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	data, err := sops.DecryptToMemory(path, sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("DecryptToMemory: %v", err)
+	}
+	if string(data) != sampleYAML {
+		t.Fatalf("got:\n%s\nwant:\n%s", data, sampleYAML)
+	}
+}
+
+func TestIntegrationStreamRoundTrip(t *testing.T) {
+	_, key, identity := setup(t)
+
+	var encrypted bytes.Buffer
+	if err := sops.EncryptStream(bytes.NewBufferString(sampleYAML), "yaml", age.FromKeys([]string{key.PublicKey}), &encrypted); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+
+	var decrypted bytes.Buffer
+	if err := sops.DecryptStream(&encrypted, "yaml", &decrypted, sops.WithIdentity(identity)); err != nil {
+		t.Fatalf("DecryptStream: %v", err)
+	}
+	if decrypted.String() != sampleYAML {
+		t.Fatalf("got:\n%s\nwant:\n%s", decrypted.String(), sampleYAML)
+	}
+}
+
+func TestIntegrationDecryptWithWrongKey(t *testing.T) {
+	dir, key, _ := setup(t)
+	path := writeSample(t, dir, "wrong.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	other, err := age.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherPath := filepath.Join(dir, "other.txt")
+	if err := age.SaveKey(other, otherPath); err != nil {
+		t.Fatal(err)
+	}
+
+	err = sops.DecryptFile(path, false, filepath.Join(dir, "wrong.dec.yaml"), sops.WithIdentity(age.WithIdentityFile(otherPath)))
+	if err == nil {
+		t.Fatal("decryption with an unrelated key succeeded")
+	}
+	if utils.FileExists(filepath.Join(dir, "wrong.dec.yaml")) {
+		t.Fatal("a failed decryption left an output file")
+	}
+}
+
+func TestIntegrationReEncryptTree(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "tree.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	second, err := age.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	report, err := sops.ReEncryptTree(dir, age.FromKeys([]string{key.PublicKey, second.PublicKey}), sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("ReEncryptTree: %v", err)
+	}
+	if report.Count(sops.StatusOK) != 1 {
+		t.Fatalf("report: %s", report.Summary())
+	}
+
+	info, err := sops.GetFileInfo(path)
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if len(info.Recipients) != 2 {
+		t.Fatalf("recipients after re-keying = %v, want both keys", info.Recipients)
+	}
+}
+
+func TestIntegrationReEncryptTreeUnchanged(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "unchanged.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := sops.ReEncryptTree(dir, age.FromKeys([]string{key.PublicKey}), sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("ReEncryptTree: %v", err)
+	}
+	if report.Count(sops.StatusUnchanged) != 1 {
+		t.Fatalf("report: %s", report.Summary())
+	}
+
+	changed, err := sops.AddRecipient(path, age.Recipient{Key: key.PublicKey})
+	if err != nil {
+		t.Fatalf("AddRecipient: %v", err)
+	}
+	if changed {
+		t.Fatal("AddRecipient rewrote a file that already had the recipient")
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("a no-op re-key rewrote the file")
+	}
+}
+
+func TestIntegrationBinaryRoundTrip(t *testing.T) {
+	dir, key, identity := setup(t)
+
+	// A PNG-like header, then bytes that are not valid UTF-8
+	blob := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00, 0xff, 0xfe, 0x80, 0x01}
+
+	// The extension suggests YAML, so only the content reveals it is binary
+	path := filepath.Join(dir, "blob.yaml")
+	if err := os.WriteFile(path, blob, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := sops.GetFileInfo(path)
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if info.Format != sops.FormatBinary {
+		t.Fatalf("format before encrypting = %q, want binary", info.Format)
+	}
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	info, err = sops.GetFileInfo(path)
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if !info.Encrypted || info.Format != sops.FormatBinary {
+		t.Fatalf("after encrypting: encrypted = %v, format = %q", info.Encrypted, info.Format)
+	}
+
+	data, err := sops.DecryptToMemory(path, sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("DecryptToMemory: %v", err)
+	}
+	if !bytes.Equal(data, blob) {
+		t.Fatalf("round trip mismatch: got %x, want %x", data, blob)
+	}
+
+	output := filepath.Join(dir, "blob.out")
+	if err := sops.DecryptFile(path, false, output, sops.WithIdentity(identity)); err != nil {
+		t.Fatalf("DecryptFile: %v", err)
+	}
+	decrypted, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, blob) {
+		t.Fatalf("decrypted file mismatch: got %x, want %x", decrypted, blob)
+	}
+}
+
+func TestIntegrationDefaultPathsWithoutHome(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", "")
+	os.Unsetenv("HOME")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	keyPath, err := age.DefaultKeyPath()
+	if err != nil {
+		// Only acceptable when the account database has no home either
+		if apperrors.Code(err) != apperrors.CodeConfigInvalid {
+			t.Fatalf("DefaultKeyPath: unexpected error %v", err)
+		}
+	} else if !filepath.IsAbs(keyPath) {
+		t.Fatalf("DefaultKeyPath = %q, want an absolute path", keyPath)
+	}
+
+	encryptedKeyPath, err := age.DefaultEncryptedKeyPath()
+	if err == nil && (!filepath.IsAbs(encryptedKeyPath) || encryptedKeyPath == ".encrypted") {
+		t.Fatalf("DefaultEncryptedKeyPath = %q, want an absolute path", encryptedKeyPath)
+	}
+
+	cfg := config.DefaultConfig()
+	for _, path := range []string{cfg.KeyPath, cfg.EncryptedKeyPath} {
+		if path != "" && !filepath.IsAbs(path) {
+			t.Fatalf("default config has the relative key path %q", path)
+		}
+	}
+
+	configPath, err := config.ConfigPath()
+	if err != nil {
+		t.Fatalf("ConfigPath: %v", err)
+	}
+	if want := filepath.Join(dir, "config"); !strings.HasPrefix(configPath, want) {
+		t.Fatalf("ConfigPath = %q, want it under %s", configPath, want)
+	}
+
+	// An empty key path is refused instead of writing to the working directory
+	err = age.SaveKey(&age.KeyPair{PrivateKey: "AGE-SECRET-KEY-1"}, "")
+	if apperrors.Code(err) != apperrors.CodeConfigInvalid {
+		t.Fatalf("SaveKey with an empty path: got %v, want %s", err, apperrors.CodeConfigInvalid)
+	}
+}
+
+func TestIntegrationDecryptIntoMissingDir(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "missing.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	outDir := filepath.Join(dir, "out", "nested")
+	output := filepath.Join(outDir, "missing.dec.yaml")
+	err := sops.DecryptFile(path, false, output, sops.WithIdentity(identity))
+	if apperrors.Code(err) != apperrors.CodeDirNotFound {
+		t.Fatalf("DecryptFile into a missing directory: got %v, want %s", err, apperrors.CodeDirNotFound)
+	}
+	if !strings.Contains(err.Error(), outDir) {
+		t.Fatalf("error %q does not name the directory %s", err, outDir)
+	}
+	if utils.FileExists(outDir) {
+		t.Fatal("the missing directory was created without being asked for")
+	}
+
+	if err := sops.DecryptFile(path, false, output, sops.WithIdentity(identity), sops.WithCreateOutputDir()); err != nil {
+		t.Fatalf("DecryptFile with WithCreateOutputDir: %v", err)
+	}
+	decrypted, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != sampleYAML {
+		t.Fatalf("got:\n%s\nwant:\n%s", decrypted, sampleYAML)
+	}
+	info, err := os.Stat(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Fatalf("created directory has mode %o, want 700", perm)
+	}
+}
+
+func TestIntegrationDecryptIntoUnwritableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	path := writeSample(t, dir, "unwritable.yaml")
+
+	outDir := filepath.Join(dir, "locked")
+	if err := os.Mkdir(outDir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(outDir, 0o700) })
+
+	// The directory is checked before sops runs, so no binaries are needed
+	output := filepath.Join(outDir, "unwritable.dec.yaml")
+	err := sops.DecryptFile(path, false, output, sops.WithCreateOutputDir())
+	if apperrors.Code(err) != apperrors.CodeFileWriteFailed || !apperrors.IsFileError(err) {
+		t.Fatalf("DecryptFile into an unwritable directory: got %v, want a %s file operation error", err, apperrors.CodeFileWriteFailed)
+	}
+	if !strings.Contains(err.Error(), outDir) {
+		t.Fatalf("error %q does not name the directory %s", err, outDir)
+	}
+
+	err = sops.EncryptToFile(path, output, age.FromKeys([]string{"age1unused"}))
+	if apperrors.Code(err) != apperrors.CodeFileWriteFailed {
+		t.Fatalf("EncryptToFile into an unwritable directory: got %v, want %s", err, apperrors.CodeFileWriteFailed)
+	}
+
+	// Nothing is left behind by the writability probe
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("the unwritable directory holds %d entries, want none", len(entries))
+	}
+}
+
+func TestIntegrationCheckoutCheckin(t *testing.T) {
+	dir, key, identity := setup(t)
+	path := writeSample(t, dir, "checkout.yaml")
+
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	working := filepath.Join(dir, "work", "checkout.yaml")
+	if _, err := sops.Checkout(path, working, sops.WithIdentity(identity), sops.WithCreateOutputDir()); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if len(history.Outstanding()) != 1 {
+		t.Fatalf("outstanding checkouts = %v, want the working copy", history.Outstanding())
+	}
+
+	edited := sampleYAML + "extra: added\n"
+	if err := os.WriteFile(working, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sops.Checkin(working, utils.DefaultWipeOptions()); err != nil {
+		t.Fatalf("Checkin: %v", err)
+	}
+	if utils.FileExists(working) {
+		t.Fatal("the working copy was left on disk")
+	}
+	if len(history.Outstanding()) != 0 {
+		t.Fatalf("outstanding checkouts = %v, want none", history.Outstanding())
+	}
+
+	data, err := sops.DecryptToMemory(path, sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("DecryptToMemory: %v", err)
+	}
+	if string(data) != edited {
+		t.Fatalf("got:\n%s\nwant:\n%s", data, edited)
+	}
+
+	_, _, err = sops.Checkin(working, utils.DefaultWipeOptions())
+	if apperrors.Code(err) != apperrors.CodeNoCheckout {
+		t.Fatalf("second Checkin: got %v, want %s", err, apperrors.CodeNoCheckout)
+	}
+}
+
+func TestIntegrationEditPreservesComments(t *testing.T) {
+	dir, key, identity := setup(t)
+	const commented = `# Production database
+database:
+  # Rotated every quarter
+  user: app
+  # Keep in sync with the vault
+  password: hunter2
+zeta: last
+alpha: first
+`
+	path := filepath.Join(dir, "commented.yaml")
+	if err := os.WriteFile(path, []byte(commented), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sops.EncryptFile(path, age.FromKeys([]string{key.PublicKey}), true); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+
+	// An editor that changes one value of the text it is given, and nothing else
+	editor := filepath.Join(dir, "edit.sh")
+	script := "#!/bin/sh\nsed 's/hunter2/correct-horse/' \"$1\" > \"$1.new\" && cat \"$1.new\" > \"$1\" && rm \"$1.new\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := sops.EditFile(path, sops.WithIdentity(identity), sops.WithEditor(editor)); err != nil {
+		t.Fatalf("EditFile: %v", err)
+	}
+
+	data, err := sops.DecryptToMemory(path, sops.WithIdentity(identity))
+	if err != nil {
+		t.Fatalf("DecryptToMemory: %v", err)
+	}
+	decrypted := string(data)
+	if !strings.Contains(decrypted, "correct-horse") || strings.Contains(decrypted, "hunter2") {
+		t.Fatalf("the edit was not saved:\n%s", decrypted)
+	}
+	for _, comment := range []string{"# Production database", "# Rotated every quarter", "# Keep in sync with the vault"} {
+		if !strings.Contains(decrypted, comment) {
+			t.Errorf("comment %q was lost:\n%s", comment, decrypted)
+		}
+	}
+	if strings.Index(decrypted, "zeta:") > strings.Index(decrypted, "alpha:") {
+		t.Errorf("keys were reordered:\n%s", decrypted)
+	}
+}
+
+func TestIntegrationResolvePathSymlinkModes(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	target := writeSample(t, dir, "secrets.yaml")
+	link := filepath.Join(dir, "link.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	realTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		mode string
+		want string
+	}{
+		{name: "default", mode: "", want: realTarget},
+		{name: "target", mode: config.SymlinkTarget, want: realTarget},
+		{name: "link", mode: config.SymlinkLink, want: link},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SUPPER_SYMLINK_MODE", tc.mode)
+			got, err := sops.ResolvePath(link)
+			if err != nil {
+				t.Fatalf("ResolvePath: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ResolvePath = %s, want %s", got, tc.want)
+			}
+			// A regular file is never changed
+			if got, err := sops.ResolvePath(target); err != nil || got != target {
+				t.Errorf("ResolvePath(target) = %s, %v, want %s", got, err, target)
+			}
+		})
+	}
+
+	t.Run("refuse", func(t *testing.T) {
+		t.Setenv("SUPPER_SYMLINK_MODE", config.SymlinkRefuse)
+		if _, err := sops.ResolvePath(link); apperrors.Code(err) != apperrors.CodeFileSymlink {
+			t.Errorf("ResolvePath error = %v, want %s", err, apperrors.CodeFileSymlink)
+		}
+		if got, err := sops.ResolvePath(target); err != nil || got != target {
+			t.Errorf("ResolvePath(target) = %s, %v, want %s", got, err, target)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package sops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// LabelsFileName is the sidecar holding the labels of the files in a directory
+const LabelsFileName = ".supper-labels.json"
+
+// MaxLabelLength bounds a label to a short human note
+const MaxLabelLength = 120
+
+// secretPatterns match text that looks like key material rather than a note
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`AGE-SECRET-KEY-`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY`),
+}
+
+// tokenPattern matches long unbroken runs such as API keys and passwords
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_-]{32,}`)
+
+// labelsPath returns the sidecar for a file, following symlinks so a link
+// and its target share one label
+func labelsPath(filePath string) (string, string) {
+	real := utils.RealPath(filePath)
+	return filepath.Join(filepath.Dir(real), LabelsFileName), filepath.Base(real)
+}
+
+// LoadLabels returns the labels of the files in a directory, keyed by file
+// name. A directory without a sidecar has no labels.
+func LoadLabels(dir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, LabelsFileName))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to read labels").
+			WithData("dir", dir)
+	}
+
+	labels := map[string]string{}
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, errors.Wrap(err, errors.TypeConfig, "Invalid labels file").
+			WithCode(errors.CodeConfigInvalid).WithData("path", filepath.Join(dir, LabelsFileName))
+	}
+	return labels, nil
+}
+
+// Label returns the label of a file, or "" when it has none
+func Label(filePath string) string {
+	sidecar, name := labelsPath(filePath)
+	labels, err := LoadLabels(filepath.Dir(sidecar))
+	if err != nil {
+		return ""
+	}
+	return labels[name]
+}
+
+// ValidateLabel rejects labels that are not a short single-line note or that
+// look like secret content. Labels are stored in plaintext next to the file.
+func ValidateLabel(label string) error {
+	if strings.ContainsAny(label, "\r\n") {
+		return errors.New(errors.TypeGeneral, "A label must be a single line").WithCode(errors.CodeLabelInvalid)
+	}
+	if utf8.RuneCountInString(label) > MaxLabelLength {
+		return errors.New(errors.TypeGeneral, fmt.Sprintf("A label must be at most %d characters", MaxLabelLength)).WithCode(errors.CodeLabelInvalid)
+	}
+	if looksLikeSecret(label) {
+		return errors.New(errors.TypeSecurity, "The label looks like it contains secret content; labels are stored unencrypted").
+			WithCode(errors.CodeLabelInvalid)
+	}
+	return nil
+}
+
+// looksLikeSecret reports whether the label contains key material or a long
+// run of mixed letters and digits; long hyphenated words alone are fine
+func looksLikeSecret(label string) bool {
+	for _, pattern := range secretPatterns {
+		if pattern.MatchString(label) {
+			return true
+		}
+	}
+	for _, run := range tokenPattern.FindAllString(label, -1) {
+		if strings.ContainsAny(run, "0123456789") && strings.IndexFunc(run, unicode.IsLetter) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLabel sets the label of a file; an empty label removes it. The sidecar
+// is keyed by file name, so the label is kept when the file is re-encrypted
+// or re-keyed in place.
+func SetLabel(filePath, label string) error {
+	label = strings.TrimSpace(label)
+	if err := ValidateLabel(label); err != nil {
+		return err
+	}
+
+	sidecar, name := labelsPath(filePath)
+	labels, err := LoadLabels(filepath.Dir(sidecar))
+	if err != nil {
+		return err
+	}
+
+	if label == "" {
+		delete(labels, name)
+	} else {
+		labels[name] = label
+	}
+
+	if len(labels) == 0 {
+		if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, errors.TypeFileOperation, "Failed to remove labels file").
+				WithCode(errors.CodeFileDeleteFailed).WithData("path", sidecar)
+		}
+		return nil
+	}
+
+	return writeLabels(sidecar, labels)
+}
+
+// writeLabels replaces the sidecar in one step. encoding/json sorts the
+// keys, which keeps diffs of a committed sidecar small.
+func writeLabels(sidecar string, labels map[string]string) error {
+	data, err := json.MarshalIndent(labels, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := sidecar + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to write labels").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", sidecar)
+	}
+	if err := os.Rename(tmp, sidecar); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to write labels").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", sidecar)
+	}
+	return nil
+}
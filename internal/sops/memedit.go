@@ -0,0 +1,141 @@
+package sops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+	"github.com/bxtal-lsn/supper/internal/secure"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// withEncryptArgs passes extra flags to sops when encrypting
+func withEncryptArgs(args ...string) Option {
+	return func(o *options) {
+		o.encryptArgs = append(o.encryptArgs, args...)
+	}
+}
+
+// DecryptForEdit decrypts a file for editing in memory and returns the
+// plaintext in a buffer the caller wipes once done with it. SaveEdit encrypts
+// the edited text back, so unlike EditFile no plaintext file is ever handed
+// to an editor. Files that cannot be encrypted back the same way are refused
+// up front: binary and age files, and files with several key groups.
+func DecryptForEdit(filePath string, opts ...Option) (*secure.Buffer, error) {
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return nil, err
+	}
+	if err := checkWritable(filePath); err != nil {
+		return nil, err
+	}
+	if _, _, err := editMetadata(filePath); err != nil {
+		return nil, err
+	}
+
+	data, err := DecryptToMemory(filePath, append(opts, untracked())...)
+	if err != nil {
+		return nil, err
+	}
+	newOptions(opts).recordAccess(filePath, "edit", "")
+	return secure.NewBuffer(data), nil
+}
+
+// SaveEdit encrypts the edited plaintext back over the file at filePath. The
+// text is piped to sops and the ciphertext written beside the file before
+// replacing it, so the plaintext never reaches the disk and a failed save
+// leaves the file as it was. The file keeps its recipients and the values
+// it leaves unencrypted. plaintext is wiped whether or not the save succeeds.
+func SaveEdit(filePath string, plaintext *secure.Buffer, opts ...Option) error {
+	defer plaintext.Wipe()
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if err := checkWritable(filePath); err != nil {
+		return err
+	}
+	md, recipients, err := editMetadata(filePath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to read file").
+			WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+	target := utils.RealPath(filePath)
+	tmp, err := os.CreateTemp(filepath.Dir(target), TempPrefix+"*")
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to create temporary file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", filePath)
+	}
+	defer os.Remove(tmp.Name())
+
+	opts = append(opts, withEncryptArgs(md.partialArgs()...))
+	err = plaintext.Use(func(secret []byte) error {
+		return EncryptStream(bytes.NewReader(secret), DetectFormat(filePath), recipients, tmp, opts...)
+	})
+	closeErr := tmp.Close()
+	switch {
+	case err != nil:
+		return err
+	case closeErr != nil:
+		return errors.Wrap(closeErr, errors.TypeFileOperation, "Failed to write encrypted output").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", filePath)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to write encrypted output").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", filePath)
+	}
+
+	tm := recovery.NewTransactionManager()
+	if err := o.begin(tm, filePath); err != nil {
+		return err
+	}
+	// Renaming onto a symlink would replace the link, so replace its target
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to write encrypted output").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", filePath)
+	}
+	tm.Commit()
+	return nil
+}
+
+// editMetadata returns the metadata of a file to be edited in memory and the
+// recipients it is encrypted back to. As with a checkout, a file with several
+// key groups is refused, since a flat recipient list would change who has to
+// cooperate to decrypt it.
+func editMetadata(filePath string) (*Metadata, []age.Recipient, error) {
+	if IsAgeFile(filePath) || DetectFormat(filePath) == FormatBinary {
+		return nil, nil, errors.New(errors.TypeFileOperation, "Binary files cannot be edited in the built-in editor; use an external editor").
+			WithCode(errors.CodeFormatUnsupported).WithData("path", filePath)
+	}
+	md, err := ReadMetadata(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(md.KeyGroups) > 1 {
+		return nil, nil, errors.New(errors.TypeFileOperation, "The file has several key groups and cannot be edited in the built-in editor; use an external editor").
+			WithCode(errors.CodeEditFailed).WithData("path", filePath)
+	}
+	recipients := md.AllRecipients()
+	if len(recipients) == 0 {
+		return nil, nil, errors.New(errors.TypeFileOperation, "The file lists no recipients to encrypt it back to").
+			WithCode(errors.CodeEditFailed).WithData("path", filePath)
+	}
+	return md, recipients, nil
+}
+
@@ -0,0 +1,366 @@
+package sops
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyGroup is a set of recipients that together hold one share of the data
+// key. With several groups and a Shamir threshold, a file can only be
+// decrypted by members of at least threshold different groups.
+type KeyGroup struct {
+	Recipients []age.Recipient // Keys of every kind; see age.Recipient.Kind
+
+	// other holds the keys of a .sops.yaml key group that are not age keys,
+	// by kind, as they were written
+	other map[string]interface{}
+}
+
+// KeepOtherKeys gives g the keys of other kinds than age that from was read
+// with from .sops.yaml, so a group edited as a list of age keys keeps them
+func (g *KeyGroup) KeepOtherKeys(from KeyGroup) {
+	g.other = from.other
+}
+
+// Keys returns the public keys of the group's age recipients
+func (g KeyGroup) Keys() []string {
+	return age.KeysOfKind(g.Recipients, age.KindAge)
+}
+
+// Metadata is the sops section stored inside an encrypted file
+type Metadata struct {
+	KeyGroups       []KeyGroup
+	ShamirThreshold int
+	LastModified    string
+	MAC             string
+	Version         string
+
+	// The values sops leaves unencrypted, as chosen when the file was first
+	// encrypted; at most one is set
+	EncryptedRegex    string
+	UnencryptedRegex  string
+	EncryptedSuffix   string
+	UnencryptedSuffix string
+}
+
+// Recipients returns every age recipient across all key groups
+func (m *Metadata) Recipients() []string {
+	var keys []string
+	for _, g := range m.KeyGroups {
+		keys = append(keys, g.Keys()...)
+	}
+	return keys
+}
+
+// AllRecipients returns the recipients of every kind across all key groups
+func (m *Metadata) AllRecipients() []age.Recipient {
+	var recipients []age.Recipient
+	for _, g := range m.KeyGroups {
+		recipients = append(recipients, g.Recipients...)
+	}
+	return recipients
+}
+
+// partialArgs returns the sops flags that leave the same values unencrypted
+// as in the file m was read from
+func (m *Metadata) partialArgs() []string {
+	switch {
+	case m.EncryptedRegex != "":
+		return []string{"--encrypted-regex", m.EncryptedRegex}
+	case m.UnencryptedRegex != "":
+		return []string{"--unencrypted-regex", m.UnencryptedRegex}
+	case m.EncryptedSuffix != "":
+		return []string{"--encrypted-suffix", m.EncryptedSuffix}
+	case m.UnencryptedSuffix != "":
+		return []string{"--unencrypted-suffix", m.UnencryptedSuffix}
+	}
+	return nil
+}
+
+// CanDecrypt reports whether the holders of the given public keys can decrypt
+// the file: they need a key in at least threshold groups, or in every group
+// when no threshold is set. Only age recipients are compared, so a group
+// without any is assumed to be decryptable by other means.
+func (m *Metadata) CanDecrypt(publicKeys []string) bool {
+	if len(m.KeyGroups) == 0 {
+		return true
+	}
+
+	have := make(map[string]bool, len(publicKeys))
+	for _, k := range publicKeys {
+		have[strings.TrimSpace(k)] = true
+	}
+
+	covered := 0
+	for _, g := range m.KeyGroups {
+		keys := g.Keys()
+		if len(keys) == 0 {
+			covered++
+			continue
+		}
+		for _, k := range keys {
+			if have[k] {
+				covered++
+				break
+			}
+		}
+	}
+
+	threshold := m.ShamirThreshold
+	if threshold <= 0 || len(m.KeyGroups) == 1 {
+		threshold = len(m.KeyGroups)
+	}
+	return covered >= threshold
+}
+
+// keyEntry is a master key as stored in file metadata. Only its string
+// fields are needed to tell which key it is.
+type keyEntry map[string]interface{}
+
+// keyEntries are the master keys of a group as stored in file metadata. The
+// YAML keys match the age.Kind constants.
+type keyEntries struct {
+	Age     []keyEntry `yaml:"age"`
+	PGP     []keyEntry `yaml:"pgp"`
+	KMS     []keyEntry `yaml:"kms"`
+	GCPKMS  []keyEntry `yaml:"gcp_kms"`
+	AzureKV []keyEntry `yaml:"azure_kv"`
+	HCVault []keyEntry `yaml:"hc_vault"`
+}
+
+// recipients converts the stored keys of every kind into recipients
+func (k keyEntries) recipients() []age.Recipient {
+	byKind := map[string][]keyEntry{
+		age.KindAge:     k.Age,
+		age.KindPGP:     k.PGP,
+		age.KindKMS:     k.KMS,
+		age.KindGCPKMS:  k.GCPKMS,
+		age.KindAzureKV: k.AzureKV,
+		age.KindHCVault: k.HCVault,
+	}
+
+	var recipients []age.Recipient
+	for _, kind := range age.Kinds() {
+		for _, e := range byKind[kind] {
+			fields := make(map[string]string, len(e))
+			for name, value := range e {
+				if s, ok := value.(string); ok {
+					fields[name] = s
+				}
+			}
+			if r, ok := recipientFromFields(kind, fields); ok {
+				recipients = append(recipients, r)
+			}
+		}
+	}
+	return recipients
+}
+
+// recipientFromFields names the key stored with the given fields the way the
+// sops command line does. ok is false when the fields naming it are missing.
+func recipientFromFields(kind string, fields map[string]string) (r age.Recipient, ok bool) {
+	var key string
+	switch kind {
+	case age.KindAge:
+		key = fields["recipient"]
+	case age.KindPGP:
+		key = fields["fp"]
+	case age.KindKMS:
+		key = fields["arn"]
+	case age.KindGCPKMS:
+		key = fields["resource_id"]
+	case age.KindAzureKV:
+		if fields["vault_url"] != "" && fields["name"] != "" {
+			key = strings.TrimSuffix(fields["vault_url"], "/") + "/keys/" + fields["name"]
+			if version := fields["version"]; version != "" {
+				key += "/" + version
+			}
+		}
+	case age.KindHCVault:
+		if fields["vault_address"] != "" && fields["key_name"] != "" {
+			key = strings.TrimSuffix(fields["vault_address"], "/") + "/v1/" +
+				strings.Trim(fields["engine_path"], "/") + "/keys/" + fields["key_name"]
+		}
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return r, false
+	}
+	r.Key = key
+	if kind != age.KindAge {
+		r.Kind = kind
+	}
+	return r, true
+}
+
+// rawMetadata mirrors the sops section of YAML and JSON files
+type rawMetadata struct {
+	Sops *struct {
+		keyEntries      `yaml:",inline"`
+		KeyGroups       []keyEntries `yaml:"key_groups"`
+		ShamirThreshold int          `yaml:"shamir_threshold"`
+		LastModified    string       `yaml:"lastmodified"`
+		MAC             string       `yaml:"mac"`
+		Version         string       `yaml:"version"`
+
+		EncryptedRegex    string `yaml:"encrypted_regex"`
+		UnencryptedRegex  string `yaml:"unencrypted_regex"`
+		EncryptedSuffix   string `yaml:"encrypted_suffix"`
+		UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	} `yaml:"sops"`
+}
+
+// ReadMetadata parses the sops metadata of an encrypted file without decrypting it
+func ReadMetadata(filePath string) (*Metadata, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read file").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+
+	var md *Metadata
+	switch DetectFormat(filePath) {
+	case FormatDotenv, FormatINI:
+		md = parseFlatMetadata(string(data))
+	default:
+		// JSON is valid YAML, and binary files are stored as JSON
+		md = parseTreeMetadata(data)
+	}
+
+	if md == nil {
+		return nil, errors.New(errors.TypeFileOperation, "File has no sops metadata").
+			WithCode(errors.CodeFileNotEncrypted).WithData("path", filePath)
+	}
+	return md, nil
+}
+
+// parseTreeMetadata reads the sops key of a YAML or JSON document
+func parseTreeMetadata(data []byte) *Metadata {
+	var raw rawMetadata
+	if err := yaml.Unmarshal(data, &raw); err != nil || raw.Sops == nil {
+		return nil
+	}
+
+	md := &Metadata{
+		ShamirThreshold: raw.Sops.ShamirThreshold,
+		LastModified:    raw.Sops.LastModified,
+		MAC:             raw.Sops.MAC,
+		Version:         raw.Sops.Version,
+
+		EncryptedRegex:    raw.Sops.EncryptedRegex,
+		UnencryptedRegex:  raw.Sops.UnencryptedRegex,
+		EncryptedSuffix:   raw.Sops.EncryptedSuffix,
+		UnencryptedSuffix: raw.Sops.UnencryptedSuffix,
+	}
+
+	// Files with a single group store its keys at the top level
+	if len(raw.Sops.KeyGroups) == 0 {
+		if recipients := raw.Sops.recipients(); len(recipients) > 0 {
+			md.KeyGroups = []KeyGroup{{Recipients: recipients}}
+		}
+	}
+	for _, g := range raw.Sops.KeyGroups {
+		md.KeyGroups = append(md.KeyGroups, KeyGroup{Recipients: g.recipients()})
+	}
+	return md
+}
+
+// flatKeyPattern matches a field of a master key in flattened dotenv and INI
+// metadata, e.g. sops_key_groups__list_1__map_age__list_0__map_recipient=age1...
+var flatKeyPattern = regexp.MustCompile(`^(?:sops_)?(?:key_groups__list_(\d+)__map_)?(age|pgp|kms|gcp_kms|azure_kv|hc_vault)__list_(\d+)__map_(\w+)\s*=\s*(.*)$`)
+
+// flatKey collects the fields of one master key in flattened metadata
+type flatKey struct {
+	group  int
+	kind   string
+	fields map[string]string
+}
+
+// parseFlatMetadata reads the sops keys of a dotenv or INI file
+func parseFlatMetadata(data string) *Metadata {
+	md := &Metadata{}
+	var keys []*flatKey
+	byID := make(map[string]*flatKey)
+	found := false
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := flatKeyPattern.FindStringSubmatch(line); m != nil {
+			found = true
+			group := 0
+			if m[1] != "" {
+				group, _ = strconv.Atoi(m[1])
+			}
+			id := m[1] + "/" + m[2] + "/" + m[3]
+			k := byID[id]
+			if k == nil {
+				k = &flatKey{group: group, kind: m[2], fields: make(map[string]string)}
+				byID[id] = k
+				keys = append(keys, k)
+			}
+			k.fields[m[4]] = strings.TrimSpace(m[5])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimPrefix(strings.TrimSpace(key), "sops_")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "shamir_threshold":
+			md.ShamirThreshold, _ = strconv.Atoi(value)
+		case "lastmodified":
+			md.LastModified = value
+			found = true
+		case "mac":
+			md.MAC = value
+		case "version":
+			md.Version = value
+		case "encrypted_regex":
+			md.EncryptedRegex = value
+		case "unencrypted_regex":
+			md.UnencryptedRegex = value
+		case "encrypted_suffix":
+			md.EncryptedSuffix = value
+		case "unencrypted_suffix":
+			md.UnencryptedSuffix = value
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	groups := make(map[int]*KeyGroup)
+	for _, k := range keys {
+		if groups[k.group] == nil {
+			groups[k.group] = &KeyGroup{}
+		}
+		if r, ok := recipientFromFields(k.kind, k.fields); ok {
+			groups[k.group].Recipients = append(groups[k.group].Recipients, r)
+		}
+	}
+
+	indexes := make([]int, 0, len(groups))
+	for i := range groups {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		md.KeyGroups = append(md.KeyGroups, *groups[i])
+	}
+	return md
+}
@@ -0,0 +1,207 @@
+package sops
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+)
+
+// stopDelay is how long a stopped sops run may take to release its output
+const stopDelay = 5 * time.Second
+
+// Option configures an optional behaviour of a SOPS operation
+type Option func(*options)
+
+// options holds the optional settings shared by SOPS operations
+type options struct {
+	ctx              context.Context
+	outputType       string
+	stdout           io.Writer
+	env              []string
+	isolated         bool
+	noBackup         bool
+	createDir        bool
+	noEncryptedRegex bool
+	untracked        bool
+	encryptArgs      []string
+	progress         func(FileResult)
+	jobs             func(Job)
+	gitScope         string
+	nonInteractive   bool
+	timeout          time.Duration
+	timeoutCtx       context.Context    // Set once a command with a timeout is built
+	stopTimeout      context.CancelFunc // Releases timeoutCtx's timer early; it also goes when it fires
+}
+
+// newOptions applies the given options over the defaults
+func newOptions(opts []Option) *options {
+	o := &options{ctx: context.Background(), stdout: os.Stdout}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithOutputType requests a different output serialization than the input
+func WithOutputType(format string) Option {
+	return func(o *options) {
+		o.outputType = format
+	}
+}
+
+// WithStdout sets where output that is not written to a file goes
+func WithStdout(w io.Writer) Option {
+	return func(o *options) {
+		o.stdout = w
+	}
+}
+
+// WithContext ties the operation to ctx; cancelling it kills the sops process
+// and rolls back any changes made to the file
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithIdentity passes an age identity to sops through its environment instead
+// of the default key file
+func WithIdentity(identity age.Identity) Option {
+	return func(o *options) {
+		o.env = append(o.env, identity.Env()...)
+	}
+}
+
+// withOnlyIdentity passes sops identity and nothing else: the identities
+// named in the environment are dropped and sops looks for its default key
+// file in configDir, which should be empty
+func withOnlyIdentity(identity age.Identity, configDir string) Option {
+	return func(o *options) {
+		o.isolated = true
+		o.env = append(o.env, identity.Env()...)
+		o.env = append(o.env, "XDG_CONFIG_HOME="+configDir)
+	}
+}
+
+// WithoutBackup skips the backup normally taken before a file is modified in
+// place. A failed operation can then not be rolled back.
+func WithoutBackup() Option {
+	return func(o *options) {
+		o.noBackup = true
+	}
+}
+
+// WithCreateOutputDir creates a missing output directory, with only the
+// owner allowed in, instead of failing with a CodeDirNotFound error
+func WithCreateOutputDir() Option {
+	return func(o *options) {
+		o.createDir = true
+	}
+}
+
+// WithProgress calls fn with the result of each file of a batch operation as
+// soon as it is done. fn may be called from several goroutines at once.
+func WithProgress(fn func(FileResult)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithJobUpdates calls fn each time a file of a batch operation is queued,
+// starts or finishes, so that callers can show where each file is. fn may be
+// called from several goroutines at once.
+func WithJobUpdates(fn func(Job)) Option {
+	return func(o *options) {
+		o.jobs = fn
+	}
+}
+
+// WithNonInteractive runs sops as in a script, with no one to answer a
+// prompt. sops gets no terminal to ask for a passphrase on, so a prompt fails
+// straight away with a CodeSOPSPromptRequired error saying how to supply the
+// credential instead. A positive timeout kills a sops process still running
+// after it, in case something waits for input regardless; the error then has
+// code CodeSOPSTimeout.
+func WithNonInteractive(timeout time.Duration) Option {
+	return func(o *options) {
+		o.nonInteractive = true
+		o.timeout = timeout
+	}
+}
+
+// begin backs up filePath in tm unless backups were disabled for the operation
+func (o *options) begin(tm *recovery.TransactionManager, filePath string) error {
+	if o.noBackup {
+		return nil
+	}
+	return tm.Begin(filePath)
+}
+
+// notify reports the result of a file of a batch operation
+func (o *options) notify(result FileResult) {
+	if o.progress != nil {
+		o.progress(result)
+	}
+}
+
+// command builds a sops command bound to the operation's context
+func (o *options) command(args ...string) *exec.Cmd {
+	return o.commandFor("sops", args...)
+}
+
+// commandFor builds a command running program, sops or age, under the same
+// context, environment and timeout rules as a sops command
+func (o *options) commandFor(program string, args ...string) *exec.Cmd {
+	ctx := o.ctx
+	if o.nonInteractive && o.timeout > 0 {
+		if o.stopTimeout != nil {
+			o.stopTimeout()
+		}
+		o.timeoutCtx, o.stopTimeout = context.WithTimeout(o.ctx, o.timeout)
+		ctx = o.timeoutCtx
+	}
+
+	cmd := exec.CommandContext(ctx, program, args...)
+	if len(o.env) > 0 || o.nonInteractive {
+		cmd.Env = append(o.baseEnv(), o.env...)
+	}
+	if o.nonInteractive {
+		detachTerminal(cmd)
+		// A killed process may leave children holding its output open
+		cmd.WaitDelay = stopDelay
+	}
+	return cmd
+}
+
+// baseEnv is the environment sops inherits before the operation's own entries
+func (o *options) baseEnv() []string {
+	if !o.isolated && !o.nonInteractive {
+		return os.Environ()
+	}
+
+	var env []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		switch {
+		case o.isolated && (name == age.EnvSOPSAgeKey || name == age.EnvSOPSAgeKeyFile || name == "XDG_CONFIG_HOME"):
+			continue
+		case o.nonInteractive && name == "GPG_TTY":
+			// gpg-agent would otherwise open this terminal for its pinentry
+			continue
+		}
+		env = append(env, entry)
+	}
+	return env
+}
+
+// IsCancelled reports whether err resulted from cancelling the operation's context
+func IsCancelled(err error) bool {
+	return stderrors.Is(err, context.Canceled)
+}
@@ -0,0 +1,139 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// CheckOutputDir reports whether a file can be created at outputPath. A
+// missing directory has code CodeDirNotFound, so the caller can offer to
+// create it; a directory that cannot be written to has CodeFileWriteFailed.
+// Both name the directory, since sops only says it could not write the file.
+func CheckOutputDir(outputPath string) error {
+	dir := filepath.Dir(outputPath)
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return errors.New(errors.TypeFileOperation, fmt.Sprintf("The output directory %s does not exist", dir)).
+			WithCode(errors.CodeDirNotFound).WithData("directory", dir)
+	}
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, fmt.Sprintf("The output directory %s cannot be read", dir)).
+			WithCode(errors.CodeFileWriteFailed).WithData("directory", dir)
+	}
+	if !info.IsDir() {
+		return errors.New(errors.TypeFileOperation, fmt.Sprintf("%s is not a directory", dir)).
+			WithCode(errors.CodeFileWriteFailed).WithData("directory", dir)
+	}
+
+	// Permission bits do not tell the whole story (ACLs, read-only mounts,
+	// root), so try what sops will do
+	probe, err := os.CreateTemp(dir, TempPrefix+"probe-*")
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, fmt.Sprintf("The output directory %s is not writable", dir)).
+			WithCode(errors.CodeFileWriteFailed).WithData("directory", dir)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// CreateOutputDir creates the missing directories leading to outputPath,
+// with only the owner allowed in, since they are about to hold plaintext
+func CreateOutputDir(outputPath string) error {
+	dir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, fmt.Sprintf("Failed to create the output directory %s", dir)).
+			WithCode(errors.CodeFileWriteFailed).WithData("directory", dir)
+	}
+	return nil
+}
+
+// prepareOutputDir checks the directory of outputPath before sops runs and,
+// with create, makes it when it is missing
+func prepareOutputDir(outputPath string, create bool) error {
+	err := CheckOutputDir(outputPath)
+	if errors.Code(err) != errors.CodeDirNotFound || !create {
+		return err
+	}
+	if err := CreateOutputDir(outputPath); err != nil {
+		return err
+	}
+	return CheckOutputDir(outputPath)
+}
+
+// DecryptedFileMode is the mode decrypted files are written with, whatever
+// sops or an existing file would use: only the owner can read the plaintext
+const DecryptedFileMode os.FileMode = 0o600
+
+// ExposedDir reports whether users other than the owner can add, replace or
+// remove files in dir: it is writable by its group or by everyone, without the
+// sticky bit that keeps them off files they do not own, as /tmp has.
+// Decrypted files are always written with DecryptedFileMode, so a readable
+// directory only shows their names.
+func ExposedDir(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	return info.Mode().Perm()&0o022 != 0 && info.Mode()&os.ModeSticky == 0
+}
+
+// OutputExposure returns a warning when plaintext written to outputPath would
+// land in an exposed directory, see ExposedDir, or "" when it would not
+func OutputExposure(outputPath string) string {
+	dir := filepath.Dir(outputPath)
+	if !ExposedDir(dir) {
+		return ""
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("The output directory %s can be written to by other users (mode %04o), who could swap or remove the decrypted file",
+		dir, info.Mode().Perm())
+}
+
+// strictOutputDir reports whether exposed output directories are refused
+func strictOutputDir() bool {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	return cfg.StrictOutputDir
+}
+
+// checkOutputExposure refuses to write plaintext to outputPath when its
+// directory is exposed and strict_output_dir is set; otherwise the caller
+// warns with OutputExposure
+func checkOutputExposure(outputPath string) error {
+	warning := OutputExposure(outputPath)
+	if warning == "" || !strictOutputDir() {
+		return nil
+	}
+	return errors.New(errors.TypeSecurity,
+		warning+"; decrypt somewhere private, or turn off Strict Output Directory").
+		WithCode(errors.CodeOutputExposed).WithData("directory", filepath.Dir(outputPath))
+}
+
+// restrictOutput gives outputPath DecryptedFileMode before sops writes
+// plaintext to it, creating it empty when it is missing. sops keeps the mode
+// of a file it overwrites, so the plaintext is never readable by others,
+// not even for a moment.
+func restrictOutput(outputPath string) error {
+	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE, DecryptedFileMode)
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to create the output file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	file.Close()
+	if err := os.Chmod(outputPath, DecryptedFileMode); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to restrict the permissions of the output file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package sops
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// PolicyViolation describes an encrypted file that lacks required recipients,
+// or whose recipients could not be read to tell
+type PolicyViolation struct {
+	Path    string          `json:"path"`
+	Missing []age.Recipient `json:"missing"`
+	Error   string          `json:"error,omitempty"` // Why the recipients could not be read
+}
+
+// RequiredRecipients returns the recipients mandated by the configuration
+func RequiredRecipients() ([]age.Recipient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	return age.ResolveRecipients(age.SplitRecipientInput(cfg.RequiredRecipients))
+}
+
+// CheckPolicy returns the required recipients that an encrypted file lacks
+func CheckPolicy(filePath string) (missing []age.Recipient, err error) {
+	required, err := RequiredRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return checkRecipients(newOptions(nil), filePath, required)
+}
+
+// checkRecipients compares a file's recipients against the required set
+func checkRecipients(o *options, filePath string, required []age.Recipient) ([]age.Recipient, error) {
+	info, err := fileInfo(o, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Encrypted {
+		return nil, errors.New(errors.TypeFileOperation, "File is not encrypted").
+			WithCode(errors.CodeFileNotEncrypted).WithData("path", filePath)
+	}
+
+	present := info.AllRecipients()
+
+	var missing []age.Recipient
+	for _, r := range required {
+		if !containsRecipient(present, r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing, nil
+}
+
+// ScanPolicy walks a directory and reports encrypted files that lack required
+// recipients. An encrypted file whose recipients cannot be read is reported
+// with the error rather than passing. Unencrypted files, hidden directories
+// and the files outside a WithGitScope scope are skipped.
+func ScanPolicy(dir string, opts ...Option) ([]PolicyViolation, error) {
+	required, err := RequiredRecipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(required) == 0 {
+		return nil, nil
+	}
+	o := newOptions(opts)
+	git, err := newGitFilter(dir, o.gitScope)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []PolicyViolation
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if (path != dir && strings.HasPrefix(d.Name(), ".")) || git.excludes(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if git.excludes(path, false) {
+			return nil
+		}
+
+		info, err := fileInfo(o, path)
+		switch {
+		case errors.Code(err) == errors.CodeSOPSTimeout || errors.Code(err) == errors.CodeSOPSPromptRequired:
+			// sops never said whether the file is encrypted, so it has not passed
+			violations = append(violations, PolicyViolation{Path: path, Error: err.Error()})
+			return nil
+		case err != nil || !info.Encrypted:
+			return nil
+		}
+
+		missing, err := checkRecipients(o, path, required)
+		if err != nil {
+			violations = append(violations, PolicyViolation{Path: path, Error: err.Error()})
+			return nil
+		}
+		if len(missing) > 0 {
+			violations = append(violations, PolicyViolation{Path: path, Missing: missing})
+		}
+		return nil
+	})
+	if err != nil {
+		return violations, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to scan directory").WithCode(errors.CodeFileNotFound).WithData("directory", dir)
+	}
+
+	return violations, nil
+}
+
+// AddMissingRecipients adds each missing recipient to the file. Recipients
+// the file already has are skipped without rewriting it. opts apply to each
+// AddRecipient.
+func AddMissingRecipients(filePath string, missing []age.Recipient, opts ...Option) error {
+	for _, r := range missing {
+		if _, err := AddRecipient(filePath, r, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
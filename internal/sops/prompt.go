@@ -0,0 +1,41 @@
+package sops
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// errPrompt matches what sops, gpg and the key services print when they
+// wanted to ask for a passphrase or PIN but had no terminal to ask on
+var errPrompt = regexp.MustCompile(`(?i)inappropriate ioctl|/dev/tty|no such device or address|pinentry|no terminal|not a terminal|could not read passphrase|failed to read passphrase|enter passphrase`)
+
+// promptHint tells how to give sops each kind of credential without a prompt
+const promptHint = "for age keys set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE (or pass --identity-env), " +
+	"for PGP keys preset the passphrase in gpg-agent with gpg-preset-passphrase, " +
+	"and for cloud KMS keys provide credentials in the environment"
+
+// parseError explains why a sops command built by command failed. Without a
+// terminal, a timeout and a failed prompt are reported as such; anything
+// else goes through ParseSOPSError.
+func (o *options) parseError(cmdErr error, stderr string) error {
+	if cmdErr == nil {
+		return nil
+	}
+	if o.nonInteractive {
+		if o.timeoutCtx != nil && stderrors.Is(o.timeoutCtx.Err(), context.DeadlineExceeded) && o.ctx.Err() == nil {
+			return errors.Wrap(cmdErr, errors.TypeSecurity,
+				fmt.Sprintf("SOPS did not finish within %s and was stopped; it may have been waiting for a passphrase. To run without prompts, %s", o.timeout, promptHint)).
+				WithCode(errors.CodeSOPSTimeout).WithData("timeout", o.timeout.String()).WithData("stderr", stderr)
+		}
+		if errPrompt.MatchString(stderr) {
+			return errors.Wrap(cmdErr, errors.TypeSecurity,
+				"SOPS needs a passphrase or other input, but there is no terminal to ask on; "+promptHint).
+				WithCode(errors.CodeSOPSPromptRequired).WithData("stderr", stderr)
+		}
+	}
+	return ParseSOPSError(cmdErr, stderr)
+}
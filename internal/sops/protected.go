@@ -0,0 +1,69 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// ProtectedPaths lists the files the generic file operations must never
+// encrypt, decrypt over or edit: the configured decrypted and encrypted age
+// keys, the key file sops is pointed at and the configured protected_paths.
+// Encrypting the key with sops would lock its owner out, so it is managed
+// from the key manager instead.
+func ProtectedPaths() []string {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	var paths []string
+	candidates := append([]string{cfg.KeyPath, cfg.EncryptedKeyPath, os.Getenv(age.EnvSOPSAgeKeyFile)}, cfg.ProtectedPaths...)
+	for _, path := range candidates {
+		if normalized, err := utils.NormalizePath(path); err == nil {
+			path = normalized
+		}
+		if path != "" {
+			paths = append(paths, canonicalPath(path))
+		}
+	}
+	return paths
+}
+
+// IsProtected reports whether path is one of ProtectedPaths, directly or
+// through a symlink
+func IsProtected(path string) bool {
+	path = canonicalPath(path)
+	for _, protected := range ProtectedPaths() {
+		if path == protected {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalPath returns path absolute and with symlinks resolved, so
+// different spellings of the same file compare equal
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return utils.RealPath(path)
+}
+
+// checkProtected refuses to operate on any of paths that is protected
+func checkProtected(paths ...string) error {
+	for _, path := range paths {
+		if path != "" && IsProtected(path) {
+			return errors.New(errors.TypeFileOperation,
+				fmt.Sprintf("%s is a protected key file; manage it from the Key Manager instead", path)).
+				WithCode(errors.CodeProtectedPath).WithData("path", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package sops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// States of a queued job
+const (
+	JobQueued    = "queued"    // Waiting for a worker or for earlier jobs on its files
+	JobRunning   = "running"   // Running now
+	JobDone      = "done"      // Finished without an error
+	JobFailed    = "failed"    // Finished with an error
+	JobCancelled = "cancelled" // Its context was cancelled before it started
+)
+
+// Task is an operation to run through a Queue
+type Task struct {
+	Operation string                          // What the task does, such as "decrypt"
+	Path      string                          // The file the task works on
+	Also      []string                        // Other files it writes or reads, such as its output
+	Run       func(ctx context.Context) error // Does the work
+}
+
+// Job is the state of a task submitted to a Queue
+type Job struct {
+	ID        int
+	Operation string
+	Path      string
+	State     string
+	Err       error
+	Submitted time.Time
+	Started   time.Time
+	Finished  time.Time
+}
+
+// Queue runs tasks on independent files in parallel, with at most a fixed
+// number running at a time, while tasks touching the same file run one after
+// another in the order they were submitted, so two sops runs never write a
+// file at once. The order on each file is kept across every Queue of the
+// process, so a batch and a watch working on the same files do not race
+// either.
+type Queue struct {
+	sem      chan struct{}
+	onChange func(Job)
+
+	mu     sync.Mutex
+	nextID int
+	active map[int]*Job
+	wg     sync.WaitGroup
+}
+
+// NewQueue creates a queue running at most workers tasks at a time,
+// DefaultBatchWorkers if workers is not positive. onChange, when not nil, is
+// called with a job each time its state changes; it may be called from
+// several goroutines at once.
+func NewQueue(workers int, onChange func(Job)) *Queue {
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	return &Queue{
+		sem:      make(chan struct{}, workers),
+		onChange: onChange,
+		active:   make(map[int]*Job),
+	}
+}
+
+// Submit queues task and returns its job's ID without waiting for it to run.
+// Once ctx is cancelled, a task that has not started yet is not run.
+func (q *Queue) Submit(ctx context.Context, task Task) int {
+	id, _ := q.enqueue(ctx, task)
+	return id
+}
+
+// Do runs task through the queue and returns its error once it has finished,
+// or a CodeCancelled error when ctx was cancelled before it could start
+func (q *Queue) Do(ctx context.Context, task Task) error {
+	_, done := q.enqueue(ctx, task)
+	return <-done
+}
+
+// Wait returns once every submitted task has finished or been cancelled
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Active returns the jobs that are queued or running, oldest first
+func (q *Queue) Active() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, len(q.active))
+	for id := 1; id <= q.nextID; id++ {
+		if job, ok := q.active[id]; ok {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// enqueue registers task and starts running it once its files and a worker
+// are free. The returned channel receives the task's error.
+func (q *Queue) enqueue(ctx context.Context, task Task) (int, <-chan error) {
+	q.mu.Lock()
+	q.nextID++
+	job := &Job{ID: q.nextID, Operation: task.Operation, Path: task.Path, State: JobQueued, Submitted: time.Now()}
+	q.active[job.ID] = job
+	q.mu.Unlock()
+	q.wg.Add(1)
+	q.changed(job)
+
+	// Claim the files now, so that later tasks on them wait for this one
+	earlier, release := claimFiles(append([]string{task.Path}, task.Also...))
+
+	result := make(chan error, 1)
+	go func() {
+		err := q.run(ctx, job, task, earlier)
+		q.mu.Lock()
+		delete(q.active, job.ID)
+		q.mu.Unlock()
+		q.changed(job)
+		result <- err
+		close(result)
+		q.wg.Done()
+
+		// A cancelled job must not let later jobs on its files overtake the
+		// ones it was waiting for
+		for _, wait := range earlier {
+			<-wait
+		}
+		release()
+	}()
+	return job.ID, result
+}
+
+// run waits for the jobs before it and a worker, then runs the task
+func (q *Queue) run(ctx context.Context, job *Job, task Task, earlier []<-chan struct{}) error {
+	cancelled := func() error {
+		err := errors.Wrap(ctx.Err(), errors.TypeGeneral, "Cancelled before it started").
+			WithCode(errors.CodeCancelled).WithData("path", task.Path)
+		q.update(job, func(j *Job) {
+			j.State = JobCancelled
+			j.Err = err
+			j.Finished = time.Now()
+		})
+		return err
+	}
+
+	for _, wait := range earlier {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return cancelled()
+		}
+	}
+	select {
+	case q.sem <- struct{}{}:
+	case <-ctx.Done():
+		return cancelled()
+	}
+	defer func() { <-q.sem }()
+	if ctx.Err() != nil {
+		return cancelled()
+	}
+
+	q.update(job, func(j *Job) {
+		j.State = JobRunning
+		j.Started = time.Now()
+	})
+	q.changed(job)
+
+	err := task.Run(ctx)
+	q.update(job, func(j *Job) {
+		j.State = JobDone
+		if err != nil {
+			j.State = JobFailed
+			j.Err = err
+		}
+		j.Finished = time.Now()
+	})
+	return err
+}
+
+// update changes job while holding the queue's lock
+func (q *Queue) update(job *Job, fn func(*Job)) {
+	q.mu.Lock()
+	fn(job)
+	q.mu.Unlock()
+}
+
+// changed reports the current state of job
+func (q *Queue) changed(job *Job) {
+	if q.onChange == nil {
+		return
+	}
+	q.mu.Lock()
+	snapshot := *job
+	q.mu.Unlock()
+	q.onChange(snapshot)
+}
+
+var (
+	fileMu sync.Mutex
+	// The last job claiming each file, closed when it finishes
+	fileTails = make(map[string]chan struct{})
+)
+
+// Busy reports whether a job of any Queue is queued or running on the file
+// at path, or writes it as its output
+func Busy(path string) bool {
+	key := fileKey(path)
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	_, ok := fileTails[key]
+	return ok
+}
+
+// claimFiles records a job on paths and returns the jobs it has to wait
+// for, the previous job on each file, and a function to call when it is done
+func claimFiles(paths []string) ([]<-chan struct{}, func()) {
+	done := make(chan struct{})
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	var earlier []<-chan struct{}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		key := fileKey(path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		if tail, ok := fileTails[key]; ok {
+			earlier = append(earlier, tail)
+		}
+		fileTails[key] = done
+	}
+
+	release := func() {
+		fileMu.Lock()
+		defer fileMu.Unlock()
+		close(done)
+		for _, key := range keys {
+			if fileTails[key] == done {
+				delete(fileTails, key)
+			}
+		}
+	}
+	return earlier, release
+}
+
+// fileKey names the file at path the same way whichever link or relative
+// path it is reached by. A file that does not exist yet, such as an output,
+// is named through its directory.
+func fileKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	if _, err := os.Lstat(abs); err == nil {
+		return abs
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
@@ -0,0 +1,79 @@
+package sops
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// RawPreviewLimit is how much of a file ReadRaw reads at most
+const RawPreviewLimit = 256 * 1024
+
+// encryptedValueMarker starts each value sops has encrypted
+const encryptedValueMarker = "ENC["
+
+// RawContent is an encrypted file as it is stored on disk, ciphertext and
+// all, for diagnosing files that do not decrypt or parse
+type RawContent struct {
+	Text        string // The content read, with control characters replaced
+	Size        int64  // Size of the whole file
+	Truncated   bool   // Only the first RawPreviewLimit bytes were read
+	MetadataErr error  // Why the sops metadata could not be read; not checked when Truncated
+}
+
+// ReadRaw reads up to RawPreviewLimit bytes of an encrypted file without
+// decrypting anything, so no key is needed. Files whose sops metadata is
+// broken are read too, as long as they hold encrypted values; a file with
+// neither is not encrypted and gets a CodeFileNotEncrypted error, since its
+// content would be plaintext.
+func ReadRaw(filePath string) (*RawContent, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read file").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read file").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, RawPreviewLimit))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read file").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+
+	raw := &RawContent{Size: info.Size(), Truncated: info.Size() > int64(len(data))}
+
+	// The metadata comes last, so it is only looked at when the whole file was read
+	parsed := false
+	if !raw.Truncated {
+		_, raw.MetadataErr = ReadMetadata(filePath)
+		parsed = raw.MetadataErr == nil
+	}
+	if !parsed && !bytes.Contains(data, []byte(encryptedValueMarker)) {
+		return nil, errors.New(errors.TypeFileOperation,
+			"File is not encrypted, so there is no ciphertext to show").
+			WithCode(errors.CodeFileNotEncrypted).WithData("path", filePath)
+	}
+	raw.Text = printable(data)
+	return raw, nil
+}
+
+// printable turns data into text that is safe to put on a terminal: invalid
+// UTF-8 and control characters other than newlines and tabs are replaced
+func printable(data []byte) string {
+	text := strings.ToValidUTF8(string(data), "�")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return '�'
+	}, text)
+}
@@ -0,0 +1,247 @@
+package sops
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+)
+
+// kindFlags are the names of the sops flags taking keys of each kind
+var kindFlags = map[string]string{
+	age.KindAge:     "age",
+	age.KindPGP:     "pgp",
+	age.KindKMS:     "kms",
+	age.KindGCPKMS:  "gcp-kms",
+	age.KindAzureKV: "azure-kv",
+	age.KindHCVault: "hc-vault-transit",
+}
+
+// recipientArgs builds one flag per kind of key among recipients, e.g.
+// --age=age1...,age1... --pgp=FINGERPRINT. prefix is empty for encrypt and
+// updatekeys, and add- or rm- for rotate.
+func recipientArgs(prefix string, recipients []age.Recipient) []string {
+	var args []string
+	for _, kind := range age.Kinds() {
+		if keys := age.KeysOfKind(recipients, kind); len(keys) > 0 {
+			args = append(args, "--"+prefix+kindFlags[kind]+"="+strings.Join(keys, ","))
+		}
+	}
+	return args
+}
+
+// recipientID identifies a recipient by its kind and key, ignoring where it
+// came from
+func recipientID(r age.Recipient) string {
+	return r.KindOrAge() + ":" + strings.TrimSpace(r.Key)
+}
+
+// SameRecipients reports whether a and b hold the same recipients, ignoring
+// order and duplicates
+func SameRecipients(a, b []age.Recipient) bool {
+	return len(difference(a, b)) == 0 && len(difference(b, a)) == 0
+}
+
+// difference returns the entries of a that are not in b
+func difference(a, b []age.Recipient) []age.Recipient {
+	inB := make(map[string]bool, len(b))
+	for _, r := range b {
+		inB[recipientID(r)] = true
+	}
+
+	var out []age.Recipient
+	for _, r := range a {
+		if !inB[recipientID(r)] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// DedupeRecipients leaves out the recipients given more than once, such as
+// a key pasted twice or self next to our own key, keeping the first of each.
+// An ssh key is the same recipient whatever comment it ends with. repeated
+// holds the copies left out.
+func DedupeRecipients(recipients []age.Recipient) (unique, repeated []age.Recipient) {
+	seen := make(map[string]bool, len(recipients))
+	for _, r := range recipients {
+		id := keyID(r)
+		if seen[id] {
+			repeated = append(repeated, r)
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, r)
+	}
+	return unique, repeated
+}
+
+// SplitPresent splits the recipients requested for a file whose recipients
+// are current into those it lacks and those it already has
+func SplitPresent(current, requested []age.Recipient) (missing, present []age.Recipient) {
+	have := make(map[string]bool, len(current))
+	for _, r := range current {
+		have[keyID(r)] = true
+	}
+	for _, r := range requested {
+		if have[keyID(r)] {
+			present = append(present, r)
+		} else {
+			missing = append(missing, r)
+		}
+	}
+	return missing, present
+}
+
+// keepOtherKinds adds to wanted the current recipients of kinds wanted does
+// not mention, so re-keying a file's age recipients leaves its KMS keys alone
+func keepOtherKinds(current, wanted []age.Recipient) []age.Recipient {
+	managed := make(map[string]bool)
+	for _, r := range wanted {
+		managed[r.KindOrAge()] = true
+	}
+
+	out := append([]age.Recipient(nil), wanted...)
+	for _, r := range current {
+		if !managed[r.KindOrAge()] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// UpdateRecipients adds and removes recipients of any kind on an encrypted
+// file, rotating its data key so removed recipients cannot open later
+// versions. Each kind is changed independently of the others. Recipients
+// the file already has, or lacks, are skipped; when nothing is left to
+// change the file is not rewritten.
+func UpdateRecipients(filePath string, add, remove []age.Recipient, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return errors.New(errors.TypeConfig, "No recipient given").WithCode(errors.CodeRecipientUnknown)
+	}
+
+	info, err := fileInfo(o, filePath)
+	if err != nil {
+		return err
+	}
+	if !info.Encrypted {
+		return errors.New(errors.TypeFileOperation, "File is not encrypted").
+			WithCode(errors.CodeFileNotEncrypted).WithData("path", filePath)
+	}
+
+	current := info.AllRecipients()
+	add, _ = DedupeRecipients(add)
+	add, _ = SplitPresent(current, add)
+	remove = difference(remove, difference(remove, current))
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	if len(add) == 0 && len(difference(current, remove)) == 0 {
+		return errors.New(errors.TypeConfig, "A file needs at least one recipient; add another before removing the last").
+			WithCode(errors.CodeRecipientUnknown).WithData("path", filePath)
+	}
+	return rotateRecipients(o, filePath, add, remove)
+}
+
+// rotateRecipients runs sops rotate on a resolved path with the recipients
+// to add and remove, rolling the file back when sops fails
+func rotateRecipients(o *options, path string, add, remove []age.Recipient) error {
+	if err := checkWritable(path); err != nil {
+		return err
+	}
+
+	tm := recovery.NewTransactionManager()
+	if err := o.begin(tm, path); err != nil {
+		return err
+	}
+
+	args := append([]string{"rotate", "-i"}, binaryArgs(path)...)
+	args = append(args, recipientArgs("add-", add)...)
+	args = append(args, recipientArgs("rm-", remove)...)
+	args = append(args, path)
+
+	cmd := o.command(args...)
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		if rollbackErr := tm.Rollback(); rollbackErr != nil {
+			return errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to re-key file and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
+				WithData("stderr", errOut.String()).
+				WithData("rollbackError", rollbackErr.Error())
+		}
+		return o.parseError(err, errOut.String())
+	}
+
+	tm.Commit()
+	return nil
+}
+
+// CanRecipientDecrypt reports whether the holder of recipientPublicKey could
+// decrypt filePath with that key alone. The key is an age or ssh public key,
+// or a key of another kind written as a recipient token such as
+// pgp:FINGERPRINT. Only the file's metadata is read, since testing the key
+// itself would take the holder's private key: the key has to be in the
+// file's recipient set and, when the file has several key groups, in enough
+// of them to meet the Shamir threshold. To confirm that a key we hold works
+// end to end, decrypt the file in memory with it, as VerifyIntegrity does.
+func CanRecipientDecrypt(filePath, recipientPublicKey string) (bool, error) {
+	token := strings.TrimSpace(recipientPublicKey)
+	recipient, ok := age.ParseMasterKey(token)
+	if age.IsPublicKey(token) {
+		recipient, ok = age.Recipient{Key: token}, true
+	}
+	if !ok {
+		return false, errors.New(errors.TypeConfig, "Not a public key or a recipient token").
+			WithCode(errors.CodeRecipientUnknown).WithData("recipient", token)
+	}
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return false, err
+	}
+	md, err := ReadMetadata(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	id := keyID(recipient)
+	covered := 0
+	for _, g := range md.KeyGroups {
+		for _, r := range g.Recipients {
+			if keyID(r) == id {
+				covered++
+				break
+			}
+		}
+	}
+
+	threshold := md.ShamirThreshold
+	if threshold <= 0 || len(md.KeyGroups) == 1 {
+		threshold = len(md.KeyGroups)
+	}
+	return covered > 0 && covered >= threshold, nil
+}
+
+// keyID is recipientID without the comment an ssh public key may end with,
+// so a key pasted from an authorized_keys line matches the one in a file
+func keyID(r age.Recipient) string {
+	key := strings.TrimSpace(r.Key)
+	if fields := strings.Fields(key); r.IsAge() && strings.HasPrefix(key, "ssh-") && len(fields) > 2 {
+		key = fields[0] + " " + fields[1]
+	}
+	return r.KindOrAge() + ":" + key
+}
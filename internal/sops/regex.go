@@ -0,0 +1,125 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// WithoutEncryptedRegex encrypts every value of the file, ignoring the
+// encrypted_regex of the .sops.yaml rule that applies to it. This is the way
+// out when the regex matches nothing and sops fails with a
+// CodeSOPSNoRegexMatch error. The rule's keys and other settings still apply.
+func WithoutEncryptedRegex() Option {
+	return func(o *options) {
+		o.noEncryptedRegex = true
+	}
+}
+
+// MatchingRule returns the .sops.yaml creation rule that sops applies to
+// filePath: the first rule of the nearest .sops.yaml whose path regex matches
+// the file's path relative to it. It also returns the rule's index and the
+// path of the .sops.yaml. ok is false when no rule applies.
+func MatchingRule(filePath string) (rule CreationRule, index int, configPath string, ok bool) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return CreationRule{}, 0, "", false
+	}
+	configPath, found := FindConfig(filepath.Dir(abs))
+	if !found {
+		return CreationRule{}, 0, "", false
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return CreationRule{}, 0, "", false
+	}
+	rel, err := filepath.Rel(filepath.Dir(configPath), abs)
+	if err != nil {
+		return CreationRule{}, 0, "", false
+	}
+
+	for i, r := range cfg.CreationRules {
+		pattern, err := regexp.Compile(r.PathRegex)
+		if err != nil {
+			continue
+		}
+		if pattern.MatchString(filepath.ToSlash(rel)) {
+			return r, i, configPath, true
+		}
+	}
+	return CreationRule{}, 0, "", false
+}
+
+// explainNoRegexMatch names the encrypted_regex behind a CodeSOPSNoRegexMatch
+// error from encrypting filePath; other errors are returned as they are
+func explainNoRegexMatch(err error, filePath string) error {
+	if errors.Code(err) != errors.CodeSOPSNoRegexMatch {
+		return err
+	}
+	rule, _, configPath, ok := MatchingRule(filePath)
+	if !ok || rule.EncryptedRegex == "" {
+		return err
+	}
+	return errors.New(errors.TypeConfig,
+		fmt.Sprintf("encrypted_regex %q in %s matched no keys of %s, so nothing would be encrypted. "+
+			"Check the pattern against the file's structure, or encrypt every value instead",
+			rule.EncryptedRegex, configPath, filepath.Base(filePath))).
+		WithCode(errors.CodeSOPSNoRegexMatch).
+		WithData("encrypted_regex", rule.EncryptedRegex).
+		WithData("config", configPath)
+}
+
+// withoutEncryptedRegexConfig writes a copy of the rule that applies to
+// filePath without its encrypted_regex, for sops to use through --config.
+// The copy has no path regex, so it applies to the file wherever it is
+// written. It returns "" when no rule, or no encrypted_regex, applies; the
+// caller removes the file once sops has finished.
+func withoutEncryptedRegexConfig(filePath string) (string, error) {
+	rule, index, configPath, ok := MatchingRule(filePath)
+	if !ok || rule.EncryptedRegex == "" {
+		return "", nil
+	}
+
+	// Copy the rule as written, so settings supper does not model survive
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read sops configuration").WithCode(errors.CodeFileNotFound).WithData("path", configPath)
+	}
+	var raw struct {
+		CreationRules []map[string]interface{} `yaml:"creation_rules"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil || index >= len(raw.CreationRules) {
+		return "", errors.New(errors.TypeConfig,
+			"Failed to parse sops configuration").WithCode(errors.CodeConfigInvalid).WithData("path", configPath)
+	}
+	copied := raw.CreationRules[index]
+	delete(copied, "encrypted_regex")
+	delete(copied, "path_regex")
+
+	out, err := yaml.Marshal(map[string]interface{}{"creation_rules": []map[string]interface{}{copied}})
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeConfig,
+			"Failed to encode sops configuration").WithCode(errors.CodeConfigInvalid)
+	}
+
+	tmp, err := os.CreateTemp("", TempPrefix+"*.sops.yaml")
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to create temporary file").WithCode(errors.CodeFileWriteFailed)
+	}
+	_, err = tmp.Write(out)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to write temporary file").WithCode(errors.CodeFileWriteFailed).WithData("path", tmp.Name())
+	}
+	return tmp.Name(), nil
+}
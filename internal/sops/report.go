@@ -0,0 +1,108 @@
+package sops
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// File statuses recorded in a batch report
+const (
+	StatusOK        = "ok"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	StatusNoKey     = "no_key"    // None of our keys can decrypt the file
+	StatusUnchanged = "unchanged" // Already in the wanted state, so not rewritten
+)
+
+// FileResult records the outcome of a batch operation on a single file
+type FileResult struct {
+	Path          string        `json:"path"`
+	Status        string        `json:"status"`
+	OldRecipients []string      `json:"old_recipients"`
+	NewRecipients []string      `json:"new_recipients"`
+	Output        string        `json:"output,omitempty"`
+	Duration      time.Duration `json:"-"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// Report summarises a batch operation across many files
+type Report struct {
+	Operation string        `json:"operation"`
+	Root      string        `json:"root"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"-"`
+	Files     []FileResult  `json:"files"`
+}
+
+// Count returns the number of files with the given status
+func (r *Report) Count(status string) int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary returns a one-line description of the report
+func (r *Report) Summary() string {
+	counts := []string{fmt.Sprintf("%d ok", r.Count(StatusOK))}
+	if n := r.Count(StatusUnchanged); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d unchanged", n))
+	}
+	counts = append(counts, fmt.Sprintf("%d failed", r.Count(StatusFailed)))
+	if n := r.Count(StatusNoKey); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d without a matching key", n))
+	}
+	counts = append(counts, fmt.Sprintf("%d skipped", r.Count(StatusSkipped)))
+
+	return fmt.Sprintf("%d file(s): %s in %s", len(r.Files), strings.Join(counts, ", "), r.Duration.Round(time.Millisecond))
+}
+
+// ToJSON writes the report as indented JSON
+func (r *Report) ToJSON(w io.Writer) error {
+	type fileJSON struct {
+		FileResult
+		Duration string `json:"duration"`
+	}
+	files := make([]fileJSON, len(r.Files))
+	for i, f := range r.Files {
+		files[i] = fileJSON{FileResult: f, Duration: f.Duration.String()}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*Report
+		Duration string     `json:"duration"`
+		Files    []fileJSON `json:"files"`
+	}{Report: r, Duration: r.Duration.String(), Files: files})
+}
+
+// ToCSV writes one row per file; recipient lists are separated by semicolons
+func (r *Report) ToCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"path", "status", "old_recipients", "new_recipients", "duration", "error"}); err != nil {
+		return err
+	}
+	for _, f := range r.Files {
+		row := []string{
+			f.Path,
+			f.Status,
+			strings.Join(f.OldRecipients, ";"),
+			strings.Join(f.NewRecipients, ";"),
+			f.Duration.String(),
+			f.Error,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,377 @@
+package sops
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the sops configuration file
+const ConfigFileName = ".sops.yaml"
+
+// CreationRule is a .sops.yaml rule choosing the keys for matching files
+type CreationRule struct {
+	PathRegex         string     `yaml:"path_regex,omitempty"`
+	Age               string     `yaml:"age,omitempty"`
+	ShamirThreshold   int        `yaml:"shamir_threshold,omitempty"`
+	KeyGroups         []KeyGroup `yaml:"key_groups,omitempty"`
+	EncryptedRegex    string     `yaml:"encrypted_regex,omitempty"`
+	UnencryptedRegex  string     `yaml:"unencrypted_regex,omitempty"`
+	EncryptedSuffix   string     `yaml:"encrypted_suffix,omitempty"`
+	UnencryptedSuffix string     `yaml:"unencrypted_suffix,omitempty"`
+
+	// Other holds the settings supper does not model, such as pgp or kms
+	// keys, so rewriting a rule keeps them as they were written
+	Other map[string]interface{} `yaml:",inline"`
+}
+
+// Config is the content of a .sops.yaml file
+type Config struct {
+	CreationRules []CreationRule `yaml:"creation_rules"`
+
+	// Other holds the sections besides the creation rules, such as
+	// destination_rules, which are written back unchanged
+	Other map[string]interface{} `yaml:",inline"`
+}
+
+// MarshalYAML writes a key group in the .sops.yaml key_groups form
+func (g KeyGroup) MarshalYAML() (interface{}, error) {
+	out := make(map[string]interface{}, len(g.other)+1)
+	for kind, keys := range g.other {
+		out[kind] = keys
+	}
+	if keys := g.Keys(); len(keys) > 0 || len(out) == 0 {
+		out["age"] = keys
+	}
+	return out, nil
+}
+
+// UnmarshalYAML reads a key group in the .sops.yaml key_groups form. Keys
+// of other kinds are kept as written, for MarshalYAML.
+func (g *KeyGroup) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	var ages struct {
+		Age []string `yaml:"age"`
+	}
+	if err := node.Decode(&ages); err != nil {
+		return err
+	}
+	g.Recipients = nil
+	for _, key := range ages.Age {
+		g.Recipients = append(g.Recipients, age.Recipient{Key: key})
+	}
+	delete(raw, "age")
+	g.other = raw
+	if len(g.other) == 0 {
+		g.other = nil
+	}
+	return nil
+}
+
+// OtherKeys returns the number of keys of the group that are not age keys
+// and are kept as written in .sops.yaml
+func (g KeyGroup) OtherKeys() int {
+	n := 0
+	for _, keys := range g.other {
+		if list, ok := keys.([]interface{}); ok {
+			n += len(list)
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Recipients returns the age recipients the rule encrypts to, across its
+// age list and key groups
+func (r CreationRule) Recipients() []age.Recipient {
+	recipients := age.FromKeys(age.SplitRecipientInput(r.Age))
+	for _, g := range r.KeyGroups {
+		recipients = append(recipients, g.Recipients...)
+	}
+	return recipients
+}
+
+// NewGroupedRule creates a rule that splits the data key across key groups
+// so that threshold groups are needed to decrypt
+func NewGroupedRule(pathRegex string, groups []KeyGroup, threshold int) CreationRule {
+	rule := CreationRule{PathRegex: pathRegex, KeyGroups: groups}
+	if len(groups) > 1 {
+		rule.ShamirThreshold = threshold
+	}
+	return rule
+}
+
+// Validate checks that a rule can be used by sops
+func (r CreationRule) Validate() error {
+	if r.PathRegex != "" {
+		if _, err := regexp.Compile(r.PathRegex); err != nil {
+			return errors.Wrap(err, errors.TypeConfig, "Invalid path regex").
+				WithCode(errors.CodeConfigInvalid).WithData("path_regex", r.PathRegex)
+		}
+	}
+
+	// sops refuses a rule that picks the values to encrypt more than one way
+	options := 0
+	for name, value := range map[string]string{
+		"encrypted_regex":    r.EncryptedRegex,
+		"unencrypted_regex":  r.UnencryptedRegex,
+		"encrypted_suffix":   r.EncryptedSuffix,
+		"unencrypted_suffix": r.UnencryptedSuffix,
+	} {
+		if value == "" {
+			continue
+		}
+		options++
+		if strings.HasSuffix(name, "_regex") {
+			if _, err := regexp.Compile(value); err != nil {
+				return errors.Wrap(err, errors.TypeConfig, "Invalid "+name).
+					WithCode(errors.CodeConfigInvalid).WithData(name, value)
+			}
+		}
+	}
+	if options > 1 {
+		return errors.New(errors.TypeConfig,
+			"Use only one of encrypted_regex, unencrypted_regex, encrypted_suffix and unencrypted_suffix").
+			WithCode(errors.CodeConfigInvalid)
+	}
+
+	if len(r.KeyGroups) == 0 {
+		if r.Age == "" && !r.hasOtherKeys() {
+			return errors.New(errors.TypeConfig, "Rule has no recipients").WithCode(errors.CodeConfigInvalid)
+		}
+		return nil
+	}
+
+	for i, g := range r.KeyGroups {
+		if len(g.Recipients) == 0 && g.OtherKeys() == 0 {
+			return errors.New(errors.TypeConfig, fmt.Sprintf("Key group %d has no recipients", i+1)).
+				WithCode(errors.CodeConfigInvalid)
+		}
+	}
+	if r.ShamirThreshold < 0 || r.ShamirThreshold > len(r.KeyGroups) {
+		return errors.New(errors.TypeConfig,
+			fmt.Sprintf("Shamir threshold must be between 1 and the number of key groups (%d)", len(r.KeyGroups))).
+			WithCode(errors.CodeConfigInvalid)
+	}
+	return nil
+}
+
+// otherKeyKinds are the .sops.yaml rule settings listing keys of kinds other
+// than age
+var otherKeyKinds = []string{"pgp", "kms", "gcp_kms", "azure_keyvault", "hc_vault_transit_uri"}
+
+// hasOtherKeys reports whether the rule lists keys of another kind than age
+func (r CreationRule) hasOtherKeys() bool {
+	for _, kind := range otherKeyKinds {
+		if value, ok := r.Other[kind]; ok && value != nil && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKeyGroups parses groups written as "age1a,age1b; age1c", with
+// semicolons separating groups and commas separating recipients
+func ParseKeyGroups(input string) ([]KeyGroup, error) {
+	var groups []KeyGroup
+	for _, part := range strings.Split(input, ";") {
+		tokens := age.SplitRecipientInput(part)
+		if len(tokens) == 0 {
+			continue
+		}
+		recipients, err := age.ResolveRecipients(tokens)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, KeyGroup{Recipients: recipients})
+	}
+	if len(groups) == 0 {
+		return nil, errors.New(errors.TypeConfig, "No key groups given").WithCode(errors.CodeConfigInvalid)
+	}
+	return groups, nil
+}
+
+// MatchCreationRule lists the files under root whose path relative to root
+// matches the rule's path regex, as sops would match them against a
+// .sops.yaml in root. A rule without a regex matches every file. Hidden
+// directories are skipped.
+func MatchCreationRule(rule CreationRule, root string) ([]string, error) {
+	pattern, err := regexp.Compile(rule.PathRegex)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeConfig, "Invalid path regex").
+			WithCode(errors.CodeConfigInvalid).WithData("path_regex", rule.PathRegex)
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == ConfigFileName {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if pattern.MatchString(filepath.ToSlash(rel)) {
+			matches = append(matches, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return matches, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to scan directory").WithCode(errors.CodeFileNotFound).WithData("directory", root)
+	}
+	return matches, nil
+}
+
+// FindConfig looks for .sops.yaml in dir and its parents, as sops does
+func FindConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads a .sops.yaml file; a missing file yields an empty config
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read sops configuration").WithCode(errors.CodeFileNotFound).WithData("path", path)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, errors.TypeConfig,
+			"Failed to parse sops configuration").WithCode(errors.CodeConfigInvalid).WithData("path", path)
+	}
+	return &cfg, nil
+}
+
+// SaveConfig writes a .sops.yaml file
+func SaveConfig(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, errors.TypeConfig,
+			"Failed to encode sops configuration").WithCode(errors.CodeConfigInvalid)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to write sops configuration").WithCode(errors.CodeFileWriteFailed).WithData("path", path)
+	}
+	return nil
+}
+
+// AddCreationRule validates rule and adds it to the .sops.yaml in dir. New
+// rules go first so they take precedence over broader existing ones.
+func AddCreationRule(dir string, rule CreationRule) (string, error) {
+	if err := rule.Validate(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, ConfigFileName)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return "", err
+	}
+
+	cfg.CreationRules = append([]CreationRule{rule}, cfg.CreationRules...)
+	return path, SaveConfig(path, cfg)
+}
+
+// WriteCreationRules replaces the creation rules of the .sops.yaml at path
+// with rules, in order, after validating each of them. The rest of the file
+// is kept, and the previous file is backed up first and restored when the
+// write fails.
+func WriteCreationRules(path string, rules []CreationRule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return errors.Wrap(err, errors.TypeConfig, fmt.Sprintf("Rule %d is invalid", i+1)).
+				WithCode(errors.CodeConfigInvalid).WithData("path", path)
+		}
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	cfg.CreationRules = rules
+
+	tm := recovery.NewTransactionManager()
+	if err := tm.Begin(path); err != nil {
+		return err
+	}
+	if err := SaveConfig(path, cfg); err != nil {
+		if rollbackErr := tm.Rollback(); rollbackErr != nil {
+			return errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to write sops configuration and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).WithData("path", path).WithData("rollbackError", rollbackErr.Error())
+		}
+		return err
+	}
+	tm.Commit()
+	return nil
+}
+
+// RuleMatches lists the files under root, relative to it, that the rule at
+// index of rules matches, as sops would match them against a .sops.yaml in
+// root. shadowed lists the ones an earlier rule matches first, which sops
+// encrypts with that rule instead.
+func RuleMatches(rules []CreationRule, index int, root string) (files, shadowed []string, err error) {
+	matches, err := MatchCreationRule(rules[index], root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var earlier []*regexp.Regexp
+	for _, rule := range rules[:index] {
+		pattern, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			continue
+		}
+		earlier = append(earlier, pattern)
+	}
+	for _, file := range matches {
+		if matchesAny(earlier, filepath.ToSlash(file)) {
+			shadowed = append(shadowed, file)
+		} else {
+			files = append(files, file)
+		}
+	}
+	return files, shadowed, nil
+}
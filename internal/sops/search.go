@@ -0,0 +1,166 @@
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// KeyMatch is a key of an encrypted file whose name matched a key search
+type KeyMatch struct {
+	Path     string // The encrypted file
+	TreePath string // The key, in the form FormatTreePath writes
+}
+
+// KeySearch is the outcome of a key search under a directory
+type KeySearch struct {
+	Root     string
+	Query    string
+	Matches  []KeyMatch // By file, then in file order
+	Searched int        // Encrypted files whose keys were searched
+	Skipped  int        // Encrypted files none of our keys can decrypt, or whose keys could not be read
+}
+
+// SearchKeys finds the keys named like query in the encrypted files under
+// root that one of publicKeys can decrypt; nil publicKeys searches every
+// file. A query is matched, ignoring case, against the name of each key, or
+// against its whole path when it holds a . or [, as in db.password.
+//
+// sops stores keys in the clear, so they are read from the encrypted files
+// as they are and no value is ever decrypted. Files are read with at most
+// workers at a time; a cancelled context stops the search.
+func SearchKeys(root, query string, publicKeys []string, workers int, opts ...Option) (*KeySearch, error) {
+	o := newOptions(opts)
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New(errors.TypeConfig, "Enter a key name to search for").WithCode(errors.CodeTreePathInvalid)
+	}
+
+	paths, err := FindEncrypted(root, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	search := &KeySearch{Root: root, Query: query}
+	found := make([][]KeyMatch, len(paths))
+	var mu sync.Mutex
+	indexes := make([]int, len(paths))
+	for i := range paths {
+		indexes[i] = i
+	}
+
+	runBounded(o.ctx, indexes, workers, func(i int) {
+		matches, ok := searchFile(paths[i], query, publicKeys)
+		mu.Lock()
+		defer mu.Unlock()
+		if !ok {
+			search.Skipped++
+			return
+		}
+		search.Searched++
+		found[i] = matches
+	}, func(int) {})
+
+	if o.ctx.Err() != nil {
+		return search, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Search cancelled").WithCode(errors.CodeCancelled)
+	}
+	for _, matches := range found {
+		search.Matches = append(search.Matches, matches...)
+	}
+	return search, nil
+}
+
+// searchFile returns the keys of path that match query. It reports false
+// when none of publicKeys can decrypt the file or its keys cannot be read.
+func searchFile(path, query string, publicKeys []string) ([]KeyMatch, bool) {
+	if _, ok := precheckDecrypt(DecryptTarget{Path: path}, publicKeys); !ok {
+		return nil, false
+	}
+	keys, err := KeyPaths(path)
+	if err != nil {
+		return nil, false
+	}
+
+	query = strings.ToLower(query)
+	wholePath := strings.ContainsAny(query, ".[")
+	var matches []KeyMatch
+	for _, treePath := range keys {
+		name := treePath
+		if !wholePath {
+			name = lastKey(treePath)
+		}
+		if strings.Contains(strings.ToLower(name), query) {
+			matches = append(matches, KeyMatch{Path: path, TreePath: treePath})
+		}
+	}
+	return matches, true
+}
+
+// lastKey returns the name of the key at treePath, "" for a list item
+func lastKey(treePath string) string {
+	parts, err := ParseTreePath(treePath)
+	if err != nil || len(parts) == 0 {
+		return treePath
+	}
+	key, _ := parts[len(parts)-1].(string)
+	return key
+}
+
+// KeyPaths lists the keys of an encrypted YAML, JSON, dotenv or INI file in
+// file order, without decrypting anything: the paths of TreePaths for YAML
+// and JSON, KEY for dotenv and section.key for INI. The sops metadata is
+// left out.
+func KeyPaths(filePath string) ([]string, error) {
+	format := DetectFormat(filePath)
+	if format == FormatYAML || format == FormatJSON {
+		return TreePaths(filePath)
+	}
+	if format != FormatDotenv && format != FormatINI {
+		return nil, errors.New(errors.TypeGeneral, "Only YAML, JSON, dotenv and INI files have keys to list").
+			WithCode(errors.CodeFormatUnsupported).WithData("format", format)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation, "Failed to read file").
+			WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+
+	var keys []string
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if format == FormatINI && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, _, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		switch {
+		case format == FormatDotenv && strings.HasPrefix(key, "sops_"):
+			// The metadata of a dotenv file is kept in sops_ keys
+		case format == FormatINI && section == "sops":
+			// And that of an INI file in its sops section
+		case section != "":
+			keys = append(keys, FormatTreePath([]any{section, key}))
+		default:
+			keys = append(keys, FormatTreePath([]any{key}))
+		}
+	}
+	return keys, nil
+}
+
@@ -0,0 +1,60 @@
+package sops
+
+import (
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Snippet is ready-to-paste text that wires recipients up for sops
+type Snippet struct {
+	Name string
+	Text string
+}
+
+// RecipientSnippets formats public keys as a .sops.yaml creation rule, a sops
+// command line and the bare keys, so they can be handed to a teammate
+// without retyping them
+func RecipientSnippets(publicKeys []string) ([]Snippet, error) {
+	var keys []string
+	for _, key := range publicKeys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !age.IsPublicKey(key) {
+			return nil, errors.New(errors.TypeConfig, "Not an age or ssh public key").
+				WithCode(errors.CodeRecipientUnknown).WithData("recipient", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New(errors.TypeConfig, "No public key given").WithCode(errors.CodeRecipientUnknown)
+	}
+	joined := strings.Join(keys, ",")
+
+	rule, err := yaml.Marshal(Config{CreationRules: []CreationRule{{PathRegex: `.*`, Age: joined}}})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeConfig, "Failed to format creation rule")
+	}
+
+	return []Snippet{
+		{Name: "Creation rule (" + ConfigFileName + ")", Text: strings.TrimSpace(string(rule))},
+		{Name: "sops command", Text: "sops --encrypt --age=" + shellQuote(joined) + " --in-place <file>"},
+		{Name: "Bare key", Text: joined},
+	}, nil
+}
+
+// shellQuote quotes value for a POSIX shell when it contains anything but
+// the characters of an age key list, as ssh keys do
+func shellQuote(value string) string {
+	unsafe := strings.ContainsFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ',')
+	})
+	if !unsafe {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -5,24 +5,56 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/bxtal-lsn/supper/internal/age"
 	"github.com/bxtal-lsn/supper/internal/errors"
 	"github.com/bxtal-lsn/supper/internal/recovery"
+	"github.com/bxtal-lsn/supper/internal/utils"
 )
 
 // FileInfo represents metadata about a SOPS-encrypted file
 type FileInfo struct {
-	Path       string
-	Encrypted  bool
-	Recipients []string
+	Path            string
+	Format          string // The format sops treats the file as, see DetectFormat
+	Encrypted       bool
+	Recipients      []string // The age recipients; KeyGroups holds keys of every kind
+	KeyGroups       []KeyGroup
+	ShamirThreshold int
+	Health          string // For encrypted files, whether anyone can open them; see HealthOK
+	AgeEncrypted    bool   // Encrypted with age itself rather than sops, see IsAgeFile; Encrypted is false
+}
+
+// Health of an encrypted file, telling whether its data key can be opened
+const (
+	HealthOK           = "ok"
+	HealthNoRecipients = "no_recipients" // Encrypted, but no key of any kind can open it
+	HealthNoKey        = "no_key"        // Only others' keys can open it, not ours
+)
+
+// CanDecrypt reports whether the holders of the given public keys can decrypt
+// the file, following the rules of Metadata.CanDecrypt
+func (i *FileInfo) CanDecrypt(publicKeys []string) bool {
+	md := Metadata{KeyGroups: i.KeyGroups, ShamirThreshold: i.ShamirThreshold}
+	return md.CanDecrypt(publicKeys)
+}
+
+// AllRecipients returns the recipients of every kind the file is encrypted to.
+// Without parsed key groups only the age recipients are known.
+func (i *FileInfo) AllRecipients() []age.Recipient {
+	if len(i.KeyGroups) == 0 {
+		return age.FromKeys(i.Recipients)
+	}
+	md := Metadata{KeyGroups: i.KeyGroups}
+	return md.AllRecipients()
 }
 
 // Common SOPS error patterns for better error detection
 var (
 	errFailedToDecrypt      = regexp.MustCompile(`(?i)failed to decrypt`)
-	errKeyNotFound          = regexp.MustCompile(`(?i)no key.*found`)
+	errKeyNotFound          = regexp.MustCompile(`(?i)no key.*found|no identity matched`)
 	errFileAlreadyEncrypt   = regexp.MustCompile(`(?i)already encrypted`)
 	errNoRegexMatch         = regexp.MustCompile(`(?i)no regex match`)
 	errMissingConfiguration = regexp.MustCompile(`(?i)could not find sops configuration`)
@@ -36,39 +68,98 @@ func ParseSOPSError(cmdErr error, stderr string) error {
 
 	switch {
 	case errFailedToDecrypt.MatchString(stderr):
-		return errors.New(errors.TypeSecurity, "Failed to decrypt file (incorrect key or corrupted file)")
+		return errors.New(errors.TypeSecurity, "Failed to decrypt file (incorrect key or corrupted file)").WithCode(errors.CodeSOPSDecryptFailed)
 	case errKeyNotFound.MatchString(stderr):
-		return errors.New(errors.TypeSecurity, "No suitable decryption key found")
+		return errors.New(errors.TypeSecurity, "No suitable decryption key found").WithCode(errors.CodeSOPSNoKey)
 	case errFileAlreadyEncrypt.MatchString(stderr):
-		return errors.New(errors.TypeFileOperation, "File is already encrypted")
+		return errors.New(errors.TypeFileOperation, "File is already encrypted").WithCode(errors.CodeSOPSAlreadyEncrypted)
 	case errNoRegexMatch.MatchString(stderr):
-		return errors.New(errors.TypeConfig, "SOPS regex pattern did not match any values")
+		return errors.New(errors.TypeConfig, "The encrypted_regex of the .sops.yaml rule matched no keys, so nothing would be encrypted; check the pattern and the file's structure").WithCode(errors.CodeSOPSNoRegexMatch)
 	case errMissingConfiguration.MatchString(stderr):
-		return errors.New(errors.TypeConfig, "Missing SOPS configuration (.sops.yaml)")
+		return errors.New(errors.TypeConfig, "Missing SOPS configuration (.sops.yaml)").WithCode(errors.CodeSOPSNoConfig)
 	default:
-		return errors.Wrap(cmdErr, errors.TypeGeneral, "SOPS operation failed").WithData("details", stderr)
+		return errors.Wrap(cmdErr, errors.TypeGeneral, "SOPS operation failed").WithCode(errors.CodeSOPSFailed).WithData("details", stderr)
 	}
 }
 
-// EncryptFile encrypts a file using SOPS and age
-func EncryptFile(filePath string, ageRecipients []string, inPlace bool) error {
-	// Prepare for operation with backup
-	tm := recovery.NewTransactionManager()
-	if err := tm.Begin(filePath); err != nil {
+// CheckAvailable checks that sops is installed and returns its version
+func CheckAvailable() (string, error) {
+	if _, err := exec.LookPath("sops"); err != nil {
+		return "", errors.Wrap(err, errors.TypeConfig, "sops is not installed").WithCode(errors.CodeSOPSNotInstalled)
+	}
+
+	out, err := exec.Command("sops", "--version").Output()
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeConfig, "Failed to get sops version").WithCode(errors.CodeSOPSNotInstalled)
+	}
+
+	// sops may print an update notice after the version line
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return version, nil
+}
+
+// checkWritable fails early when a file that will be modified in place is read-only
+func checkWritable(filePath string) error {
+	if utils.FileExists(filePath) && utils.IsReadOnly(filePath) {
+		return errors.New(errors.TypeFileOperation, "File is read-only").
+			WithCode(errors.CodeFileReadOnly).WithData("path", filePath)
+	}
+	return nil
+}
+
+// EncryptFile encrypts a file using SOPS to recipients of any kind, e.g. age
+// keys together with a PGP fingerprint and a KMS ARN
+func EncryptFile(filePath string, recipients []age.Recipient, inPlace bool, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
 		return err
 	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if IsAgeFile(filePath) {
+		return errors.New(errors.TypeFileOperation, "File is already encrypted with age; decrypt it first to encrypt it with sops").
+			WithCode(errors.CodeSOPSAlreadyEncrypted).WithData("path", filePath)
+	}
 
-	args := []string{}
+	if inPlace {
+		if err := checkWritable(filePath); err != nil {
+			return err
+		}
+	}
+	// sops would add a key given twice to the metadata twice
+	recipients, _ = DedupeRecipients(recipients)
+
+	// Point sops at a copy of the file's rule without its encrypted_regex
+	var args []string
+	if o.noEncryptedRegex {
+		configPath, err := withoutEncryptedRegexConfig(filePath)
+		if err != nil {
+			return err
+		}
+		if configPath != "" {
+			defer os.Remove(configPath)
+			args = append(args, "--config", configPath)
+		}
+	}
 
-	// Add age recipients
-	if len(ageRecipients) > 0 {
-		recipientArg := "--age=" + strings.Join(ageRecipients, ",")
-		args = append(args, recipientArg)
+	// Prepare for operation with backup
+	tm := recovery.NewTransactionManager()
+	if err := o.begin(tm, filePath); err != nil {
+		return err
 	}
 
+	// Add the recipients of each kind
+	args = append(args, recipientArgs("", recipients)...)
+
 	// Add encrypt flag
 	args = append(args, "-e")
 
+	// Keep sops from parsing binary content as the format its name suggests
+	args = append(args, binaryArgs(filePath)...)
+
 	// Add in-place flag if requested
 	if inPlace {
 		args = append(args, "-i")
@@ -78,7 +169,7 @@ func EncryptFile(filePath string, ageRecipients []string, inPlace bool) error {
 	args = append(args, filePath)
 
 	// Execute SOPS command
-	cmd := exec.Command("sops", args...)
+	cmd := o.command(args...)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
@@ -90,25 +181,146 @@ func EncryptFile(filePath string, ageRecipients []string, inPlace bool) error {
 			// Both encryption and rollback failed
 			return errors.Wrap(err, errors.TypeFileOperation,
 				"Failed to encrypt file and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
 				WithData("stderr", errOut.String()).
 				WithData("rollbackError", rollbackErr.Error())
 		}
 
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Encryption cancelled").WithCode(errors.CodeCancelled)
+		}
+
 		// Return parsed error
-		return ParseSOPSError(err, errOut.String())
+		return explainNoRegexMatch(o.parseError(err, errOut.String()), filePath)
 	}
 
 	// Commit the operation (clear backups)
 	tm.Commit()
+
+	// Without in-place, sops writes the ciphertext to stdout
+	if !inPlace {
+		if _, err := o.stdout.Write(out.Bytes()); err != nil {
+			return errors.Wrap(err, errors.TypeFileOperation, "Failed to write encrypted output").
+				WithCode(errors.CodeFileWriteFailed)
+		}
+	}
 	return nil
 }
 
+// SidecarPath returns where EncryptToFile writes the ciphertext of path by
+// default: the configured output template applied to path (see OutputPath),
+// or <path>.enc when the template cannot name it
+func SidecarPath(path string) string {
+	if output, err := OutputPath(OutputTemplate(), path); err == nil {
+		return output
+	}
+	return path + ".enc"
+}
+
+// TempPrefix names the transient files encrypted output is staged in, so
+// directory watchers can ignore them
+const TempPrefix = ".supper-tmp-"
+
+// EncryptToFile encrypts filePath into outputPath and leaves the plaintext in
+// place. The ciphertext is staged in a temporary file next to the output and
+// renamed into place only once sops has succeeded, so an existing output is
+// never left half written.
+func EncryptToFile(filePath, outputPath string, recipients []age.Recipient, opts ...Option) error {
+	if err := checkProtected(outputPath); err != nil {
+		return err
+	}
+	if err := prepareOutputDir(outputPath, newOptions(opts).createDir); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), TempPrefix+"*")
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to create temporary file").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	tmpPath := tmp.Name()
+
+	// The plaintext is only read, so there is nothing to back up
+	opts = append(opts, WithStdout(tmp), WithoutBackup())
+	err = EncryptFile(filePath, recipients, false, opts...)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, errors.TypeFileOperation, "Failed to write encrypted output").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+	}
+	if err == nil {
+		// Renaming onto a symlink would replace the link, so replace its target
+		if renameErr := os.Rename(tmpPath, utils.RealPath(outputPath)); renameErr != nil {
+			err = errors.Wrap(renameErr, errors.TypeFileOperation, "Failed to write encrypted output").
+				WithCode(errors.CodeFileWriteFailed).WithData("path", outputPath)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
 // DecryptFile decrypts a file using SOPS
-func DecryptFile(filePath string, inPlace bool, outputPath string) error {
+func DecryptFile(filePath string, inPlace bool, outputPath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	written := outputPath
+	if inPlace {
+		written = ""
+	}
+	if err := checkProtected(filePath, written); err != nil {
+		return err
+	}
+
+	// Reject impossible conversions before touching the file
+	rawAge := IsAgeFile(filePath)
+	if rawAge && o.outputType != "" {
+		return errors.New(errors.TypeConfig, "A file encrypted with age itself is decrypted as it is and cannot be converted").
+			WithCode(errors.CodeFormatUnsupported).WithData("outputType", o.outputType)
+	}
+	inputType := DetectFormat(filePath)
+	if err := ValidateOutputType(inputType, o.outputType); err != nil {
+		return err
+	}
+
+	// sops only says it failed to write, so name the directory at fault first
+	if outputPath != "" && !inPlace {
+		if err := prepareOutputDir(outputPath, o.createDir); err != nil {
+			return err
+		}
+	}
+
+	// The plaintext lands in the output file, or over the encrypted one
+	plaintextPath := outputPath
+	if inPlace {
+		plaintextPath = filePath
+	}
+	if plaintextPath != "" {
+		if err := checkOutputExposure(plaintextPath); err != nil {
+			return err
+		}
+	}
+
+	// sops cannot open a file it did not encrypt, so age does it directly
+	if rawAge {
+		if err := decryptAgeFile(filePath, plaintextPath, o); err != nil {
+			return err
+		}
+		o.recordAccess(filePath, "decrypt", plaintextPath)
+		return nil
+	}
+
 	// Prepare for operation with backup if modifying in-place
 	tm := recovery.NewTransactionManager()
 	if inPlace {
-		if err := tm.Begin(filePath); err != nil {
+		if err := checkWritable(filePath); err != nil {
+			return err
+		}
+		if err := o.begin(tm, filePath); err != nil {
 			return err
 		}
 	}
@@ -120,6 +332,21 @@ func DecryptFile(filePath string, inPlace bool, outputPath string) error {
 		args = append(args, "-i")
 	}
 
+	// Remember whether the output existed so a failed run can clean up after itself
+	outputExisted := outputPath != "" && utils.FileExists(outputPath)
+	if plaintextPath != "" {
+		if err := restrictOutput(plaintextPath); err != nil {
+			return err
+		}
+	}
+
+	// Add output type if a conversion was requested
+	if o.outputType != "" && o.outputType != inputType {
+		args = append(args, "--input-type", inputType, "--output-type", o.outputType)
+	} else {
+		args = append(args, binaryArgs(filePath)...)
+	}
+
 	// Add output path if provided
 	if outputPath != "" && !inPlace {
 		args = append(args, "--output", outputPath)
@@ -129,7 +356,7 @@ func DecryptFile(filePath string, inPlace bool, outputPath string) error {
 	args = append(args, filePath)
 
 	// Execute SOPS command
-	cmd := exec.Command("sops", args...)
+	cmd := o.command(args...)
 	var errOut bytes.Buffer
 	cmd.Stderr = &errOut
 
@@ -145,12 +372,20 @@ func DecryptFile(filePath string, inPlace bool, outputPath string) error {
 			if rollbackErr := tm.Rollback(); rollbackErr != nil {
 				return errors.Wrap(err, errors.TypeFileOperation,
 					"Failed to decrypt file and rollback also failed").
+					WithCode(errors.CodeRollbackFailed).
 					WithData("stderr", errOut.String()).
 					WithData("rollbackError", rollbackErr.Error())
 			}
 		}
 
-		return ParseSOPSError(err, errOut.String())
+		if !inPlace && outputPath != "" && !outputExisted {
+			os.Remove(outputPath)
+		}
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Decryption cancelled").WithCode(errors.CodeCancelled)
+		}
+
+		return o.parseError(err, errOut.String())
 	}
 
 	// If in-place, commit the operation
@@ -158,23 +393,128 @@ func DecryptFile(filePath string, inPlace bool, outputPath string) error {
 		tm.Commit()
 	}
 
+	// In case sops replaced the file rather than writing to it
+	if plaintextPath != "" {
+		if err := os.Chmod(plaintextPath, DecryptedFileMode); err != nil {
+			return errors.Wrap(err, errors.TypeFileOperation, "Failed to restrict the permissions of the decrypted file").
+				WithCode(errors.CodeFileWriteFailed).WithData("path", plaintextPath)
+		}
+	}
+
 	// If output path is not provided and not in-place, write to stdout
 	if !inPlace && outputPath == "" {
-		fmt.Print(out.String())
+		fmt.Fprint(o.stdout, out.String())
 	}
 
+	o.recordAccess(filePath, "decrypt", plaintextPath)
 	return nil
 }
 
-// EditFile opens a SOPS-encrypted file in an editor
-func EditFile(filePath string) error {
+// DecryptToMemory decrypts a file and returns the plaintext without writing
+// it to disk. Files encrypted with age itself are decrypted with age, as
+// DecryptFile does. Callers should wipe the returned slice with
+// utils.WipeBytes once they are done with it.
+func DecryptToMemory(filePath string, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	inputType := DetectFormat(filePath)
+	if IsAgeFile(filePath) {
+		return decryptAgeToMemory(filePath, inputType, o)
+	}
+	if err := ValidateOutputType(inputType, o.outputType); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-d"}
+	if o.outputType != "" && o.outputType != inputType {
+		args = append(args, "--input-type", inputType, "--output-type", o.outputType)
+	} else {
+		args = append(args, binaryArgs(filePath)...)
+	}
+	args = append(args, filePath)
+
+	// The plaintext is smaller than the encrypted file, so sizing the buffer
+	// up front avoids leaving copies behind when it grows
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+	}
+	out := bytes.NewBuffer(make([]byte, 0, size))
+
+	cmd := o.command(args...)
+	var errOut bytes.Buffer
+	cmd.Stdout = out
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		utils.WipeBytes(out.Bytes())
+		if o.ctx.Err() != nil {
+			return nil, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Decryption cancelled").WithCode(errors.CodeCancelled)
+		}
+		return nil, o.parseError(err, errOut.String())
+	}
+
+	o.recordAccess(filePath, "view", "")
+	return out.Bytes(), nil
+}
+
+// decryptAgeToMemory is DecryptToMemory for a file encrypted with age itself,
+// which sops cannot open. Its plaintext is returned as it is.
+func decryptAgeToMemory(filePath, inputType string, o *options) ([]byte, error) {
+	if o.outputType != "" && o.outputType != inputType {
+		return nil, errors.New(errors.TypeConfig, "A file encrypted with age itself is decrypted as it is and cannot be converted").
+			WithCode(errors.CodeFormatUnsupported).WithData("outputType", o.outputType)
+	}
+
+	// As with sops, sizing the buffer up front leaves no copies behind
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+	}
+	out := bytes.NewBuffer(make([]byte, 0, size))
+	o.stdout = out
+	if err := decryptAgeFile(filePath, "", o); err != nil {
+		utils.WipeBytes(out.Bytes())
+		return nil, err
+	}
+	o.recordAccess(filePath, "view", "")
+	return out.Bytes(), nil
+}
+
+// EditFile opens a SOPS-encrypted file in an editor. The editor gets the
+// decrypted text as sops writes it, comments and key order included, and the
+// bytes it saves are encrypted back as they are; nothing is parsed and
+// re-serialized in between, so a YAML file keeps its comments.
+func EditFile(filePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+
+	if err := checkWritable(filePath); err != nil {
+		return err
+	}
+
 	// Create backup before editing
 	tm := recovery.NewTransactionManager()
-	if err := tm.Begin(filePath); err != nil {
+	if err := o.begin(tm, filePath); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("sops", filePath)
+	// The format is given explicitly, so sops reads secrets.yaml.enc with its
+	// YAML store rather than the binary one the .enc suffix would select
+	format := DetectFormat(filePath)
+	cmd := o.command("--input-type", format, "--output-type", format, filePath)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -182,39 +522,60 @@ func EditFile(filePath string) error {
 	if err := cmd.Run(); err != nil {
 		// If editing fails, we'll ask if the user wants to restore from backup
 		return errors.Wrap(err, errors.TypeFileOperation,
-			"Failed to edit file").WithData("path", filePath)
+			"Failed to edit file").WithCode(errors.CodeEditFailed).WithData("path", filePath)
 	}
 
 	// Editing was successful, commit the transaction
 	tm.Commit()
+	o.recordAccess(filePath, "edit", "")
 	return nil
 }
 
 // GetFileInfo retrieves information about a SOPS file
-func GetFileInfo(filePath string) (*FileInfo, error) {
+func GetFileInfo(filePath string, opts ...Option) (*FileInfo, error) {
+	return fileInfo(newOptions(opts), filePath)
+}
+
+// fileInfo is GetFileInfo for callers that already hold their options
+func fileInfo(o *options, filePath string) (*FileInfo, error) {
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, errors.Wrap(err, errors.TypeFileOperation,
-			"File does not exist").WithData("path", filePath)
+			"File does not exist").WithCode(errors.CodeFileNotFound).WithData("path", filePath)
+	}
+
+	var info FileInfo
+	info.Path = filePath
+	info.Format = DetectFormat(filePath)
+
+	// sops does not know files age encrypted by itself
+	if IsAgeFile(filePath) {
+		info.AgeEncrypted = true
+		return &info, nil
 	}
 
 	// Use SOPS to check if the file is encrypted
-	cmd := exec.Command("sops", "--output-type", "json", "filestatus", filePath)
+	cmd := o.command("--output-type", "json", "filestatus", filePath)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &errOut
 
-	var info FileInfo
-	info.Path = filePath
-
 	if err := cmd.Run(); err != nil {
+		if o.ctx.Err() != nil {
+			return nil, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Status check cancelled").WithCode(errors.CodeCancelled)
+		}
+		// A sops stopped by the timeout has said nothing about the file
+		if o.timeoutCtx != nil && o.timeoutCtx.Err() != nil {
+			return nil, o.parseError(err, errOut.String())
+		}
+
 		// If command fails, check the error
 		if errOut.String() != "" {
 			// If there's an error message but it's not about encryption status
 			// then return the error
 			if !strings.Contains(errOut.String(), "not an encrypted file") {
-				return nil, ParseSOPSError(err, errOut.String())
+				return nil, o.parseError(err, errOut.String())
 			}
 		}
 
@@ -229,14 +590,37 @@ func GetFileInfo(filePath string) (*FileInfo, error) {
 		info.Encrypted = true
 	}
 
-	// If encrypted, get list of recipients
+	// If encrypted, read the recipients and key groups from the file's metadata
 	if info.Encrypted {
-		info.Recipients = extractRecipients(output)
+		if md, err := ReadMetadata(filePath); err == nil {
+			info.KeyGroups = md.KeyGroups
+			info.ShamirThreshold = md.ShamirThreshold
+			info.Recipients = md.Recipients()
+		} else {
+			info.Recipients = extractRecipients(output)
+		}
+		info.Health = fileHealth(&info)
 	}
 
 	return &info, nil
 }
 
+// fileHealth tells whether anyone, and we in particular, can open the data
+// key of an encrypted file. Our key is only checked when sops would use it
+// rather than an identity named in the environment.
+func fileHealth(info *FileInfo) string {
+	if len(info.AllRecipients()) == 0 {
+		return HealthNoRecipients
+	}
+	if os.Getenv(age.EnvSOPSAgeKey) != "" || os.Getenv(age.EnvSOPSAgeKeyFile) != "" {
+		return HealthOK
+	}
+	if key, err := age.SelfPublicKey(); err == nil && !info.CanDecrypt([]string{key}) {
+		return HealthNoKey
+	}
+	return HealthOK
+}
+
 // extractRecipients parses the SOPS filestatus output to extract recipients
 func extractRecipients(output string) []string {
 	var recipients []string
@@ -254,44 +638,164 @@ func extractRecipients(output string) []string {
 	return recipients
 }
 
-// AddRecipient adds a recipient to an encrypted file
-func AddRecipient(filePath string, recipient string) error {
+// AddRecipient adds a recipient of any kind to an encrypted file and reports
+// whether the file changed. A file that already has the recipient is left
+// untouched, so repeated runs do not rewrite its MAC and lastmodified.
+func AddRecipient(filePath string, recipient age.Recipient, opts ...Option) (bool, error) {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return false, err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return false, err
+	}
+
+	info, err := fileInfo(o, filePath)
+	if err != nil {
+		return false, err
+	}
+	// A key already on the file would make updatekeys a no-op
+	if _, present := SplitPresent(info.AllRecipients(), []age.Recipient{recipient}); len(present) > 0 {
+		return false, nil
+	}
+	if err := checkWritable(filePath); err != nil {
+		return false, err
+	}
+
 	// Create backup before modifying
 	tm := recovery.NewTransactionManager()
-	if err := tm.Begin(filePath); err != nil {
-		return err
+	if err := o.begin(tm, filePath); err != nil {
+		return false, err
 	}
 
-	cmd := exec.Command("sops", "updatekeys", "--age", recipient, filePath)
+	// Without --yes updatekeys asks before writing the file
+	args := append([]string{"updatekeys", "--yes"}, recipientArgs("", []age.Recipient{recipient})...)
+	// updatekeys only takes an input type; it writes the file back the same way
+	if binaryArgs(filePath) != nil {
+		args = append(args, "--input-type", FormatBinary)
+	}
+	cmd := o.command(append(args, filePath)...)
 	var errOut bytes.Buffer
 	cmd.Stderr = &errOut
 
 	if err := cmd.Run(); err != nil {
 		// Rollback if operation fails
 		if rollbackErr := tm.Rollback(); rollbackErr != nil {
-			return errors.Wrap(err, errors.TypeFileOperation,
+			return false, errors.Wrap(err, errors.TypeFileOperation,
 				"Failed to add recipient and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
 				WithData("stderr", errOut.String()).
 				WithData("rollbackError", rollbackErr.Error())
 		}
+		if o.ctx.Err() != nil {
+			return false, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Adding the recipient cancelled").WithCode(errors.CodeCancelled)
+		}
 
-		return ParseSOPSError(err, errOut.String())
+		return false, o.parseError(err, errOut.String())
 	}
 
 	// Operation succeeded, commit
+	tm.Commit()
+	return true, nil
+}
+
+// RepairRecipients runs updatekeys to give a file that lost its recipients,
+// or has none we hold, the given recipients. sops still has to open the
+// data key, with our identity or a key of another kind; when nothing can,
+// the file is only recoverable from a backup.
+func RepairRecipients(filePath string, recipients []age.Recipient, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return errors.New(errors.TypeConfig, "No recipient given").WithCode(errors.CodeRecipientUnknown)
+	}
+	if err := checkWritable(filePath); err != nil {
+		return err
+	}
+
+	tm := recovery.NewTransactionManager()
+	if err := o.begin(tm, filePath); err != nil {
+		return err
+	}
+
+	args := append([]string{"updatekeys", "--yes"}, recipientArgs("", recipients)...)
+	if binaryArgs(filePath) != nil {
+		args = append(args, "--input-type", FormatBinary)
+	}
+	cmd := o.command(append(args, filePath)...)
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		if rollbackErr := tm.Rollback(); rollbackErr != nil {
+			return errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to repair recipients and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
+				WithData("stderr", errOut.String()).
+				WithData("rollbackError", rollbackErr.Error())
+		}
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Repair cancelled").WithCode(errors.CodeCancelled)
+		}
+
+		parsed := o.parseError(err, errOut.String())
+		switch errors.Code(parsed) {
+		case errors.CodeSOPSDecryptFailed, errors.CodeSOPSNoKey:
+			return errors.Wrap(parsed, errors.TypeKeyManagement,
+				"No key can open the data key, so the recipients cannot be repaired; restore the file from a backup").
+				WithCode(errors.Code(parsed)).WithData("path", filePath)
+		}
+		return parsed
+	}
+
 	tm.Commit()
 	return nil
 }
 
+// containsRecipient reports whether recipients includes a key of the same
+// kind as recipient
+func containsRecipient(recipients []age.Recipient, recipient age.Recipient) bool {
+	id := recipientID(recipient)
+	for _, r := range recipients {
+		if recipientID(r) == id {
+			return true
+		}
+	}
+	return false
+}
+
 // RotateKey rotates the data key in an encrypted file
-func RotateKey(filePath string) error {
+func RotateKey(filePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	filePath, err := ResolvePath(filePath)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(filePath); err != nil {
+		return err
+	}
+	if err := checkWritable(filePath); err != nil {
+		return err
+	}
+
 	// Create backup before rotating keys
 	tm := recovery.NewTransactionManager()
-	if err := tm.Begin(filePath); err != nil {
+	if err := o.begin(tm, filePath); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("sops", "rotate", "-i", filePath)
+	args := append([]string{"rotate", "-i"}, binaryArgs(filePath)...)
+	cmd := o.command(append(args, filePath)...)
 	var errOut bytes.Buffer
 	cmd.Stderr = &errOut
 
@@ -300,11 +804,15 @@ func RotateKey(filePath string) error {
 		if rollbackErr := tm.Rollback(); rollbackErr != nil {
 			return errors.Wrap(err, errors.TypeFileOperation,
 				"Failed to rotate key and rollback also failed").
+				WithCode(errors.CodeRollbackFailed).
 				WithData("stderr", errOut.String()).
 				WithData("rollbackError", rollbackErr.Error())
 		}
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Key rotation cancelled").WithCode(errors.CodeCancelled)
+		}
 
-		return ParseSOPSError(err, errOut.String())
+		return o.parseError(err, errOut.String())
 	}
 
 	// Operation succeeded, commit
@@ -0,0 +1,159 @@
+package sops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// SiblingSuffixes are the extensions of an encrypted copy kept beside its
+// plaintext, in the order they are looked for after the name the output
+// template gives it (see SidecarPath). The default template writes .enc.
+var SiblingSuffixes = []string{".enc", ".sops"}
+
+// EncryptedSibling returns the encrypted copy kept beside the plaintext file
+// at path, or "" when there is none
+func EncryptedSibling(path string) string {
+	for _, candidate := range siblingCandidates(OutputTemplate(), path) {
+		if info, err := os.Stat(candidate); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if _, err := ReadMetadata(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// IsStale reports whether the plaintext file at path was modified after its
+// encrypted sibling was written, so the ciphertext no longer matches it
+func IsStale(path string) bool {
+	sibling := EncryptedSibling(path)
+	if sibling == "" {
+		return false
+	}
+	// Two encrypted files that happen to pair up are not plaintext and copy
+	if _, err := ReadMetadata(path); err == nil {
+		return false
+	}
+	plain, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	encrypted, err := os.Stat(sibling)
+	if err != nil {
+		return false
+	}
+	return plain.ModTime().After(encrypted.ModTime())
+}
+
+// StaleFiles lists the plaintext files directly in dir that are newer than
+// their encrypted siblings. Hidden files are skipped, as in the file browser.
+func StaleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to read directory").WithCode(errors.CodeFileNotFound).WithData("directory", dir)
+	}
+
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+
+	template := OutputTemplate()
+	var stale []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !HasSiblingName(names, dir, entry.Name(), template) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if IsStale(path) {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// ResealFiles re-encrypts each plaintext file over its encrypted sibling,
+// to the recipients the sibling already has, so the ciphertext catches up
+// with the plaintext. The plaintext is left in place. A sibling with several
+// key groups is skipped, since re-encrypting it to a flat recipient list
+// would change who has to cooperate to decrypt it. Files are re-encrypted a
+// few at a time through a Queue. A cancelled context skips the files that
+// have not started yet.
+func ResealFiles(paths []string, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+
+	report := &Report{Operation: "reseal", Started: time.Now()}
+	if len(paths) > 0 {
+		report.Root = filepath.Dir(paths[0])
+	}
+
+	report.Files = make([]FileResult, len(paths))
+	queue := NewQueue(DefaultBatchWorkers, o.jobs)
+	for i, path := range paths {
+		report.Files[i] = FileResult{Path: path, Status: StatusSkipped, Error: "cancelled"}
+		queue.Submit(o.ctx, Task{Operation: "reseal", Path: path, Also: []string{EncryptedSibling(path)}, Run: func(context.Context) error {
+			report.Files[i] = resealFile(path, opts)
+			o.notify(report.Files[i])
+			return resultError(report.Files[i])
+		}})
+	}
+	queue.Wait()
+
+	report.Duration = time.Since(report.Started)
+
+	if o.ctx.Err() != nil {
+		return report, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Re-encryption cancelled").WithCode(errors.CodeCancelled)
+	}
+	return report, nil
+}
+
+// resealFile re-encrypts a single plaintext file over its encrypted sibling
+func resealFile(path string, opts []Option) FileResult {
+	start := time.Now()
+	result := FileResult{Path: path}
+
+	finish := func(status, reason string) FileResult {
+		result.Status = status
+		result.Error = reason
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sibling := EncryptedSibling(path)
+	if sibling == "" {
+		return finish(StatusSkipped, "there is no encrypted copy beside the file")
+	}
+	result.Output = sibling
+
+	md, err := ReadMetadata(sibling)
+	if err != nil {
+		return finish(StatusFailed, err.Error())
+	}
+	recipients := md.AllRecipients()
+	result.OldRecipients = age.RecipientTokens(recipients)
+	result.NewRecipients = result.OldRecipients
+	if len(md.KeyGroups) > 1 {
+		return finish(StatusSkipped, "the encrypted copy has several key groups; re-encrypt it by hand")
+	}
+	if len(recipients) == 0 {
+		return finish(StatusSkipped, "the encrypted copy lists no recipients to re-encrypt to")
+	}
+
+	if err := EncryptToFile(path, sibling, recipients, opts...); err != nil {
+		if errors.Code(err) == errors.CodeCancelled {
+			return finish(StatusSkipped, err.Error())
+		}
+		return finish(StatusFailed, err.Error())
+	}
+	return finish(StatusOK, "")
+}
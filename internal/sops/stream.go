@@ -0,0 +1,82 @@
+package sops
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+)
+
+// stdinPath is the path sops reads from when data is piped to it
+const stdinPath = "/dev/stdin"
+
+// EncryptStream encrypts data read from r and writes the ciphertext to w.
+// The plaintext is piped to sops and never written to disk. inputType is
+// required because there is no filename to infer the format from.
+func EncryptStream(r io.Reader, inputType string, recipients []age.Recipient, w io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if err := validateStreamType(inputType); err != nil {
+		return err
+	}
+
+	args := recipientArgs("", recipients)
+	args = append(args, o.encryptArgs...)
+	args = append(args, "--input-type", inputType, "--output-type", inputType, "-e", stdinPath)
+
+	return runStream(o, r, w, args, "Encryption cancelled")
+}
+
+// DecryptStream decrypts data read from r and writes the plaintext to w
+func DecryptStream(r io.Reader, inputType string, w io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if err := validateStreamType(inputType); err != nil {
+		return err
+	}
+	if err := ValidateOutputType(inputType, o.outputType); err != nil {
+		return err
+	}
+
+	outputType := inputType
+	if o.outputType != "" {
+		outputType = o.outputType
+	}
+
+	args := []string{"--input-type", inputType, "--output-type", outputType, "-d", stdinPath}
+
+	return runStream(o, r, w, args, "Decryption cancelled")
+}
+
+// validateStreamType checks that a stream's format was given and is known
+func validateStreamType(inputType string) error {
+	for _, format := range Formats {
+		if format == inputType {
+			return nil
+		}
+	}
+	return errors.New(errors.TypeConfig, "An input type is required when reading from stdin").
+		WithCode(errors.CodeFormatUnsupported).
+		WithData("inputType", inputType).
+		WithData("supported", strings.Join(Formats, ", "))
+}
+
+// runStream runs sops with r as stdin and w as stdout
+func runStream(o *options, r io.Reader, w io.Writer, args []string, cancelMessage string) error {
+	cmd := o.command(args...)
+	var errOut bytes.Buffer
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = &errOut
+
+	if err := cmd.Run(); err != nil {
+		if o.ctx.Err() != nil {
+			return errors.Wrap(o.ctx.Err(), errors.TypeGeneral, cancelMessage).WithCode(errors.CodeCancelled)
+		}
+		return o.parseError(err, errOut.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package sops
+
+import (
+	"fmt"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// symlinkMode returns the configured handling of symlinked files
+func symlinkMode() string {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	return cfg.SymlinkMode
+}
+
+// ResolvePath applies the configured symlink handling to filePath. In target
+// mode (the default) a symlink is replaced by the file it points to; in link
+// mode the link's own path is kept; in refuse mode an error is returned.
+// Writes always go through the link, so a symlink is never replaced by a
+// regular file.
+func ResolvePath(filePath string) (string, error) {
+	if !utils.IsSymlink(filePath) {
+		return filePath, nil
+	}
+
+	switch symlinkMode() {
+	case config.SymlinkLink:
+		return filePath, nil
+	case config.SymlinkRefuse:
+		return "", errors.New(errors.TypeFileOperation, "File is a symlink").
+			WithCode(errors.CodeFileSymlink).
+			WithData("path", filePath).
+			WithData("target", utils.RealPath(filePath))
+	default:
+		return utils.RealPath(filePath), nil
+	}
+}
+
+// SymlinkWarning describes how a symlinked path will be handled, or returns
+// an empty string if it is not a symlink
+func SymlinkWarning(filePath string) string {
+	if !utils.IsSymlink(filePath) {
+		return ""
+	}
+
+	target := utils.RealPath(filePath)
+	switch symlinkMode() {
+	case config.SymlinkLink:
+		return fmt.Sprintf("%s is a symlink to %s; changes are written through the link", filePath, target)
+	case config.SymlinkRefuse:
+		return fmt.Sprintf("%s is a symlink to %s; symlinks are refused by the current settings", filePath, target)
+	default:
+		return fmt.Sprintf("%s is a symlink; operating on its target %s", filePath, target)
+	}
+}
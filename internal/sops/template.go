@@ -0,0 +1,84 @@
+package sops
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// OutputTemplate returns the configured name of encrypted copies
+func OutputTemplate() string {
+	cfg, err := config.Load()
+	if err != nil || cfg.OutputTemplate == "" {
+		return config.DefaultOutputTemplate
+	}
+	return cfg.OutputTemplate
+}
+
+// OutputPath applies an output template to the file at path. {name} is the
+// file's name without its extension, {ext} the extension with its dot and
+// {dir} the name of the directory it is in; the result is relative to that
+// directory. A dotfile such as .env has no extension. The result never
+// leaves the file's directory and never names the file itself.
+func OutputPath(template, path string) (string, error) {
+	if err := config.ValidateOutputTemplate(template); err != nil {
+		return "", errors.Wrap(err, errors.TypeConfig, fmt.Sprintf("Invalid output template %q", template)).
+			WithCode(errors.CodeConfigInvalid).WithData("template", template)
+	}
+
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	if name == "" {
+		name, ext = base, ""
+	}
+	dirName := filepath.Base(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dirName = filepath.Base(abs)
+	}
+
+	rel := strings.NewReplacer("{name}", name, "{ext}", ext, "{dir}", dirName).Replace(template)
+	output := filepath.Join(dir, filepath.FromSlash(rel))
+	if !within(dir, output) || output == filepath.Clean(path) {
+		return "", errors.New(errors.TypeConfig, fmt.Sprintf("Output template %q does not give %s a name of its own", template, base)).
+			WithCode(errors.CodeConfigInvalid).WithData("template", template).WithData("path", path)
+	}
+	return output, nil
+}
+
+// siblingCandidates returns where an encrypted copy of the plaintext file at
+// path may be: the configured output name first, then the usual suffixes
+func siblingCandidates(template, path string) []string {
+	var candidates []string
+	if output, err := OutputPath(template, path); err == nil {
+		candidates = append(candidates, output)
+	}
+	for _, suffix := range SiblingSuffixes {
+		if candidate := path + suffix; len(candidates) == 0 || candidate != candidates[0] {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// HasSiblingName reports whether a possible encrypted copy of the file
+// called name in dir exists, under template or one of SiblingSuffixes.
+// names holds the entries of dir, so the usual pairs are found without
+// touching the disk; only copies in a subdirectory are looked up.
+func HasSiblingName(names map[string]bool, dir, name, template string) bool {
+	for _, candidate := range siblingCandidates(template, filepath.Join(dir, name)) {
+		if filepath.Dir(candidate) == filepath.Clean(dir) {
+			if names[filepath.Base(candidate)] {
+				return true
+			}
+		} else if utils.FileExists(candidate) {
+			return true
+		}
+	}
+	return false
+}
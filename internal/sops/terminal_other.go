@@ -0,0 +1,9 @@
+//go:build !unix
+
+package sops
+
+import "os/exec"
+
+// detachTerminal cannot take the terminal away from cmd here; the timeout
+// given to WithNonInteractive still stops a process waiting on a prompt
+func detachTerminal(_ *exec.Cmd) {}
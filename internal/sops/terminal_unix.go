@@ -0,0 +1,18 @@
+//go:build unix
+
+package sops
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTerminal starts cmd in a session of its own, without a controlling
+// terminal, so opening /dev/tty to prompt fails instead of waiting for input.
+// Stopping cmd stops the whole session, including a gpg it started.
+func detachTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
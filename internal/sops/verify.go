@@ -0,0 +1,190 @@
+package sops
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/utils"
+)
+
+// VerifyIntegrity checks that an encrypted file can be decrypted and that
+// its MAC matches, so no value was changed or dropped behind sops' back. The
+// plaintext is only held in memory and wiped straight away.
+func VerifyIntegrity(filePath string, opts ...Option) error {
+	data, err := DecryptToMemory(filePath, append(opts, untracked())...)
+	utils.WipeBytes(data)
+	return err
+}
+
+// FindEncrypted lists the encrypted files under root, each once even when
+// links lead to it more than once. Hidden directories, and the files outside
+// a WithGitScope scope, are skipped. A cancelled context stops the walk.
+func FindEncrypted(root string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	git, err := newGitFilter(root, o.gitScope)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if o.ctx.Err() != nil {
+			return o.ctx.Err()
+		}
+		if d.IsDir() {
+			if (path != root && strings.HasPrefix(d.Name(), ".")) || git.excludes(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if git.excludes(path, false) {
+			return nil
+		}
+
+		info, err := fileInfo(o, path)
+		if err != nil || !info.Encrypted {
+			return nil
+		}
+		// Unresolvable links are kept so the caller can report them
+		if target, err := ResolvePath(path); err == nil {
+			if seen[target] {
+				return nil
+			}
+			seen[target] = true
+		}
+		paths = append(paths, path)
+		return nil
+	})
+
+	if err != nil {
+		if o.ctx.Err() != nil {
+			return paths, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Scan cancelled").WithCode(errors.CodeCancelled)
+		}
+		return paths, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to scan directory").WithCode(errors.CodeFileNotFound).WithData("directory", root)
+	}
+	return paths, nil
+}
+
+// VerifyFiles runs VerifyIntegrity on files concurrently, with at most
+// workers sops processes at a time. Files that verified are StatusOK and
+// files whose check failed StatusFailed. Files that none of publicKeys can
+// open, or that list no recipients, are StatusNoKey without running sops;
+// nil publicKeys tries every file. A cancelled context skips the files that
+// have not started yet.
+func VerifyFiles(paths []string, publicKeys []string, workers int, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	targets := make([]DecryptTarget, len(paths))
+	for i, path := range paths {
+		targets[i] = DecryptTarget{Path: path}
+	}
+	report := &Report{Operation: "verify", Root: commonDir(targets), Started: time.Now(), Files: make([]FileResult, len(paths))}
+
+	var pending []int
+	for i, t := range targets {
+		if result, ok := precheckDecrypt(t, publicKeys); !ok {
+			report.Files[i] = result
+			o.notify(result)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	runBounded(o.ctx, pending, workers, func(i int) {
+		report.Files[i] = verifyFile(paths[i], opts)
+		o.notify(report.Files[i])
+	}, func(i int) {
+		report.Files[i] = FileResult{Path: paths[i], Status: StatusSkipped, Error: "cancelled"}
+	})
+
+	report.Duration = time.Since(report.Started)
+
+	if o.ctx.Err() != nil {
+		return report, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Verification cancelled").WithCode(errors.CodeCancelled)
+	}
+	return report, nil
+}
+
+// VerifyIdleFiles runs VerifyIntegrity on files one at a time, for a sweep
+// that runs in the background of interactive use. The results are those of
+// VerifyFiles, except that a file a Queue job is queued or running on is
+// skipped rather than waited for. Each file is claimed like a queued job
+// while it is checked, so an operation started on it meanwhile waits for the
+// check rather than the check reading a half-written file.
+func VerifyIdleFiles(paths []string, publicKeys []string, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	targets := make([]DecryptTarget, len(paths))
+	for i, path := range paths {
+		targets[i] = DecryptTarget{Path: path}
+	}
+	report := &Report{Operation: "verify", Root: commonDir(targets), Started: time.Now(), Files: make([]FileResult, len(paths))}
+
+	queue := NewQueue(1, nil)
+	for i, t := range targets {
+		result, ok := precheckDecrypt(t, publicKeys)
+		switch {
+		case o.ctx.Err() != nil:
+			result = FileResult{Path: t.Path, Status: StatusSkipped, Error: "cancelled"}
+		case !ok:
+			// Not worth running sops on, as precheckDecrypt says
+		case Busy(t.Path):
+			result = FileResult{Path: t.Path, Status: StatusSkipped, Error: "an operation is in progress on it"}
+		default:
+			err := queue.Do(o.ctx, Task{Operation: "verify", Path: t.Path, Run: func(context.Context) error {
+				result = verifyFile(t.Path, opts)
+				return nil
+			}})
+			if err != nil {
+				result = FileResult{Path: t.Path, Status: StatusSkipped, Error: "cancelled"}
+			}
+		}
+		report.Files[i] = result
+		o.notify(result)
+	}
+
+	report.Duration = time.Since(report.Started)
+
+	if o.ctx.Err() != nil {
+		return report, errors.Wrap(o.ctx.Err(), errors.TypeGeneral, "Verification cancelled").WithCode(errors.CodeCancelled)
+	}
+	return report, nil
+}
+
+// verifyFile checks a single file of a batch
+func verifyFile(path string, opts []Option) FileResult {
+	start := time.Now()
+	result := FileResult{Path: path, Status: StatusOK}
+	if md, err := ReadMetadata(path); err == nil {
+		result.OldRecipients = age.RecipientTokens(md.AllRecipients())
+		result.NewRecipients = result.OldRecipients
+	}
+
+	if err := VerifyIntegrity(path, opts...); err != nil {
+		result.Error = err.Error()
+		switch errors.Code(err) {
+		case errors.CodeSOPSNoKey:
+			result.Status = StatusNoKey
+		case errors.CodeCancelled:
+			result.Status = StatusSkipped
+		default:
+			result.Status = StatusFailed
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
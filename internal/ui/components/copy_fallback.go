@@ -0,0 +1,24 @@
+package components
+
+import (
+	"github.com/charmbracelet/lipgloss"
+)
+
+// CopyFallback renders a value that could not be copied to the clipboard in
+// a bordered box, with instructions for copying it by hand. The box is not
+// wrapped so a selection never picks up line breaks inside the value.
+func CopyFallback(what, value string) string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.DoubleBorder()).
+		BorderForeground(lipgloss.Color("#FFAA00")).
+		Padding(0, 1)
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("Clipboard unavailable, copy the "+what+" by hand:"),
+		box.Render(value),
+		hintStyle.Render("Select the text with your mouse (hold Shift in most terminals) and copy it with your terminal's copy shortcut."),
+	)
+}
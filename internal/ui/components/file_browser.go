@@ -2,14 +2,20 @@ package components
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/history"
 	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/bxtal-lsn/supper/internal/utils"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -20,27 +26,205 @@ type FileSelectedMsg struct {
 	Info *sops.FileInfo
 }
 
-// DirectoryChangedMsg is sent when the directory changes
+// DirectoryChangedMsg asks the browser to show another directory
 type DirectoryChangedMsg struct {
 	Path string
 }
 
+// DirectoryLoadedMsg carries the entries of a directory read in the
+// background. The browser applies it in Update, so the parent has to pass it
+// on whatever its own state.
+type DirectoryLoadedMsg struct {
+	dir   string
+	focus string
+	items []list.Item
+}
+
 // FileItem represents a file or directory in the file browser
 type FileItem struct {
 	Path     string
 	Name     string
 	IsDir    bool
 	IsSOPS   bool
+	IsAge    bool // Encrypted with age itself, so not by sops
+	ReadOnly bool
 	Size     int64
 	ModTime  string
+	Label    string
+	Selected bool
+	Stale    bool // Plaintext modified since its encrypted copy was written
 	FileInfo *sops.FileInfo
+
+	// ownKeys are our public keys and marker the glyph before the name,
+	// filled in when the item is rendered
+	ownKeys []string
+	marker  string
 }
 
 // FilterValue implements list.Item
 func (i FileItem) FilterValue() string {
+	if i.Label != "" {
+		return i.Name + " " + i.Label
+	}
 	return i.Name
 }
 
+// Title implements list.DefaultItem
+func (i FileItem) Title() string {
+	if i.IsDir {
+		return i.Name + "/"
+	}
+	title := i.marker + i.Name
+	if i.Selected {
+		title = "✓ " + title
+	}
+	if i.ReadOnly {
+		title += " [read-only]"
+	}
+	return title
+}
+
+// Description implements list.DefaultItem
+func (i FileItem) Description() string {
+	if i.IsDir {
+		return "Directory"
+	}
+	desc := fmt.Sprintf("%s, modified %s", utils.FormatSize(i.Size), i.ModTime)
+	if i.IsSOPS {
+		desc += ", " + i.encryptionSummary()
+	}
+	if i.IsAge {
+		desc += ", age (not SOPS)"
+	}
+	if i.Stale {
+		desc += " · ⚠ stale, needs re-encrypt"
+	}
+	if i.Label != "" {
+		desc += " · " + i.Label
+	}
+	return desc
+}
+
+// encryptionSummary describes an encrypted file in a few characters: how many
+// recipients it has and, when our keys are known, whether we can decrypt it
+func (i FileItem) encryptionSummary() string {
+	summary := "SOPS"
+	if i.FileInfo == nil {
+		return summary
+	}
+
+	if i.FileInfo.Health == sops.HealthNoRecipients {
+		return summary + " · ⚠ no recipients"
+	}
+
+	recipients := i.FileInfo.AllRecipients()
+	summary += fmt.Sprintf(" · %d recipient", len(recipients))
+	if len(recipients) != 1 {
+		summary += "s"
+	}
+	if len(age.KeysOfKind(recipients, age.KindAge)) != len(recipients) {
+		summary += " (" + age.SummarizeKinds(recipients) + ")"
+	}
+	if groups := len(i.FileInfo.KeyGroups); groups > 1 {
+		summary += fmt.Sprintf(" in %d groups", groups)
+	}
+
+	if len(i.ownKeys) > 0 {
+		if i.FileInfo.CanDecrypt(i.ownKeys) {
+			summary += " · ✓ yours"
+		} else {
+			summary += " · ✗ not yours"
+		}
+	}
+	return summary
+}
+
+// EncryptedStyle is how the file browser makes encrypted files stand out:
+// one of the config.Marker* glyph styles and a color for their names, empty
+// for the terminal's own
+type EncryptedStyle struct {
+	Marker string
+	Color  string
+}
+
+// markerGlyphs holds, for each marker style, the glyphs put before the names
+// of encrypted and of plaintext files
+var markerGlyphs = map[string][2]string{
+	config.MarkerLock:   {"🔒 ", ""},
+	config.MarkerShapes: {"■ ", "□ "},
+	config.MarkerASCII:  {"[enc] ", ""},
+	config.MarkerNone:   {"", ""},
+}
+
+// fileItemDelegate renders file items, marking encrypted files and
+// highlighting read-only ones
+type fileItemDelegate struct {
+	list.DefaultDelegate
+	readOnly  list.DefaultItemStyles
+	encrypted list.DefaultItemStyles
+	glyphs    [2]string
+	ownKeys   func() []string
+}
+
+// newFileItemDelegate creates the delegate used by the file browser. ownKeys
+// returns our public keys, to show which encrypted files we can decrypt.
+func newFileItemDelegate(ownKeys func() []string, style EncryptedStyle) fileItemDelegate {
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+	d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(lipgloss.Color("#DDDDDD")).Background(lipgloss.Color("#1E88E5"))
+
+	readOnly := d.Styles
+	readOnly.NormalTitle = readOnly.NormalTitle.Foreground(lipgloss.Color("#FFAA00"))
+	readOnly.SelectedTitle = readOnly.SelectedTitle.Foreground(lipgloss.Color("#FFAA00"))
+
+	// The selected row keeps its own colors, so only other rows are tinted
+	encrypted := d.Styles
+	if style.Color != "" {
+		encrypted.NormalTitle = encrypted.NormalTitle.Foreground(lipgloss.Color(style.Color))
+	}
+
+	glyphs, ok := markerGlyphs[style.Marker]
+	if !ok {
+		glyphs = markerGlyphs[config.MarkerLock]
+	}
+
+	return fileItemDelegate{DefaultDelegate: d, readOnly: readOnly, encrypted: encrypted, glyphs: glyphs, ownKeys: ownKeys}
+}
+
+// Render implements list.ItemDelegate
+func (d fileItemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	i, ok := item.(FileItem)
+	if !ok {
+		d.DefaultDelegate.Render(w, m, index, item)
+		return
+	}
+
+	// Our keys can change while the directory is shown, so they are looked
+	// up on every render rather than when the item is loaded
+	if i.IsSOPS {
+		i.ownKeys = d.ownKeys()
+		i.marker = d.glyphs[0]
+	} else if i.IsAge {
+		i.marker = d.glyphs[0]
+	} else if !i.IsDir {
+		i.marker = d.glyphs[1]
+	}
+
+	// A read-only warning matters more than the encrypted color
+	switch {
+	case i.ReadOnly:
+		styled := d.DefaultDelegate
+		styled.Styles = d.readOnly
+		styled.Render(w, m, index, i)
+	case i.IsSOPS || i.IsAge:
+		styled := d.DefaultDelegate
+		styled.Styles = d.encrypted
+		styled.Render(w, m, index, i)
+	default:
+		d.DefaultDelegate.Render(w, m, index, i)
+	}
+}
+
 // fileBrowserKeyMap defines the keybindings for the file browser
 type fileBrowserKeyMap struct {
 	Up       key.Binding
@@ -49,6 +233,12 @@ type fileBrowserKeyMap struct {
 	GoBack   key.Binding
 	GoHome   key.Binding
 	GoParent key.Binding
+	GoTo     key.Binding
+	Complete key.Binding
+	Cancel   key.Binding
+	Select   key.Binding
+	Recent   key.Binding
+	Hidden   key.Binding
 }
 
 // newFileBrowserKeyMap returns the default file browser keybindings
@@ -78,6 +268,30 @@ func newFileBrowserKeyMap() fileBrowserKeyMap {
 			key.WithKeys(".."),
 			key.WithHelp("..", "go to parent"),
 		),
+		GoTo: key.NewBinding(
+			key.WithKeys(":"),
+			key.WithHelp(":", "go to path"),
+		),
+		Complete: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "complete path"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+		Select: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "select file"),
+		),
+		Recent: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "recent dirs"),
+		),
+		Hidden: key.NewBinding(
+			key.WithKeys("."),
+			key.WithHelp(".", "show/hide hidden files"),
+		),
 	}
 }
 
@@ -89,6 +303,19 @@ type FileBrowser struct {
 	history    []string
 	width      int
 	height     int
+	gotoActive bool
+	gotoInput  textinput.Model
+	gotoError  string
+	gotoHint   string
+	selected   map[string]bool
+	ownKeys    []string
+	showHidden bool
+
+	// Recently visited directories, kept across sessions
+	recentLimit  int
+	recentActive bool
+	recentDirs   []string
+	recentCursor int
 }
 
 // NewFileBrowser creates a new file browser
@@ -101,21 +328,28 @@ func NewFileBrowser() *FileBrowser {
 		currentDir = "."
 	}
 
+	fb := &FileBrowser{}
+
 	// Create delegate for custom list item rendering
-	delegate := list.NewDefaultDelegate()
-	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
-	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.Foreground(lipgloss.Color("#DDDDDD")).Background(lipgloss.Color("#1E88E5"))
+	delegate := newFileItemDelegate(fb.currentOwnKeys, EncryptedStyle{Marker: config.MarkerLock})
 
 	// Create list model
 	listModel := list.New([]list.Item{}, delegate, 0, 0)
 	listModel.Title = "File Browser"
 	listModel.Styles.Title = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#333333")).Padding(0, 1)
 
-	fb := &FileBrowser{
+	gotoInput := textinput.New()
+	gotoInput.Placeholder = "/absolute/path or ~/path"
+	gotoInput.Prompt = "Go to: "
+	gotoInput.Width = 60
+
+	*fb = FileBrowser{
 		list:       listModel,
 		keys:       keys,
 		currentDir: currentDir,
 		history:    []string{},
+		gotoInput:  gotoInput,
+		selected:   make(map[string]bool),
 	}
 
 	return fb
@@ -138,8 +372,41 @@ func (f *FileBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		f.list.SetSize(msg.Width, msg.Height-5)
 
 	case tea.KeyMsg:
+		if f.gotoActive {
+			return f, f.updateGoTo(msg)
+		}
+		if f.recentActive {
+			return f, f.updateRecent(msg)
+		}
+
 		// Handle custom key bindings
 		switch {
+		case key.Matches(msg, f.keys.GoTo) && f.list.FilterState() == list.Unfiltered:
+			f.gotoActive = true
+			f.gotoError = ""
+			f.gotoHint = ""
+			f.gotoInput.SetValue("")
+			return f, f.gotoInput.Focus()
+
+		case key.Matches(msg, f.keys.Recent) && f.list.FilterState() == list.Unfiltered:
+			f.openRecent()
+			return f, nil
+
+		case key.Matches(msg, f.keys.Hidden) && f.list.FilterState() != list.Filtering:
+			return f, f.SetShowHidden(!f.showHidden)
+
+		case key.Matches(msg, f.keys.Select) && f.list.FilterState() != list.Filtering:
+			if i, ok := f.list.SelectedItem().(FileItem); ok && !i.IsDir {
+				i.Selected = !i.Selected
+				if i.Selected {
+					f.selected[i.Path] = true
+				} else {
+					delete(f.selected, i.Path)
+				}
+				return f, f.list.SetItem(f.list.Index(), i)
+			}
+			return f, nil
+
 		case key.Matches(msg, f.keys.GoBack) && len(f.history) > 0:
 			// Go back in history
 			prev := f.history[len(f.history)-1]
@@ -148,7 +415,7 @@ func (f *FileBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, f.keys.GoHome):
 			// Go to home directory
-			home, err := os.UserHomeDir()
+			home, err := utils.HomeDir()
 			if err == nil {
 				f.history = append(f.history, f.currentDir)
 				return f, f.loadDirectory(home)
@@ -184,6 +451,9 @@ func (f *FileBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Handle directory changed externally
 		f.history = append(f.history, f.currentDir)
 		return f, f.loadDirectory(msg.Path)
+
+	case DirectoryLoadedMsg:
+		return f, f.showDirectory(msg)
 	}
 
 	// Update list model
@@ -200,15 +470,225 @@ func (f *FileBrowser) View() string {
 		Foreground(lipgloss.Color("#AAAAAA")).
 		Render(fmt.Sprintf(" %s ", f.currentDir))
 
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		breadcrumb,
-		f.list.View(),
-	)
+	if f.recentActive {
+		return lipgloss.JoinVertical(lipgloss.Left, breadcrumb, f.recentView())
+	}
+
+	if !f.gotoActive {
+		return lipgloss.JoinVertical(
+			lipgloss.Left,
+			breadcrumb,
+			f.list.View(),
+		)
+	}
+
+	lines := []string{breadcrumb, f.gotoInput.View()}
+	if f.gotoError != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.gotoError))
+	} else if f.gotoHint != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render(f.gotoHint))
+	}
+	lines = append(lines, f.list.View())
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// updateGoTo handles keys while the go-to-path input is open
+func (f *FileBrowser) updateGoTo(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, f.keys.Cancel):
+		f.gotoActive = false
+		f.gotoInput.Blur()
+		return nil
+
+	case key.Matches(msg, f.keys.Enter):
+		dir := f.resolveGoToPath(f.gotoInput.Value())
+		if !utils.DirExists(dir) {
+			// Keep the input open and the current directory unchanged
+			f.gotoError = fmt.Sprintf("Not an existing directory: %s", dir)
+			return nil
+		}
+		f.gotoActive = false
+		f.gotoInput.Blur()
+		f.history = append(f.history, f.currentDir)
+		return f.loadDirectory(dir)
+
+	case key.Matches(msg, f.keys.Complete):
+		f.completeGoToPath()
+		return nil
+	}
+
+	f.gotoError = ""
+	var cmd tea.Cmd
+	f.gotoInput, cmd = f.gotoInput.Update(msg)
+	return cmd
+}
+
+// resolveGoToPath turns the typed path into a clean absolute path; relative
+// paths are taken from the current directory
+func (f *FileBrowser) resolveGoToPath(input string) string {
+	path := utils.ExpandPath(strings.TrimSpace(input))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.currentDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// completeGoToPath completes the last path segment to the matching
+// directories, listing the candidates when more than one matches
+func (f *FileBrowser) completeGoToPath() {
+	input := f.gotoInput.Value()
+
+	// Split the raw input so the completion keeps the user's spelling (e.g. ~)
+	base := ""
+	prefix := input
+	if i := strings.LastIndex(input, "/"); i >= 0 {
+		base = input[:i+1]
+		prefix = input[i+1:]
+	}
+
+	dir := f.currentDir
+	if base != "" {
+		dir = f.resolveGoToPath(base)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		f.gotoError = fmt.Sprintf("Cannot read %s", dir)
+		return
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		matches = append(matches, name)
+	}
+
+	switch len(matches) {
+	case 0:
+		f.gotoHint = "No matching directories"
+	case 1:
+		f.gotoHint = ""
+		f.gotoInput.SetValue(base + matches[0] + "/")
+	default:
+		f.gotoHint = strings.Join(matches, "  ")
+		f.gotoInput.SetValue(base + commonPrefix(matches))
+	}
+	f.gotoInput.CursorEnd()
+}
+
+// commonPrefix returns the longest prefix shared by all names
+func commonPrefix(names []string) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// openRecent shows the recently visited directories other than the current one
+func (f *FileBrowser) openRecent() {
+	f.recentActive = true
+	f.recentCursor = 0
+	f.recentDirs = nil
+	if f.recentLimit <= 0 {
+		return
+	}
+	for _, dir := range history.RecentDirs(f.recentLimit + 1) {
+		if dir != f.currentDir {
+			f.recentDirs = append(f.recentDirs, dir)
+		}
+	}
+}
+
+// updateRecent handles keys while the recent directories are shown. Enter
+// or the number beside a directory switches to it.
+func (f *FileBrowser) updateRecent(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, f.keys.Cancel), key.Matches(msg, f.keys.Recent):
+		f.recentActive = false
+		return nil
+	case key.Matches(msg, f.keys.Up):
+		f.recentCursor = max(0, f.recentCursor-1)
+		return nil
+	case key.Matches(msg, f.keys.Down):
+		f.recentCursor = max(0, min(len(f.recentDirs)-1, f.recentCursor+1))
+		return nil
+	case key.Matches(msg, f.keys.Enter):
+		return f.switchToRecent(f.recentCursor)
+	}
+	if s := msg.String(); len(s) == 1 && s >= "1" && s <= "9" {
+		return f.switchToRecent(int(s[0] - '1'))
+	}
+	return nil
+}
+
+// switchToRecent browses the recent directory at index i
+func (f *FileBrowser) switchToRecent(i int) tea.Cmd {
+	if i < 0 || i >= len(f.recentDirs) {
+		return nil
+	}
+	dir := f.recentDirs[i]
+	f.recentActive = false
+	if !utils.DirExists(dir) {
+		return nil
+	}
+	f.history = append(f.history, f.currentDir)
+	return f.loadDirectory(dir)
+}
+
+// recentView renders the recent directory switcher
+func (f *FileBrowser) recentView() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Recent directories"), ""}
+
+	switch {
+	case f.recentLimit == 0:
+		lines = append(lines, hintStyle.Render("Not tracked: set Recent Directories in Settings to remember them"))
+	case len(f.recentDirs) == 0:
+		lines = append(lines, hintStyle.Render("No other directories visited yet"))
+	}
+	for i, dir := range f.recentDirs {
+		number := " "
+		if i < 9 {
+			number = fmt.Sprint(i + 1)
+		}
+		line := fmt.Sprintf("  %s  %s", number, dir)
+		if i == f.recentCursor {
+			line = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#1E88E5")).Render("> " + line[2:])
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "", hintStyle.Render("↑/↓: Choose • Enter or 1-9: Go • Esc: Back"))
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// CapturingInput reports whether the go-to-path input, the filter or the
+// recent directory switcher has focus
+func (f *FileBrowser) CapturingInput() bool {
+	return f.gotoActive || f.recentActive || f.list.FilterState() == list.Filtering
 }
 
 // loadDirectory loads the contents of a directory
 func (f *FileBrowser) loadDirectory(dir string) tea.Cmd {
+	return f.loadDirectoryAt(dir, "")
+}
+
+// loadDirectoryAt loads dir with the cursor on the entry at focus, when it
+// is listed
+func (f *FileBrowser) loadDirectoryAt(dir, focus string) tea.Cmd {
+	// The directory is read off the main loop, so it must not touch f
+	showHidden := f.showHidden
+	recentLimit := f.recentLimit
 	return func() tea.Msg {
 		// Read directory contents
 		entries, err := os.ReadDir(dir)
@@ -216,8 +696,8 @@ func (f *FileBrowser) loadDirectory(dir string) tea.Cmd {
 			return nil
 		}
 
-		// Update current directory
-		f.currentDir = dir
+		// Remembering the visit is a convenience, so a write error is ignored
+		_ = history.VisitDir(dir, recentLimit)
 
 		// Convert entries to list items
 		items := make([]list.Item, 0, len(entries))
@@ -232,6 +712,9 @@ func (f *FileBrowser) loadDirectory(dir string) tea.Cmd {
 			})
 		}
 
+		// Labels are optional, so an unreadable sidecar just shows none
+		labels, _ := sops.LoadLabels(dir)
+
 		// Sort directories first, then alphabetically
 		sort.Slice(entries, func(i, j int) bool {
 			if entries[i].IsDir() != entries[j].IsDir() {
@@ -240,10 +723,17 @@ func (f *FileBrowser) loadDirectory(dir string) tea.Cmd {
 			return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
 		})
 
+		// Only names with an encrypted copy beside them can be stale
+		names := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+		template := sops.OutputTemplate()
+
 		// Add each entry
 		for _, entry := range entries {
-			// Skip hidden files
-			if strings.HasPrefix(entry.Name(), ".") && entry.Name() != ".." {
+			// The .. entry above is always there, whatever the setting
+			if !showHidden && strings.HasPrefix(entry.Name(), ".") {
 				continue
 			}
 
@@ -259,22 +749,75 @@ func (f *FileBrowser) loadDirectory(dir string) tea.Cmd {
 				fileInfo, _ = sops.GetFileInfo(path)
 			}
 
+			stale := false
+			if !entry.IsDir() && (fileInfo == nil || !fileInfo.Encrypted && !fileInfo.AgeEncrypted) {
+				if sops.HasSiblingName(names, dir, entry.Name(), template) {
+					stale = sops.IsStale(path)
+				}
+			}
+
 			items = append(items, FileItem{
 				Path:     path,
 				Name:     entry.Name(),
 				IsDir:    entry.IsDir(),
 				IsSOPS:   fileInfo != nil && fileInfo.Encrypted,
+				IsAge:    fileInfo != nil && fileInfo.AgeEncrypted,
+				ReadOnly: !entry.IsDir() && utils.IsReadOnly(path),
 				Size:     info.Size(),
 				ModTime:  info.ModTime().Format("2006-01-02 15:04:05"),
+				Label:    labels[entry.Name()],
+				Stale:    stale,
 				FileInfo: fileInfo,
 			})
 		}
 
-		// Update list with new items
-		f.list.SetItems(items)
+		return DirectoryLoadedMsg{dir: dir, focus: focus, items: items}
+	}
+}
+
+// showDirectory lists a loaded directory, marking the files selected by the
+// time it arrives
+func (f *FileBrowser) showDirectory(msg DirectoryLoadedMsg) tea.Cmd {
+	f.currentDir = msg.dir
+	for idx, item := range msg.items {
+		if i, ok := item.(FileItem); ok && f.selected[i.Path] {
+			i.Selected = true
+			msg.items[idx] = i
+		}
+	}
+
+	cmd := f.list.SetItems(msg.items)
+	for i, item := range msg.items {
+		if item.(FileItem).Path == msg.focus {
+			f.list.Select(i)
+			break
+		}
+	}
+	return cmd
+}
+
+// Selection returns the selected files in sorted order. The selection is
+// kept while browsing other directories.
+func (f *FileBrowser) Selection() []string {
+	paths := make([]string, 0, len(f.selected))
+	for path := range f.selected {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
 
-		return DirectoryChangedMsg{Path: dir}
+// ClearSelection unselects every file
+func (f *FileBrowser) ClearSelection() {
+	f.selected = make(map[string]bool)
+	items := f.list.Items()
+	for idx, item := range items {
+		if i, ok := item.(FileItem); ok && i.Selected {
+			i.Selected = false
+			items[idx] = i
+		}
 	}
+	f.list.SetItems(items)
 }
 
 // SetSize sets the size of the component
@@ -284,11 +827,61 @@ func (f *FileBrowser) SetSize(width, height int) {
 	f.list.SetSize(width, height-5)
 }
 
+// CurrentDir returns the directory being browsed
+func (f *FileBrowser) CurrentDir() string {
+	return f.currentDir
+}
+
+// currentOwnKeys returns our public keys as they are when an item is rendered
+func (f *FileBrowser) currentOwnKeys() []string {
+	return f.ownKeys
+}
+
+// SetEncryptedStyle changes how encrypted files are marked
+func (f *FileBrowser) SetEncryptedStyle(style EncryptedStyle) {
+	f.list.SetDelegate(newFileItemDelegate(f.currentOwnKeys, style))
+}
+
+// SetOwnKeys sets our public keys, which mark the encrypted files we can decrypt
+func (f *FileBrowser) SetOwnKeys(keys []string) {
+	f.ownKeys = keys
+}
+
+// SetRecentLimit sets how many recently visited directories are remembered;
+// 0 stops recording visits
+func (f *FileBrowser) SetRecentLimit(n int) {
+	f.recentLimit = n
+}
+
+// SetShowHidden sets whether dotfiles and dot directories are listed, and
+// reloads the current directory when that changes
+func (f *FileBrowser) SetShowHidden(show bool) tea.Cmd {
+	if f.showHidden == show {
+		return nil
+	}
+	f.showHidden = show
+	f.list.Title = "File Browser"
+	if show {
+		f.list.Title = "File Browser (hidden files shown)"
+	}
+	return f.loadDirectory(f.currentDir)
+}
+
 // SetDirectory changes the current directory
 func (f *FileBrowser) SetDirectory(dir string) tea.Cmd {
 	return f.loadDirectory(dir)
 }
 
+// ShowFile changes to the directory of path with the cursor on it, and
+// selects it as if Enter had been pressed there
+func (f *FileBrowser) ShowFile(path string) tea.Cmd {
+	f.history = append(f.history, f.currentDir)
+	return tea.Sequence(f.loadDirectoryAt(filepath.Dir(path), path), func() tea.Msg {
+		info, _ := sops.GetFileInfo(path)
+		return FileSelectedMsg{Path: path, Info: info}
+	})
+}
+
 // ShortHelp returns keybindings to be shown in the mini help view
 func (f *FileBrowser) ShortHelp() []key.Binding {
 	return []key.Binding{
@@ -297,6 +890,9 @@ func (f *FileBrowser) ShortHelp() []key.Binding {
 		f.keys.Enter,
 		f.keys.GoBack,
 		f.keys.GoHome,
+		f.keys.GoTo,
+		f.keys.Recent,
+		f.keys.Select,
 	}
 }
 
@@ -304,7 +900,7 @@ func (f *FileBrowser) ShortHelp() []key.Binding {
 func (f *FileBrowser) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{f.keys.Up, f.keys.Down},
-		{f.keys.Enter, f.keys.GoBack, f.keys.GoHome, f.keys.GoParent},
+		{f.keys.Enter, f.keys.GoBack, f.keys.GoHome, f.keys.GoParent, f.keys.GoTo, f.keys.Recent, f.keys.Select, f.keys.Hidden},
 	}
 }
 
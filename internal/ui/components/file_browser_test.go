@@ -0,0 +1,68 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TestFileBrowserSelectDuringLoad toggles the selection while a directory is
+// read in the background; run it with -race to catch the loader touching the
+// browser's state
+func TestFileBrowserSelectDuringLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	// No sops on PATH keeps the file info lookups quick and local
+	t.Setenv("PATH", t.TempDir())
+
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("secret-%02d.yaml", i))
+		if err := os.WriteFile(name, []byte("key: value\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := NewFileBrowser()
+	f.SetSize(80, 40)
+	f.Update(f.loadDirectory(dir)())
+	if n := len(f.list.Items()); n < 50 {
+		t.Fatalf("listed %d items, want at least 50", n)
+	}
+
+	loaded := make(chan tea.Msg)
+	go func() { loaded <- f.loadDirectory(dir)() }()
+
+	space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	var msg tea.Msg
+	for toggles := 0; msg == nil; toggles++ {
+		select {
+		case msg = <-loaded:
+		default:
+			f.list.Select(toggles % len(f.list.Items()))
+			f.Update(space)
+		}
+	}
+	// Selecting after the read finished must still show in the listing
+	f.list.Select(len(f.list.Items()) - 1)
+	f.Update(space)
+
+	f.Update(msg)
+	marked := 0
+	for _, item := range f.list.Items() {
+		i := item.(FileItem)
+		if i.Selected != f.selected[i.Path] {
+			t.Errorf("%s: Selected = %v, want %v", i.Name, i.Selected, f.selected[i.Path])
+		}
+		if i.Selected {
+			marked++
+		}
+	}
+	if marked == 0 || marked != len(f.selected) {
+		t.Errorf("%d items marked, want %d", marked, len(f.selected))
+	}
+}
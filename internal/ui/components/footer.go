@@ -0,0 +1,53 @@
+package components
+
+import (
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// Footer renders the help at the bottom of the screen: the keys of what the
+// active view is showing, followed by the keys that work everywhere
+type Footer struct {
+	help help.Model
+}
+
+// NewFooter creates a footer
+func NewFooter() *Footer {
+	return &Footer{help: help.New()}
+}
+
+// SetWidth sets the width the footer is truncated to
+func (f *Footer) SetWidth(width int) {
+	f.help.Width = width
+}
+
+// View renders the keys of local, which may be nil, then those of global: on
+// one line from their ShortHelp, or with full as the groups of their FullHelp
+func (f *Footer) View(local, global help.KeyMap, full bool) string {
+	f.help.ShowAll = full
+	return f.help.View(joinedKeys{local: local, global: global})
+}
+
+// joinedKeys lists the keys of a view before the global ones
+type joinedKeys struct {
+	local  help.KeyMap
+	global help.KeyMap
+}
+
+// ShortHelp implements help.KeyMap
+func (j joinedKeys) ShortHelp() []key.Binding {
+	var kb []key.Binding
+	if j.local != nil {
+		kb = append(kb, j.local.ShortHelp()...)
+	}
+	return append(kb, j.global.ShortHelp()...)
+}
+
+// FullHelp implements help.KeyMap
+func (j joinedKeys) FullHelp() [][]key.Binding {
+	var groups [][]key.Binding
+	if j.local != nil {
+		groups = append(groups, j.local.FullHelp()...)
+	}
+	return append(groups, j.global.FullHelp()...)
+}
@@ -132,6 +132,16 @@ func (p PassphraseInput) View() string {
 	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1).Render(view)
 }
 
+// Retry clears what was typed and shows errMsg, so another passphrase can be
+// entered without leaving the prompt
+func (p *PassphraseInput) Retry(errMsg string) tea.Cmd {
+	p.errMsg = errMsg
+	p.textInput.Reset()
+	p.confirmInput.Reset()
+	p.confirmInput.Blur()
+	return p.textInput.Focus()
+}
+
 // SetWidth sets the width of the input field
 func (p *PassphraseInput) SetWidth(width int) {
 	p.width = width
@@ -0,0 +1,151 @@
+package components
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bxtal-lsn/supper/internal/secure"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// MaxEditorLines is the longest file, in lines, the secret editor opens
+const MaxEditorLines = 10000
+
+// EditorSavedMsg is sent when the edited text is to be encrypted back. The
+// receiver owns Plaintext and must wipe it.
+type EditorSavedMsg struct {
+	Plaintext *secure.Buffer
+}
+
+// EditorClosedMsg is sent when the secret editor is closed without saving
+type EditorClosedMsg struct{}
+
+// SecretEditor edits decrypted content in memory. The original plaintext is
+// wiped when the editor is closed; the edited text leaves it in a buffer of
+// its own, to be encrypted back and wiped.
+//
+// The text area keeps its own copy of the text, as strings the runtime may
+// leave behind, so that copy is only cleared, not zeroed.
+type SecretEditor struct {
+	textarea textarea.Model
+	title    string
+	original *secure.Buffer
+	notice   string
+	width    int
+	height   int
+}
+
+// NewSecretEditor creates an editor for plaintext, taking ownership of it.
+// Content the text area would change on its own, such as tabs, carriage
+// returns or more than MaxEditorLines lines, is refused, since saving it
+// unedited would then still rewrite the file; plaintext is wiped then.
+func NewSecretEditor(title string, plaintext *secure.Buffer) (*SecretEditor, error) {
+	ta := textarea.New()
+	ta.CharLimit = 0
+	ta.MaxHeight = MaxEditorLines
+	ta.MaxWidth = 0
+	ta.ShowLineNumbers = true
+	ta.Prompt = ""
+
+	err := plaintext.Use(func(secret []byte) error {
+		if lines := bytes.Count(secret, []byte("\n")) + 1; lines > MaxEditorLines {
+			return fmt.Errorf("the file has %d lines, more than the %d the built-in editor opens", lines, MaxEditorLines)
+		}
+		ta.SetValue(string(secret))
+		if ta.Value() != string(secret) {
+			return fmt.Errorf("the file contains tabs, carriage returns or other characters the built-in editor cannot keep")
+		}
+		return nil
+	})
+	if err != nil {
+		ta.Reset()
+		plaintext.Wipe()
+		return nil, err
+	}
+
+	ta.Focus()
+	e := &SecretEditor{textarea: ta, title: title, original: plaintext}
+	e.SetSize(80, 24)
+	return e, nil
+}
+
+// Init initializes the component
+func (e *SecretEditor) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+// Update handles events and updates the model
+func (e *SecretEditor) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			e.Close()
+			return e, func() tea.Msg { return EditorClosedMsg{} }
+		case "ctrl+s":
+			return e, e.save()
+		}
+		e.notice = ""
+	}
+
+	var cmd tea.Cmd
+	e.textarea, cmd = e.textarea.Update(msg)
+	return e, cmd
+}
+
+// save hands the edited text on to be encrypted back, unless it is unchanged
+func (e *SecretEditor) save() tea.Cmd {
+	edited := []byte(e.textarea.Value())
+	unchanged := false
+	e.original.Use(func(secret []byte) error {
+		unchanged = bytes.Equal(secret, edited)
+		return nil
+	})
+	if unchanged {
+		utils.WipeBytes(edited)
+		e.notice = "No changes to save"
+		return nil
+	}
+
+	e.Close()
+	plaintext := secure.NewBuffer(edited)
+	return func() tea.Msg { return EditorSavedMsg{Plaintext: plaintext} }
+}
+
+// Close wipes the original plaintext and clears the text area
+func (e *SecretEditor) Close() {
+	e.original.Wipe()
+	e.textarea.Reset()
+	e.textarea.Blur()
+	e.notice = ""
+}
+
+// SetSize sets the size of the editor
+func (e *SecretEditor) SetSize(width, height int) {
+	e.width = width
+	e.height = height
+	e.textarea.SetWidth(max(1, width-4))
+	e.textarea.SetHeight(max(1, height-6))
+}
+
+// View renders the component
+func (e *SecretEditor) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true)
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	lines := []string{
+		titleStyle.Render(e.title + " (in memory, encrypted back on save)"),
+		e.textarea.View(),
+	}
+	if e.notice != "" {
+		lines = append(lines, helpStyle.Render(e.notice))
+	}
+	lines = append(lines, helpStyle.Render("Ctrl+S: Encrypt and save • Esc: Discard and wipe"))
+
+	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(
+		lipgloss.JoinVertical(lipgloss.Left, lines...),
+	)
+}
+
@@ -0,0 +1,275 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+)
+
+// treeNode is an entry of the collapsible tree of a structured file
+type treeNode struct {
+	key      string
+	path     string // Keys from the root, e.g. db.password or hosts[0]
+	value    string
+	children []*treeNode
+	expanded bool
+	depth    int
+	parent   *treeNode
+}
+
+// leaf reports whether the entry holds a value rather than more entries
+func (n *treeNode) leaf() bool {
+	return n.children == nil
+}
+
+// treeValueCopied reports the result of copying a value of the tree
+type treeValueCopied struct {
+	path   string
+	method clipboard.Method
+	err    error
+}
+
+// SecretTree shows decrypted YAML or JSON as a tree: mappings and sequences
+// expand and collapse, values are shown inline and the selected value can be
+// copied to the clipboard. It is fed plaintext from memory and holds no more
+// of it than the values it shows.
+type SecretTree struct {
+	roots  []*treeNode
+	cursor int
+	offset int
+	height int
+	status string
+}
+
+// NewSecretTree parses plaintext in the given sops format into a tree. It
+// returns nil for formats without structure and for content that does not
+// parse, which is then best shown as text.
+func NewSecretTree(data []byte, format string) *SecretTree {
+	if format != "yaml" && format != "json" {
+		return nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	roots := buildTree(root.Content[0], nil, 0)
+	if len(roots) == 0 {
+		return nil
+	}
+	return &SecretTree{roots: roots, height: 20}
+}
+
+// buildTree converts a YAML node into tree entries
+func buildTree(node *yaml.Node, parent *treeNode, depth int) []*treeNode {
+	var nodes []*treeNode
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			nodes = append(nodes, newTreeNode(node.Content[i].Value, node.Content[i+1], parent, depth))
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			nodes = append(nodes, newTreeNode(fmt.Sprintf("[%d]", i), item, parent, depth))
+		}
+	}
+
+	return nodes
+}
+
+// newTreeNode creates the entry for a key and its value
+func newTreeNode(key string, value *yaml.Node, parent *treeNode, depth int) *treeNode {
+	if value.Kind == yaml.AliasNode && value.Alias != nil {
+		value = value.Alias
+	}
+
+	n := &treeNode{key: key, path: key, depth: depth, parent: parent}
+	if parent != nil {
+		n.path = parent.path + "." + key
+		if strings.HasPrefix(key, "[") {
+			n.path = parent.path + key
+		}
+	}
+
+	switch value.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		n.children = buildTree(value, n, depth+1)
+		if n.children == nil {
+			n.children = []*treeNode{}
+		}
+		n.value = fmt.Sprintf("(%d)", len(n.children))
+	default:
+		n.value = value.Value
+	}
+	return n
+}
+
+// visible returns the entries that are not inside a collapsed entry
+func (t *SecretTree) visible() []*treeNode {
+	var visible []*treeNode
+	var walk func(nodes []*treeNode)
+	walk = func(nodes []*treeNode) {
+		for _, n := range nodes {
+			visible = append(visible, n)
+			if n.expanded {
+				walk(n.children)
+			}
+		}
+	}
+	walk(t.roots)
+	return visible
+}
+
+// Selected returns the path of the selected entry
+func (t *SecretTree) Selected() string {
+	visible := t.visible()
+	if len(visible) == 0 {
+		return ""
+	}
+	return visible[t.cursor].path
+}
+
+// Status returns the outcome of the last copy, or "" when there is none
+func (t *SecretTree) Status() string {
+	return t.status
+}
+
+// SetHeight sets how many entries are shown at once
+func (t *SecretTree) SetHeight(height int) {
+	t.height = max(1, height)
+	t.scroll()
+}
+
+// Init initializes the component
+func (t *SecretTree) Init() tea.Cmd {
+	return nil
+}
+
+// Update moves the cursor, expands and collapses entries and copies values
+func (t *SecretTree) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case treeValueCopied:
+		switch {
+		case msg.err != nil:
+			t.status = "Clipboard unavailable; select the value on screen to copy it by hand"
+		case msg.method == clipboard.MethodOSC52:
+			t.status = fmt.Sprintf("Sent %s to the terminal's clipboard", msg.path)
+		default:
+			t.status = fmt.Sprintf("Copied %s to the clipboard", msg.path)
+		}
+		return t, nil
+
+	case tea.KeyMsg:
+		visible := t.visible()
+		if len(visible) == 0 {
+			return t, nil
+		}
+		current := visible[t.cursor]
+		t.status = ""
+
+		switch msg.String() {
+		case "up", "k":
+			t.cursor = max(0, t.cursor-1)
+		case "down", "j":
+			t.cursor = min(len(visible)-1, t.cursor+1)
+		case "pgup":
+			t.cursor = max(0, t.cursor-t.height)
+		case "pgdown":
+			t.cursor = min(len(visible)-1, t.cursor+t.height)
+		case "home", "g":
+			t.cursor = 0
+		case "end", "G":
+			t.cursor = len(visible) - 1
+		case "enter", " ":
+			if !current.leaf() {
+				current.expanded = !current.expanded
+			}
+		case "right", "l":
+			if !current.leaf() {
+				current.expanded = true
+			}
+		case "left", "h":
+			// A collapsed entry or a value moves the cursor to its parent
+			if current.expanded {
+				current.expanded = false
+			} else if current.parent != nil {
+				current.parent.expanded = false
+				t.cursor = indexOf(t.visible(), current.parent)
+			}
+		case "y":
+			if !current.leaf() {
+				t.status = "Select a value to copy; " + current.path + " holds " + current.value + " entries"
+				return t, nil
+			}
+			path, value := current.path, current.value
+			return t, func() tea.Msg {
+				method, err := clipboard.Copy(value)
+				return treeValueCopied{path: path, method: method, err: err}
+			}
+		}
+		t.scroll()
+	}
+	return t, nil
+}
+
+// indexOf returns the position of n among nodes, or 0 when it is missing
+func indexOf(nodes []*treeNode, n *treeNode) int {
+	for i, node := range nodes {
+		if node == n {
+			return i
+		}
+	}
+	return 0
+}
+
+// scroll keeps the cursor among the entries shown
+func (t *SecretTree) scroll() {
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	} else if t.cursor >= t.offset+t.height {
+		t.offset = t.cursor - t.height + 1
+	}
+}
+
+// View renders the entries that fit in the height
+func (t *SecretTree) View() string {
+	visible := t.visible()
+	end := min(len(visible), t.offset+t.height)
+
+	var lines []string
+	for i := t.offset; i < end; i++ {
+		n := visible[i]
+		marker := "  "
+		if !n.leaf() {
+			marker = "▸ "
+			if n.expanded {
+				marker = "▾ "
+			}
+		}
+
+		line := strings.Repeat("  ", n.depth) + marker + viewerKeyStyle.Render(n.key)
+		if n.leaf() {
+			line += ": " + n.value
+		} else {
+			line += " " + viewerCommentStyle.Render(n.value)
+		}
+
+		if i == t.cursor {
+			line = viewerCursorStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Wipe drops the values held by the tree
+func (t *SecretTree) Wipe() {
+	t.roots = nil
+	t.cursor = 0
+	t.offset = 0
+	t.status = ""
+}
@@ -0,0 +1,179 @@
+package components
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ViewerClosedMsg is sent when the secret viewer is closed
+type ViewerClosedMsg struct{}
+
+// SecretViewer shows decrypted content read-only. The plaintext only lives in
+// memory and is wiped when the viewer is closed.
+type SecretViewer struct {
+	viewport viewport.Model
+	title    string
+	data     []byte
+	format   string
+	tree     *SecretTree
+	treeMode bool
+	width    int
+	height   int
+}
+
+var (
+	viewerKeyStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#1E88E5")).Bold(true)
+	viewerCommentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#777777"))
+	viewerCursorStyle  = lipgloss.NewStyle().Background(lipgloss.Color("#333333"))
+
+	// yamlKeyPattern matches "key:" at the start of a YAML line, after any list marker
+	yamlKeyPattern = regexp.MustCompile(`^(\s*(?:-\s+)?)([^\s:#][^:#]*?)(:(?:\s|$).*)$`)
+	// jsonKeyPattern matches a quoted JSON object key
+	jsonKeyPattern = regexp.MustCompile(`^(\s*)("(?:[^"\\]|\\.)*")(\s*:.*)$`)
+	// assignmentPattern matches KEY=value lines of dotenv and INI files
+	assignmentPattern = regexp.MustCompile(`^(\s*)([^=#;\s][^=]*?)(\s*=.*)$`)
+)
+
+// NewSecretViewer creates a viewer for plaintext in the given sops format.
+// The viewer takes ownership of data and wipes it on Close.
+func NewSecretViewer(title string, data []byte, format string) *SecretViewer {
+	v := &SecretViewer{
+		viewport: viewport.New(80, 20),
+		title:    title,
+		data:     data,
+		format:   format,
+	}
+
+	v.tree = NewSecretTree(data, format)
+	v.viewport.SetContent(v.highlighted())
+	return v
+}
+
+// Init initializes the component
+func (v *SecretViewer) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles events and updates the model
+func (v *SecretViewer) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc", "q":
+			v.Close()
+			return v, func() tea.Msg { return ViewerClosedMsg{} }
+		case "t":
+			if v.tree != nil {
+				v.treeMode = !v.treeMode
+			}
+			return v, nil
+		}
+
+		if v.treeMode {
+			return v, v.updateTree(msg)
+		}
+	}
+
+	// Copy results come back to the tree whichever view is shown
+	if _, ok := msg.(treeValueCopied); ok && v.tree != nil {
+		return v, v.updateTree(msg)
+	}
+
+	v.viewport, cmd = v.viewport.Update(msg)
+	return v, cmd
+}
+
+// updateTree passes a message to the tree view
+func (v *SecretViewer) updateTree(msg tea.Msg) tea.Cmd {
+	_, cmd := v.tree.Update(msg)
+	return cmd
+}
+
+// highlighted renders the plaintext with keys and comments styled
+func (v *SecretViewer) highlighted() string {
+	lines := strings.Split(string(v.data), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#") || (v.format == "ini" && strings.HasPrefix(trimmed, ";")):
+			lines[i] = viewerCommentStyle.Render(line)
+		case v.format == "yaml":
+			lines[i] = highlightKey(yamlKeyPattern, line)
+		case v.format == "json":
+			lines[i] = highlightKey(jsonKeyPattern, line)
+		case v.format == "ini" && strings.HasPrefix(trimmed, "["):
+			lines[i] = viewerKeyStyle.Render(line)
+		case v.format == "dotenv" || v.format == "ini":
+			lines[i] = highlightKey(assignmentPattern, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// highlightKey styles the key matched by the pattern's second group
+func highlightKey(pattern *regexp.Regexp, line string) string {
+	m := pattern.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	return m[1] + viewerKeyStyle.Render(m[2]) + m[3]
+}
+
+// Close wipes the plaintext held by the viewer
+func (v *SecretViewer) Close() {
+	utils.WipeBytes(v.data)
+	v.data = nil
+	if v.tree != nil {
+		v.tree.Wipe()
+		v.tree = nil
+	}
+	v.treeMode = false
+	v.viewport.SetContent("")
+}
+
+// SetSize sets the size of the viewer
+func (v *SecretViewer) SetSize(width, height int) {
+	v.width = width
+	v.height = height
+	v.viewport.Width = width - 4
+	v.viewport.Height = max(1, height-6)
+	if v.tree != nil {
+		// One line fewer for the copy status
+		v.tree.SetHeight(v.viewport.Height - 1)
+	}
+}
+
+// View renders the component
+func (v *SecretViewer) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true)
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	help := "↑/↓: Scroll • Esc: Close and wipe"
+	body := v.viewport.View()
+	if v.tree != nil {
+		if v.treeMode {
+			help = "↑/↓: Move • Enter: Expand/collapse • y: Copy value • t: Text view • Esc: Close and wipe"
+			body = v.tree.View()
+			if status := v.tree.Status(); status != "" {
+				body += "\n" + helpStyle.Render(status)
+			}
+		} else {
+			help = "↑/↓: Scroll • t: Tree view • Esc: Close and wipe"
+		}
+	}
+
+	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(
+		lipgloss.JoinVertical(
+			lipgloss.Left,
+			titleStyle.Render(v.title+" (read-only, not saved to disk)"),
+			body,
+			helpStyle.Render(help),
+		),
+	)
+}
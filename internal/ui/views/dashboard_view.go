@@ -1,23 +1,46 @@
 package views
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/audit"
+	"github.com/bxtal-lsn/supper/internal/clipboard"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/doctor"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/bxtal-lsn/supper/internal/ui/components"
+	"github.com/bxtal-lsn/supper/internal/utils"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// recentFilesLimit is how many recent files the dashboard lists
+const recentFilesLimit = 5
+
+// verifyListLimit is how many files of a sweep's failures are listed at once
+const verifyListLimit = 10
+
+// verifyBarWidth is the width of the sweep's progress bar in cells
+const verifyBarWidth = 40
+
 // DashboardView is the main dashboard view
 type DashboardView struct {
 	keys            KeyMap
 	viewport        viewport.Model
 	width           int
 	height          int
+	layout          LayoutMsg
 	hasDecryptedKey bool
 	hasEncryptedKey bool
 	keyPath         string
@@ -25,21 +48,142 @@ type DashboardView struct {
 	keyCreated      time.Time
 	keyExpiry       time.Time
 	publicKey       string
+	autoDelete      time.Duration
+	showDetails     bool
+	copyStatus      string
+	copyFallback    string
+	doctorChecks    []doctor.Check
+	runningDoctor   bool
+	pruneActive     bool
+	prunePurge      bool
+	pruneCandidates []recovery.Backup
+	pruneStatus     string
+	auditActive     bool
+	auditRunning    bool
+	auditDir        string
+	violations      []sops.PolicyViolation
+	auditStatus     string
+	recentFiles     []string
+	checkouts       []history.Checkout
+	cfg             *config.Config
+	verifyActive    bool
+	verifyRoot      string
+	verifyScanning  bool
+	verifyTotal     int
+	verifyDone      int
+	verifyCancel    context.CancelFunc
+	verifyEvents    chan tea.Msg
+	verifyReport    *sops.Report
+	verifyStatus    string
+	verifyCursor    int
+	lastSweep       *history.Sweep
+	verifyStarted   time.Time
+	sweepGen        int                // Counts changes of the background sweep interval
+	sweepCancel     context.CancelFunc // Stops the background sweep; nil when none is running
+	unprotected     bool               // The plaintext key has no encrypted copy
+	unprotectedFor  time.Duration      // How long it has been on disk
+	protectInput    *components.PassphraseInput
+	protectRunning  bool
+	protectStatus   string
+}
+
+// doctorComplete is sent when the environment checks finish
+type doctorComplete struct {
+	checks []doctor.Check
+}
+
+// prunePreviewed is sent when the list of prunable backups is ready
+type prunePreviewed struct {
+	backups []recovery.Backup
+	err     error
+}
+
+// pruneComplete is sent when prunable backups have been removed
+type pruneComplete struct {
+	removed int
+	err     error
+}
+
+// auditComplete is sent when the recipient policy scan finishes
+type auditComplete struct {
+	violations []sops.PolicyViolation
+	err        error
+}
+
+// remediationComplete is sent when missing recipients have been added
+type remediationComplete struct {
+	fixed int
+	err   error
+}
+
+// verifyScanned is sent when the encrypted files under the sweep's root are found
+type verifyScanned struct {
+	paths []string
+	err   error
+}
+
+// verifyProgress carries the result of one file of an integrity sweep
+type verifyProgress struct {
+	result sops.FileResult
+}
+
+// verifyComplete is sent when every file of an integrity sweep is done
+type verifyComplete struct {
+	report *sops.Report
+	err    error
+}
+
+// backgroundSweepDue is sent when the next background sweep is due. gen
+// tells apart the ticks scheduled before the interval last changed.
+type backgroundSweepDue struct {
+	gen int
+}
+
+// backgroundSweepDone is sent when a background sweep has finished
+type backgroundSweepDone struct {
+	gen    int
+	root   string
+	report *sops.Report
+	err    error
+}
+
+// keyProtected is sent when the plaintext key has been encrypted and deleted
+type keyProtected struct {
+	result *utils.WipeResult
+	err    error
+}
+
+// copyResult is sent when a value has been copied to the clipboard
+type copyResult struct {
+	what   string
+	value  string
+	method clipboard.Method
+	err    error
 }
 
 // NewDashboardView creates a new dashboard view
 func NewDashboardView() *DashboardView {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	// A missing or unreadable record just shows no previous sweep
+	lastSweep, _ := history.LastSweep()
+
 	return &DashboardView{
 		keys:          DefaultKeyMap(),
-		keyPath:       age.DefaultKeyPath(),
-		encryptedPath: age.DefaultEncryptedKeyPath(),
-		keyExpiry:     time.Now().Add(12 * time.Hour), // Placeholder
+		keyPath:       cfg.KeyPath,
+		encryptedPath: cfg.EncryptedKeyPath,
+		autoDelete:    cfg.AutoDeleteInterval,
+		cfg:           cfg,
+		lastSweep:     lastSweep,
 	}
 }
 
 // Init initializes the view
 func (d *DashboardView) Init() tea.Cmd {
-	return d.checkKeyStatus()
+	return tea.Batch(d.checkKeyStatus(), d.scheduleSweep())
 }
 
 // Update handles events and updates the model
@@ -54,8 +198,87 @@ func (d *DashboardView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		d.viewport = viewport.New(msg.Width, msg.Height-5)
 		d.viewport.YPosition = 2
 
+	case LayoutMsg:
+		d.layout = msg
+
 	case tea.KeyMsg:
+		if d.protectInput != nil {
+			_, cmd = d.protectInput.Update(msg)
+			return d, cmd
+		}
+
+		if d.verifyActive {
+			switch {
+			case key.Matches(msg, d.keys.Cancel) && d.verifyRunning():
+				if d.verifyCancel != nil {
+					d.verifyCancel()
+					d.verifyCancel = nil
+				}
+			case key.Matches(msg, d.keys.Cancel):
+				d.verifyActive = false
+				d.verifyReport = nil
+				d.verifyStatus = ""
+			case key.Matches(msg, d.keys.Up):
+				d.verifyCursor = max(0, d.verifyCursor-1)
+			case key.Matches(msg, d.keys.Down):
+				d.verifyCursor = max(0, min(len(d.verifyFailures())-1, d.verifyCursor+1))
+			}
+			return d, nil
+		}
+
+		if d.auditActive {
+			switch {
+			case key.Matches(msg, d.keys.Enter) && !d.auditRunning && len(d.violations) > 0:
+				d.auditRunning = true
+				return d, d.addMissingRecipients(d.violations)
+			case key.Matches(msg, d.keys.Cancel):
+				d.auditActive = false
+				d.violations = nil
+				d.auditStatus = ""
+			}
+			return d, nil
+		}
+
+		if d.pruneActive {
+			switch {
+			case key.Matches(msg, d.keys.Enter) && len(d.pruneCandidates) > 0:
+				return d, d.pruneBackups(d.pruneCandidates)
+			case key.Matches(msg, d.keys.Purge):
+				d.prunePurge = !d.prunePurge
+				return d, d.previewPrune()
+			case key.Matches(msg, d.keys.Cancel):
+				d.pruneActive = false
+				d.pruneCandidates = nil
+				d.pruneStatus = ""
+			}
+			return d, nil
+		}
+
 		switch {
+		case key.Matches(msg, d.keys.Enter):
+			d.showDetails = !d.showDetails
+			d.copyStatus = ""
+			d.copyFallback = ""
+			return d, nil
+
+		case key.Matches(msg, d.keys.CopyKey) && d.showDetails && d.publicKey != "":
+			return d, copyToClipboard("public key", d.publicKey)
+
+		case key.Matches(msg, d.keys.CopyPrint) && d.showDetails && d.publicKey != "":
+			return d, copyToClipboard("fingerprint", age.Fingerprint(d.publicKey))
+
+		case key.Matches(msg, d.keys.Audit):
+			return d, d.runAudit()
+
+		case key.Matches(msg, d.keys.Verify):
+			return d, d.startVerify()
+
+		case key.Matches(msg, d.keys.Prune):
+			d.pruneActive = true
+			d.prunePurge = false
+			d.pruneStatus = ""
+			return d, d.previewPrune()
+
 		case key.Matches(msg, d.keys.GenerateKey):
 			return d, func() tea.Msg {
 				return SwitchTabMsg{Tab: ViewKeyManager}
@@ -65,7 +288,178 @@ func (d *DashboardView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return d, func() tea.Msg {
 				return SwitchTabMsg{Tab: ViewKeyManager}
 			}
+
+		case key.Matches(msg, d.keys.Doctor) && !d.runningDoctor:
+			d.runningDoctor = true
+			return d, d.runDoctor()
+
+		case key.Matches(msg, d.keys.ProtectKey) && d.unprotected && !d.protectRunning:
+			d.protectStatus = ""
+			d.protectInput = components.NewPassphraseInput("Passphrase to encrypt "+d.keyPath+" with", true)
+			return d, d.protectInput.Init()
 		}
+
+	case components.PassphraseConfirmedMsg:
+		if d.protectInput != nil {
+			d.protectInput = nil
+			d.protectRunning = true
+			return d, d.protectKey(msg.Passphrase)
+		}
+
+	case components.PassphraseCancelledMsg:
+		d.protectInput = nil
+
+	case keyProtected:
+		d.protectRunning = false
+		if msg.err != nil {
+			d.protectStatus = errors.FormatErrorForDisplay(msg.err)
+		} else {
+			d.protectStatus = fmt.Sprintf("Key encrypted to %s and the plaintext securely deleted (%s)", d.encryptedPath, msg.result)
+		}
+		// Every view shows the key's status
+		return d, func() tea.Msg { return CheckKeyStatusMsg{} }
+
+	case CheckKeyStatusMsg:
+		cmds = append(cmds, d.checkKeyStatus())
+
+	case ConfigSavedMsg:
+		rescheduled := msg.Config.BackgroundSweep != d.cfg.BackgroundSweep
+		d.keyPath = msg.Config.KeyPath
+		d.encryptedPath = msg.Config.EncryptedKeyPath
+		d.autoDelete = msg.Config.AutoDeleteInterval
+		d.cfg = msg.Config
+		cmds = append(cmds, d.checkKeyStatus())
+		if rescheduled {
+			d.sweepGen++
+			d.stopSweep()
+			cmds = append(cmds, d.scheduleSweep())
+		}
+
+	case backgroundSweepDue:
+		if msg.gen != d.sweepGen {
+			return d, nil
+		}
+		// Nothing is read while the user sweeps, or without a key to read with
+		if d.verifyRunning() || d.sweepCancel != nil || !d.hasDecryptedKey {
+			return d, d.scheduleSweep()
+		}
+		return d, d.backgroundSweep()
+
+	case backgroundSweepDone:
+		if msg.gen != d.sweepGen {
+			return d, nil
+		}
+		d.stopSweep()
+		cmds = append(cmds, d.scheduleSweep())
+		if msg.err != nil {
+			return d, tea.Batch(cmds...)
+		}
+
+		d.lastSweep = sweepRecord(msg.root, msg.report)
+		sweep := *d.lastSweep
+		cmds = append(cmds, func() tea.Msg {
+			_ = history.RecordSweep(sweep)
+			return nil
+		})
+		if failed := msg.report.Count(sops.StatusFailed); failed > 0 {
+			// The failures are listed as a sweep started here would list them
+			if !d.verifyActive {
+				d.verifyActive = true
+				d.verifyRoot = msg.root
+				d.verifyReport = msg.report
+				d.verifyStatus = ""
+				d.verifyCursor = 0
+			}
+			message := fmt.Sprintf("Background sweep: %d file(s) under %s failed the integrity check; the Dashboard lists them", failed, msg.root)
+			cmds = append(cmds, func() tea.Msg { return NotifyMsg{Message: message} })
+		}
+		return d, tea.Batch(cmds...)
+
+	// Sweep events return straight away so each file does not start another status tick
+	case verifyScanned:
+		d.verifyScanning = false
+		if msg.err != nil {
+			d.finishVerify()
+			d.verifyStatus = d.verifyError("Scan", msg.err)
+			return d, nil
+		}
+		d.verifyTotal = len(msg.paths)
+		return d, d.waitForVerifyEvent()
+
+	case verifyProgress:
+		d.verifyDone++
+		return d, d.waitForVerifyEvent()
+
+	case verifyComplete:
+		d.finishVerify()
+		d.verifyReport = msg.report
+		elapsed := time.Since(d.verifyStarted)
+		if msg.err != nil {
+			d.verifyStatus = d.verifyError("Sweep", msg.err)
+			if sops.IsCancelled(msg.err) {
+				return d, nil
+			}
+			return d, notifyCompletion(d.cfg, elapsed, d.verifyStatus)
+		}
+		d.lastSweep = sweepRecord(d.verifyRoot, msg.report)
+		sweep := *d.lastSweep
+		return d, tea.Batch(func() tea.Msg {
+			// Failing to record the time only loses it for the next start
+			_ = history.RecordSweep(sweep)
+			return nil
+		}, notifyCompletion(d.cfg, elapsed, fmt.Sprintf("Integrity sweep of %s: %s", d.verifyRoot, msg.report.Summary())))
+
+	case doctorComplete:
+		d.runningDoctor = false
+		d.doctorChecks = msg.checks
+
+	case copyResult:
+		d.copyFallback = ""
+		switch {
+		case msg.err != nil:
+			// Show the value instead so the action still achieves something
+			d.copyStatus = fmt.Sprintf("Could not copy %s: %v", msg.what, msg.err)
+			d.copyFallback = components.CopyFallback(msg.what, msg.value)
+		case msg.method == clipboard.MethodOSC52:
+			d.copyStatus = fmt.Sprintf("Sent %s to the terminal clipboard (OSC 52); if nothing pastes, your terminal may not support it", msg.what)
+		default:
+			d.copyStatus = fmt.Sprintf("Copied %s to clipboard", msg.what)
+		}
+
+	case auditComplete:
+		d.auditRunning = false
+		d.violations = msg.violations
+		if msg.err != nil {
+			d.auditStatus = fmt.Sprintf("Policy check failed: %v", msg.err)
+		}
+
+	case remediationComplete:
+		d.auditRunning = false
+		d.violations = nil
+		if msg.err != nil {
+			d.auditStatus = fmt.Sprintf("Fixed %d file(s), then failed: %v", msg.fixed, msg.err)
+		} else {
+			d.auditStatus = fmt.Sprintf("Added missing recipients to %d file(s)", msg.fixed)
+		}
+
+	case prunePreviewed:
+		d.pruneCandidates = msg.backups
+		if msg.err != nil {
+			d.pruneStatus = fmt.Sprintf("Failed to scan backups: %v", msg.err)
+		}
+
+	case pruneComplete:
+		d.pruneCandidates = nil
+		if msg.err != nil {
+			d.pruneStatus = fmt.Sprintf("Removed %d backup(s), some failed: %v", msg.removed, msg.err)
+		} else {
+			d.pruneStatus = fmt.Sprintf("Removed %d backup(s)", msg.removed)
+		}
+	}
+
+	if d.protectInput != nil {
+		_, cmd = d.protectInput.Update(msg)
+		cmds = append(cmds, cmd)
 	}
 
 	d.viewport, cmd = d.viewport.Update(msg)
@@ -86,12 +480,20 @@ func (d *DashboardView) View() string {
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(lipgloss.Color("#1E88E5")).
 		Padding(1, 2).
-		Width(60)
+		Width(d.layout.boxWidth(60))
+	if d.layout.Compact {
+		boxStyle = boxStyle.Padding(0, 1)
+	}
+	wide := d.layout.boxWidth(122)
 
 	// Key status section
 	keyStatus := "Key Status: "
-	if d.hasDecryptedKey {
+	if d.unprotected {
+		keyStatus += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("Plaintext only (no encrypted copy)")
+	} else if d.hasDecryptedKey {
 		keyStatus += lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render("Decrypted")
+	} else if d.hasEncryptedKey && age.PassphraseCached() {
+		keyStatus += lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render("Unlocked (in memory)")
 	} else if d.hasEncryptedKey {
 		keyStatus += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("Encrypted")
 	} else {
@@ -99,8 +501,9 @@ func (d *DashboardView) View() string {
 	}
 
 	// Calculate time remaining if key is decrypted
+	// A plaintext-only key is never auto-deleted, it is the only copy
 	var timeRemaining string
-	if d.hasDecryptedKey {
+	if d.hasDecryptedKey && !d.unprotected {
 		remaining := d.keyExpiry.Sub(time.Now())
 		if remaining > 0 {
 			timeRemaining = fmt.Sprintf("Auto-delete in: %s", remaining.Round(time.Second))
@@ -121,20 +524,20 @@ func (d *DashboardView) View() string {
 			fmt.Sprintf("Encrypted path: %s", d.encryptedPath),
 			"",
 			d.getKeyActions(),
+			lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render("Press 'enter' for key details"),
 		),
 	)
 
 	// Recent files section
-	recentFilesSection := boxStyle.Render(
-		lipgloss.JoinVertical(
-			lipgloss.Left,
-			lipgloss.NewStyle().Bold(true).Render("Recent Files"),
-			"",
-			"No recent files",
-			"",
-			"Press 'f' to browse files",
-		),
-	)
+	recentLines := []string{lipgloss.NewStyle().Bold(true).Render("Recent Files"), ""}
+	if len(d.recentFiles) == 0 {
+		recentLines = append(recentLines, "No recent files")
+	}
+	for _, path := range d.recentFiles {
+		recentLines = append(recentLines, filepath.Base(path))
+	}
+	recentLines = append(recentLines, "", "Press 'f' to browse files")
+	recentFilesSection := boxStyle.Render(lipgloss.JoinVertical(lipgloss.Left, recentLines...))
 
 	// Quick Actions
 	quickActionsSection := boxStyle.Render(
@@ -147,26 +550,665 @@ func (d *DashboardView) View() string {
 			"e - Encrypt file",
 			"D - Decrypt file",
 			"E - Edit file",
+			"c - Check environment",
+			"b - Prune orphaned backups",
+			"a - Audit required recipients",
+			"V - Verify all encrypted files",
+			"",
+			d.lastSweepLine(),
 		),
 	)
 
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		titleStyle.Render("Dashboard"),
-		lipgloss.JoinHorizontal(
-			lipgloss.Top,
-			lipgloss.JoinVertical(
-				lipgloss.Left,
-				keySection,
-				quickActionsSection,
+	if d.showDetails {
+		keySection = boxStyle.Render(d.renderKeyDetails())
+	}
+
+	sections := []string{titleStyle.Render("Dashboard")}
+	if reminder := d.renderPlaintextReminder(); reminder != "" {
+		sections = append(sections, boxStyle.Width(wide).BorderForeground(lipgloss.Color("#FFAA00")).Render(reminder))
+	}
+	if len(d.checkouts) > 0 {
+		sections = append(sections, boxStyle.Width(wide).BorderForeground(lipgloss.Color("#D32F2F")).Render(d.renderCheckouts()))
+	}
+	if d.layout.Compact {
+		sections = append(sections, keySection, quickActionsSection, recentFilesSection)
+	} else {
+		sections = append(sections,
+			lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				lipgloss.JoinVertical(
+					lipgloss.Left,
+					keySection,
+					quickActionsSection,
+				),
+				recentFilesSection,
 			),
-			recentFilesSection,
-		),
+		)
+	}
+
+	if d.runningDoctor || d.doctorChecks != nil {
+		sections = append(sections, boxStyle.Width(wide).Render(d.renderDoctorChecks()))
+	}
+
+	if d.pruneActive {
+		sections = append(sections, boxStyle.Width(wide).Render(d.renderPrunePreview()))
+	}
+
+	if d.auditActive {
+		sections = append(sections, boxStyle.Width(wide).Render(d.renderAudit()))
+	}
+
+	if d.verifyActive {
+		sections = append(sections, boxStyle.Width(wide).Render(d.renderVerify()))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
+}
+
+// remindPlaintext reports whether the plaintext key has been on disk without
+// an encrypted copy for longer than the configured reminder
+func (d *DashboardView) remindPlaintext() bool {
+	return d.unprotected && d.cfg.PlaintextReminder > 0 && d.unprotectedFor >= d.cfg.PlaintextReminder
+}
+
+// renderPlaintextReminder asks to encrypt a long-lived plaintext key, shows
+// the passphrase prompt for it, or the outcome; "" when there is nothing to say
+func (d *DashboardView) renderPlaintextReminder() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	switch {
+	case d.protectInput != nil:
+		return lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Render("Encrypt Plaintext Key"),
+			"",
+			d.protectInput.View(),
+			"",
+			hintStyle.Render(fmt.Sprintf("The key is saved encrypted to %s, checked to open with this passphrase, and only then removed from %s", d.encryptedPath, d.keyPath)),
+		)
+	case d.protectRunning:
+		return "Encrypting the key, then securely deleting the plaintext..."
+	case d.protectStatus != "":
+		return d.protectStatus
+	case d.remindPlaintext():
+		days := int(d.unprotectedFor.Hours() / 24)
+		since := fmt.Sprintf("%d days", days)
+		if days < 2 {
+			since = d.unprotectedFor.Round(time.Hour).String()
+		}
+		return lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("⚠ Unprotected key"),
+			"",
+			fmt.Sprintf("Your key at %s has been on disk unencrypted for %s and has no encrypted copy.", d.keyPath, since),
+			"Anything that can read your home directory can read it.",
+			"",
+			fmt.Sprintf("Press 'P' to encrypt it with a passphrase to %s and securely delete the plaintext.", d.encryptedPath),
+			hintStyle.Render("The reminder is set by Plaintext Key Reminder (plaintext_key_reminder) in Settings"),
+		)
+	}
+	return ""
+}
+
+// renderCheckouts lists the working copies that are plaintext on disk
+// until they are checked in
+func (d *DashboardView) renderCheckouts() string {
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#D32F2F")).Render(
+			fmt.Sprintf("⚠ %d checked out file(s) in plaintext", len(d.checkouts))),
+		"",
+	}
+	for _, c := range d.checkouts {
+		lines = append(lines, fmt.Sprintf("%s (from %s, %s ago)", c.WorkingCopy, filepath.Base(c.Source),
+			time.Since(c.Time).Round(time.Minute)))
+	}
+	lines = append(lines, "",
+		"Run 'supper checkin <working-copy>' to encrypt the changes back and delete the plaintext",
 	)
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// protectKey encrypts the plaintext key with passphrase, then wipes it
+func (d *DashboardView) protectKey(passphrase string) tea.Cmd {
+	keyPath, encryptedPath := d.keyPath, d.encryptedPath
+	wipe := d.cfg.WipeOptions()
+	return func() tea.Msg {
+		result, err := age.ProtectKey(keyPath, encryptedPath, passphrase, wipe)
+		return keyProtected{result: result, err: err}
+	}
+}
+
+// CapturingInput reports whether the passphrase prompt has focus
+func (d *DashboardView) CapturingInput() bool {
+	return d.protectInput != nil
+}
+
+// ShortHelp returns the keys of what the dashboard is showing for the hint bar
+func (d *DashboardView) ShortHelp() []key.Binding {
+	switch {
+	case d.protectInput != nil:
+		return []key.Binding{relabel(d.keys.Enter, "confirm"), d.keys.Cancel}
+	case d.verifyRunning():
+		return []key.Binding{relabel(d.keys.Cancel, "stop")}
+	}
+	kb := []key.Binding{d.keys.GenerateKey, d.keys.DecryptKey, d.keys.Doctor, d.keys.Verify}
+	if d.unprotected {
+		kb = append(kb, d.keys.ProtectKey)
+	}
+	return kb
+}
+
+// FullHelp returns every dashboard key, grouped by what it acts on
+func (d *DashboardView) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{d.keys.GenerateKey, d.keys.DecryptKey, d.keys.CopyKey, d.keys.CopyPrint, d.keys.ProtectKey},
+		{d.keys.Doctor, d.keys.Verify, d.keys.Audit, d.keys.Prune, d.keys.Purge},
+	}
+}
+
+// renderPrunePreview lists the backups that pruning would delete
+func (d *DashboardView) renderPrunePreview() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Prune Backups"), ""}
+
+	if d.pruneStatus != "" {
+		lines = append(lines, d.pruneStatus, "", hintStyle.Render("Press 'esc' to close"))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+	}
+
+	if len(d.pruneCandidates) == 0 {
+		lines = append(lines, "No orphaned or duplicate backups found")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d backup(s) would be deleted:", len(d.pruneCandidates)))
+		for _, b := range d.pruneCandidates {
+			lines = append(lines, fmt.Sprintf("  %s (%s: %s)", filepath.Base(b.Path), b.Reason, b.Source))
+		}
+	}
+
+	purge := "keeping the latest backup of missing originals"
+	if d.prunePurge {
+		purge = "purging all backups of missing originals"
+	}
+	lines = append(lines, "", hintStyle.Render(fmt.Sprintf("Currently %s. 'p' to toggle, 'enter' to delete, 'esc' to cancel", purge)))
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// renderAudit lists files that lack required recipients
+func (d *DashboardView) renderAudit() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Recipient Policy"), ""}
+
+	switch {
+	case d.auditRunning:
+		lines = append(lines, fmt.Sprintf("Checking files in %s...", d.auditDir))
+	case d.auditStatus != "":
+		lines = append(lines, d.auditStatus, "", hintStyle.Render("Press 'esc' to close"))
+	case len(d.violations) == 0:
+		lines = append(lines, fmt.Sprintf("All encrypted files in %s include the required recipients", d.auditDir),
+			"", hintStyle.Render("Press 'esc' to close"))
+	default:
+		lines = append(lines, fmt.Sprintf("%d file(s) lack required recipients or could not be checked:", len(d.violations)))
+		for _, v := range d.violations {
+			if v.Error != "" {
+				lines = append(lines, fmt.Sprintf("  %s (could not be read: %s)", v.Path, v.Error))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("  %s (missing %d)", v.Path, len(v.Missing)))
+		}
+		lines = append(lines, "", hintStyle.Render("Press 'enter' to add the missing recipients or 'esc' to cancel"))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// runAudit scans the working directory for policy violations
+func (d *DashboardView) runAudit() tea.Cmd {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = "."
+	}
+
+	d.auditActive = true
+	d.auditRunning = true
+	d.auditDir = dir
+	d.auditStatus = ""
+	scope := d.cfg.GitScope
+
+	return func() tea.Msg {
+		required, err := sops.RequiredRecipients()
+		if err == nil && len(required) == 0 {
+			return auditComplete{err: fmt.Errorf("no required recipients are configured")}
+		}
+		violations, err := sops.ScanPolicy(dir, sops.WithGitScope(scope))
+		return auditComplete{violations: violations, err: err}
+	}
+}
+
+// addMissingRecipients remediates every violating file
+func (d *DashboardView) addMissingRecipients(violations []sops.PolicyViolation) tea.Cmd {
+	cfg := d.cfg
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return remediationComplete{err: err}
+		}
+		// sops runs beside the TUI, so it must not stop to ask for anything
+		opts := append(keyOpts, sops.WithNonInteractive(cfg.SOPSTimeout))
+
+		fixed := 0
+		for _, v := range violations {
+			// A file whose recipients could not be read has nothing to add
+			if v.Error != "" {
+				continue
+			}
+			if err := sops.AddMissingRecipients(v.Path, v.Missing, opts...); err != nil {
+				return remediationComplete{fixed: fixed, err: err}
+			}
+			fixed++
+		}
+		return remediationComplete{fixed: fixed}
+	}
+}
+
+// startVerify begins an integrity sweep of the configured root, or of the
+// working directory when none is set. The files are found first, so the
+// progress bar knows how many there are, then checked a few at a time.
+func (d *DashboardView) startVerify() tea.Cmd {
+	root := d.sweepRoot()
+	// The user's sweep covers what the background one would have
+	d.stopSweep()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.verifyActive = true
+	d.verifyRoot = root
+	d.verifyScanning = true
+	d.verifyTotal = 0
+	d.verifyDone = 0
+	d.verifyCancel = cancel
+	d.verifyReport = nil
+	d.verifyStatus = ""
+	d.verifyCursor = 0
+	d.verifyStarted = time.Now()
+
+	events := make(chan tea.Msg, 16)
+	d.verifyEvents = events
+
+	cfg := d.cfg
+	go func() {
+		defer close(events)
+
+		paths, err := sops.FindEncrypted(root, sops.WithContext(ctx), sops.WithGitScope(cfg.GitScope))
+		events <- verifyScanned{paths: paths, err: err}
+		if err != nil {
+			return
+		}
+
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			events <- verifyComplete{err: err}
+			return
+		}
+		opts := append(keyOpts, sops.WithContext(ctx), sops.WithNonInteractive(cfg.SOPSTimeout), sops.WithProgress(func(result sops.FileResult) {
+			events <- verifyProgress{result: result}
+		}))
+		// Without our public key every file is tried and sops reports the failures
+		report, err := sops.VerifyFiles(paths, ownPublicKeys(cfg), sops.DefaultBatchWorkers, opts...)
+		events <- verifyComplete{report: report, err: err}
+	}()
+	return d.waitForVerifyEvent()
+}
+
+// sweepRoot returns the directory sweeps check, the working directory when
+// Verify Root is empty
+func (d *DashboardView) sweepRoot() string {
+	root := utils.ExpandPath(strings.TrimSpace(d.cfg.VerifyRoot))
+	if root == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			dir = "."
+		}
+		root = dir
+	}
+	return root
+}
+
+// scheduleSweep waits for the next background sweep, when they are enabled
+func (d *DashboardView) scheduleSweep() tea.Cmd {
+	interval := d.cfg.BackgroundSweep
+	if interval <= 0 {
+		return nil
+	}
+	gen := d.sweepGen
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		return backgroundSweepDue{gen: gen}
+	})
+}
+
+// backgroundSweep checks the files under the sweep's root while the user
+// works on: one file at a time, skipping those an operation is in progress
+// on. Each sweep is logged to the audit log, with every file that failed.
+func (d *DashboardView) backgroundSweep() tea.Cmd {
+	root := d.sweepRoot()
+	ctx, cancel := context.WithCancel(context.Background())
+	d.sweepCancel = cancel
+	cfg := d.cfg
+	gen := d.sweepGen
+
+	return func() tea.Msg {
+		paths, err := sops.FindEncrypted(root, sops.WithContext(ctx), sops.WithGitScope(cfg.GitScope))
+		var report *sops.Report
+		if err == nil {
+			var keyOpts []sops.Option
+			if keyOpts, err = keyOptions(cfg); err == nil {
+				opts := append(keyOpts, sops.WithContext(ctx), sops.WithNonInteractive(cfg.SOPSTimeout))
+				report, err = sops.VerifyIdleFiles(paths, ownPublicKeys(cfg), opts...)
+			}
+		}
+
+		summary := ""
+		if report != nil {
+			summary = report.Summary()
+			for _, result := range report.Files {
+				if result.Status == sops.StatusFailed {
+					audit.Record("background-sweep", result.Path,
+						errors.New(errors.TypeSecurity, result.Error), "root="+root)
+				}
+			}
+		}
+		audit.Record("background-sweep", root, err, summary)
+		return backgroundSweepDone{gen: gen, root: root, report: report, err: err}
+	}
+}
+
+// stopSweep cancels the background sweep, if one is running
+func (d *DashboardView) stopSweep() {
+	if d.sweepCancel != nil {
+		d.sweepCancel()
+		d.sweepCancel = nil
+	}
+}
+
+// waitForVerifyEvent delivers the next sweep event to the update loop
+func (d *DashboardView) waitForVerifyEvent() tea.Cmd {
+	events := d.verifyEvents
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// verifyRunning reports whether a sweep is scanning or checking files
+func (d *DashboardView) verifyRunning() bool {
+	return d.verifyEvents != nil
+}
+
+// finishVerify releases the sweep's context once it has stopped
+func (d *DashboardView) finishVerify() {
+	if d.verifyCancel != nil {
+		d.verifyCancel()
+		d.verifyCancel = nil
+	}
+	d.verifyEvents = nil
+}
+
+// verifyError describes a scan or sweep that stopped early
+func (d *DashboardView) verifyError(what string, err error) string {
+	if sops.IsCancelled(err) {
+		return what + " cancelled"
+	}
+	return fmt.Sprintf("%s failed: %v", what, err)
+}
+
+// verifyFailures returns the files of the sweep that did not verify
+func (d *DashboardView) verifyFailures() []sops.FileResult {
+	if d.verifyReport == nil {
+		return nil
+	}
+	var failures []sops.FileResult
+	for _, f := range d.verifyReport.Files {
+		if f.Status != sops.StatusOK {
+			failures = append(failures, f)
+		}
+	}
+	return failures
+}
+
+// sweepRecord summarises a finished sweep for the dashboard and its record
+func sweepRecord(root string, report *sops.Report) *history.Sweep {
+	return &history.Sweep{
+		Time:       report.Started,
+		Root:       root,
+		Verified:   report.Count(sops.StatusOK),
+		Failed:     report.Count(sops.StatusFailed),
+		Unreadable: report.Count(sops.StatusNoKey) + report.Count(sops.StatusSkipped),
+	}
+}
+
+// lastSweepLine describes when the files were last verified
+func (d *DashboardView) lastSweepLine() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	schedule := ""
+	if d.cfg.BackgroundSweep > 0 {
+		schedule = fmt.Sprintf(" · in the background every %s", d.cfg.BackgroundSweep)
+	}
+	if d.lastSweep == nil {
+		return hintStyle.Render("Never verified" + schedule)
+	}
+
+	line := fmt.Sprintf("Last verified %s: %d ok", d.lastSweep.Time.Format("2006-01-02 15:04"), d.lastSweep.Verified)
+	if d.lastSweep.Failed > 0 {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(fmt.Sprintf("%s, %d failed%s", line, d.lastSweep.Failed, schedule))
+	}
+	return hintStyle.Render(line + schedule)
+}
+
+// renderVerify shows the sweep's progress, then its summary and failures
+func (d *DashboardView) renderVerify() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Integrity Sweep"), "", "Root: " + d.verifyRoot, ""}
+
+	switch {
+	case d.verifyScanning:
+		lines = append(lines, "Looking for encrypted files...", "", hintStyle.Render("Press 'esc' to cancel"))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+
+	case d.verifyRunning():
+		lines = append(lines,
+			progressBar(d.verifyDone, d.verifyTotal, verifyBarWidth),
+			"",
+			hintStyle.Render("Press 'esc' to stop after the files in progress"),
+		)
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+	}
+
+	if d.verifyStatus != "" {
+		lines = append(lines, d.verifyStatus, "")
+	}
+	if d.verifyReport == nil {
+		lines = append(lines, hintStyle.Render("Press 'esc' to close"))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+	}
+
+	sweep := sweepRecord(d.verifyRoot, d.verifyReport)
+	lines = append(lines, fmt.Sprintf("%d verified, %s, %s in %s",
+		sweep.Verified,
+		failStyle.Render(fmt.Sprintf("%d failed", sweep.Failed)),
+		warnStyle.Render(fmt.Sprintf("%d unreadable", sweep.Unreadable)),
+		d.verifyReport.Duration.Round(time.Millisecond),
+	))
+
+	failures := d.verifyFailures()
+	if len(failures) == 0 {
+		if len(d.verifyReport.Files) == 0 {
+			lines = append(lines, "", "No encrypted files found")
+		}
+		lines = append(lines, "", hintStyle.Render("Press 'esc' to close"))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+	}
+
+	lines = append(lines, "")
+	start := max(0, d.verifyCursor-verifyListLimit+1)
+	end := min(len(failures), start+verifyListLimit)
+	for i := start; i < end; i++ {
+		f := failures[i]
+		style, status := warnStyle, "unreadable"
+		switch f.Status {
+		case sops.StatusFailed:
+			style, status = failStyle, "failed"
+		case sops.StatusSkipped:
+			status = "skipped"
+		}
+		line := fmt.Sprintf("  %-10s  %s", status, f.Path)
+		if i == d.verifyCursor {
+			lines = append(lines, selectedStyle.Render(line))
+		} else {
+			lines = append(lines, style.Render(line))
+		}
+	}
+	if selected := failures[min(d.verifyCursor, len(failures)-1)]; selected.Error != "" {
+		lines = append(lines, "", hintStyle.Render(selected.Error))
+	}
+	lines = append(lines, "", hintStyle.Render("↑/↓ select a file, 'esc' to close"))
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// progressBar renders done out of total as a bar of the given width
+func progressBar(done, total, width int) string {
+	filled := width
+	if total > 0 {
+		filled = min(width, done*width/total)
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+	return fmt.Sprintf("%s %d/%d", bar, done, total)
+}
+
+// previewPrune collects the backups that would be pruned
+func (d *DashboardView) previewPrune() tea.Cmd {
+	purge := d.prunePurge
+	return func() tea.Msg {
+		backups, err := recovery.NewBackupManager("").FindOrphans(nil, purge)
+		return prunePreviewed{backups: backups, err: err}
+	}
+}
+
+// pruneBackups deletes the previewed backups
+func (d *DashboardView) pruneBackups(backups []recovery.Backup) tea.Cmd {
+	return func() tea.Msg {
+		removed, err := recovery.NewBackupManager("").RemoveBackups(backups)
+		return pruneComplete{removed: removed, err: err}
+	}
+}
+
+// renderKeyDetails renders the expanded identity details
+func (d *DashboardView) renderKeyDetails() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	publicKey := d.publicKey
+	fingerprint := ""
+	if publicKey == "" {
+		publicKey = "unknown (decrypt the key to read it)"
+	} else {
+		fingerprint = age.Fingerprint(d.publicKey)
+	}
+
+	created := "unknown"
+	if !d.keyCreated.IsZero() {
+		created = d.keyCreated.Format("2006-01-02 15:04:05")
+	}
+	expiry := "not decrypted"
+	if d.hasDecryptedKey {
+		expiry = d.keyExpiry.Format("2006-01-02 15:04:05")
+	}
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render("Age Key Details"),
+		"",
+		"Public key:",
+		publicKey,
+		"",
+		fmt.Sprintf("Fingerprint: %s", fingerprint),
+		fmt.Sprintf("Key path: %s", d.keyPath),
+		fmt.Sprintf("Encrypted path: %s", d.encryptedPath),
+		fmt.Sprintf("Created: %s", created),
+		fmt.Sprintf("Auto-delete at: %s", expiry),
+		"",
+	}
+	if d.copyStatus != "" {
+		lines = append(lines, d.copyStatus)
+	}
+	if d.copyFallback != "" {
+		lines = append(lines, d.copyFallback, "")
+	}
+	if d.publicKey != "" {
+		lines = append(lines, hintStyle.Render("'y' copy public key, 'Y' copy fingerprint, 'enter' collapse"))
+	} else {
+		lines = append(lines, hintStyle.Render("Press 'enter' to collapse"))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// copyToClipboard copies value in the background
+func copyToClipboard(what, value string) tea.Cmd {
+	return func() tea.Msg {
+		method, err := clipboard.Copy(value)
+		return copyResult{what: what, value: value, method: method, err: err}
+	}
+}
+
+// renderDoctorChecks renders the results of the environment checks
+func (d *DashboardView) renderDoctorChecks() string {
+	if d.runningDoctor {
+		return "Checking environment..."
+	}
+
+	statusStyles := map[doctor.Status]lipgloss.Style{
+		doctor.StatusPass: lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")),
+		doctor.StatusWarn: lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")),
+		doctor.StatusFail: lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")),
+	}
+	fixStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Environment Check"), ""}
+	for _, check := range d.doctorChecks {
+		lines = append(lines, fmt.Sprintf("%s %s: %s",
+			statusStyles[check.Status].Render("["+check.Status.String()+"]"),
+			check.Name,
+			check.Message,
+		))
+		if check.Fix != "" && check.Status != doctor.StatusPass {
+			lines = append(lines, fixStyle.Render("       fix: "+check.Fix))
+		}
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// runDoctor runs the environment checks in the background
+func (d *DashboardView) runDoctor() tea.Cmd {
+	return func() tea.Msg {
+		return doctorComplete{checks: doctor.Run()}
+	}
 }
 
 // getKeyActions returns actions based on key status
 func (d *DashboardView) getKeyActions() string {
+	if d.unprotected {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(
+			"Recommended: press 'P' to encrypt this key with a passphrase")
+	}
 	if d.hasDecryptedKey {
 		return "Press 'x' to securely delete the decrypted key"
 	} else if d.hasEncryptedKey {
@@ -186,13 +1228,26 @@ func (d *DashboardView) checkKeyStatus() tea.Cmd {
 		_, err = os.Stat(d.encryptedPath)
 		d.hasEncryptedKey = err == nil
 
+		d.recentFiles = history.RecentFiles(recentFilesLimit)
+		d.checkouts = history.Outstanding()
+		d.unprotectedFor, d.unprotected = age.UnprotectedKeyAge(d.keyPath, d.encryptedPath)
+
 		// If decrypted key exists, get info about it
 		if d.hasDecryptedKey {
 			fileInfo, err := os.Stat(d.keyPath)
 			if err == nil {
 				d.keyCreated = fileInfo.ModTime()
-				// This is a placeholder - in a real app, you'd parse the key to get more info
-				d.publicKey = "age1..."
+				d.keyExpiry = d.keyCreated.Add(d.autoDelete)
+				if d.publicKey == "" {
+					d.publicKey, _ = age.PublicKeyFromFile(d.keyPath)
+				}
+			}
+		} else if d.hasEncryptedKey {
+			if fileInfo, err := os.Stat(d.encryptedPath); err == nil {
+				d.keyCreated = fileInfo.ModTime()
+			}
+			if d.publicKey == "" {
+				d.publicKey, _ = age.LoadPublicKey(d.encryptedPath)
 			}
 		}
 
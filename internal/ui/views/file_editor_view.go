@@ -1,13 +1,30 @@
 package views
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/audit"
+	"github.com/bxtal-lsn/supper/internal/clipboard"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/filemanager"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/notify"
+	"github.com/bxtal-lsn/supper/internal/recovery"
+	"github.com/bxtal-lsn/supper/internal/secure"
 	"github.com/bxtal-lsn/supper/internal/sops"
 	"github.com/bxtal-lsn/supper/internal/ui/components"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"github.com/bxtal-lsn/supper/internal/watch"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -26,8 +43,224 @@ const (
 	stateConfirmation
 	stateComplete
 	stateError
+	stateSizeWarning
+	stateFetchingRecipients
+	stateRecipientReview
+	stateRekeying
+	stateReportPath
+	stateRuleInput
+	stateViewing
+	stateHistory
+	stateTrustWarning
+	stateLabelInput
+	stateBatchDecrypting
+	stateRecipients
+	stateExtractInput
+	stateCoverage
+	stateIdentitySelect
+	stateMetadata
+	stateRecipientSource
+	stateRaw
+	stateExportInput
+	stateResults
+	stateAccesses
+	stateInlineEdit
+	stateKeySearchInput
+	stateKeySearch
 )
 
+// historyPageSize is the number of past operations listed at once
+const historyPageSize = 12
+
+// Steps of creating a .sops.yaml rule
+const (
+	ruleStepRegex = iota
+	ruleStepGroups
+	ruleStepThreshold
+)
+
+// rulePreviewDelay is how long typing must pause before the regex preview is refreshed
+const rulePreviewDelay = 300 * time.Millisecond
+
+// rulePreviewLimit is the number of matching files listed in the preview
+const rulePreviewLimit = 10
+
+// extractSuggestionLimit is the number of matching paths listed under the
+// path prompt
+const extractSuggestionLimit = 8
+
+// coverageLimit is the number of uncovered files listed in the coverage report
+const coverageLimit = 15
+
+// resultsLimit is the number of operation results kept in the results panel
+const resultsLimit = 50
+
+// recipientsResolved is sent when recipient tokens have been expanded
+type recipientsResolved struct {
+	recipients []age.Recipient
+	err        error
+}
+
+// writableCopyCreated is sent when a writable copy of a read-only file is ready
+type writableCopyCreated struct {
+	path string
+	info *sops.FileInfo
+	err  error
+}
+
+// rekeyComplete is sent when a directory has been re-keyed
+type rekeyComplete struct {
+	report *sops.Report
+	err    error
+}
+
+// watchEventMsg carries an event from the background watcher
+type watchEventMsg struct {
+	event watch.Event
+}
+
+// watchStoppedMsg is sent when the background watcher exits
+type watchStoppedMsg struct {
+	events chan tea.Msg
+	err    error
+}
+
+// historyLoaded is sent when the operation history has been read
+type historyLoaded struct {
+	ops []history.Operation
+	err error
+}
+
+// batchProgressMsg carries the result of one file of a batch decryption
+type batchProgressMsg struct {
+	result sops.FileResult
+}
+
+// batchJobMsg carries a file of a batch decryption being queued or started
+type batchJobMsg struct {
+	job sops.Job
+}
+
+// resealComplete is sent when the stale files of a directory have been
+// re-encrypted
+type resealComplete struct {
+	report *sops.Report
+	err    error
+}
+
+// batchDecryptComplete is sent when every file of a batch decryption is done
+type batchDecryptComplete struct {
+	report *sops.Report
+	err    error
+}
+
+// exportComplete is sent when a file has been exported to its targets
+type exportComplete struct {
+	report *sops.Report
+	err    error
+}
+
+// recipientsTested carries whether each recipient entered could decrypt
+// the selected file
+type recipientsTested struct {
+	results []recipientTest
+}
+
+// recipientTest is the outcome of testing one recipient
+type recipientTest struct {
+	recipient age.Recipient
+	ok        bool  // The metadata lets the key decrypt the file
+	own       bool  // The key is ours, so it was tried end to end
+	verified  bool  // The file was decrypted in memory with our key
+	err       error // Why the test, or the decryption, failed
+}
+
+// resultEntry is the outcome of a finished operation, as kept in the
+// results panel
+type resultEntry struct {
+	time      time.Time
+	operation string
+	failed    bool
+	summary   string
+	files     []sops.FileResult // Each file's result, for batch operations
+}
+
+// labelSaved is sent when a file's label has been written or removed
+type labelSaved struct {
+	path  string
+	label string
+	err   error
+}
+
+// viewerReady is sent when a file, or the value at treePath, has been
+// decrypted into memory for viewing
+type viewerReady struct {
+	data     []byte
+	treePath string
+	copyErr  error // Set when the value was to be copied but could not be
+	err      error
+}
+
+// rawLoaded is sent when the raw content of an encrypted file has been read
+type rawLoaded struct {
+	raw *sops.RawContent
+	err error
+}
+
+// keySearchDone is sent when a search for a key name has finished
+type keySearchDone struct {
+	search *sops.KeySearch
+	err    error
+}
+
+// inlineEditReady is sent when a file has been decrypted for the built-in
+// editor; the receiver owns plaintext
+type inlineEditReady struct {
+	plaintext *secure.Buffer
+}
+
+// accessesLoaded is sent when the decrypt history of a file has been read
+type accessesLoaded struct {
+	path     string
+	accesses []history.Access
+	err      error
+}
+
+// valueCopied is sent when a value extracted from a file is on the clipboard
+type valueCopied struct {
+	treePath string
+	method   clipboard.Method
+}
+
+// coverageReady is sent when the files of a directory have been compared
+// with the creation rules
+type coverageReady struct {
+	root      string
+	covered   []string
+	uncovered []string
+	secrets   []string // The uncovered files that look like secrets
+	err       error
+}
+
+// identitiesMatched lists the loaded identities that are recipients of the
+// file about to be decrypted, so one can be chosen
+type identitiesMatched struct {
+	path     string
+	matching []age.Candidate
+}
+
+// rulePreviewTick fires once typing in the regex input has paused
+type rulePreviewTick struct {
+	seq int
+}
+
+// rulePreviewMsg carries the files matched by a path regex
+type rulePreviewMsg struct {
+	seq   int
+	files []string
+	err   error
+}
+
 // FileEditorView is the view for encrypting, decrypting, and editing files
 type FileEditorView struct {
 	keys            KeyMap
@@ -35,17 +268,96 @@ type FileEditorView struct {
 	spinner         spinner.Model
 	fileBrowser     *components.FileBrowser
 	textInput       textinput.Model
+	pathInput       textinput.Model
 	width           int
 	height          int
+	layout          LayoutMsg
 	state           int
 	selectedFile    string
 	fileInfo        *sops.FileInfo
+	readOnly        bool
 	recipientInput  string
+	recipients      []age.Recipient
+	recipientSource string // The encrypted file the recipient input was copied from
+	sourceInput     string // The input as copied, to tell once it has been edited
 	operation       string
 	operationResult string
+	outputType      string
+	tryIdentities   bool
 	error           error
-	showHelp        bool
 	hasDecryptedKey bool
+	cfg             *config.Config
+	sizeWarning     string
+	cancel          context.CancelFunc
+	cancelling      bool
+	notice          string
+	rekeyDir        string
+	staleSibling    string
+	checkedOutFrom  string
+	protectedKey    bool // The selected file is an age key, see sops.ProtectedPaths
+	archiveDir      string
+	archiveFiles    int
+	archiveBytes    int64
+	lastReport      *sops.Report
+	outputDir       string
+	outputErr       error
+	createOutputDir bool
+	skipBackup      bool
+	watchDir        string
+	watchCancel     context.CancelFunc
+	watchEvents     chan tea.Msg
+	ruleStep        int
+	ruleDir         string
+	ruleRegex       string
+	ruleGroups      []sops.KeyGroup
+	ruleErr         string
+	previewSeq      int
+	previewRegex    string
+	previewFiles    []string
+	previewErr      error
+	coverageRoot    string
+	coverageConfig  string
+	coverage        *coverageReady
+	viewer          *components.SecretViewer
+	editor          *components.SecretEditor
+	skipConfirm     bool
+	pendingOp       *history.Operation
+	historyOps      []history.Operation
+	historyCursor   int
+	identityChoices []age.Candidate
+	identityCursor  int
+	metadata        *sops.Metadata // The sops block shown in the metadata viewer
+	metadataErr     error
+	metadataDrift   *sops.MetadataDrift // Against the file's .sops.yaml rule; nil without one
+	raw             *sops.RawContent    // The ciphertext shown in the raw viewer
+	accesses        []history.Access    // The decrypt history shown, newest first
+	chosenIdentity  *age.Candidate      // The only identity given to sops for the next decrypt
+	untrusted       []age.Recipient
+	trustConfirmed  bool
+	label           string
+	labelInput      textinput.Model
+	labelErr        string
+	treeInput       textinput.Model
+	exportInput     textinput.Model
+	keySearchInput  textinput.Model
+	keySearch       *sops.KeySearch // The finished key search shown; nil while one runs
+	keySearchCursor int
+	exportTargets   []sops.ExportTarget
+	exportOverwrite bool // Replace targets that exist rather than skip them
+	exportErr       string
+	batchFiles      []string
+	batchInPlace    bool
+	encryptInPlace  bool
+	encryptAll      bool // Retrying an encrypt without the rule's encrypted_regex
+	batchDone       int
+	batchEvents     chan tea.Msg
+	batchStates     map[string]string // Queue state, then outcome, of each selected file
+	queue           *sops.Queue       // Runs single-file operations after others on the same file
+	recipientCursor int
+	recipientTests  []string      // The outcome of the last recipient test, a line per key
+	recipientNotes  []string      // The recipients entered that were left out, and why
+	results         []resultEntry // Outcomes of the operations of this session, newest first
+	opStarted       time.Time
 }
 
 // NewFileEditorView creates a new file editor view
@@ -58,15 +370,48 @@ func NewFileEditorView() *FileEditorView {
 	ti.Placeholder = "Enter age recipient public key"
 	ti.Width = 50
 
+	pi := textinput.New()
+	pi.Placeholder = "Path to save the report (.json or .csv)"
+	pi.Width = 70
+
+	li := textinput.New()
+	li.Placeholder = "e.g. Production database credentials, owned by the platform team"
+	li.CharLimit = sops.MaxLabelLength
+	li.Width = 70
+
+	xi := textinput.New()
+	xi.Placeholder = "e.g. db.password or hosts[0].name (Tab completes)"
+	xi.ShowSuggestions = true
+	xi.Width = 70
+
+	ei := textinput.New()
+	ei.Placeholder = "e.g. out.json, prod.env or yaml=out.txt, separated by commas"
+	ei.Width = 70
+
 	fb := components.NewFileBrowser()
 
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	fb.SetEncryptedStyle(encryptedStyle(cfg))
+	fb.SetRecentLimit(cfg.RecentDirs)
+	// Init loads the first directory with the setting applied
+	fb.SetShowHidden(cfg.ShowHiddenFiles)
+
 	return &FileEditorView{
+		cfg:         cfg,
 		keys:        DefaultKeyMap(),
 		spinner:     s,
 		fileBrowser: fb,
 		textInput:   ti,
+		pathInput:   pi,
+		labelInput:  li,
+		treeInput:   xi,
+		exportInput: ei,
 		state:       stateFileSelect,
-		showHelp:    true,
+		skipConfirm: cfg.SkipConfirmations,
+		queue:       sops.NewQueue(sops.DefaultBatchWorkers, nil),
 	}
 }
 
@@ -79,8 +424,19 @@ func (f *FileEditorView) Init() tea.Cmd {
 	)
 }
 
-// Update handles events and updates the model
+// Update handles events and updates the model, keeping the outcome of each
+// operation that finishes for the results panel
 func (f *FileEditorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	before := f.state
+	model, cmd := f.update(msg)
+	if f.state != before && (f.state == stateComplete || f.state == stateError) {
+		f.logResult()
+	}
+	return model, cmd
+}
+
+// update handles events and updates the model
+func (f *FileEditorView) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
 
@@ -91,9 +447,68 @@ func (f *FileEditorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		f.viewport = viewport.New(msg.Width, msg.Height-5)
 		f.viewport.YPosition = 2
 		f.fileBrowser.SetSize(msg.Width, msg.Height-10)
+		if f.state == stateResults {
+			f.showResults()
+		} else if f.state == stateAccesses {
+			f.showAccesses()
+		} else if f.raw != nil {
+			f.showRaw()
+		}
+
+	case LayoutMsg:
+		f.layout = msg
+
+	case CheckKeyStatusMsg:
+		cmds = append(cmds, f.checkKeyStatus())
+
+	case ConfigSavedMsg:
+		// Only a change to the setting overrides the . toggle of this session
+		if msg.Config.ShowHiddenFiles != f.cfg.ShowHiddenFiles {
+			cmds = append(cmds, f.fileBrowser.SetShowHidden(msg.Config.ShowHiddenFiles))
+		}
+		f.cfg = msg.Config
+		f.skipConfirm = msg.Config.SkipConfirmations
+		f.fileBrowser.SetEncryptedStyle(encryptedStyle(msg.Config))
+		f.fileBrowser.SetRecentLimit(msg.Config.RecentDirs)
+		cmds = append(cmds, f.checkKeyStatus())
+
+	case ownKeysLoaded:
+		f.fileBrowser.SetOwnKeys(msg.keys)
 
 	case tea.KeyMsg:
+		// The viewer and the editor handle every key so closing them always
+		// wipes the plaintext
+		if f.state == stateViewing || f.state == stateInlineEdit {
+			break
+		}
+
+		// Keys other than Enter and Esc go straight to a focused text input
+		if f.CapturingInput() && !key.Matches(msg, f.keys.Enter) && !key.Matches(msg, f.keys.Cancel) {
+			break
+		}
+
 		switch {
+		case (key.Matches(msg, f.keys.Cancel) || key.Matches(msg, f.keys.Quit)) && f.inFlight():
+			// Cancel the running operation; the result arrives as an error message
+			if f.cancel != nil && !f.cancelling {
+				f.cancelling = true
+				f.cancel()
+			}
+			return f, nil
+
+		case f.state == stateRecipientSource && f.fileBrowser.CapturingInput():
+			// Esc closes the browser's own input first
+
+		case (key.Matches(msg, f.keys.Cancel) || key.Matches(msg, f.keys.Quit)) && f.state == stateRecipientSource:
+			f.notice = ""
+			f.state = stateRecipientInput
+			return f, f.textInput.Focus()
+
+		case key.Matches(msg, f.keys.Cancel) && f.state != stateFileSelect:
+			f.state = stateFileSelect
+			f.error = nil
+			return f, nil
+
 		case key.Matches(msg, f.keys.Quit):
 			if f.state == stateFileSelect {
 				return f, tea.Quit
@@ -104,51 +519,468 @@ func (f *FileEditorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return f, nil
 			}
 
-		case key.Matches(msg, f.keys.Help):
-			f.showHelp = !f.showHelp
+		case f.state == stateFileSelect && f.protectedKey && f.touchesFile(msg):
+			f.notice = protectedKeyNotice
+			return f, nil
 
 		case key.Matches(msg, f.keys.EncryptFile) && f.state == stateFileSelect:
+			if f.selectedFile != "" && f.ageEncrypted() {
+				f.notice = "Already encrypted with age itself; press D to decrypt it first"
+				return f, nil
+			}
 			if f.selectedFile != "" && (!f.fileInfo.Encrypted) {
 				f.state = stateRecipientInput
 				f.operation = "encrypt"
+				f.encryptInPlace = f.cfg.EncryptInPlace
 				f.textInput.Focus()
 				return f, nil
 			}
 
+		case key.Matches(msg, f.keys.DecryptFile) && f.state == stateFileSelect && len(f.fileBrowser.Selection()) > 0:
+			if !f.hasDecryptedKey {
+				f.notice = "Decrypt your key first"
+				return f, nil
+			}
+			f.operation = "batch-decrypt"
+			f.batchFiles = f.fileBrowser.Selection()
+			f.batchInPlace = false
+			f.outputType = ""
+			f.skipBackup = false
+			f.state = stateConfirmation
+			return f, nil
+
 		case key.Matches(msg, f.keys.DecryptFile) && f.state == stateFileSelect:
+			// age itself decrypts these, with the same key, so there is no
+			// sops metadata to match identities against
+			if f.selectedFile != "" && f.ageEncrypted() {
+				if !f.hasDecryptedKey {
+					f.notice = "Decrypt your key first"
+					return f, nil
+				}
+				f.operation = "decrypt"
+				f.outputType = ""
+				f.tryIdentities = false
+				f.chosenIdentity = nil
+				return f, f.confirmOperation()
+			}
+			// Another loaded identity may still open a file our key cannot
+			if f.fileInfo != nil && f.fileInfo.Encrypted && f.fileInfo.Health == sops.HealthNoKey {
+				f.operation = "decrypt"
+				f.outputType = ""
+				f.tryIdentities = true
+				f.chosenIdentity = nil
+				return f, f.confirmOperation()
+			}
+			if reason := f.unreadable(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			if f.selectedFile != "" && f.fileInfo.Encrypted && f.hasDecryptedKey && sops.IsArchive(f.selectedFile) {
+				f.operation = "unarchive"
+				return f, f.confirmOperation()
+			}
 			if f.selectedFile != "" && f.fileInfo.Encrypted && f.hasDecryptedKey {
-				f.state = stateConfirmation
 				f.operation = "decrypt"
+				f.outputType = ""
+				f.tryIdentities = false
+				f.chosenIdentity = nil
+				if f.cfg.ChooseIdentity {
+					return f, f.matchIdentities(f.selectedFile)
+				}
+				return f, f.confirmOperation()
+			}
+
+		case key.Matches(msg, f.keys.ViewFile) && f.state == stateFileSelect:
+			if reason := f.unreadable(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			if f.selectedFile != "" && (f.fileInfo.Encrypted || f.ageEncrypted()) && f.hasDecryptedKey {
+				f.operation = "view"
+				f.state = stateDecrypting
+				return f, tea.Batch(f.viewFile(f.startOperation()), f.spinner.Tick)
+			}
+
+		case key.Matches(msg, f.keys.Extract) && f.state == stateFileSelect:
+			if reason := f.unreadable(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			if f.selectedFile != "" && f.fileInfo.Encrypted && f.hasDecryptedKey {
+				// Keys are stored in the clear, so suggestions need no decryption
+				paths, err := sops.TreePaths(f.selectedFile)
+				if err != nil {
+					f.notice = "Only YAML and JSON files have single values to view; press v to view the whole file"
+					return f, nil
+				}
+				f.treeInput.SetValue("")
+				f.treeInput.SetSuggestions(paths)
+				f.treeInput.Focus()
+				f.state = stateExtractInput
+				return f, nil
+			}
+
+		case key.Matches(msg, f.keys.Export) && f.state == stateFileSelect:
+			if reason := f.unreadable(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			if f.selectedFile != "" && f.fileInfo.Encrypted && f.hasDecryptedKey {
+				if f.fileFormat() == sops.FormatBinary {
+					f.notice = "Binary files have no structure to convert; press D to decrypt as it is"
+					return f, nil
+				}
+				f.exportErr = ""
+				f.exportInput.SetValue(strings.Join(f.exportDefaults(), ", "))
+				f.exportInput.CursorEnd()
+				f.exportInput.Focus()
+				f.state = stateExportInput
+				return f, nil
+			}
+
+		case key.Matches(msg, f.keys.Rekey) && f.state == stateFileSelect:
+			f.operation = "rekey"
+			f.rekeyDir = f.fileBrowser.CurrentDir()
+			f.textInput.SetValue(f.cfg.DefaultRecipients)
+			f.textInput.Focus()
+			f.state = stateRecipientInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.Reseal) && f.state == stateFileSelect:
+			stale, err := sops.StaleFiles(f.fileBrowser.CurrentDir())
+			if err != nil {
+				f.state = stateError
+				f.error = err
+				return f, nil
+			}
+			if len(stale) == 0 {
+				f.notice = "No plaintext file here is newer than its encrypted copy"
+				return f, nil
+			}
+			f.operation = "reseal"
+			f.batchFiles = stale
+			f.skipBackup = false
+			return f, f.proceed()
+
+		case key.Matches(msg, f.keys.Archive) && f.state == stateFileSelect:
+			f.operation = "archive"
+			f.archiveDir = f.fileBrowser.CurrentDir()
+			f.textInput.SetValue(f.cfg.DefaultRecipients)
+			f.textInput.Focus()
+			f.state = stateRecipientInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.Repair) && f.state == stateFileSelect && f.unreadable() != "":
+			f.operation = "repair"
+			recipients := f.cfg.DefaultRecipients
+			if recipients == "" {
+				recipients = "self"
+			}
+			f.textInput.SetValue(recipients)
+			f.textInput.Focus()
+			f.state = stateRecipientInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.Metadata) && f.state == stateFileSelect && f.selectedFile != "" && f.fileInfo.Encrypted:
+			f.loadMetadata()
+			f.notice = ""
+			f.state = stateMetadata
+			return f, nil
+
+		case key.Matches(msg, f.keys.Accesses) && f.state == stateFileSelect && f.selectedFile != "" && f.fileInfo.Encrypted:
+			f.notice = ""
+			return f, f.loadAccesses(f.selectedFile)
+
+		case key.Matches(msg, f.keys.Raw) && f.state == stateFileSelect && f.selectedFile != "":
+			// Not only encrypted files: the raw view is for the malformed ones too
+			f.notice = ""
+			return f, f.loadRaw(f.selectedFile)
+
+		case key.Matches(msg, f.keys.Repair) && f.state == stateMetadata && f.metadataDrift != nil:
+			f.operation = "repair-metadata"
+			f.setRecipients(nil)
+			return f, f.confirmOperation()
+
+		case key.Matches(msg, f.keys.Recipients) && f.state == stateFileSelect && f.selectedFile != "" && f.fileInfo.Encrypted:
+			f.recipientCursor = 0
+			f.recipientTests = nil
+			f.notice = ""
+			f.state = stateRecipients
+			return f, nil
+
+		case key.Matches(msg, f.keys.Up) && f.state == stateRecipients:
+			f.recipientCursor = max(0, f.recipientCursor-1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Down) && f.state == stateRecipients:
+			if f.recipientCursor < len(f.fileInfo.AllRecipients())-1 {
+				f.recipientCursor++
+			}
+			return f, nil
+
+		case key.Matches(msg, f.keys.Audit) && f.state == stateRecipients:
+			if reason := f.recipientsLocked(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			f.operation = "add-recipients"
+			f.textInput.SetValue("")
+			f.textInput.Focus()
+			f.state = stateRecipientInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.TestKey) && f.state == stateRecipients:
+			// Suggest the selected recipient, or our own key for a check end to end
+			value := "self"
+			if current := f.fileInfo.AllRecipients(); len(current) > 0 {
+				value = current[f.recipientCursor].String()
+			}
+			f.operation = "test-recipient"
+			f.notice = ""
+			f.textInput.SetValue(value)
+			f.textInput.CursorEnd()
+			f.textInput.Focus()
+			f.state = stateRecipientInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.DeleteKey) && f.state == stateRecipients:
+			current := f.fileInfo.AllRecipients()
+			if reason := f.recipientsLocked(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
+			if len(current) < 2 {
+				f.notice = "A file needs at least one recipient; add another before removing this one"
+				return f, nil
+			}
+			f.operation = "remove-recipients"
+			f.setRecipients([]age.Recipient{current[f.recipientCursor]})
+			return f, f.confirmOperation()
+
+		case key.Matches(msg, f.keys.NewRule) && f.state == stateFileSelect:
+			return f, f.startRule(f.fileBrowser.CurrentDir(), `\.(yaml|yml|json|env|ini)$`)
+
+		case key.Matches(msg, f.keys.NewRule) && f.state == stateCoverage && f.coverage != nil && len(f.coverage.secrets) > 0:
+			// The rule goes in the .sops.yaml sops uses, so it is not shadowed
+			dir := f.coverageRoot
+			if f.coverageConfig != "" {
+				dir = filepath.Dir(f.coverageConfig)
+			}
+			paths := make([]string, len(f.coverage.secrets))
+			for i, p := range f.coverage.secrets {
+				paths[i], _ = filepath.Rel(dir, filepath.Join(f.coverageRoot, p))
+			}
+			return f, f.startRule(dir, sops.PathsRegex(paths))
+
+		case key.Matches(msg, f.keys.Coverage) && f.state == stateFileSelect:
+			f.coverageRoot = f.fileBrowser.CurrentDir()
+			f.coverageConfig, _ = sops.FindConfig(f.coverageRoot)
+			f.coverage = nil
+			f.state = stateCoverage
+			return f, tea.Batch(f.checkCoverage(f.coverageRoot), f.spinner.Tick)
+
+		case key.Matches(msg, f.keys.Watch) && f.state == stateFileSelect:
+			if f.watchCancel != nil {
+				f.stopWatch()
+				f.notice = fmt.Sprintf("Stopped watching %s", f.watchDir)
 				return f, nil
 			}
+			return f, f.startWatch(f.fileBrowser.CurrentDir())
+
+		case key.Matches(msg, f.keys.SaveReport) && f.state == stateComplete && f.hasReport():
+			f.pathInput.SetValue(filepath.Join(f.lastReport.Root, fmt.Sprintf("%s-report-%s.json", f.lastReport.Operation, f.lastReport.Started.Format("20060102-150405"))))
+			f.pathInput.Focus()
+			f.outputDir = ""
+			f.checkOutputDir()
+			f.state = stateReportPath
+			return f, nil
+
+		case key.Matches(msg, f.keys.CopyFile) && f.canCopyReadOnly():
+			return f, f.makeWritableCopy()
+
+		case key.Matches(msg, f.keys.EncryptAll) && f.canEncryptAll():
+			f.encryptAll = true
+			f.error = nil
+			return f, f.runOperation()
+
+		case key.Matches(msg, f.keys.InPlace) && f.state == stateConfirmation && f.operation == "batch-decrypt":
+			f.batchInPlace = !f.batchInPlace
+			return f, nil
+
+		case key.Matches(msg, f.keys.InPlace) && f.state == stateConfirmation && f.operation == "encrypt":
+			f.encryptInPlace = !f.encryptInPlace
+			return f, nil
+
+		case key.Matches(msg, f.keys.Overwrite) && f.state == stateConfirmation && f.operation == "export":
+			f.exportOverwrite = !f.exportOverwrite
+			return f, nil
+
+		case key.Matches(msg, f.keys.SkipBackup) && f.state == stateConfirmation && f.backsUp() && f.cfg.EnableBackups:
+			f.skipBackup = !f.skipBackup
+			return f, nil
+
+		case key.Matches(msg, f.keys.Format) && f.state == stateConfirmation && f.operation == "decrypt" && !f.ageEncrypted():
+			f.outputType = nextOutputType(f.fileFormat(), f.outputType)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Identities) && f.state == stateConfirmation && f.operation == "decrypt" && f.chosenIdentity == nil && !f.ageEncrypted():
+			f.tryIdentities = !f.tryIdentities
+			return f, nil
 
 		case key.Matches(msg, f.keys.EditFile) && f.state == stateFileSelect:
+			if reason := f.unreadable(); reason != "" {
+				f.notice = reason
+				return f, nil
+			}
 			if f.selectedFile != "" && f.fileInfo.Encrypted && f.hasDecryptedKey {
-				f.state = stateConfirmation
 				f.operation = "edit"
+				f.skipBackup = false
+				return f, f.proceed()
+			}
+
+		case key.Matches(msg, f.keys.Label) && f.state == stateFileSelect && f.selectedFile != "":
+			f.labelErr = ""
+			f.labelInput.SetValue(f.label)
+			f.labelInput.Focus()
+			f.state = stateLabelInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.History) && f.state == stateFileSelect:
+			return f, f.loadHistory()
+
+		case key.Matches(msg, f.keys.Reveal) && f.state == stateFileSelect:
+			f.notice = f.reveal()
+			return f, nil
+
+		case key.Matches(msg, f.keys.Results) && f.state == stateFileSelect:
+			if len(f.results) == 0 {
+				f.notice = "No operation has finished yet this session"
 				return f, nil
 			}
+			f.notice = ""
+			f.showResults()
+			f.state = stateResults
+			return f, nil
+
+		case key.Matches(msg, f.keys.DeleteKey) && f.state == stateResults:
+			f.results = nil
+			f.notice = "Cleared the operation results"
+			f.state = stateFileSelect
+			return f, nil
+
+		case key.Matches(msg, f.keys.FindKey) && f.state == stateFileSelect:
+			f.keySearchInput = textinput.New()
+			f.keySearchInput.Placeholder = "Key name, e.g. DATABASE_URL, or a path such as db.password"
+			f.keySearchInput.Width = 70
+			f.keySearchInput.Focus()
+			f.state = stateKeySearchInput
+			return f, nil
+
+		case key.Matches(msg, f.keys.Up) && f.state == stateKeySearch:
+			f.keySearchCursor = max(0, f.keySearchCursor-1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Down) && f.state == stateKeySearch && f.keySearch != nil:
+			f.keySearchCursor = max(0, min(len(f.keySearch.Matches)-1, f.keySearchCursor+1))
+			return f, nil
+
+		case key.Matches(msg, f.keys.Extract) && f.state == stateKeySearch && f.keySearch != nil && len(f.keySearch.Matches) > 0:
+			return f, f.extractMatch(f.keySearch.Matches[f.keySearchCursor])
+
+		case key.Matches(msg, f.keys.Up) && f.state == stateHistory:
+			f.historyCursor = max(0, f.historyCursor-1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Down) && f.state == stateHistory:
+			f.historyCursor = min(len(f.historyOps)-1, f.historyCursor+1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Up) && f.state == stateIdentitySelect:
+			f.identityCursor = max(0, f.identityCursor-1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.Down) && f.state == stateIdentitySelect:
+			f.identityCursor = min(len(f.identityChoices)-1, f.identityCursor+1)
+			return f, nil
+
+		case key.Matches(msg, f.keys.SkipConfirm) && f.state == stateFileSelect:
+			f.skipConfirm = !f.skipConfirm
+			if f.skipConfirm {
+				f.notice = "Confirmations skipped for decrypt and edit this session; destructive operations still ask"
+			} else {
+				f.notice = "Confirmations enabled for all operations"
+			}
+			return f, nil
 
 		case key.Matches(msg, f.keys.Enter):
 			switch f.state {
 			case stateRecipientInput:
 				if f.textInput.Value() != "" {
 					f.recipientInput = f.textInput.Value()
-					f.state = stateConfirmation
+					tokens := age.SplitRecipientInput(f.recipientInput)
+					if age.NeedsFetch(tokens) {
+						// Keys have to be fetched, so let the user review them first
+						f.state = stateFetchingRecipients
+						return f, tea.Batch(f.resolveRecipients(tokens), f.spinner.Tick)
+					}
+					recipients, err := age.ResolveRecipients(tokens)
+					if err != nil {
+						f.state = stateError
+						f.error = err
+						return f, nil
+					}
+					f.setRecipients(recipients)
+					return f, f.confirmOperation()
 				}
-			case stateConfirmation:
-				switch f.operation {
-				case "encrypt":
-					f.state = stateEncrypting
-					return f, f.encryptFile()
-				case "decrypt":
-					f.state = stateDecrypting
-					return f, f.decryptFile()
-				case "edit":
-					f.state = stateEditing
-					return f, f.editFile()
+			case stateRecipientReview:
+				return f, f.confirmOperation()
+			case stateSizeWarning:
+				return f, f.proceed()
+			case stateTrustWarning:
+				f.trustConfirmed = true
+				return f, f.confirmOperation()
+			case stateReportPath:
+				if f.pathInput.Value() != "" {
+					// A missing directory is only created once asked for
+					if errors.Code(f.outputErr) == errors.CodeDirNotFound && !f.createOutputDir {
+						f.createOutputDir = true
+						return f, nil
+					}
+					if f.outputErr == nil || f.createOutputDir {
+						return f, f.saveReport(f.pathInput.Value(), f.createOutputDir)
+					}
+				}
+			case stateRuleInput:
+				return f, f.advanceRule()
+			case stateLabelInput:
+				label := strings.TrimSpace(f.labelInput.Value())
+				if err := sops.ValidateLabel(label); err != nil {
+					f.labelErr = err.Error()
+					return f, nil
+				}
+				return f, f.saveLabel(f.selectedFile, label)
+			case stateExtractInput:
+				return f, f.startExtract(false)
+			case stateExportInput:
+				return f, f.startExport()
+			case stateKeySearchInput:
+				return f, f.startKeySearch()
+			case stateKeySearch:
+				if f.keySearch != nil && len(f.keySearch.Matches) > 0 {
+					f.state = stateFileSelect
+					return f, f.fileBrowser.ShowFile(f.keySearch.Matches[f.keySearchCursor].Path)
 				}
-			case stateComplete, stateError:
+			case stateHistory:
+				if len(f.historyOps) > 0 {
+					f.replay(f.historyOps[f.historyCursor])
+				}
+			case stateIdentitySelect:
+				chosen := f.identityChoices[f.identityCursor]
+				f.chosenIdentity = &chosen
+				return f, f.confirmOperation()
+			case stateConfirmation:
+				return f, f.runOperation()
+			case stateComplete, stateError, stateResults:
 				f.state = stateFileSelect
 				f.error = nil
 			}
@@ -159,9 +991,28 @@ func (f *FileEditorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		f.spinner, cmd = f.spinner.Update(msg)
 		cmds = append(cmds, cmd)
 
+	case components.DirectoryLoadedMsg:
+		// The browser takes its listing whatever screen is showing
+		newModel, cmd := f.fileBrowser.Update(msg)
+		if updatedModel, ok := newModel.(*components.FileBrowser); ok {
+			f.fileBrowser = updatedModel
+		}
+		return f, cmd
+
 	case components.FileSelectedMsg:
+		if f.state == stateRecipientSource {
+			cmds = append(cmds, f.useRecipientsFrom(msg.Path, msg.Info))
+			break
+		}
+		f.notice = ""
 		f.selectedFile = msg.Path
 		f.fileInfo = msg.Info
+		f.readOnly = utils.IsReadOnly(msg.Path)
+		f.notice = sops.SymlinkWarning(msg.Path)
+		f.label = sops.Label(msg.Path)
+		f.staleSibling = staleSibling(msg.Path)
+		f.checkedOutFrom = checkedOutFrom(msg.Path)
+		f.protectedKey = sops.IsProtected(msg.Path)
 		if f.fileInfo == nil {
 			// If no file info (shouldn't happen), create a default one
 			f.fileInfo = &sops.FileInfo{
@@ -170,226 +1021,3355 @@ func (f *FileEditorView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-	case OperationCompleteMsg:
-		f.state = stateComplete
-		f.operationResult = msg.Message
-
-	case OperationErrorMsg:
-		f.state = stateError
-		f.error = msg.Error
-	}
-
-	// Update sub-components based on state
-	switch f.state {
-	case stateFileSelect:
-		newModel, cmd := f.fileBrowser.Update(msg)
-		if updatedModel, ok := newModel.(*components.FileBrowser); ok {
-			f.fileBrowser = updatedModel
+	case writableCopyCreated:
+		if msg.err != nil {
+			f.state = stateError
+			f.error = msg.err
+			break
 		}
-		cmds = append(cmds, cmd)
+		f.state = stateFileSelect
+		f.error = nil
+		f.selectedFile = msg.path
+		f.fileInfo = msg.info
+		f.readOnly = false
+		f.notice = fmt.Sprintf("Created writable copy %s", filepath.Base(msg.path))
+		cmds = append(cmds, f.fileBrowser.SetDirectory(filepath.Dir(msg.path)))
 
-	case stateRecipientInput:
-		f.textInput, cmd = f.textInput.Update(msg)
-		cmds = append(cmds, cmd)
-	}
+	case recipientsResolved:
+		if msg.err != nil {
+			f.state = stateError
+			f.error = msg.err
+		} else {
+			f.setRecipients(msg.recipients)
+			f.state = stateRecipientReview
+		}
 
-	return f, tea.Batch(cmds...)
-}
+	case watchEventMsg:
+		if msg.event.Err != nil {
+			f.notice = fmt.Sprintf("Watch: %v", msg.event.Err)
+		} else {
+			f.notice = fmt.Sprintf("Watch: encrypted %s at %s", filepath.Base(msg.event.Path), msg.event.Time.Format("15:04:05"))
+		}
+		cmds = append(cmds, f.waitForWatchEvent())
 
-// View renders the view
-func (f *FileEditorView) View() string {
-	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5")).Padding(0, 1)
+	case watchStoppedMsg:
+		// Ignore a previous watcher finishing after a new one was started
+		if msg.events != f.watchEvents {
+			break
+		}
+		f.watchCancel = nil
+		f.watchEvents = nil
+		if msg.err != nil {
+			f.notice = fmt.Sprintf("Watch stopped: %v", msg.err)
+		}
 
-	var content string
-	switch f.state {
-	case stateFileSelect:
-		content = f.fileBrowser.View()
+	case batchProgressMsg:
+		f.batchDone++
+		f.batchStates[msg.result.Path] = msg.result.Status
+		cmds = append(cmds, f.waitForBatchEvent())
 
-		// Show file info if a file is selected
-		if f.selectedFile != "" {
-			infoStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1)
+	case batchJobMsg:
+		// Outcomes come with the file's result instead
+		if msg.job.State == sops.JobQueued || msg.job.State == sops.JobRunning {
+			f.batchStates[msg.job.Path] = msg.job.State
+		}
+		cmds = append(cmds, f.waitForBatchEvent())
 
-			fileInfo := fmt.Sprintf("Selected: %s\n", f.selectedFile)
-			fileInfo += fmt.Sprintf("Status: %s\n", getEncryptionStatusText(f.fileInfo))
+	case batchDecryptComplete:
+		elapsed := f.finishOperation()
+		f.batchEvents = nil
+		f.lastReport = msg.report
+		f.fileBrowser.ClearSelection()
+		cmds = append(cmds, f.fileBrowser.SetDirectory(f.fileBrowser.CurrentDir()))
+		if msg.err != nil && !sops.IsCancelled(msg.err) {
+			f.state = stateError
+			f.error = msg.err
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, "Batch decryption failed"))
+			break
+		}
+		f.state = stateComplete
+		f.operationResult = f.batchSummary("Decrypted selected files", msg.report, sops.StatusNoKey, sops.StatusFailed)
+		cmds = append(cmds, notifyCompletion(f.cfg, elapsed, "Decrypted "+msg.report.Summary()))
+		if msg.err != nil {
+			f.operationResult += "\nCancelled before all files were processed"
+		}
 
-			// Show available actions based on file state
-			fileInfo += "\nAvailable Actions:\n"
-			if !f.fileInfo.Encrypted {
-				fileInfo += "  e - Encrypt file\n"
-			}
-			if f.fileInfo.Encrypted && f.hasDecryptedKey {
-				fileInfo += "  d - Decrypt file\n"
-				fileInfo += "  E - Edit file\n"
+	case exportComplete:
+		elapsed := f.finishOperation()
+		f.lastReport = msg.report
+		cmds = append(cmds, f.fileBrowser.SetDirectory(f.fileBrowser.CurrentDir()))
+		if msg.err != nil {
+			if sops.IsCancelled(msg.err) {
+				f.state = stateFileSelect
+				break
 			}
+			f.state = stateError
+			f.error = msg.err
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("Failed to export %s", filepath.Base(f.selectedFile))))
+			break
+		}
+		f.state = stateComplete
+		f.operationResult = exportSummary(filepath.Base(f.selectedFile), msg.report)
+		cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("Exported %s: %s", filepath.Base(f.selectedFile), msg.report.Summary())))
 
-			content = lipgloss.JoinVertical(
-				lipgloss.Left,
-				content,
-				infoStyle.Render(fileInfo),
-			)
+	case recipientsTested:
+		if f.state == stateDecrypting {
+			f.finishOperation()
 		}
+		f.recipientTests = recipientTestLines(msg.results, len(f.fileInfo.KeyGroups) > 1)
+		f.state = stateRecipients
 
-	case stateRecipientInput:
-		content = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1).Render(
-			lipgloss.JoinVertical(
-				lipgloss.Left,
-				"Enter the age public key of the recipient:",
-				f.textInput.View(),
-				"",
-				"Press Enter to confirm or Esc to cancel",
-			),
-		)
+	case labelSaved:
+		if msg.err != nil {
+			f.labelErr = msg.err.Error()
+			break
+		}
+		f.state = stateFileSelect
+		if msg.path == f.selectedFile {
+			f.label = msg.label
+		}
+		if msg.label == "" {
+			f.notice = fmt.Sprintf("Removed the label of %s", filepath.Base(msg.path))
+		} else {
+			f.notice = fmt.Sprintf("Labelled %s", filepath.Base(msg.path))
+		}
+		cmds = append(cmds, f.fileBrowser.SetDirectory(f.fileBrowser.CurrentDir()))
 
-	case stateConfirmation:
-		confirmStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1)
+	case historyLoaded:
+		if msg.err != nil {
+			f.notice = fmt.Sprintf("Failed to read history: %v", msg.err)
+			break
+		}
+		if len(msg.ops) == 0 {
+			f.notice = "No operations recorded yet"
+			break
+		}
+		// Newest first
+		f.historyOps = make([]history.Operation, len(msg.ops))
+		for i, op := range msg.ops {
+			f.historyOps[len(msg.ops)-1-i] = op
+		}
+		f.historyCursor = 0
+		f.state = stateHistory
+
+	case viewerReady:
+		elapsed := f.finishOperation()
+		if msg.err != nil {
+			if sops.IsCancelled(msg.err) {
+				f.state = stateFileSelect
+				break
+			}
+			f.state = stateError
+			f.error = msg.err
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("Failed to open %s", filepath.Base(f.selectedFile))))
+			break
+		}
+		cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("%s is ready to view", filepath.Base(f.selectedFile))))
+		title := filepath.Base(f.selectedFile)
+		if msg.treePath != "" {
+			title += " → " + msg.treePath
+		}
+		if msg.copyErr != nil {
+			f.notice = fmt.Sprintf("Could not copy %s (%v), so it was shown instead", msg.treePath, msg.copyErr)
+		}
+		f.viewer = components.NewSecretViewer(title, msg.data, f.fileFormat())
+		f.viewer.SetSize(f.width, f.height-4)
+		f.state = stateViewing
+
+	case valueCopied:
+		f.finishOperation()
+		f.state = stateFileSelect
+		if msg.method == clipboard.MethodOSC52 {
+			f.notice = fmt.Sprintf("Sent %s to the terminal clipboard (OSC 52); if nothing pastes, your terminal may not support it", msg.treePath)
+		} else {
+			f.notice = fmt.Sprintf("Copied %s to clipboard", msg.treePath)
+		}
+
+	case keySearchDone:
+		f.finishOperation()
+		if f.state != stateKeySearch {
+			break
+		}
+		if msg.err != nil {
+			f.state = stateFileSelect
+			f.notice = fmt.Sprintf("Key search failed: %v", msg.err)
+			if sops.IsCancelled(msg.err) {
+				f.notice = "Key search cancelled"
+			}
+			break
+		}
+		f.keySearch = msg.search
+		f.keySearchCursor = 0
+
+	case components.ViewerClosedMsg:
+		f.viewer = nil
+		f.state = stateFileSelect
+
+	case inlineEditReady:
+		f.finishOperation()
+		editor, err := components.NewSecretEditor(filepath.Base(f.selectedFile), msg.plaintext)
+		if err != nil {
+			err = errors.Wrap(err, errors.TypeFileOperation, "The file cannot be edited in the built-in editor; use an external editor").
+				WithCode(errors.CodeFormatUnsupported).WithData("path", f.selectedFile)
+			cmds = append(cmds, f.recordHistory(err))
+			f.state = stateError
+			f.error = err
+			break
+		}
+		f.editor = editor
+		f.editor.SetSize(f.width, f.height-4)
+		f.state = stateInlineEdit
+		cmds = append(cmds, f.editor.Init())
+
+	case components.EditorSavedMsg:
+		f.editor = nil
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		cmds = append(cmds, f.queued(ctx, f.saveInlineEdit(ctx, msg.Plaintext)))
+
+	case components.EditorClosedMsg:
+		f.editor = nil
+		f.pendingOp = nil
+		f.state = stateFileSelect
+		f.notice = fmt.Sprintf("Discarded the changes to %s", filepath.Base(f.selectedFile))
+
+	case accessesLoaded:
+		if f.state != stateFileSelect {
+			break
+		}
+		if msg.err != nil {
+			f.notice = fmt.Sprintf("Failed to read the decrypt history: %v", msg.err)
+			break
+		}
+		if len(msg.accesses) == 0 {
+			f.notice = fmt.Sprintf("No decryption of %s recorded yet", filepath.Base(msg.path))
+			break
+		}
+		f.accesses = msg.accesses
+		f.showAccesses()
+		f.state = stateAccesses
+
+	case rawLoaded:
+		if f.state != stateFileSelect {
+			break
+		}
+		if msg.err != nil {
+			f.notice = fmt.Sprintf("Cannot show %s raw: %v", filepath.Base(f.selectedFile), msg.err)
+			break
+		}
+		f.raw = msg.raw
+		f.showRaw()
+		f.state = stateRaw
+
+	case rulePreviewTick:
+		if msg.seq == f.previewSeq {
+			cmds = append(cmds, f.previewRule(msg.seq))
+		}
+
+	case identitiesMatched:
+		// The selection may have moved on while the identities were read
+		if msg.path != f.selectedFile || f.operation != "decrypt" || f.state != stateFileSelect {
+			break
+		}
+		if len(msg.matching) < 2 {
+			return f, f.confirmOperation()
+		}
+		f.identityChoices = msg.matching
+		f.identityCursor = 0
+		f.state = stateIdentitySelect
+		return f, nil
+
+	case coverageReady:
+		// Drop the result of a scan of a directory since left
+		if msg.root == f.coverageRoot {
+			f.coverage = &msg
+		}
+
+	case rulePreviewMsg:
+		// Drop results for a regex that has since been edited
+		if msg.seq == f.previewSeq {
+			f.previewFiles = msg.files
+			f.previewErr = msg.err
+		}
+
+	case resealComplete:
+		elapsed := f.finishOperation()
+		f.lastReport = msg.report
+		f.staleSibling = staleSibling(f.selectedFile)
+		cmds = append(cmds, f.fileBrowser.SetDirectory(f.fileBrowser.CurrentDir()))
+		if msg.err != nil && !sops.IsCancelled(msg.err) {
+			f.state = stateError
+			f.error = msg.err
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, "Re-encrypting stale files failed"))
+			break
+		}
+		f.state = stateComplete
+		f.operationResult = f.batchSummary("Re-encrypted stale files in "+f.fileBrowser.CurrentDir(), msg.report, sops.StatusFailed, sops.StatusSkipped)
+		cmds = append(cmds, notifyCompletion(f.cfg, elapsed, "Re-encrypted stale files: "+msg.report.Summary()))
+		if msg.err != nil {
+			f.operationResult += "\nCancelled before all files were processed"
+		}
+
+	case rekeyComplete:
+		elapsed := f.finishOperation()
+		cmds = append(cmds, f.recordHistory(msg.err))
+		f.lastReport = msg.report
+		if msg.err != nil && !sops.IsCancelled(msg.err) {
+			f.state = stateError
+			f.error = msg.err
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("Re-keying %s failed", f.rekeyDir)))
+			break
+		}
+		f.state = stateComplete
+		f.operationResult = fmt.Sprintf("Re-keyed %s\n%s", f.rekeyDir, msg.report.Summary())
+		cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("Re-keyed %s: %s", f.rekeyDir, msg.report.Summary())))
+		if msg.err != nil {
+			f.operationResult += "\nCancelled before all files were processed"
+		}
+
+	case OperationCompleteMsg:
+		cmds = append(cmds, notifyCompletion(f.cfg, f.finishOperation(), msg.Message))
+		cmds = append(cmds, f.recordHistory(nil))
+		if f.operation == "repair" || f.operation == "repair-metadata" || f.changesRecipients() {
+			if info, err := sops.GetFileInfo(f.selectedFile); err == nil {
+				f.fileInfo = info
+			}
+		}
+		// Writing the encrypted copy brings it up to date
+		f.staleSibling = staleSibling(f.selectedFile)
+		// Show files the operation created, such as a separate encrypted copy
+		cmds = append(cmds, f.fileBrowser.SetDirectory(f.fileBrowser.CurrentDir()))
+		f.state = stateComplete
+		f.operationResult = msg.Message
+		// Repeat what was left out, in case the confirmation was skipped
+		if f.operation == "encrypt" || f.operation == "rekey" || f.operation == "repair" || f.operation == "archive" || f.changesRecipients() {
+			for _, note := range f.recipientNotes {
+				f.operationResult += "\n" + note
+			}
+		}
+
+	case OperationErrorMsg:
+		elapsed := f.finishOperation()
+		cmds = append(cmds, f.recordHistory(msg.Error))
+		if sops.IsCancelled(msg.Error) {
+			f.state = stateFileSelect
+			f.notice = fmt.Sprintf("Cancelled %s of %s, original restored", f.operation, filepath.Base(f.selectedFile))
+			if f.operation == "decrypt" {
+				f.notice = fmt.Sprintf("Cancelled decrypt of %s, original left unchanged", filepath.Base(f.selectedFile))
+			}
+			if (f.skipBackup || !f.cfg.EnableBackups) && f.backsUp() {
+				f.notice = fmt.Sprintf("Cancelled %s of %s, no backup was taken", f.operation, filepath.Base(f.selectedFile))
+			}
+			if f.operation == "archive" {
+				f.notice = fmt.Sprintf("Cancelled sealing %s, no archive was written", f.archiveDir)
+			}
+			if f.operation == "unarchive" {
+				f.notice = fmt.Sprintf("Cancelled restoring %s, nothing was extracted", filepath.Base(f.selectedFile))
+			}
+		} else {
+			f.state = stateError
+			f.error = msg.Error
+			cmds = append(cmds, notifyCompletion(f.cfg, elapsed, fmt.Sprintf("%s of %s failed", f.operation, filepath.Base(f.selectedFile))))
+		}
+	}
+
+	// Update sub-components based on state
+	switch f.state {
+	case stateFileSelect, stateRecipientSource:
+		newModel, cmd := f.fileBrowser.Update(msg)
+		if updatedModel, ok := newModel.(*components.FileBrowser); ok {
+			f.fileBrowser = updatedModel
+		}
+		cmds = append(cmds, cmd)
+
+	case stateRecipientInput:
+		if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, f.keys.CopyFrom) {
+			f.textInput.Blur()
+			f.notice = ""
+			f.state = stateRecipientSource
+			return f, nil
+		}
+		f.textInput, cmd = f.textInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateRaw, stateResults, stateAccesses:
+		f.viewport, cmd = f.viewport.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateViewing:
+		if f.viewer != nil {
+			if sizeMsg, ok := msg.(tea.WindowSizeMsg); ok {
+				f.viewer.SetSize(sizeMsg.Width, sizeMsg.Height-4)
+			}
+			_, cmd = f.viewer.Update(msg)
+			cmds = append(cmds, cmd)
+		}
+
+	case stateInlineEdit:
+		if f.editor != nil {
+			if sizeMsg, ok := msg.(tea.WindowSizeMsg); ok {
+				f.editor.SetSize(sizeMsg.Width, sizeMsg.Height-4)
+			}
+			_, cmd = f.editor.Update(msg)
+			cmds = append(cmds, cmd)
+		}
+
+	case stateLabelInput:
+		f.labelInput, cmd = f.labelInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateExtractInput:
+		if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, f.keys.CopyValue) {
+			return f, f.startExtract(true)
+		}
+		f.treeInput, cmd = f.treeInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateKeySearchInput:
+		f.keySearchInput, cmd = f.keySearchInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateExportInput:
+		f.exportInput, cmd = f.exportInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case stateReportPath, stateRuleInput:
+		f.pathInput, cmd = f.pathInput.Update(msg)
+		cmds = append(cmds, cmd)
+
+		if f.state == stateReportPath {
+			f.checkOutputDir()
+		}
+
+		// Refresh the preview once the regex has changed
+		if f.state == stateRuleInput && f.ruleStep == ruleStepRegex && f.pathInput.Value() != f.previewRegex {
+			cmds = append(cmds, f.scheduleRulePreview())
+		}
+	}
+
+	return f, tea.Batch(cmds...)
+}
+
+// View renders the view
+func (f *FileEditorView) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5")).Padding(0, 1)
+
+	var content string
+	switch f.state {
+	case stateFileSelect:
+		content = f.fileBrowser.View()
+
+		if f.notice != "" {
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(f.notice),
+				content,
+			)
+		}
+
+		if selected := len(f.fileBrowser.Selection()); selected > 0 {
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("#1E88E5")).Render(
+					fmt.Sprintf("%d file(s) selected (d to decrypt them, space to unselect)", selected)),
+				content,
+			)
+		}
+
+		if len(f.results) > 0 {
+			last := f.results[0]
+			mark, color := "✓", "#00AA00"
+			if last.failed {
+				mark, color = "✗", "#FF0000"
+			}
+			headline, _, _ := strings.Cut(last.summary, "\n")
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render(
+					fmt.Sprintf("%s %s %s (ctrl+l for all %d result(s))", last.time.Format("15:04:05"), mark, truncateKey(headline, 80), len(f.results))),
+				content,
+			)
+		}
+
+		if f.watchCancel != nil {
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("#1E88E5")).Render(
+					fmt.Sprintf("Watching %s for changes (W to stop)", f.watchDir)),
+				content,
+			)
+		}
+
+		// Show file info if a file is selected
+		if f.selectedFile != "" {
+			infoStyle := f.layout.box()
+
+			fileInfo := fmt.Sprintf("Selected: %s\n", f.selectedFile)
+			fileInfo += fmt.Sprintf("Status: %s\n", getEncryptionStatusText(f.fileInfo))
+			if f.binaryContent() {
+				fileInfo += "Format: binary (detected from the content)\n"
+			}
+			if f.label != "" {
+				fileInfo += fmt.Sprintf("Label: %s\n", f.label)
+			}
+			for i, g := range f.fileInfo.KeyGroups {
+				name := "Recipients"
+				if len(f.fileInfo.KeyGroups) > 1 {
+					name = fmt.Sprintf("Group %d", i+1)
+				}
+				fileInfo += fmt.Sprintf("%s: %s\n", name, age.SummarizeKinds(g.Recipients))
+			}
+			if len(f.fileInfo.KeyGroups) > 1 {
+				threshold := f.fileInfo.ShamirThreshold
+				if threshold == 0 {
+					threshold = len(f.fileInfo.KeyGroups)
+				}
+				fileInfo += fmt.Sprintf("Key groups: %d (%d needed to decrypt)\n", len(f.fileInfo.KeyGroups), threshold)
+			}
+			if f.readOnly {
+				fileInfo += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("Read-only: cannot be encrypted or edited in place") + "\n"
+			}
+			if reason := f.unreadable(); reason != "" {
+				fileInfo += lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(reason) + "\n"
+			}
+			if f.staleSibling != "" {
+				fileInfo += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).
+					Render(fmt.Sprintf("Stale: modified after %s was written, needs re-encrypt", filepath.Base(f.staleSibling))) + "\n"
+			}
+			if f.checkedOutFrom != "" {
+				fileInfo += lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#D32F2F")).
+					Render(fmt.Sprintf("Checked out from %s: plaintext until 'supper checkin'", f.checkedOutFrom)) + "\n"
+			}
+
+			if f.protectedKey {
+				fileInfo += lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#D32F2F")).Render(protectedKeyNotice) + "\n"
+			}
+
+			// Show available actions based on file state
+			fileInfo += "\nAvailable Actions:\n"
+			if !f.fileInfo.Encrypted && !f.protectedKey {
+				fileInfo += "  e - Encrypt file\n"
+			}
+			readable := f.fileInfo.Encrypted && f.hasDecryptedKey && f.unreadable() == "" && !f.protectedKey
+			if readable && sops.IsArchive(f.selectedFile) {
+				fileInfo += "  d - Restore the sealed directory\n"
+			} else if readable {
+				fileInfo += "  d - Decrypt file\n"
+				fileInfo += "  E - Edit file\n"
+			}
+			if f.unreadable() != "" && !f.protectedKey {
+				fileInfo += "  F - Repair recipients\n"
+			}
+			if f.fileInfo.Encrypted && !f.protectedKey {
+				fileInfo += "  M - Manage recipients\n"
+			}
+			if f.staleSibling != "" {
+				fileInfo += "  S - Re-encrypt the stale files in this directory\n"
+			}
+			if f.readOnly && !f.protectedKey {
+				fileInfo += "  w - Make a writable copy\n"
+			}
+			if f.label == "" {
+				fileInfo += "  L - Add a label\n"
+			} else {
+				fileInfo += "  L - Edit or remove the label\n"
+			}
+
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				content,
+				infoStyle.Render(fileInfo),
+			)
+		}
+
+	case stateRecipientInput:
+		prompt := "Enter the age public keys of the recipients (comma-separated):"
+		if f.operation == "test-recipient" {
+			prompt = "Enter the public keys to test against " + filepath.Base(f.selectedFile) + " (comma-separated):"
+		}
+		content = f.layout.box().Render(
+			lipgloss.JoinVertical(
+				lipgloss.Left,
+				prompt,
+				"Use gh:username to encrypt to a GitHub user's ssh keys, an https:// URL for the",
+				"recipients file it serves, self for your own key, or a name or @team from recipient_aliases",
+				"Keys of other kinds can be mixed in: pgp:FINGERPRINT, a KMS ARN, gcp-kms:RESOURCE,",
+				"azure-kv:KEY_URL or hc-vault:KEY_URL",
+				f.textInput.View(),
+				"",
+				"Press Enter to confirm, ctrl+o to copy an encrypted file's recipients, or Esc to cancel",
+			),
+		)
+
+	case stateRecipientSource:
+		content = lipgloss.JoinVertical(
+			lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Render("Pick an encrypted file to copy its recipients (Esc to go back)"),
+			f.fileBrowser.View(),
+		)
+		if f.notice != "" {
+			content = lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(f.notice),
+				content,
+			)
+		}
+
+	case stateFetchingRecipients:
+		content = f.layout.box().Render(
+			fmt.Sprintf("%s Fetching recipient keys...", f.spinner.View()),
+		)
+
+	case stateRecipientReview:
+		heading := "Review the recipients before encrypting:"
+		if f.operation == "test-recipient" {
+			heading = "Review the keys to test:"
+		}
+		lines := []string{heading, ""}
+		for _, r := range f.recipients {
+			lines = append(lines, "  "+recipientLine(r))
+		}
+		lines = append(lines, "", "Press Enter to continue or q to cancel")
+		content = f.layout.box().Render(
+			lipgloss.JoinVertical(lipgloss.Left, lines...),
+		)
+
+	case stateRecipients:
+		content = f.recipientsView()
+
+	case stateSizeWarning:
+		content = f.layout.box().
+			BorderForeground(lipgloss.Color("#FFAA00")).
+			Render(
+				lipgloss.JoinVertical(
+					lipgloss.Left,
+					lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("Large file warning"),
+					"",
+					f.sizeWarning,
+					"",
+					"Press Enter to continue anyway or q to cancel",
+				),
+			)
+
+	case stateTrustWarning:
+		lines := []string{
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("Untrusted recipients"),
+			"",
+			"These recipients are not in the trusted allowlist:",
+			"",
+		}
+		for _, r := range f.untrusted {
+			lines = append(lines, fmt.Sprintf("  %s %s", age.Fingerprint(r.Key), truncateKey(r.Key, 40)))
+		}
+		lines = append(lines,
+			"",
+			"Anyone holding these keys will be able to decrypt the file.",
+			"Add the fingerprints to trusted_recipients to stop this warning.",
+			"",
+			"Press Enter to encrypt to them anyway or Esc to cancel",
+		)
+		content = f.layout.box().
+			BorderForeground(lipgloss.Color("#FFAA00")).
+			Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+
+	case stateConfirmation:
+		confirmStyle := f.layout.box()
 
 		var action string
 		switch f.operation {
 		case "encrypt":
-			action = fmt.Sprintf("encrypt file %s for recipient %s", f.selectedFile, f.recipientInput)
+			action = fmt.Sprintf("encrypt file %s for %d recipient(s)", f.selectedFile, len(f.recipients))
 		case "decrypt":
 			action = fmt.Sprintf("decrypt file %s", f.selectedFile)
 		case "edit":
 			action = fmt.Sprintf("edit encrypted file %s", f.selectedFile)
+		case "rekey":
+			action = fmt.Sprintf("re-key every encrypted file under %s to %d recipient(s)", f.rekeyDir, len(f.recipients))
+		case "repair":
+			action = fmt.Sprintf("repair the recipients of %s with %d recipient(s)", f.selectedFile, len(f.recipients))
+		case "repair-metadata":
+			action = fmt.Sprintf("regenerate the sops metadata of %s", f.selectedFile)
+		case "add-recipients":
+			action = fmt.Sprintf("add %d recipient(s) to %s", len(f.recipients), f.selectedFile)
+		case "remove-recipients":
+			action = fmt.Sprintf("remove %d recipient(s) from %s", len(f.recipients), f.selectedFile)
+		case "batch-decrypt":
+			action = fmt.Sprintf("decrypt %d selected file(s)", len(f.batchFiles))
+		case "reseal":
+			action = fmt.Sprintf("re-encrypt %d stale file(s) over their encrypted copies", len(f.batchFiles))
+		case "archive":
+			action = fmt.Sprintf("seal %d file(s) (%s) under %s for %d recipient(s)",
+				f.archiveFiles, utils.FormatSize(f.archiveBytes), f.archiveDir, len(f.recipients))
+		case "unarchive":
+			action = fmt.Sprintf("restore the directory sealed in %s", f.selectedFile)
+		case "export":
+			action = fmt.Sprintf("export %s to %d target(s)", f.selectedFile, len(f.exportTargets))
+		}
+
+		lines := []string{fmt.Sprintf("Are you sure you want to %s?", action), ""}
+		if f.operation == "encrypt" || f.operation == "rekey" || f.operation == "repair" || f.operation == "archive" || f.changesRecipients() {
+			if f.recipientSource != "" && f.recipientInput == f.sourceInput && f.operation != "remove-recipients" {
+				lines = append(lines, fmt.Sprintf("Recipients copied from %s:", f.recipientSource))
+			}
+			for _, r := range f.recipients {
+				lines = append(lines, "  "+recipientLine(r))
+			}
+			lines = append(lines, "")
+			for _, note := range f.recipientNotes {
+				lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(note))
+			}
+			if len(f.recipientNotes) > 0 {
+				lines = append(lines, "")
+			}
+		}
+		if f.operation == "encrypt" {
+			if f.encryptInPlace {
+				lines = append(lines, "Output: in place, replacing the plaintext", "Press 'i' to write a separate encrypted file instead", "")
+			} else {
+				lines = append(lines, fmt.Sprintf("Output file: %s", sops.SidecarPath(f.operationPath())))
+				if template := sops.OutputTemplate(); template != config.DefaultOutputTemplate {
+					lines = append(lines, fmt.Sprintf("Named by the output template %s", template))
+				}
+				lines = append(lines,
+					"The plaintext is left in place. Press 'i' to encrypt in place instead",
+					"",
+				)
+				if f.destructive() {
+					lines = append(lines,
+						lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("The output file already exists and will be overwritten"),
+						"",
+					)
+				}
+			}
+		}
+		if f.operation == "reseal" {
+			for _, path := range f.batchFiles {
+				lines = append(lines, fmt.Sprintf("  %s → %s", filepath.Base(path), filepath.Base(sops.EncryptedSibling(path))))
+			}
+			lines = append(lines, "", "Each copy keeps the recipients it already has; the plaintext is left in place.", "")
+		}
+		if f.operation == "archive" {
+			lines = append(lines,
+				fmt.Sprintf("Output file: %s", sops.ArchivePath(f.archiveDir)),
+				"The directory is archived in memory; no plaintext archive is written to disk.",
+				"Symlinks and special files are skipped.",
+				"",
+			)
+			if f.destructive() {
+				lines = append(lines,
+					lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("The archive already exists and will be replaced"),
+					"",
+				)
+			}
+		}
+		if f.operation == "unarchive" {
+			lines = append(lines,
+				fmt.Sprintf("Output directory: %s", sops.ArchiveDir(f.selectedFile)),
+				"The directory must not exist yet; files are extracted as they are decrypted.",
+				"",
+			)
+		}
+		if f.operation == "repair" {
+			lines = append(lines,
+				"sops updatekeys rewrites the recipient list, which needs a key that can",
+				"still open the file. If none can, restore the file from a backup instead.",
+				"",
+			)
+		}
+		if f.operation == "repair-metadata" && f.metadataDrift != nil {
+			lines = append(lines, fmt.Sprintf("Recipients are taken from the matching rule in %s:", f.metadataDrift.ConfigPath))
+			for _, r := range f.metadataDrift.Missing {
+				lines = append(lines, "  + "+truncateKey(r.Key, 60))
+			}
+			for _, r := range f.metadataDrift.Extra {
+				lines = append(lines, "  - "+truncateKey(r.Key, 60))
+			}
+			if !f.metadataDrift.Drifted() {
+				lines = append(lines, "  The file already lists the rule's age recipients")
+			}
+			lines = append(lines, "",
+				"sops updatekeys rewrites the key entries, which needs a key that can",
+				"still open the file. If none can, restore the file from a backup instead.",
+				"",
+			)
+		}
+		if f.operation == "remove-recipients" {
+			lines = append(lines,
+				"sops rotates the data key, so the removed recipient cannot read later",
+				"versions. Copies they already decrypted stay readable to them.",
+				"",
+			)
+		}
+		if f.operation == "batch-decrypt" {
+			lines = append(lines, f.batchTargetsView()...)
+			if f.batchInPlace {
+				lines = append(lines, "Output: in place, replacing each encrypted file", "Press 'i' to write separate plaintext files instead", "")
+			} else {
+				lines = append(lines, "Press 'i' to decrypt in place instead", "")
+			}
+			var outputs []string
+			for _, t := range f.batchTargets() {
+				if t.Output == "" {
+					outputs = append(outputs, t.Path)
+				} else {
+					outputs = append(outputs, t.Output)
+				}
+			}
+			lines = append(lines, f.exposureView(outputs...)...)
+		}
+		if f.operation == "export" {
+			lines = append(lines, f.exportTargetsView()...)
+			var outputs []string
+			for _, target := range f.exportTargets {
+				outputs = append(outputs, target.Path)
+			}
+			lines = append(lines, f.exposureView(outputs...)...)
+		}
+		if (f.operation == "encrypt" || f.operation == "decrypt") && f.binaryContent() {
+			lines = append(lines,
+				lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("Binary content: sops will treat the file as opaque binary data"),
+				"",
+			)
 		}
+		if f.operation == "decrypt" && f.ageEncrypted() {
+			lines = append(lines,
+				"Encrypted with age itself, not sops: age decrypts it with your key, as it is",
+				fmt.Sprintf("Output file: %s", decryptOutputPath(f.operationPath(), "")),
+			)
+		} else if f.operation == "decrypt" {
+			format := f.outputType
+			if format == "" {
+				format = "same as input (" + f.fileFormat() + ")"
+			}
+			lines = append(lines,
+				fmt.Sprintf("Output format: %s", format),
+				fmt.Sprintf("Output file: %s", decryptOutputPath(f.operationPath(), f.outputType)),
+			)
+			if f.fileFormat() != sops.FormatBinary {
+				lines = append(lines, "Press 'f' to change the output format")
+			}
+			if f.chosenIdentity != nil {
+				lines = append(lines, "Identity: "+f.chosenIdentity.Label()+", given to sops on its own")
+			} else if f.tryIdentities {
+				lines = append(lines, "Identities: each loaded identity is tried on its own", "Press 't' to decrypt with your key only")
+			} else {
+				lines = append(lines, "Press 't' to try every loaded identity and report which one works")
+			}
+		}
+		if f.operation == "decrypt" {
+			lines = append(lines, "")
+			if f.destructive() {
+				lines = append(lines,
+					lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("The output file already exists and will be overwritten"),
+					"",
+				)
+			}
+			lines = append(lines, f.exposureView(decryptOutputPath(f.operationPath(), f.outputType))...)
+		}
+		if f.backsUp() {
+			if !f.cfg.EnableBackups {
+				lines = append(lines,
+					lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF0000")).Render("Backup: off (Enable Backups in Settings)"),
+					"If the operation fails the file cannot be rolled back.",
+					"",
+				)
+			} else if f.skipBackup {
+				lines = append(lines,
+					lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF0000")).Render("Backup: skipped for this operation"),
+					"If the operation fails the file cannot be rolled back.",
+					"Press 'b' to take a backup",
+					"",
+				)
+			} else {
+				lines = append(lines, "Backup: enabled", "Press 'b' to skip the backup for this operation", "")
+			}
+		}
+		lines = append(lines, "Press Enter to confirm or Esc to cancel")
+
+		content = confirmStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+
+	case stateBatchDecrypting:
+		status := "Press Esc to stop after the files in progress"
+		if f.cancelling {
+			status = "Stopping after the files in progress..."
+		}
+		lines := []string{fmt.Sprintf("%s Decrypting %d of %d file(s)...", f.spinner.View(), f.batchDone, len(f.batchFiles)), ""}
+		lines = append(lines, f.batchStatesView()...)
+		content = f.layout.box().Render(lipgloss.JoinVertical(lipgloss.Left, append(lines, status)...))
+
+	case stateEncrypting, stateDecrypting, stateEditing, stateRekeying:
+		var operation string
+		target := f.selectedFile
+		switch f.state {
+		case stateRekeying:
+			operation = "Re-keying"
+			target = f.rekeyDir
+		case stateEncrypting:
+			operation = "Encrypting"
+		case stateDecrypting:
+			operation = "Decrypting"
+		case stateEditing:
+			operation = "Opening"
+		}
+		if f.operation == "repair" {
+			operation = "Repairing recipients"
+		}
+		if f.changesRecipients() {
+			operation = "Updating recipients"
+		}
+		if f.operation == "reseal" {
+			operation = "Re-encrypting stale files"
+			target = f.fileBrowser.CurrentDir()
+		}
+		if f.operation == "archive" {
+			operation = "Sealing"
+			target = f.archiveDir
+		}
+		if f.operation == "unarchive" {
+			operation = "Restoring"
+		}
+		if f.operation == "export" {
+			operation = "Exporting"
+		}
+		if f.operation == "test-recipient" {
+			operation = "Testing your key"
+		}
+
+		status := "Press Esc to cancel and restore the original"
+		if f.operation == "view" || f.operation == "edit" || f.operation == "archive" || f.operation == "unarchive" || f.operation == "export" || f.operation == "test-recipient" {
+			status = "Press Esc to cancel"
+		}
+		if f.cancelling {
+			status = "Cancelling and restoring the original..."
+		}
+		if f.state == stateEditing {
+			status = ""
+		}
+		if f.state == stateRekeying {
+			status = "Press Esc to stop after the current file"
+			if f.cancelling {
+				status = "Stopping after the current file..."
+			}
+		}
+
+		lines := []string{
+			fmt.Sprintf("%s %s...", f.spinner.View(), operation),
+			fmt.Sprintf("Path: %s", target),
+		}
+		if f.waiting() {
+			lines = append(lines, "Queued until another operation on this file has finished")
+		}
+		content = f.layout.box().Render(lipgloss.JoinVertical(lipgloss.Left, append(lines, "", status)...))
+
+	case stateComplete:
+		lines := []string{"Operation complete!", "", f.operationResult, ""}
+		if f.hasReport() {
+			lines = append(lines, "Press 's' to save the report")
+		}
+		lines = append(lines, "Press Enter to continue")
+
+		content = f.layout.box().
+			BorderForeground(lipgloss.Color("#00AA00")).
+			Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+
+	case stateRuleInput:
+		var prompt []string
+		switch f.ruleStep {
+		case ruleStepRegex:
+			prompt = []string{"New .sops.yaml rule in " + f.ruleDir, "Path regex of the files the rule applies to:"}
+		case ruleStepGroups:
+			prompt = []string{
+				"Key groups: separate groups with ';' and recipients with ','",
+				"With several groups, the data key is split so no single group can decrypt alone",
+			}
+		case ruleStepThreshold:
+			prompt = []string{fmt.Sprintf("How many of the %d key groups are needed to decrypt?", len(f.ruleGroups))}
+		}
+
+		lines := append(prompt, f.pathInput.View())
+		if f.ruleErr != "" {
+			lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.ruleErr))
+		}
+		if f.ruleStep == ruleStepRegex {
+			lines = append(lines, "", f.rulePreviewView())
+		}
+		lines = append(lines, "", "Press Enter to continue or Esc to cancel")
+		content = f.layout.box().Render(
+			lipgloss.JoinVertical(lipgloss.Left, lines...),
+		)
+
+	case stateViewing:
+		if f.viewer != nil {
+			content = f.viewer.View()
+		}
+
+	case stateInlineEdit:
+		if f.editor != nil {
+			content = f.editor.View()
+		}
+
+	case stateHistory:
+		content = f.layout.box().Render(f.historyView())
+
+	case stateIdentitySelect:
+		content = f.layout.box().Render(f.identityView())
+
+	case stateLabelInput:
+		lines := []string{
+			"Label for " + filepath.Base(f.selectedFile) + " (what it is, who owns it):",
+			f.labelInput.View(),
+		}
+		if f.labelErr != "" {
+			lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.labelErr))
+		}
+		lines = append(lines,
+			"",
+			lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render("Labels are stored unencrypted in "+sops.LabelsFileName+"; never put secrets in them"),
+			"Leave empty to remove the label",
+			"",
+			"Press Enter to save or Esc to cancel",
+		)
+		content = f.layout.box().Render(
+			lipgloss.JoinVertical(lipgloss.Left, lines...),
+		)
+
+	case stateExtractInput:
+		content = f.layout.box().Render(f.extractView())
+
+	case stateExportInput:
+		content = f.layout.box().Render(f.exportInputView())
+
+	case stateKeySearchInput:
+		content = f.layout.box().Render(lipgloss.JoinVertical(lipgloss.Left,
+			fmt.Sprintf("Key name to search for in the encrypted files under %s:", f.searchRoot()),
+			"",
+			f.keySearchInput.View(),
+			"",
+			"Only key names are searched; no value is decrypted or shown",
+		))
+
+	case stateKeySearch:
+		content = f.layout.box().Render(f.keySearchView())
+
+	case stateCoverage:
+		content = f.layout.box().Render(f.coverageView())
+
+	case stateMetadata:
+		content = f.layout.box().Render(f.metadataView())
+
+	case stateRaw:
+		content = f.layout.box().Render(f.rawView())
+
+	case stateResults:
+		content = f.layout.box().Render(f.resultsView())
+
+	case stateAccesses:
+		content = f.layout.box().Render(f.accessesView())
+
+	case stateReportPath:
+		content = f.layout.box().Render(
+			lipgloss.JoinVertical(
+				lipgloss.Left,
+				"Save the report to (a .csv extension writes CSV, anything else JSON):",
+				f.pathInput.View(),
+				f.outputDirView(),
+				"",
+				"Press Enter to save or Esc to cancel",
+			),
+		)
+
+	case stateError:
+		lines := []string{"Error:", "", fmt.Sprintf("%v", f.error), ""}
+		if f.canCopyReadOnly() {
+			lines = append(lines, "Press 'w' to make a writable copy and use it instead")
+		}
+		if f.canEncryptAll() {
+			lines = append(lines, "Press 'r' to retry without the encrypted_regex, encrypting every value")
+		}
+		lines = append(lines, "Press Enter to continue")
+
+		content = f.layout.box().
+			BorderForeground(lipgloss.Color("#FF0000")).
+			Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+	}
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		titleStyle.Render("File Operations"),
+		content,
+	)
+}
+
+// confirmOperation moves to the confirmation step, showing a size warning
+// first if the selected file exceeds the configured threshold
+func (f *FileEditorView) confirmOperation() tea.Cmd {
+	// A test reads the file and changes nothing, so there is nothing to confirm
+	if f.operation == "test-recipient" {
+		return f.testRecipients()
+	}
+	if f.operation == "add-recipients" && !f.skipPresent() {
+		return nil
+	}
+	if !f.checkTrust() {
+		return nil
+	}
+
+	f.sizeWarning = ""
+	f.skipBackup = false
+	f.encryptAll = false
+
+	// Directories are re-keyed file by file, so there is no single size to warn about
+	if f.operation == "rekey" {
+		return f.proceed()
+	}
+
+	// A directory sealed into one archive is warned about by its total size
+	if f.operation == "archive" {
+		if err := f.countArchive(); err != nil {
+			f.state = stateError
+			f.error = err
+			return nil
+		}
+		if f.cfg.MaxFileSizeWarning <= 0 || f.archiveBytes <= f.cfg.MaxFileSizeWarning {
+			return f.proceed()
+		}
+		f.sizeWarning = fmt.Sprintf("%s holds %d file(s) totalling %s, which exceeds the warning threshold of %s.\nThe whole directory is archived in memory as it is encrypted, which may take a long time.",
+			f.archiveDir, f.archiveFiles, utils.FormatSize(f.archiveBytes), utils.FormatSize(f.cfg.MaxFileSizeWarning))
+		f.state = stateSizeWarning
+		return nil
+	}
+
+	info, err := os.Stat(f.selectedFile)
+	if err != nil || f.cfg.MaxFileSizeWarning <= 0 || info.Size() <= f.cfg.MaxFileSizeWarning {
+		return f.proceed()
+	}
+
+	size, err := utils.GetFileSize(f.selectedFile)
+	if err != nil {
+		size = fmt.Sprintf("%d bytes", info.Size())
+	}
+
+	f.sizeWarning = fmt.Sprintf("%s is %s, which exceeds the warning threshold of %s.\nThe operation may take a long time.",
+		filepath.Base(f.selectedFile), size, utils.FormatSize(f.cfg.MaxFileSizeWarning))
+	if !f.cfg.EnableBackups || !recovery.ShouldBackup(f.selectedFile, f.cfg.NoBackupPatterns, f.cfg.MaxFileSizeWarning) {
+		f.sizeWarning += "\nNo backup will be made, so the file cannot be rolled back if the operation fails."
+	}
+	f.state = stateSizeWarning
+	return nil
+}
+
+// countArchive counts the files under the directory about to be sealed
+func (f *FileEditorView) countArchive() error {
+	files, size, err := sops.DirSize(f.archiveDir)
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to read the directory").
+			WithCode(errors.CodeArchiveFailed).WithData("path", f.archiveDir)
+	}
+	if files == 0 {
+		return errors.New(errors.TypeFileOperation, "The directory has no files to seal").
+			WithCode(errors.CodeArchiveFailed).WithData("path", f.archiveDir)
+	}
+	f.archiveFiles, f.archiveBytes = files, size
+	return nil
+}
+
+// setRecipients takes the recipients entered for the pending operation,
+// leaving out those given more than once and noting them for the
+// confirmation, with a warning when our own key is one of them
+func (f *FileEditorView) setRecipients(recipients []age.Recipient) {
+	unique, repeated := sops.DedupeRecipients(recipients)
+	f.recipients = unique
+	f.recipientNotes = nil
+	for _, r := range repeated {
+		f.recipientNotes = append(f.recipientNotes, fmt.Sprintf("%s was given more than once and is used once", f.recipientName(r)))
+	}
+}
+
+// skipPresent leaves out of an addition the recipients the file already
+// has, so sops is not run for nothing. When none is left it goes back to the
+// recipient manager with a notice and reports false.
+func (f *FileEditorView) skipPresent() bool {
+	missing, present := sops.SplitPresent(f.fileInfo.AllRecipients(), f.recipients)
+	f.recipients = missing
+	for _, r := range present {
+		f.recipientNotes = append(f.recipientNotes, fmt.Sprintf("%s is already a recipient and is skipped", f.recipientName(r)))
+	}
+	if len(missing) > 0 {
+		return true
+	}
+
+	f.state = stateRecipients
+	f.notice = fmt.Sprintf("%d recipient(s) are already on %s; nothing to add", len(present), filepath.Base(f.selectedFile))
+	if len(present) == 1 {
+		f.notice = fmt.Sprintf("%s is already a recipient of %s; nothing to add", f.recipientName(present[0]), filepath.Base(f.selectedFile))
+	}
+	return false
+}
+
+// recipientName describes r in a note, calling our own key by that name
+func (f *FileEditorView) recipientName(r age.Recipient) string {
+	for _, own := range ownPublicKeys(f.cfg) {
+		if r.IsAge() && strings.TrimSpace(r.Key) == own {
+			return "Your own key"
+		}
+	}
+	return truncateKey(r.String(), 60)
+}
+
+// checkTrust holds back an encryption to recipients missing from the trusted
+// allowlist: strict mode refuses it, otherwise the user has to accept the
+// recipients first. It reports whether the operation may continue.
+func (f *FileEditorView) checkTrust() bool {
+	if (f.operation != "encrypt" && f.operation != "rekey" && f.operation != "repair" && f.operation != "add-recipients" && f.operation != "archive") ||
+		!f.cfg.TrustCheckEnabled() {
+		return true
+	}
+
+	untrusted := age.UntrustedRecipients(f.recipients)
+	if len(untrusted) == 0 {
+		return true
+	}
+	if f.cfg.StrictRecipients {
+		f.state = stateError
+		f.error = age.UntrustedError(untrusted)
+		return false
+	}
+	if f.trustConfirmed {
+		// The acceptance only covers this attempt
+		f.trustConfirmed = false
+		return true
+	}
+
+	f.untrusted = untrusted
+	f.state = stateTrustWarning
+	return false
+}
+
+// proceed shows the confirmation step, or runs the operation straight away
+// when confirmations are skipped and the operation is not destructive
+func (f *FileEditorView) proceed() tea.Cmd {
+	if f.skipConfirm && !f.destructive() {
+		return f.runOperation()
+	}
+	f.state = stateConfirmation
+	return nil
+}
+
+// destructive reports whether the pending operation can overwrite data or
+// remove access to it. These operations are always confirmed: encrypting in
+// place or over an existing file, decrypting or exporting over an existing
+// file, sealing over an existing archive and re-keying, which removes
+// recipients.
+func (f *FileEditorView) destructive() bool {
+	switch f.operation {
+	case "encrypt":
+		return f.encryptInPlace || utils.FileExists(sops.SidecarPath(f.operationPath()))
+	case "decrypt":
+		return utils.FileExists(decryptOutputPath(f.operationPath(), f.outputType))
+	case "archive":
+		return utils.FileExists(sops.ArchivePath(f.archiveDir))
+	case "export":
+		for _, target := range f.exportTargets {
+			if utils.FileExists(target.Path) {
+				return true
+			}
+		}
+		return false
+	case "edit", "unarchive":
+		return false
+	default:
+		return true
+	}
+}
+
+// runOperation starts the confirmed operation
+func (f *FileEditorView) runOperation() tea.Cmd {
+	// Batches depend on the selection or on which files are stale, and
+	// exports on the targets typed, so they are not recorded for replay
+	if f.operation == "batch-decrypt" {
+		f.state = stateBatchDecrypting
+		return tea.Batch(f.batchDecrypt(f.startOperation()), f.spinner.Tick)
+	}
+	if f.operation == "reseal" {
+		f.state = stateRekeying
+		return tea.Batch(f.resealStale(f.startOperation()), f.spinner.Tick)
+	}
+	if f.operation == "export" {
+		f.state = stateDecrypting
+		ctx := f.startOperation()
+		return tea.Batch(f.queued(ctx, f.exportFile(ctx)), f.spinner.Tick)
+	}
+
+	op := history.Operation{
+		Action:     f.operation,
+		Path:       f.selectedFile,
+		OutputType: f.outputType,
+		SkipBackup: f.skipBackup && f.backsUp(),
+	}
+	if f.operation == "rekey" {
+		op.Path = f.rekeyDir
+	}
+	if f.operation == "archive" {
+		op.Path = f.archiveDir
+		op.Output = sops.ArchivePath(f.archiveDir)
+	}
+	if f.operation == "encrypt" || f.operation == "rekey" || f.operation == "repair" || f.operation == "archive" || f.changesRecipients() {
+		op.Recipients = age.RecipientTokens(f.recipients)
+	}
+	if f.operation == "encrypt" && !f.encryptInPlace {
+		op.Output = sops.SidecarPath(f.operationPath())
+	}
+	f.pendingOp = &op
+
+	switch f.operation {
+	case "rekey":
+		f.state = stateRekeying
+		return tea.Batch(f.rekeyTree(f.startOperation()), f.spinner.Tick)
+	case "encrypt":
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.encryptFile(ctx))
+	case "repair":
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.repairFile(ctx))
+	case "repair-metadata":
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.repairMetadata(ctx))
+	case "add-recipients", "remove-recipients":
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.updateRecipients(ctx))
+	case "decrypt":
+		f.state = stateDecrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.decryptFile(ctx))
+	case "archive":
+		f.state = stateEncrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.archiveDirectory(ctx))
+	case "unarchive":
+		f.state = stateDecrypting
+		ctx := f.startOperation()
+		return f.queued(ctx, f.restoreArchive(ctx))
+	case "edit":
+		if f.cfg.EditorCommand == config.BuiltinEditorCommand {
+			f.state = stateDecrypting
+			ctx := f.startOperation()
+			return f.queued(ctx, f.openInlineEditor(ctx))
+		}
+		f.state = stateEditing
+		return f.editFile()
+	}
+	return nil
+}
+
+// queued runs the operation cmd through the view's queue, so that it waits
+// for a batch or the watcher to finish with the files it writes first
+func (f *FileEditorView) queued(ctx context.Context, cmd tea.Cmd) tea.Cmd {
+	task := sops.Task{Operation: f.operation, Path: f.selectedFile}
+	switch f.operation {
+	case "encrypt":
+		if !f.encryptInPlace {
+			task.Also = []string{sops.SidecarPath(f.operationPath())}
+		}
+	case "decrypt":
+		task.Also = []string{decryptOutputPath(f.operationPath(), f.outputType)}
+	case "archive":
+		task.Path = sops.ArchivePath(f.archiveDir)
+	case "export":
+		for _, target := range f.exportTargets {
+			task.Also = append(task.Also, target.Path)
+		}
+	}
+
+	queue := f.queue
+	return func() tea.Msg {
+		var msg tea.Msg
+		task.Run = func(context.Context) error {
+			msg = cmd()
+			return nil
+		}
+		if err := queue.Do(ctx, task); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return msg
+	}
+}
+
+// waiting reports whether the running operation is queued behind another
+// operation on the same file
+func (f *FileEditorView) waiting() bool {
+	for _, job := range f.queue.Active() {
+		if job.State == sops.JobQueued {
+			return true
+		}
+	}
+	return false
+}
+
+// unreadable explains why the selected file is encrypted but cannot be
+// decrypted, or returns "" when it can or is not encrypted
+func (f *FileEditorView) unreadable() string {
+	if f.selectedFile == "" || f.fileInfo == nil || !f.fileInfo.Encrypted {
+		return ""
+	}
+	switch f.fileInfo.Health {
+	case sops.HealthNoRecipients:
+		return "Encrypted, but the file lists no recipients: no key can decrypt it. Press F to repair them, or restore a backup"
+	case sops.HealthNoKey:
+		return "None of your keys is a recipient of this file. Ask a recipient to add you, press F to repair its recipients, or D to try every loaded identity"
+	}
+	return ""
+}
+
+// getEncryptionStatusText returns a formatted text for encryption status
+func getEncryptionStatusText(info *sops.FileInfo) string {
+	if info.Encrypted && info.Health == sops.HealthNoRecipients {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render("Encrypted, no recipients")
+	}
+	if info.Encrypted {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render("Encrypted")
+	}
+	if info.AgeEncrypted {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#00AAAA")).Render("Encrypted with age, not SOPS")
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render("Not encrypted")
+}
+
+// ShortHelp returns the keys of the current step for the hint bar
+func (f *FileEditorView) ShortHelp() []key.Binding {
+	if f.inFlight() {
+		return []key.Binding{relabel(f.keys.Cancel, "stop")}
+	}
+	switch f.state {
+	case stateFileSelect:
+		return []key.Binding{f.keys.EncryptFile, f.keys.DecryptFile, f.keys.EditFile, f.keys.ViewFile, f.keys.Recipients, f.keys.History}
+	case stateRecipients:
+		return []key.Binding{relabel(f.keys.Audit, "add"), relabel(f.keys.DeleteKey, "remove"), relabel(f.keys.TestKey, "test"), relabel(f.keys.Cancel, "back")}
+	case stateHistory:
+		return []key.Binding{relabel(f.keys.Enter, "replay"), relabel(f.keys.Cancel, "close")}
+	case stateIdentitySelect:
+		return []key.Binding{f.keys.Up, f.keys.Down, relabel(f.keys.Enter, "decrypt with"), f.keys.Cancel}
+	case stateMetadata:
+		if f.metadataDrift != nil {
+			return []key.Binding{relabel(f.keys.Repair, "repair metadata"), relabel(f.keys.Cancel, "close")}
+		}
+		return []key.Binding{relabel(f.keys.Cancel, "close")}
+	case stateRaw, stateAccesses:
+		return []key.Binding{relabel(f.keys.Up, "scroll up"), relabel(f.keys.Down, "scroll down"), relabel(f.keys.Cancel, "close")}
+	case stateResults:
+		return []key.Binding{relabel(f.keys.Up, "scroll up"), relabel(f.keys.Down, "scroll down"), relabel(f.keys.DeleteKey, "clear"), relabel(f.keys.Cancel, "close")}
+	case stateCoverage:
+		if f.coverage != nil && len(f.coverage.secrets) > 0 {
+			return []key.Binding{relabel(f.keys.NewRule, "add rule"), relabel(f.keys.Cancel, "close")}
+		}
+		return []key.Binding{relabel(f.keys.Cancel, "close")}
+	case stateConfirmation:
+		kb := []key.Binding{relabel(f.keys.Enter, "confirm"), f.keys.Cancel}
+		switch f.operation {
+		case "decrypt":
+			if !f.ageEncrypted() {
+				kb = append(kb, f.keys.Format, f.keys.Identities)
+			}
+		case "encrypt", "batch-decrypt":
+			kb = append(kb, f.keys.InPlace)
+		case "export":
+			kb = append(kb, f.keys.Overwrite)
+		}
+		if f.backsUp() && f.cfg.EnableBackups {
+			kb = append(kb, f.keys.SkipBackup)
+		}
+		return kb
+	case stateRecipientInput:
+		return []key.Binding{relabel(f.keys.Enter, "confirm"), f.keys.CopyFrom, f.keys.Cancel}
+	case stateRecipientSource:
+		return append([]key.Binding{relabel(f.keys.Enter, "use recipients"), relabel(f.keys.Cancel, "back")}, f.fileBrowser.ShortHelp()...)
+	case stateSizeWarning, stateTrustWarning, stateReportPath, stateRuleInput, stateLabelInput:
+		return []key.Binding{relabel(f.keys.Enter, "confirm"), f.keys.Cancel}
+	case stateExtractInput:
+		return []key.Binding{relabel(f.keys.Enter, "view"), f.keys.CopyValue, f.keys.Cancel}
+	case stateExportInput:
+		return []key.Binding{relabel(f.keys.Enter, "export"), f.keys.Cancel}
+	case stateKeySearchInput:
+		return []key.Binding{relabel(f.keys.Enter, "search"), f.keys.Cancel}
+	case stateKeySearch:
+		return []key.Binding{f.keys.Up, f.keys.Down, relabel(f.keys.Enter, "go to file"), relabel(f.keys.Extract, "view value"), relabel(f.keys.Cancel, "close")}
+	case stateComplete, stateError:
+		kb := []key.Binding{relabel(f.keys.Enter, "continue")}
+		if f.canEncryptAll() {
+			kb = append(kb, f.keys.EncryptAll)
+		}
+		return kb
+	}
+	return nil
+}
+
+// FullHelp returns every key of the current step, grouped by what it acts on
+func (f *FileEditorView) FullHelp() [][]key.Binding {
+	if f.state != stateFileSelect || f.inFlight() {
+		return [][]key.Binding{f.ShortHelp()}
+	}
+	groups := [][]key.Binding{
+		{f.keys.EncryptFile, f.keys.DecryptFile, f.keys.EditFile, f.keys.ViewFile, f.keys.Extract, f.keys.Export},
+		{f.keys.Recipients, f.keys.Metadata, f.keys.Raw, f.keys.Repair, f.keys.Rekey, f.keys.Reseal, f.keys.Archive, f.keys.Watch, f.keys.NewRule, f.keys.Coverage},
+		{f.keys.History, f.keys.Accesses, f.keys.Results, f.keys.Label, f.keys.Toggle, f.keys.SkipConfirm, f.keys.CopyFile, f.keys.Reveal, f.keys.FindKey},
+	}
+	return append(groups, f.fileBrowser.FullHelp()...)
+}
+
+// CapturingInput reports whether a text input currently has focus
+func (f *FileEditorView) CapturingInput() bool {
+	if f.state == stateFileSelect || f.state == stateRecipientSource {
+		return f.fileBrowser.CapturingInput()
+	}
+	return f.state == stateRecipientInput || f.state == stateReportPath || f.state == stateRuleInput || f.state == stateLabelInput || f.state == stateViewing ||
+		f.state == stateInlineEdit || f.state == stateExtractInput || f.state == stateKeySearchInput || f.state == stateExportInput
+}
+
+// backsUp reports whether the pending operation modifies files in place and
+// so normally takes a backup first
+func (f *FileEditorView) backsUp() bool {
+	return (f.operation == "encrypt" && f.encryptInPlace) || f.operation == "edit" || f.operation == "rekey" ||
+		f.operation == "repair" || f.operation == "repair-metadata" || f.changesRecipients() || (f.operation == "batch-decrypt" && f.batchInPlace)
+}
+
+// changesRecipients reports whether the pending operation adds or removes
+// recipients of the selected file from the recipient manager
+func (f *FileEditorView) changesRecipients() bool {
+	return f.operation == "add-recipients" || f.operation == "remove-recipients"
+}
+
+// recipientsLocked explains why the recipients of the selected file cannot
+// be changed: sops has to open the data key to encrypt it to new ones
+func (f *FileEditorView) recipientsLocked() string {
+	if !f.hasDecryptedKey {
+		return "Decrypt your key first"
+	}
+	return f.unreadable()
+}
+
+// backupOptions returns the sops options for the per-operation backup choice
+func (f *FileEditorView) backupOptions() []sops.Option {
+	if f.skipBackup {
+		return []sops.Option{sops.WithoutBackup()}
+	}
+	return nil
+}
+
+// inFlight reports whether a cancellable operation is running
+func (f *FileEditorView) inFlight() bool {
+	return f.state == stateEncrypting || f.state == stateDecrypting || f.state == stateRekeying || f.state == stateBatchDecrypting ||
+		(f.state == stateKeySearch && f.keySearch == nil)
+}
+
+// startOperation creates the context for a new cancellable operation
+func (f *FileEditorView) startOperation() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.cancelling = false
+	f.notice = ""
+	f.opStarted = time.Now()
+	return ctx
+}
+
+// finishOperation releases the context of the finished operation and
+// returns how long it ran, or zero when none was started
+func (f *FileEditorView) finishOperation() time.Duration {
+	if f.cancel != nil {
+		f.cancel()
+		f.cancel = nil
+	}
+	f.cancelling = false
+
+	var elapsed time.Duration
+	if !f.opStarted.IsZero() {
+		elapsed = time.Since(f.opStarted)
+		f.opStarted = time.Time{}
+	}
+	return elapsed
+}
+
+// notifyCompletion rings the bell, and with the desktop setting also shows
+// message as a notification, when an operation ran for at least the
+// configured threshold. Faster operations finish while they are watched.
+func notifyCompletion(cfg *config.Config, elapsed time.Duration, message string) tea.Cmd {
+	if elapsed < cfg.NotifyThreshold {
+		return nil
+	}
+	return notifyAlert(cfg, message)
+}
+
+// notifyAlert rings the bell, and with desktop notifications shows message,
+// however long the work behind it took, unless notifications are off
+func notifyAlert(cfg *config.Config, message string) tea.Cmd {
+	if cfg == nil || cfg.NotifyOnCompletion == config.NotifyOff {
+		return nil
+	}
+	desktop := cfg.NotifyOnCompletion == config.NotifyDesktop
+	return func() tea.Msg {
+		// A missing terminal or notification tool is not worth an error
+		_ = notify.Bell()
+		if desktop {
+			_ = notify.Desktop("supper", message)
+		}
+		return nil
+	}
+}
+
+// canCopyReadOnly reports whether a writable copy of the selected file can be offered
+func (f *FileEditorView) canCopyReadOnly() bool {
+	switch f.state {
+	case stateFileSelect:
+		return f.selectedFile != "" && f.readOnly
+	case stateError:
+		return errors.Code(f.error) == errors.CodeFileReadOnly
+	}
+	return false
+}
+
+// canEncryptAll reports whether a failed encrypt can be retried without the
+// encrypted_regex that matched nothing
+func (f *FileEditorView) canEncryptAll() bool {
+	return f.state == stateError && f.operation == "encrypt" && !f.encryptAll &&
+		errors.Code(f.error) == errors.CodeSOPSNoRegexMatch
+}
+
+// reveal shows the selected file, or the directory being browsed when the
+// file is elsewhere or none is selected, in the system file manager, and
+// returns the notice to show. Where there is none the path is shown instead.
+func (f *FileEditorView) reveal() string {
+	path := f.fileBrowser.CurrentDir()
+	if f.selectedFile != "" && filepath.Dir(f.selectedFile) == path {
+		path = f.selectedFile
+	}
+	if err := filemanager.Reveal(path); err != nil {
+		return fmt.Sprintf("Could not open a file manager (%v); the path is %s", err, path)
+	}
+	return "Opened " + filepath.Base(path) + " in the file manager"
+}
+
+// makeWritableCopy copies the selected read-only file so it can be modified
+func (f *FileEditorView) makeWritableCopy() tea.Cmd {
+	return func() tea.Msg {
+		path, err := utils.WritableCopy(f.selectedFile)
+		if err != nil {
+			return writableCopyCreated{err: errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to create writable copy").WithCode(errors.CodeFileWriteFailed).WithData("path", f.selectedFile)}
+		}
+
+		info, err := sops.GetFileInfo(path)
+		if err != nil {
+			info = &sops.FileInfo{Path: path}
+		}
+		return writableCopyCreated{path: path, info: info}
+	}
+}
+
+// encryptFile encrypts the selected file
+func (f *FileEditorView) encryptFile(ctx context.Context) tea.Cmd {
+	return func() tea.Msg {
+		recipients := f.recipients
+
+		// Extract filename for result message
+		filename := filepath.Base(f.selectedFile)
+
+		opts := []sops.Option{sops.WithContext(ctx)}
+		suffix := ""
+		if f.encryptAll {
+			opts = append(opts, sops.WithoutEncryptedRegex())
+			suffix = ", every value (encrypted_regex ignored)"
+		}
+
+		if !f.encryptInPlace {
+			// The output template may name a subdirectory beside the file
+			outputPath := sops.SidecarPath(f.operationPath())
+			if err := sops.EncryptToFile(f.selectedFile, outputPath, recipients, append(opts, sops.WithCreateOutputDir())...); err != nil {
+				return OperationErrorMsg{Error: err}
+			}
+			outputName, err := filepath.Rel(filepath.Dir(f.operationPath()), outputPath)
+			if err != nil {
+				outputName = filepath.Base(outputPath)
+			}
+			return OperationCompleteMsg{
+				Message: fmt.Sprintf("Successfully encrypted %s to %s%s", filename, outputName, suffix),
+			}
+		}
+
+		// Encrypt file
+		err := sops.EncryptFile(f.selectedFile, recipients, true, append(opts, f.backupOptions()...)...)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Successfully encrypted %s%s", filename, suffix),
+		}
+	}
+}
+
+// updateRecipients adds or removes the recipients chosen in the recipient
+// manager, leaving the file's other recipients as they are
+func (f *FileEditorView) updateRecipients(ctx context.Context) tea.Cmd {
+	var add, remove []age.Recipient
+	message := "Added %d recipient(s) to %s"
+	if f.operation == "remove-recipients" {
+		remove = f.recipients
+		message = "Removed %d recipient(s) from %s"
+	} else {
+		add = f.recipients
+	}
+	count := len(f.recipients)
+	opts := append([]sops.Option{sops.WithContext(ctx)}, f.backupOptions()...)
+	cfg := f.cfg
+	path := f.selectedFile
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		if err := sops.UpdateRecipients(path, add, remove, append(keyOpts, opts...)...); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{Message: fmt.Sprintf(message, count, filepath.Base(path))}
+	}
+}
+
+// repairFile gives the selected file new recipients with sops updatekeys
+func (f *FileEditorView) repairFile(ctx context.Context) tea.Cmd {
+	recipients := f.recipients
+	opts := append([]sops.Option{sops.WithContext(ctx)}, f.backupOptions()...)
+	cfg := f.cfg
+	path := f.selectedFile
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		if err := sops.RepairRecipients(path, recipients, append(keyOpts, opts...)...); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Repaired the recipients of %s", filepath.Base(path)),
+		}
+	}
+}
+
+// repairMetadata regenerates the selected file's metadata from its .sops.yaml rule
+func (f *FileEditorView) repairMetadata(ctx context.Context) tea.Cmd {
+	opts := append([]sops.Option{sops.WithContext(ctx)}, f.backupOptions()...)
+	cfg := f.cfg
+	path := f.selectedFile
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		if err := sops.RepairMetadata(path, append(keyOpts, opts...)...); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Regenerated the sops metadata of %s", filepath.Base(path)),
+		}
+	}
+}
+
+// decryptFile decrypts the selected file
+func (f *FileEditorView) decryptFile(ctx context.Context) tea.Cmd {
+	return func() tea.Msg {
+		// Extract filename for result message
+		filename := filepath.Base(f.selectedFile)
+
+		outputPath := decryptOutputPath(f.operationPath(), f.outputType)
+
+		opts := []sops.Option{sops.WithContext(ctx)}
+		if f.outputType != "" {
+			opts = append(opts, sops.WithOutputType(f.outputType))
+		}
+
+		if f.chosenIdentity != nil {
+			chosen := *f.chosenIdentity
+			err := sops.DecryptWithIdentity(f.selectedFile, false, outputPath, chosen, opts...)
+			audit.Record("decrypt", f.selectedFile, err, "identity="+chosen.Label())
+			if err != nil {
+				return OperationErrorMsg{Error: err}
+			}
+			return OperationCompleteMsg{
+				Message: fmt.Sprintf("Successfully decrypted %s to %s with %s", filename, filepath.Base(outputPath), chosen.Label()),
+			}
+		}
+
+		if f.tryIdentities {
+			matched, err := sops.ForceDecrypt(f.selectedFile, false, outputPath, identityCandidates(f.cfg), opts...)
+			if err != nil {
+				return OperationErrorMsg{Error: err}
+			}
+			return OperationCompleteMsg{
+				Message: fmt.Sprintf("Successfully decrypted %s to %s with %s", filename, filepath.Base(outputPath), matched.Label()),
+			}
+		}
+
+		// Decrypt file
+		keyOpts, err := keyOptions(f.cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		err = sops.DecryptFile(f.selectedFile, false, outputPath, append(keyOpts, opts...)...)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Successfully decrypted %s to %s", filename, filepath.Base(outputPath)),
+		}
+	}
+}
+
+// startWatch re-encrypts tracked plaintext files in dir as they change
+func (f *FileEditorView) startWatch(dir string) tea.Cmd {
+	resolved, err := age.ResolveRecipients(age.SplitRecipientInput(f.cfg.DefaultRecipients))
+	if err != nil || len(resolved) == 0 {
+		f.notice = "Set default recipients in Settings before watching"
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan tea.Msg, 16)
+	f.watchDir = dir
+	f.watchCancel = cancel
+	f.watchEvents = events
+	f.notice = ""
+
+	opts := watch.Options{Recipients: resolved}
+	go func() {
+		err := watch.Run(ctx, []string{dir}, opts, func(ev watch.Event) {
+			select {
+			case events <- watchEventMsg{event: ev}:
+			case <-ctx.Done():
+			}
+		})
+		events <- watchStoppedMsg{events: events, err: err}
+		close(events)
+	}()
+
+	return f.waitForWatchEvent()
+}
+
+// waitForWatchEvent delivers the next watcher event to the update loop
+func (f *FileEditorView) waitForWatchEvent() tea.Cmd {
+	events := f.watchEvents
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// stopWatch stops the background watcher
+func (f *FileEditorView) stopWatch() {
+	if f.watchCancel != nil {
+		f.watchCancel()
+		f.watchCancel = nil
+	}
+}
+
+// startRule asks for a new .sops.yaml rule in dir, starting from regex
+func (f *FileEditorView) startRule(dir, regex string) tea.Cmd {
+	f.operation = "rule"
+	f.ruleDir = dir
+	f.ruleStep = ruleStepRegex
+	f.ruleErr = ""
+	f.pathInput.SetValue(regex)
+	f.pathInput.Focus()
+	f.state = stateRuleInput
+	f.previewRegex = ""
+	return f.scheduleRulePreview()
+}
+
+// advanceRule takes the current rule input and moves to the next step,
+// writing the rule once it is complete
+func (f *FileEditorView) advanceRule() tea.Cmd {
+	value := strings.TrimSpace(f.pathInput.Value())
+	f.ruleErr = ""
+
+	switch f.ruleStep {
+	case ruleStepRegex:
+		if _, err := regexp.Compile(value); err != nil {
+			f.ruleErr = fmt.Sprintf("Invalid path regex: %v", err)
+			return nil
+		}
+		f.ruleRegex = value
+		f.ruleStep = ruleStepGroups
+		f.pathInput.SetValue(f.cfg.DefaultRecipients)
+		return nil
+
+	case ruleStepGroups:
+		groups, err := sops.ParseKeyGroups(value)
+		if err != nil {
+			f.ruleErr = err.Error()
+			return nil
+		}
+		f.ruleGroups = groups
+		if len(groups) == 1 {
+			return f.writeRule(sops.NewGroupedRule(f.ruleRegex, groups, 0))
+		}
+		f.ruleStep = ruleStepThreshold
+		f.pathInput.SetValue(strconv.Itoa(len(groups)))
+		return nil
+
+	case ruleStepThreshold:
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 || threshold > len(f.ruleGroups) {
+			f.ruleErr = fmt.Sprintf("Enter a number between 1 and %d", len(f.ruleGroups))
+			return nil
+		}
+		return f.writeRule(sops.NewGroupedRule(f.ruleRegex, f.ruleGroups, threshold))
+	}
+	return nil
+}
+
+// scheduleRulePreview refreshes the regex preview after typing pauses
+func (f *FileEditorView) scheduleRulePreview() tea.Cmd {
+	f.previewSeq++
+	f.previewRegex = f.pathInput.Value()
+	seq := f.previewSeq
+	return tea.Tick(rulePreviewDelay, func(time.Time) tea.Msg {
+		return rulePreviewTick{seq: seq}
+	})
+}
+
+// previewRule lists the files in the current directory matched by the typed regex
+func (f *FileEditorView) previewRule(seq int) tea.Cmd {
+	rule := sops.CreationRule{PathRegex: strings.TrimSpace(f.pathInput.Value())}
+	dir := f.ruleDir
+	return func() tea.Msg {
+		files, err := sops.MatchCreationRule(rule, dir)
+		return rulePreviewMsg{seq: seq, files: files, err: err}
+	}
+}
+
+// rulePreviewView renders the files the typed regex matches
+func (f *FileEditorView) rulePreviewView() string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	if f.previewErr != nil {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.previewErr.Error())
+	}
+	if len(f.previewFiles) == 0 {
+		return dim.Render("No files in this directory match")
+	}
+
+	lines := []string{fmt.Sprintf("Matches %d file(s):", len(f.previewFiles))}
+	for i, file := range f.previewFiles {
+		if i == rulePreviewLimit {
+			lines = append(lines, dim.Render(fmt.Sprintf("  ... and %d more", len(f.previewFiles)-rulePreviewLimit)))
+			break
+		}
+		lines = append(lines, "  "+file)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// writeRule adds the rule to the .sops.yaml of the current directory
+func (f *FileEditorView) writeRule(rule sops.CreationRule) tea.Cmd {
+	if err := rule.Validate(); err != nil {
+		f.ruleErr = err.Error()
+		return nil
+	}
+
+	dir := f.ruleDir
+	return func() tea.Msg {
+		path, err := sops.AddCreationRule(dir, rule)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+
+		msg := fmt.Sprintf("Added rule for %q to %s with %d key group(s)", rule.PathRegex, path, len(rule.KeyGroups))
+		if rule.ShamirThreshold > 0 {
+			msg += fmt.Sprintf(", %d needed to decrypt", rule.ShamirThreshold)
+		}
+		return OperationCompleteMsg{Message: msg}
+	}
+}
+
+// recordHistory stores the outcome of the operation that just finished.
+// Cancelled operations are not recorded.
+func (f *FileEditorView) recordHistory(opErr error) tea.Cmd {
+	if f.pendingOp == nil {
+		return nil
+	}
+	op := *f.pendingOp
+	f.pendingOp = nil
+	if opErr != nil && sops.IsCancelled(opErr) {
+		return nil
+	}
+
+	return func() tea.Msg {
+		history.Record(op, opErr)
+		return nil
+	}
+}
+
+// loadHistory reads the recorded operations
+func (f *FileEditorView) loadHistory() tea.Cmd {
+	return func() tea.Msg {
+		ops, err := history.Load()
+		return historyLoaded{ops: ops, err: err}
+	}
+}
+
+// replay sets up a past operation against the file's current state and asks
+// for confirmation again, even when confirmations are skipped
+func (f *FileEditorView) replay(op history.Operation) {
+	fail := func(reason string) {
+		f.state = stateFileSelect
+		f.notice = fmt.Sprintf("Cannot replay %s of %s: %s", op.Action, filepath.Base(op.Path), reason)
+	}
+
+	if op.Action != "encrypt" && op.Action != "archive" && !f.hasDecryptedKey {
+		fail("decrypt your key first")
+		return
+	}
+
+	if op.Action == "rekey" || op.Action == "archive" {
+		if !utils.DirExists(op.Path) {
+			fail("the directory no longer exists")
+			return
+		}
+		if op.Action == "rekey" {
+			f.rekeyDir = op.Path
+		} else {
+			f.archiveDir = op.Path
+			if err := f.countArchive(); err != nil {
+				fail(err.Error())
+				return
+			}
+		}
+	} else {
+		info, err := sops.GetFileInfo(op.Path)
+		if err != nil {
+			fail("the file no longer exists")
+			return
+		}
+		if op.Action == "encrypt" && info.Encrypted {
+			fail("the file is already encrypted")
+			return
+		}
+		if op.Action != "encrypt" && !info.Encrypted {
+			fail("the file is not encrypted")
+			return
+		}
+		if op.Action != "encrypt" && op.Action != "repair" && info.Health != sops.HealthOK {
+			fail("none of your keys can open it")
+			return
+		}
+		f.selectedFile = op.Path
+		f.fileInfo = info
+		f.readOnly = utils.IsReadOnly(op.Path)
+	}
+
+	recipients, err := age.ResolveRecipients(op.Recipients)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	f.operation = op.Action
+	f.setRecipients(recipients)
+	f.encryptInPlace = op.Output == ""
+	f.outputType = op.OutputType
+	f.skipBackup = false
+	f.sizeWarning = ""
+	f.notice = ""
+	if !f.checkTrust() {
+		return
+	}
+	f.state = stateConfirmation
+}
+
+// matchIdentities finds the loaded identities that are recipients of the
+// file at path, so the user can pick one when there are several
+func (f *FileEditorView) matchIdentities(path string) tea.Cmd {
+	cfg := f.cfg
+	return func() tea.Msg {
+		return identitiesMatched{path: path, matching: sops.MatchingIdentities(path, identityCandidates(cfg))}
+	}
+}
+
+// identityView lists the identities the selected file can be decrypted with
+func (f *FileEditorView) identityView() string {
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+
+	lines := []string{
+		fmt.Sprintf("%d of your identities can decrypt %s.", len(f.identityChoices), filepath.Base(f.selectedFile)),
+		"Choose the one to decrypt with; sops is given no other:",
+		"",
+	}
+	for i, c := range f.identityChoices {
+		line := "  " + c.Label()
+		if i == f.identityCursor {
+			line = selectedStyle.Render("> " + c.Label())
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", "The choice is recorded in the audit log. Press Enter to choose or Esc to cancel")
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// startKeySearch searches the encrypted files under the search root for
+// keys named like the name entered
+func (f *FileEditorView) startKeySearch() tea.Cmd {
+	query := strings.TrimSpace(f.keySearchInput.Value())
+	if query == "" {
+		return nil
+	}
+	f.keySearchInput.Blur()
+	f.keySearch = nil
+	f.state = stateKeySearch
+	return tea.Batch(f.searchKeys(f.startOperation(), query), f.spinner.Tick)
+}
+
+// searchKeys runs a key search over the files one of our keys can decrypt
+func (f *FileEditorView) searchKeys(ctx context.Context, query string) tea.Cmd {
+	root := f.searchRoot()
+	cfg := f.cfg
+	return func() tea.Msg {
+		search, err := sops.SearchKeys(root, query, ownPublicKeys(cfg), sops.DefaultBatchWorkers,
+			sops.WithContext(ctx), sops.WithGitScope(cfg.GitScope))
+		return keySearchDone{search: search, err: err}
+	}
+}
+
+// searchRoot returns the directory key searches cover, the browser's when
+// Search Root is empty
+func (f *FileEditorView) searchRoot() string {
+	if root := utils.ExpandPath(strings.TrimSpace(f.cfg.SearchRoot)); root != "" {
+		return root
+	}
+	return f.fileBrowser.CurrentDir()
+}
+
+// extractMatch views the value of a key search match alone, with its file
+// selected in the browser for when the viewer is closed
+func (f *FileEditorView) extractMatch(match sops.KeyMatch) tea.Cmd {
+	if !f.hasDecryptedKey {
+		f.notice = "Decrypt your key first"
+		return nil
+	}
+	format := sops.DetectFormat(match.Path)
+	if format != sops.FormatYAML && format != sops.FormatJSON {
+		f.notice = "Only YAML and JSON files have single values to view; press Enter to go to the file and v to view it"
+		return nil
+	}
+
+	// The browser selects the file properly once its directory is loaded
+	f.selectedFile = match.Path
+	f.fileInfo = &sops.FileInfo{Path: match.Path, Encrypted: true, Format: format}
+	f.notice = ""
+	f.treeInput.SetValue(match.TreePath)
+	return tea.Batch(f.fileBrowser.ShowFile(match.Path), f.startExtract(false))
+}
+
+// keySearchView renders the progress of a key search, then the keys found
+func (f *FileEditorView) keySearchView() string {
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	search := f.keySearch
+	if search == nil {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			fmt.Sprintf("%s Searching the keys of the encrypted files under %s...", f.spinner.View(), f.searchRoot()),
+			"",
+			"Press Esc to cancel",
+		)
+	}
+
+	lines := []string{fmt.Sprintf("Keys matching %q under %s", search.Query, search.Root), ""}
+	if len(search.Matches) == 0 {
+		lines = append(lines, "  No key matches")
+	}
+
+	// Scroll so the cursor stays within the page
+	start := max(0, f.keySearchCursor-historyPageSize+1)
+	end := min(len(search.Matches), start+historyPageSize)
+	for i := start; i < end; i++ {
+		match := search.Matches[i]
+		path := match.Path
+		if rel, err := filepath.Rel(search.Root, match.Path); err == nil {
+			path = rel
+		}
+		line := fmt.Sprintf("%s  %s", path, match.TreePath)
+		if i == f.keySearchCursor {
+			line = selectedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if len(search.Matches) > historyPageSize {
+		lines = append(lines, "", dimStyle.Render(fmt.Sprintf("%d of %d keys", f.keySearchCursor+1, len(search.Matches))))
+	}
+
+	summary := fmt.Sprintf("Searched %d encrypted file(s)", search.Searched)
+	if search.Skipped > 0 {
+		summary += fmt.Sprintf("; skipped %d that none of your keys can decrypt or whose keys could not be read", search.Skipped)
+	}
+	lines = append(lines, "", dimStyle.Render(summary), dimStyle.Render("Values are not decrypted; press X to view one"))
+	if f.notice != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(f.notice))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// historyView renders the list of past operations
+func (f *FileEditorView) historyView() string {
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+	failedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	lines := []string{"Operation history (Enter replays the selected operation)", ""}
+
+	// Scroll so the cursor stays within the page
+	start := max(0, f.historyCursor-historyPageSize+1)
+	end := min(len(f.historyOps), start+historyPageSize)
+	for i := start; i < end; i++ {
+		op := f.historyOps[i]
+		line := fmt.Sprintf("%s  %-7s  %s", op.Time.Format("2006-01-02 15:04"), op.Action, op.Path)
+		if op.Output != "" {
+			line += " → " + filepath.Base(op.Output)
+		}
+		if len(op.Recipients) > 0 {
+			line += fmt.Sprintf("  (%d recipient(s))", len(op.Recipients))
+		}
+		if op.OutputType != "" {
+			line += "  as " + op.OutputType
+		}
+
+		switch {
+		case i == f.historyCursor:
+			line = selectedStyle.Render(line)
+		case op.Result == "failed":
+			line = failedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(f.historyOps) > historyPageSize {
+		lines = append(lines, "", dimStyle.Render(fmt.Sprintf("%d of %d operations", f.historyCursor+1, len(f.historyOps))))
+	}
+	if op := f.historyOps[f.historyCursor]; op.Error != "" {
+		lines = append(lines, "", failedStyle.Render("Failed: "+op.Error))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// checkCoverage compares the files under root with the creation rules
+func (f *FileEditorView) checkCoverage(root string) tea.Cmd {
+	scope := f.cfg.GitScope
+	return func() tea.Msg {
+		covered, uncovered, err := sops.CoverageReport(root, sops.WithGitScope(scope))
+		msg := coverageReady{root: root, covered: covered, uncovered: uncovered, err: err}
+		for _, p := range uncovered {
+			if sops.LooksLikeSecret(filepath.Join(root, p)) {
+				msg.secrets = append(msg.secrets, p)
+			}
+		}
+		return msg
+	}
+}
+
+// coverageView renders the uncovered files that look like secrets
+func (f *FileEditorView) coverageView() string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	source := "no .sops.yaml found"
+	if f.coverageConfig != "" {
+		source = "rules from " + f.coverageConfig
+	}
+	lines := []string{"Creation rule coverage of " + f.coverageRoot, dim.Render(source), ""}
+
+	switch c := f.coverage; {
+	case c == nil:
+		lines = append(lines, f.spinner.View()+" Comparing files with the rules...")
+	case c.err != nil:
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(c.err.Error()))
+	default:
+		lines = append(lines, fmt.Sprintf("%d file(s) covered, %d not covered by any rule", len(c.covered), len(c.uncovered)))
+		if len(c.secrets) == 0 {
+			lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render("Every file that looks like a secret is covered"))
+			break
+		}
+		lines = append(lines, "", lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).
+			Render(fmt.Sprintf("⚠ %d uncovered file(s) look like secrets:", len(c.secrets))))
+		for i, p := range c.secrets {
+			if i == coverageLimit {
+				lines = append(lines, dim.Render(fmt.Sprintf("  ... and %d more", len(c.secrets)-i)))
+				break
+			}
+			lines = append(lines, "  "+p)
+		}
+		lines = append(lines, "",
+			dim.Render("sops would encrypt these with only the keys given on its command line"),
+			"Press 'N' to add a rule for them",
+		)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, append(lines, "", "Press Esc to close")...)
+}
+
+// saveLabel writes the label of a file to its directory's sidecar; an empty
+// label removes it
+func (f *FileEditorView) saveLabel(path, label string) tea.Cmd {
+	return func() tea.Msg {
+		return labelSaved{path: path, label: label, err: sops.SetLabel(path, label)}
+	}
+}
+
+// viewFile decrypts the selected file into memory for the read-only viewer
+func (f *FileEditorView) viewFile(ctx context.Context) tea.Cmd {
+	path := f.selectedFile
+	cfg := f.cfg
+	return func() tea.Msg {
+		opts, err := keyOptions(cfg)
+		if err != nil {
+			return viewerReady{err: err}
+		}
+		data, err := sops.DecryptToMemory(path, append(opts, sops.WithContext(ctx))...)
+		return viewerReady{data: data, err: err}
+	}
+}
+
+// startExtract decrypts the value at the path entered, to view it or, with
+// copyValue, to put it on the clipboard
+func (f *FileEditorView) startExtract(copyValue bool) tea.Cmd {
+	treePath := strings.TrimSpace(f.treeInput.Value())
+	if treePath == "" {
+		return nil
+	}
+	f.treeInput.Blur()
+	f.operation = "view"
+	f.state = stateDecrypting
+	return tea.Batch(f.extractValue(f.startOperation(), treePath, copyValue), f.spinner.Tick)
+}
+
+// extractValue decrypts only the value at treePath of the selected file
+func (f *FileEditorView) extractValue(ctx context.Context, treePath string, copyValue bool) tea.Cmd {
+	path := f.selectedFile
+	cfg := f.cfg
+	return func() tea.Msg {
+		opts, err := keyOptions(cfg)
+		if err != nil {
+			return viewerReady{err: err}
+		}
+		data, err := sops.Extract(path, treePath, append(opts, sops.WithContext(ctx))...)
+		if err != nil || !copyValue {
+			return viewerReady{data: data, treePath: treePath, err: err}
+		}
+
+		method, err := clipboard.Copy(strings.TrimSuffix(string(data), "\n"))
+		if err != nil {
+			// Show the value instead so the action still achieves something
+			return viewerReady{data: data, treePath: treePath, copyErr: err}
+		}
+		utils.WipeBytes(data)
+		return valueCopied{treePath: treePath, method: method}
+	}
+}
+
+// extractView renders the path prompt with the paths that match what has
+// been typed so far
+func (f *FileEditorView) extractView() string {
+	lines := []string{
+		"Value of " + filepath.Base(f.selectedFile) + " to decrypt:",
+		f.treeInput.View(),
+		"",
+	}
+
+	typed := strings.TrimSpace(f.treeInput.Value())
+	var matches []string
+	for _, p := range f.treeInput.AvailableSuggestions() {
+		if strings.HasPrefix(p, typed) {
+			matches = append(matches, p)
+		}
+	}
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	for i, p := range matches {
+		if i == extractSuggestionLimit {
+			lines = append(lines, dim.Render(fmt.Sprintf("  ... and %d more", len(matches)-i)))
+			break
+		}
+		lines = append(lines, dim.Render("  "+p))
+	}
+	if len(matches) == 0 {
+		lines = append(lines, dim.Render("  No key starts with "+typed))
+	}
+
+	lines = append(lines,
+		"",
+		"Only this value is decrypted; the rest of the file stays encrypted",
+		"Press Enter to view it, ctrl+y to copy it, or Esc to cancel",
+	)
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// exportDefaults returns a target next to the selected file for each format
+// it can be converted to
+func (f *FileEditorView) exportDefaults() []string {
+	inputType := f.fileFormat()
+	var specs []string
+	for _, format := range sops.Formats {
+		if format != inputType && format != sops.FormatBinary && sops.ValidateOutputType(inputType, format) == nil {
+			specs = append(specs, decryptOutputPath(f.operationPath(), format))
+		}
+	}
+	return specs
+}
+
+// startExport parses the targets entered and moves on to the confirmation
+func (f *FileEditorView) startExport() tea.Cmd {
+	f.exportTargets = nil
+	for _, spec := range strings.Split(f.exportInput.Value(), ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		target, err := sops.ParseExportTarget(spec)
+		if err != nil {
+			f.exportErr = err.Error()
+			return nil
+		}
+		f.exportTargets = append(f.exportTargets, target)
+	}
+	if len(f.exportTargets) == 0 {
+		f.exportErr = "Enter at least one target"
+		return nil
+	}
+	f.exportInput.Blur()
+	f.exportOverwrite = false
+	f.operation = "export"
+	return f.proceed()
+}
+
+// exportInputView renders the prompt for the targets of an export
+func (f *FileEditorView) exportInputView() string {
+	lines := []string{
+		"Export " + filepath.Base(f.selectedFile) + " to:",
+		f.exportInput.View(),
+	}
+	if f.exportErr != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.exportErr))
+	}
+	var formats []string
+	for _, format := range sops.Formats {
+		if format != sops.FormatBinary {
+			formats = append(formats, format)
+		}
+	}
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	lines = append(lines,
+		"",
+		dim.Render("Each target's extension names its format; write format=path to choose another."),
+		dim.Render("Formats: "+strings.Join(formats, ", ")),
+		"The file is decrypted once and each target is written mode 0600.",
+		"",
+		"Press Enter to continue or Esc to cancel",
+	)
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// exportTargetsView lists the targets of the pending export and which of
+// them already exist
+func (f *FileEditorView) exportTargetsView() []string {
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+	lines := []string{"Targets:"}
+	exists := false
+	for _, target := range f.exportTargets {
+		line := fmt.Sprintf("  %s (%s)", target.Path, target.Format)
+		if utils.FileExists(target.Path) {
+			exists = true
+			if f.exportOverwrite {
+				line = warn.Render(line + ", exists and will be overwritten")
+			} else {
+				line += ", exists and will be skipped"
+			}
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "")
+	if exists && f.exportOverwrite {
+		lines = append(lines, "Press ctrl+w to skip existing targets instead", "")
+	} else if exists {
+		lines = append(lines, "Press ctrl+w to overwrite existing targets", "")
+	}
+	return lines
+}
+
+// exportFile decrypts the selected file once and writes it to each target
+func (f *FileEditorView) exportFile(ctx context.Context) tea.Cmd {
+	path := f.selectedFile
+	targets := f.exportTargets
+	overwrite := f.exportOverwrite
+	cfg := f.cfg
+	return func() tea.Msg {
+		opts, err := keyOptions(cfg)
+		if err != nil {
+			return exportComplete{err: err}
+		}
+		report, err := sops.ExportFile(path, targets, overwrite, append(opts, sops.WithContext(ctx))...)
+		return exportComplete{report: report, err: err}
+	}
+}
+
+// exportSummary describes a finished export of name, listing the targets
+// written, skipped and failed
+func exportSummary(name string, report *sops.Report) string {
+	lines := []string{"Exported " + name, report.Summary()}
+	for _, group := range []struct {
+		status, title string
+	}{
+		{sops.StatusOK, "Written:"},
+		{sops.StatusSkipped, "Skipped:"},
+		{sops.StatusFailed, "Errors:"},
+	} {
+		var outputs []string
+		for _, file := range report.Files {
+			if file.Status != group.status {
+				continue
+			}
+			if file.Error == "" {
+				outputs = append(outputs, "  "+file.Output)
+			} else {
+				outputs = append(outputs, "  "+file.Output+": "+file.Error)
+			}
+		}
+		if len(outputs) > 0 {
+			lines = append(lines, "", group.title)
+			lines = append(lines, outputs...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// archiveDirectory seals the chosen directory into a single encrypted archive
+// beside it
+func (f *FileEditorView) archiveDirectory(ctx context.Context) tea.Cmd {
+	dir := f.archiveDir
+	recipients := f.recipients
+	return func() tea.Msg {
+		outputPath := sops.ArchivePath(dir)
+		result, err := sops.EncryptDir(dir, outputPath, recipients, sops.WithContext(ctx))
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Sealed %s into %s\n%s", filepath.Base(dir), filepath.Base(outputPath), result.Summary()),
+		}
+	}
+}
+
+// restoreArchive extracts the directory sealed in the selected archive
+// beside it
+func (f *FileEditorView) restoreArchive(ctx context.Context) tea.Cmd {
+	archivePath := f.selectedFile
+	cfg := f.cfg
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		destDir := sops.ArchiveDir(archivePath)
+		result, err := sops.DecryptArchive(archivePath, destDir, append(keyOpts, sops.WithContext(ctx))...)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Restored %s into %s\n%s", filepath.Base(archivePath), filepath.Base(destDir), result.Summary()),
+		}
+	}
+}
+
+// rekeyTree re-keys every encrypted file in the chosen directory
+func (f *FileEditorView) rekeyTree(ctx context.Context) tea.Cmd {
+	dir := f.rekeyDir
+	recipients := f.recipients
+	// Files are re-keyed several at a time behind the TUI, with no terminal
+	// for sops to prompt on
+	opts := append([]sops.Option{sops.WithContext(ctx), sops.WithNonInteractive(f.cfg.SOPSTimeout), sops.WithGitScope(f.cfg.GitScope)}, f.backupOptions()...)
+	cfg := f.cfg
+	return func() tea.Msg {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			return rekeyComplete{err: err}
+		}
+		report, err := sops.ReEncryptTree(dir, recipients, append(keyOpts, opts...)...)
+		return rekeyComplete{report: report, err: err}
+	}
+}
+
+// resealStale re-encrypts the stale plaintext files found in the current
+// directory over their encrypted copies
+func (f *FileEditorView) resealStale(ctx context.Context) tea.Cmd {
+	paths := f.batchFiles
+	opts := []sops.Option{sops.WithContext(ctx), sops.WithNonInteractive(f.cfg.SOPSTimeout)}
+	return func() tea.Msg {
+		report, err := sops.ResealFiles(paths, opts...)
+		return resealComplete{report: report, err: err}
+	}
+}
+
+// encryptedStyle is how the configuration asks for encrypted files to be marked
+func encryptedStyle(cfg *config.Config) components.EncryptedStyle {
+	return components.EncryptedStyle{Marker: cfg.EncryptedMarker, Color: cfg.EncryptedColor}
+}
+
+// staleSibling returns the encrypted copy of the plaintext file at path when
+// the plaintext has changed since, or ""
+func staleSibling(path string) string {
+	if path == "" || !sops.IsStale(path) {
+		return ""
+	}
+	return sops.EncryptedSibling(path)
+}
+
+// protectedKeyNotice turns the user away from operating on a key file
+const protectedKeyNotice = "This is a protected key file: manage your age key from the Key Manager tab, not here"
+
+// touchesFile reports whether msg starts an operation that would encrypt,
+// decrypt, edit or re-key the selected file itself
+func (f *FileEditorView) touchesFile(msg tea.KeyMsg) bool {
+	if key.Matches(msg, f.keys.DecryptFile) {
+		// A decrypt with files ticked works on those, not the selection
+		return len(f.fileBrowser.Selection()) == 0
+	}
+	return key.Matches(msg, f.keys.EncryptFile) || key.Matches(msg, f.keys.EditFile) || key.Matches(msg, f.keys.Export) ||
+		key.Matches(msg, f.keys.Repair) || key.Matches(msg, f.keys.Recipients) || key.Matches(msg, f.keys.CopyFile)
+}
+
+// checkedOutFrom returns the encrypted file the working copy at path was
+// checked out from, or ""
+func checkedOutFrom(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	if checkout, ok := history.FindCheckout(abs); ok {
+		return checkout.Source
+	}
+	return ""
+}
+
+// hasReport reports whether the finished operation produced a batch report
+func (f *FileEditorView) hasReport() bool {
+	return f.lastReport != nil && (f.operation == "rekey" || f.operation == "batch-decrypt" || f.operation == "reseal" || f.operation == "export")
+}
+
+// batchTargets returns where each selected file is decrypted to
+func (f *FileEditorView) batchTargets() []sops.DecryptTarget {
+	targets := make([]sops.DecryptTarget, len(f.batchFiles))
+	for i, path := range f.batchFiles {
+		targets[i] = sops.DecryptTarget{Path: path}
+		if !f.batchInPlace {
+			targets[i].Output = decryptOutputPath(utils.RealPath(path), "")
+		}
+	}
+	return targets
+}
+
+// exposureView warns about the outputs whose directory other users can
+// write to, once per directory. Decrypted files are written with
+// sops.DecryptedFileMode either way; strict mode refuses these directories.
+func (f *FileEditorView) exposureView(outputs ...string) []string {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+	if f.cfg.StrictOutputDir {
+		style = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF0000"))
+	}
+
+	var lines []string
+	warned := make(map[string]bool)
+	for _, output := range outputs {
+		dir := filepath.Dir(output)
+		if warned[dir] {
+			continue
+		}
+		warned[dir] = true
+		if warning := sops.OutputExposure(output); warning != "" {
+			lines = append(lines, style.Render(warning))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	if f.cfg.StrictOutputDir {
+		lines = append(lines, "Strict Output Directory is on, so the decryption will be refused")
+	} else {
+		lines = append(lines, "Decrypted files are still only readable by you (mode 0600)")
+	}
+	return append(lines, "")
+}
+
+// batchTargetsView lists the selected files and their outputs
+func (f *FileEditorView) batchTargetsView() []string {
+	const shown = 10
+
+	var lines []string
+	for i, t := range f.batchTargets() {
+		if i == shown {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(f.batchFiles)-shown))
+			break
+		}
+		if t.Output == "" {
+			lines = append(lines, "  "+t.Path)
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s → %s", t.Path, filepath.Base(t.Output)))
+		}
+	}
+	return append(lines, "")
+}
+
+// batchStatesView lists the selected files of a running batch decryption
+// with where each one is: queued, running or its outcome. Running files come
+// first, then the queued ones, so the list shows what is happening now.
+func (f *FileEditorView) batchStatesView() []string {
+	const shown = 10
+
+	files := append([]string(nil), f.batchFiles...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return stateRank(f.batchStates[files[i]]) < stateRank(f.batchStates[files[j]])
+	})
+
+	var lines []string
+	for i, path := range files {
+		if i == shown {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(files)-shown))
+			break
+		}
+		state := f.batchStates[path]
+		if state == "" {
+			state = sops.JobQueued
+		}
+		lines = append(lines, fmt.Sprintf("  %-10s %s", batchStateLabel(state), filepath.Base(path)))
+	}
+	return append(lines, "")
+}
+
+// stateRank orders a batch file's state for batchStatesView
+func stateRank(state string) int {
+	switch state {
+	case sops.JobRunning:
+		return 0
+	case sops.JobQueued, "":
+		return 1
+	}
+	return 2
+}
+
+// batchStateLabel describes a queue state or file status in a few words
+func batchStateLabel(state string) string {
+	switch state {
+	case sops.StatusOK:
+		return "done"
+	case sops.StatusNoKey:
+		return "no key"
+	case sops.StatusFailed:
+		return "failed"
+	case sops.StatusSkipped:
+		return "skipped"
+	}
+	return state
+}
+
+// batchDecrypt decrypts the selected files with a bounded pool of workers,
+// reporting progress as each file finishes
+func (f *FileEditorView) batchDecrypt(ctx context.Context) tea.Cmd {
+	targets := f.batchTargets()
+	f.batchDone = 0
+	f.batchStates = make(map[string]string, len(targets))
+
+	// Without our public key every file is tried and sops reports the failures
+	publicKeys := ownPublicKeys(f.cfg)
+
+	// Room for each file's queued, running and finished events
+	events := make(chan tea.Msg, 3*len(targets)+1)
+	f.batchEvents = events
 
-		content = confirmStyle.Render(
-			lipgloss.JoinVertical(
-				lipgloss.Left,
-				fmt.Sprintf("Are you sure you want to %s?", action),
-				"",
-				"Press Enter to confirm or Esc to cancel",
-			),
-		)
+	opts := append([]sops.Option{
+		sops.WithContext(ctx),
+		sops.WithNonInteractive(f.cfg.SOPSTimeout),
+		sops.WithProgress(func(result sops.FileResult) {
+			events <- batchProgressMsg{result: result}
+		}),
+		sops.WithJobUpdates(func(job sops.Job) {
+			if job.State == sops.JobQueued || job.State == sops.JobRunning {
+				events <- batchJobMsg{job: job}
+			}
+		}),
+	}, f.backupOptions()...)
 
-	case stateEncrypting, stateDecrypting, stateEditing:
-		var operation string
-		switch f.state {
-		case stateEncrypting:
-			operation = "Encrypting"
-		case stateDecrypting:
-			operation = "Decrypting"
-		case stateEditing:
-			operation = "Opening"
+	cfg := f.cfg
+	go func() {
+		keyOpts, err := keyOptions(cfg)
+		if err != nil {
+			events <- batchDecryptComplete{err: err}
+			close(events)
+			return
 		}
+		report, err := sops.DecryptFiles(targets, publicKeys, sops.DefaultBatchWorkers, append(keyOpts, opts...)...)
+		events <- batchDecryptComplete{report: report, err: err}
+		close(events)
+	}()
 
-		content = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1).Render(
-			lipgloss.JoinVertical(
-				lipgloss.Left,
-				fmt.Sprintf("%s %s file...", f.spinner.View(), operation),
-				fmt.Sprintf("File: %s", f.selectedFile),
-			),
-		)
+	return f.waitForBatchEvent()
+}
 
-	case stateComplete:
-		content = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("#00AA00")).
-			Padding(1).
-			Render(
-				lipgloss.JoinVertical(
-					lipgloss.Left,
-					"Operation complete!",
-					"",
-					f.operationResult,
-					"",
-					"Press Enter to continue",
-				),
-			)
+// waitForBatchEvent delivers the next batch decryption event to the update loop
+func (f *FileEditorView) waitForBatchEvent() tea.Cmd {
+	events := f.batchEvents
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
 
-	case stateError:
-		content = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("#FF0000")).
-			Padding(1).
-			Render(
-				lipgloss.JoinVertical(
-					lipgloss.Left,
-					"Error:",
-					"",
-					fmt.Sprintf("%v", f.error),
-					"",
-					"Press Enter to continue",
-				),
-			)
+// batchSummary describes a finished batch operation under title, listing the
+// files with each of the given statuses apart from one another
+func (f *FileEditorView) batchSummary(title string, report *sops.Report, statuses ...string) string {
+	lines := []string{title, report.Summary()}
+
+	for _, status := range statuses {
+		var paths []string
+		for _, file := range report.Files {
+			if file.Status == status {
+				paths = append(paths, "  "+filepath.Base(file.Path)+": "+file.Error)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		switch status {
+		case sops.StatusNoKey:
+			lines = append(lines, "", "No matching key:")
+		case sops.StatusSkipped:
+			lines = append(lines, "", "Skipped:")
+		default:
+			lines = append(lines, "", "Errors:")
+		}
+		lines = append(lines, paths...)
 	}
+	return strings.Join(lines, "\n")
+}
 
-	// Show help if enabled
-	var helpView string
-	if f.showHelp {
-		helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
-		helpContent := "? - toggle help, q - quit/back"
+// saveReport writes the last batch report, as CSV for .csv paths and JSON otherwise
+func (f *FileEditorView) saveReport(path string, createDir bool) tea.Cmd {
+	report := f.lastReport
+	return func() tea.Msg {
+		path = utils.ExpandPath(path)
+		if createDir {
+			if err := sops.CreateOutputDir(path); err != nil {
+				return OperationErrorMsg{Error: err}
+			}
+		}
+		if err := sops.CheckOutputDir(path); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return OperationErrorMsg{Error: errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to create report file").WithCode(errors.CodeFileWriteFailed).WithData("path", path)}
+		}
+		defer file.Close()
 
-		switch f.state {
-		case stateFileSelect:
-			helpContent += ", e - encrypt, d - decrypt, E - edit"
-		case stateRecipientInput, stateConfirmation:
-			helpContent += ", Enter - confirm, Esc - cancel"
-		case stateComplete, stateError:
-			helpContent += ", Enter - continue"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			err = report.ToCSV(file)
+		} else {
+			err = report.ToJSON(file)
+		}
+		if err != nil {
+			return OperationErrorMsg{Error: errors.Wrap(err, errors.TypeFileOperation,
+				"Failed to write report").WithCode(errors.CodeFileWriteFailed).WithData("path", path)}
 		}
 
-		helpView = helpStyle.Render(helpContent)
+		return OperationCompleteMsg{Message: fmt.Sprintf("Saved report to %s", path)}
 	}
+}
 
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		titleStyle.Render("File Operations"),
-		content,
-		helpView,
-	)
+// checkOutputDir validates the directory of the path being typed. It is
+// only checked again once the directory changes, as checking writes a probe
+// file.
+func (f *FileEditorView) checkOutputDir() {
+	dir := filepath.Dir(utils.ExpandPath(strings.TrimSpace(f.pathInput.Value())))
+	if dir == f.outputDir {
+		return
+	}
+	f.outputDir = dir
+	f.outputErr = sops.CheckOutputDir(filepath.Join(dir, "report"))
+	f.createOutputDir = false
 }
 
-// getEncryptionStatusText returns a formatted text for encryption status
-func getEncryptionStatusText(info *sops.FileInfo) string {
-	if info.Encrypted {
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render("Encrypted")
+// outputDirView describes what is wrong with the directory of the path
+// being typed, or asks to create it when it is missing
+func (f *FileEditorView) outputDirView() string {
+	switch {
+	case f.outputErr == nil:
+		return ""
+	case errors.Code(f.outputErr) != errors.CodeDirNotFound:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(f.outputErr.Error())
+	case f.createOutputDir:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(
+			fmt.Sprintf("Press Enter again to create %s and save, or edit the path", f.outputDir))
+	default:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(
+			fmt.Sprintf("%s does not exist; Enter offers to create it", f.outputDir))
 	}
-	return lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render("Not encrypted")
 }
 
-// encryptFile encrypts the selected file
-func (f *FileEditorView) encryptFile() tea.Cmd {
+// resolveRecipients expands recipient tokens in the background
+func (f *FileEditorView) resolveRecipients(tokens []string) tea.Cmd {
 	return func() tea.Msg {
-		recipients := []string{f.recipientInput}
+		recipients, err := age.ResolveRecipients(tokens)
+		return recipientsResolved{recipients: recipients, err: err}
+	}
+}
 
-		// Extract filename for result message
-		filename := filepath.Base(f.selectedFile)
+// recipientsView lists the selected file's recipients by key group, with
+// the kind of each key
+func (f *FileEditorView) recipientsView() string {
+	lines := []string{fmt.Sprintf("Recipients of %s:", f.selectedFile), ""}
 
-		// Encrypt file
-		err := sops.EncryptFile(f.selectedFile, recipients, true)
-		if err != nil {
-			return OperationErrorMsg{Error: err}
+	index := 0
+	for i, g := range f.fileInfo.KeyGroups {
+		if len(f.fileInfo.KeyGroups) > 1 {
+			lines = append(lines, fmt.Sprintf("Group %d:", i+1))
 		}
+		for _, r := range g.Recipients {
+			line := fmt.Sprintf("  %-16s %s", age.KindName(r.KindOrAge()), truncateKey(r.Key, 60))
+			if index == f.recipientCursor {
+				line = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#1E88E5")).Render("> " + line[2:])
+			}
+			lines = append(lines, line)
+			index++
+		}
+	}
+	if index == 0 {
+		lines = append(lines, "  The file lists no recipients. Press F to repair them.")
+	}
 
-		return OperationCompleteMsg{
-			Message: fmt.Sprintf("Successfully encrypted %s", filename),
+	lines = append(lines, "",
+		"Press 'a' to add recipients of any kind, 'x' to remove the selected one,",
+		"'T' to test whether a key can decrypt the file, or Esc to go back",
+	)
+	if len(f.recipientTests) > 0 {
+		lines = append(lines, "", "Test results:")
+		lines = append(lines, f.recipientTests...)
+	}
+	if f.notice != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(f.notice))
+	}
+	return f.layout.box().Render(
+		lipgloss.JoinVertical(lipgloss.Left, lines...),
+	)
+}
+
+// testRecipients checks whether each recipient entered could decrypt the
+// selected file on its own. Only the metadata can be checked for others'
+// keys; ours is also tried end to end, by decrypting the file in memory.
+func (f *FileEditorView) testRecipients() tea.Cmd {
+	path := f.selectedFile
+	recipients := f.recipients
+	cfg := f.cfg
+	canVerify := f.hasDecryptedKey
+	f.textInput.Blur()
+
+	own := make(map[string]bool)
+	for _, key := range ownPublicKeys(cfg) {
+		own[key] = true
+	}
+	ctx := context.Background()
+	for _, r := range recipients {
+		if own[strings.TrimSpace(r.Key)] && canVerify {
+			f.state = stateDecrypting
+			ctx = f.startOperation()
+			break
+		}
+	}
+
+	return func() tea.Msg {
+		results := make([]recipientTest, len(recipients))
+		for i, r := range recipients {
+			result := recipientTest{recipient: r, own: own[strings.TrimSpace(r.Key)]}
+			result.ok, result.err = sops.CanRecipientDecrypt(path, r.String())
+			if result.ok && result.own && canVerify {
+				opts, err := keyOptions(cfg)
+				if err == nil {
+					err = sops.VerifyIntegrity(path, append(opts, sops.WithContext(ctx))...)
+				}
+				result.verified, result.err = err == nil, err
+			}
+			results[i] = result
 		}
+		return recipientsTested{results: results}
 	}
 }
 
-// decryptFile decrypts the selected file
-func (f *FileEditorView) decryptFile() tea.Cmd {
+// recipientTestLines describes the outcome of a recipient test, a line per
+// key; grouped is set when the file has several key groups
+func recipientTestLines(results []recipientTest, grouped bool) []string {
+	pass := lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00"))
+	fail := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+
+	var lines []string
+	for _, result := range results {
+		name := recipientLine(result.recipient)
+		if result.own {
+			name += " (your key)"
+		}
+		switch {
+		case result.verified:
+			lines = append(lines, pass.Render("  ✓ "+name+": decrypted in memory and the MAC matches"))
+		case result.ok && result.err != nil:
+			lines = append(lines, fail.Render(fmt.Sprintf("  ✗ %s is a recipient, but decrypting failed: %v", name, result.err)))
+		case result.ok && result.own:
+			lines = append(lines, pass.Render("  ✓ "+name+" is a recipient; decrypt your key to test it end to end"))
+		case result.ok:
+			lines = append(lines, pass.Render("  ✓ "+name+" is a recipient and can decrypt the file"))
+		case result.err != nil:
+			lines = append(lines, fail.Render(fmt.Sprintf("  ✗ %s: %v", name, result.err)))
+		case grouped:
+			lines = append(lines, fail.Render("  ✗ "+name+" cannot decrypt on its own: it is missing from the file or from too many of its key groups"))
+		default:
+			lines = append(lines, fail.Render("  ✗ "+name+" is not a recipient of this file"))
+		}
+	}
+	return lines
+}
+
+// loadMetadata reads the sops block of the selected file for the metadata viewer
+func (f *FileEditorView) loadMetadata() {
+	f.metadata, f.metadataErr = sops.ReadMetadata(f.selectedFile)
+	f.metadataDrift = nil
+	if f.metadataErr == nil {
+		f.metadataDrift, _ = sops.CheckDrift(f.selectedFile, f.metadata)
+	}
+}
+
+// loadRaw reads the raw content of path for the raw viewer
+func (f *FileEditorView) loadRaw(path string) tea.Cmd {
 	return func() tea.Msg {
-		// Extract filename for result message
-		filename := filepath.Base(f.selectedFile)
+		raw, err := sops.ReadRaw(path)
+		return rawLoaded{raw: raw, err: err}
+	}
+}
+
+// loadAccesses reads the decrypt history of the file at path
+func (f *FileEditorView) loadAccesses(path string) tea.Cmd {
+	return func() tea.Msg {
+		accesses, err := sops.AccessHistory(path)
+		return accessesLoaded{path: path, accesses: accesses, err: err}
+	}
+}
+
+// showAccesses puts the decrypt history in the viewport, a line per
+// decryption with the output it wrote below it
+func (f *FileEditorView) showAccesses() {
+	f.viewport.Width = max(20, f.layout.boxWidth(f.width-4)-2)
+	f.viewport.Height = max(3, f.height-16)
+
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	wrap := lipgloss.NewStyle().Width(f.viewport.Width)
 
-		// Generate output filename by removing .enc if present
-		outputPath := strings.TrimSuffix(f.selectedFile, ".enc")
-		if outputPath == f.selectedFile {
-			outputPath = f.selectedFile + ".dec"
+	var lines []string
+	for _, access := range f.accesses {
+		identity := "unknown identity"
+		if access.Identity != "" {
+			identity = age.Candidate{PublicKey: access.Identity, Source: access.Source}.Label()
 		}
+		lines = append(lines, wrap.Render(fmt.Sprintf("%s  %-7s  %s", access.Time.Local().Format("2006-01-02 15:04:05"), access.Action, identity)))
+		if access.Output != "" {
+			lines = append(lines, hintStyle.Render(wrap.Render("    → "+access.Output)))
+		}
+	}
+	f.viewport.SetContent(strings.Join(lines, "\n"))
+	f.viewport.GotoTop()
+}
 
-		// Decrypt file
-		err := sops.DecryptFile(f.selectedFile, false, outputPath)
-		if err != nil {
-			return OperationErrorMsg{Error: err}
+// accessesView shows when the selected file was decrypted and with which key
+func (f *FileEditorView) accessesView() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		fmt.Sprintf("Decryptions of %s, newest first (%d):", filepath.Base(f.selectedFile), len(f.accesses)),
+		hintStyle.Render("Only decryptions made with supper are recorded; no content is kept."),
+		"",
+		f.viewport.View(),
+		"",
+		hintStyle.Render(fmt.Sprintf("%3.f%% • ↑/↓ to scroll • Esc to close", f.viewport.ScrollPercent()*100)),
+	)
+}
+
+// showRaw puts the raw content in the viewport, sized to leave room for
+// the lines around it in rawView
+func (f *FileEditorView) showRaw() {
+	f.viewport.Width = max(20, f.layout.boxWidth(f.width-4)-2)
+	f.viewport.Height = max(3, f.height-16)
+	f.viewport.SetContent(f.raw.Text)
+}
+
+// rawView shows the selected file as it is stored on disk, ciphertext
+// included, without decrypting anything
+func (f *FileEditorView) rawView() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+
+	lines := []string{
+		fmt.Sprintf("Raw content of %s (read-only, nothing decrypted):", f.selectedFile),
+		hintStyle.Render(utils.FormatSize(f.raw.Size)),
+	}
+	switch {
+	case f.raw.Truncated:
+		lines = append(lines, warnStyle.Render(fmt.Sprintf("Showing the first %s only; the sops metadata at the end is not checked",
+			utils.FormatSize(sops.RawPreviewLimit))))
+	case f.raw.MetadataErr != nil:
+		lines = append(lines, warnStyle.Render("⚠ The sops metadata cannot be read: "+f.raw.MetadataErr.Error()))
+	default:
+		lines = append(lines, hintStyle.Render("The sops metadata is readable (m shows it)"))
+	}
+	lines = append(lines, "", f.viewport.View(), "")
+	lines = append(lines, hintStyle.Render(fmt.Sprintf("%3.f%% • ↑/↓ to scroll • Esc to close", f.viewport.ScrollPercent()*100)))
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// logResult adds the outcome of the operation that just finished to the
+// results panel, with each file's result for batch operations
+func (f *FileEditorView) logResult() {
+	entry := resultEntry{time: time.Now(), operation: f.operation, summary: f.operationResult}
+	if f.state == stateError {
+		entry.failed = true
+		entry.summary = fmt.Sprintf("%v", f.error)
+	}
+	if f.hasReport() {
+		entry.files = f.lastReport.Files
+		// The report lists the files, so only its title and counts are kept
+		if lines := strings.SplitN(entry.summary, "\n", 3); len(lines) > 1 && !entry.failed {
+			entry.summary = lines[0] + ": " + lines[1]
 		}
+	}
+	f.results = append([]resultEntry{entry}, f.results...)
+	if len(f.results) > resultsLimit {
+		f.results = f.results[:resultsLimit]
+	}
+}
 
-		return OperationCompleteMsg{
-			Message: fmt.Sprintf("Successfully decrypted %s to %s", filename, filepath.Base(outputPath)),
+// showResults puts the results panel in the viewport, sized to leave room
+// for the lines around it in resultsView
+func (f *FileEditorView) showResults() {
+	f.viewport.Width = max(20, f.layout.boxWidth(f.width-4)-2)
+	f.viewport.Height = max(3, f.height-14)
+
+	okStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00"))
+	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	wrap := lipgloss.NewStyle().Width(f.viewport.Width)
+
+	var lines []string
+	for i, entry := range f.results {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		header := okStyle.Render(entry.time.Format("15:04:05") + " ✓ " + entry.operation)
+		if entry.failed {
+			header = failStyle.Render(entry.time.Format("15:04:05") + " ✗ " + entry.operation)
+		}
+		lines = append(lines, header)
+		for _, line := range strings.Split(entry.summary, "\n") {
+			lines = append(lines, wrap.Render("  "+line))
+		}
+		for _, file := range entry.files {
+			name := file.Path
+			if file.Output != "" {
+				name += " → " + file.Output
+			}
+			line := fmt.Sprintf("    %-9s %s", file.Status, name)
+			if file.Error != "" {
+				line += ": " + file.Error
+			}
+			switch file.Status {
+			case sops.StatusOK, sops.StatusUnchanged:
+				lines = append(lines, wrap.Render(line))
+			case sops.StatusSkipped:
+				lines = append(lines, hintStyle.Render(wrap.Render(line)))
+			default:
+				lines = append(lines, failStyle.Render(wrap.Render(line)))
+			}
+		}
+	}
+	f.viewport.SetContent(strings.Join(lines, "\n"))
+	f.viewport.GotoTop()
+}
+
+// resultsView lists the outcomes of the operations of this session
+func (f *FileEditorView) resultsView() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		fmt.Sprintf("Operation results of this session, newest first (%d):", len(f.results)),
+		"",
+		f.viewport.View(),
+		"",
+		hintStyle.Render(fmt.Sprintf("%3.f%% • ↑/↓ to scroll • x to clear • Esc to close", f.viewport.ScrollPercent()*100)),
+	)
+}
+
+// metadataView shows the sops block of the selected file, read without
+// decrypting anything
+func (f *FileEditorView) metadataView() string {
+	labelStyle := lipgloss.NewStyle().Bold(true)
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+
+	lines := []string{fmt.Sprintf("sops metadata of %s:", f.selectedFile), ""}
+	if f.metadataErr != nil {
+		lines = append(lines, errors.FormatErrorForDisplay(f.metadataErr), "", hintStyle.Render("Press Esc to go back"))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
+	}
+
+	md := f.metadata
+	field := func(name, value string) string {
+		if value == "" {
+			value = hintStyle.Render("(not set)")
+		}
+		return fmt.Sprintf("%s %s", labelStyle.Render(fmt.Sprintf("%-14s", name)), value)
+	}
+	lines = append(lines,
+		field("Version:", md.Version),
+		field("Last modified:", md.LastModified),
+		field("MAC:", truncateKey(md.MAC, 60)),
+	)
+	if len(md.KeyGroups) > 1 {
+		threshold := md.ShamirThreshold
+		if threshold <= 0 {
+			threshold = len(md.KeyGroups)
+		}
+		lines = append(lines, field("Key groups:", fmt.Sprintf("%d, %d needed to decrypt", len(md.KeyGroups), threshold)))
+	}
+
+	lines = append(lines, "", labelStyle.Render("Recipients:"))
+	for i, g := range md.KeyGroups {
+		if len(md.KeyGroups) > 1 {
+			lines = append(lines, fmt.Sprintf("Group %d:", i+1))
+		}
+		for _, r := range g.Recipients {
+			lines = append(lines, fmt.Sprintf("  %-16s %s", age.KindName(r.KindOrAge()), truncateKey(r.Key, 60)))
+		}
+	}
+	if len(md.AllRecipients()) == 0 {
+		lines = append(lines, "  "+warnStyle.Render("None: no key can decrypt the file"))
+	}
+
+	lines = append(lines, "")
+	switch drift := f.metadataDrift; {
+	case drift == nil:
+		lines = append(lines, hintStyle.Render("No .sops.yaml rule applies to the file, so there is nothing to compare against."))
+	case drift.Drifted():
+		lines = append(lines, warnStyle.Render("The recipients differ from the rule in "+drift.ConfigPath+":"))
+		for _, r := range drift.Missing {
+			lines = append(lines, "  missing "+truncateKey(r.Key, 60))
+		}
+		for _, r := range drift.Extra {
+			lines = append(lines, "  extra   "+truncateKey(r.Key, 60))
+		}
+	default:
+		lines = append(lines, hintStyle.Render("The age recipients match the rule in "+drift.ConfigPath+"."))
+	}
+
+	lines = append(lines, "")
+	if f.metadataDrift != nil {
+		lines = append(lines, hintStyle.Render("Press 'F' to regenerate it from the rule (sops updatekeys) or Esc to go back"))
+	} else {
+		lines = append(lines, hintStyle.Render("Press Esc to go back"))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// recipientLine shows a recipient's key, and the alias, GitHub user or URL
+// it was resolved from when it was not entered directly
+func recipientLine(r age.Recipient) string {
+	if r.Source == "" || r.Source == "input" {
+		return truncateKey(r.String(), 60)
+	}
+	return fmt.Sprintf("%s → %s", r.Source, truncateKey(r.String(), 60))
+}
+
+// truncateKey shortens long public keys for display
+func truncateKey(key string, max int) string {
+	if len(key) <= max {
+		return key
+	}
+	return key[:max-3] + "..."
+}
+
+// operationPath returns the path operations on the selected file act on,
+// following a symlink when the settings say so
+func (f *FileEditorView) operationPath() string {
+	path, err := sops.ResolvePath(f.selectedFile)
+	if err != nil {
+		return f.selectedFile
+	}
+	return path
+}
+
+// decryptOutputPath derives the output filename for a decrypted file
+func decryptOutputPath(path, outputType string) string {
+	// Generate output filename by removing .enc, or the .age of a file
+	// encrypted with age itself, if present
+	outputPath := strings.TrimSuffix(strings.TrimSuffix(path, ".enc"), ".age")
+	if outputType != "" && outputType != sops.FormatFromPath(path) {
+		outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + sops.FormatExtension(outputType)
+	}
+	if outputPath == path {
+		outputPath = path + ".dec"
+	}
+	return outputPath
+}
+
+// fileFormat returns the format sops treats the selected file as
+func (f *FileEditorView) fileFormat() string {
+	if f.fileInfo != nil && f.fileInfo.Format != "" {
+		return f.fileInfo.Format
+	}
+	return sops.FormatFromPath(f.selectedFile)
+}
+
+// ageEncrypted reports whether the selected file was encrypted with age
+// itself rather than by sops
+func (f *FileEditorView) ageEncrypted() bool {
+	return f.fileInfo != nil && f.fileInfo.AgeEncrypted
+}
+
+// binaryContent reports whether the selected file is handled as binary even
+// though its name suggests a structured format
+func (f *FileEditorView) binaryContent() bool {
+	return !f.ageEncrypted() && f.fileFormat() == sops.FormatBinary && sops.FormatFromPath(f.selectedFile) != sops.FormatBinary
+}
+
+// nextOutputType returns the next output format compatible with the input format
+func nextOutputType(inputType, current string) string {
+	choices := []string{""}
+	for _, format := range sops.Formats {
+		if format != inputType && sops.ValidateOutputType(inputType, format) == nil {
+			choices = append(choices, format)
+		}
+	}
+
+	for i, choice := range choices {
+		if choice == current {
+			return choices[(i+1)%len(choices)]
 		}
 	}
+	return ""
 }
 
 // editFile opens the encrypted file in an editor
@@ -399,23 +4379,168 @@ func (f *FileEditorView) editFile() tea.Cmd {
 		filename := filepath.Base(f.selectedFile)
 
 		// Edit file
-		err := sops.EditFile(f.selectedFile)
+		opts, err := keyOptions(f.cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		// Check the editor first, so a missing one fails before sops starts
+		editor, warning, err := sops.ResolveEditor(f.cfg.EditorCommand, f.cfg.EditorFallback)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		opts = append(opts, sops.WithEditor(editor))
+		err = sops.EditFile(f.selectedFile, append(opts, f.backupOptions()...)...)
 		if err != nil {
 			return OperationErrorMsg{Error: err}
 		}
 
+		message := fmt.Sprintf("Successfully edited %s", filename)
+		if warning != "" {
+			message += "\nWarning: " + warning
+		}
 		return OperationCompleteMsg{
-			Message: fmt.Sprintf("Successfully edited %s", filename),
+			Message: message,
 		}
 	}
 }
 
-// checkKeyStatus checks if a decrypted key exists
-func (f *FileEditorView) checkKeyStatus() tea.Cmd {
+// openInlineEditor decrypts the selected file into memory for the built-in
+// editor
+func (f *FileEditorView) openInlineEditor(ctx context.Context) tea.Cmd {
+	path := f.selectedFile
+	cfg := f.cfg
+	return func() tea.Msg {
+		opts, err := keyOptions(cfg)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		plaintext, err := sops.DecryptForEdit(path, append(opts, sops.WithContext(ctx))...)
+		if err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return inlineEditReady{plaintext: plaintext}
+	}
+}
+
+// saveInlineEdit encrypts the text edited in the built-in editor back over
+// the selected file, piping it to sops so it never touches the disk, and
+// wipes it
+func (f *FileEditorView) saveInlineEdit(ctx context.Context, plaintext *secure.Buffer) tea.Cmd {
+	path := f.selectedFile
+	cfg := f.cfg
+	backup := f.backupOptions()
 	return func() tea.Msg {
-		f.hasDecryptedKey = age.IsKeyDecrypted()
+		opts, err := keyOptions(cfg)
+		if err != nil {
+			plaintext.Wipe()
+			return OperationErrorMsg{Error: err}
+		}
+		opts = append(opts, sops.WithContext(ctx))
+		if err := sops.SaveEdit(path, plaintext, append(opts, backup...)...); err != nil {
+			return OperationErrorMsg{Error: err}
+		}
+		return OperationCompleteMsg{
+			Message: fmt.Sprintf("Successfully edited %s", filepath.Base(path)),
+		}
+	}
+}
+
+// useRecipientsFrom fills the recipient input with the recipients of the
+// encrypted file at path, picked in the browser, so a new file can be
+// encrypted for the same people
+func (f *FileEditorView) useRecipientsFrom(path string, info *sops.FileInfo) tea.Cmd {
+	if info == nil {
+		var err error
+		if info, err = sops.GetFileInfo(path); err != nil {
+			f.notice = fmt.Sprintf("Failed to read %s: %v", filepath.Base(path), err)
+			return nil
+		}
+	}
+	if !info.Encrypted {
+		f.notice = fmt.Sprintf("%s is not encrypted; pick an encrypted file", filepath.Base(path))
+		return nil
+	}
+	recipients := info.AllRecipients()
+	if len(recipients) == 0 {
+		f.notice = fmt.Sprintf("%s lists no recipients to copy", filepath.Base(path))
 		return nil
 	}
+
+	tokens := make([]string, len(recipients))
+	for i, r := range recipients {
+		tokens[i] = r.String()
+	}
+	f.recipientSource = path
+	f.sourceInput = strings.Join(tokens, ", ")
+	f.textInput.SetValue(f.sourceInput)
+	f.textInput.CursorEnd()
+	f.notice = ""
+	f.state = stateRecipientInput
+	return f.textInput.Focus()
+}
+
+// ownKeysLoaded carries our public keys to the file browser
+type ownKeysLoaded struct {
+	keys []string
+}
+
+// checkKeyStatus checks if the key can be used, either decrypted on disk or
+// unlocked in memory with the cached session passphrase
+func (f *FileEditorView) checkKeyStatus() tea.Cmd {
+	cfg := f.cfg
+	return func() tea.Msg {
+		f.hasDecryptedKey = age.IsKeyDecrypted() || age.PassphraseCached()
+		return ownKeysLoaded{keys: ownPublicKeys(cfg)}
+	}
+}
+
+// ownPublicKeys returns our public key, from the decrypted key or, when the
+// key is only unlocked in memory, from the encrypted key's header. It is nil
+// when we have no key.
+func ownPublicKeys(cfg *config.Config) []string {
+	if publicKey, err := age.PublicKeyFromFile(cfg.KeyPath); err == nil {
+		return []string{publicKey}
+	}
+	if publicKey, err := age.LoadPublicKey(cfg.EncryptedKeyPath); err == nil && publicKey != "" {
+		return []string{publicKey}
+	}
+	return nil
+}
+
+// keyOptions returns the sops options that give an operation our key. sops
+// finds a decrypted key at its default location by itself, one elsewhere is
+// passed explicitly; otherwise the key is unlocked in memory with the cached
+// session passphrase.
+func keyOptions(cfg *config.Config) ([]sops.Option, error) {
+	if identity, ok := age.ConfiguredIdentity(cfg.KeyPath); ok {
+		return []sops.Option{sops.WithIdentity(identity)}, nil
+	}
+	if age.IsKeyDecrypted() || !age.PassphraseCached() {
+		return nil, nil
+	}
+	identity, err := age.SessionIdentity(cfg.EncryptedKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return []sops.Option{sops.WithIdentity(identity)}, nil
+}
+
+// identityCandidates lists every age identity available to try on its own,
+// including our key when it is only unlocked in memory
+func identityCandidates(cfg *config.Config) []age.Candidate {
+	candidates := age.AvailableIdentities(cfg.KeyPath)
+	if !age.PassphraseCached() {
+		return candidates
+	}
+	identity, err := age.SessionIdentity(cfg.EncryptedKeyPath)
+	if err != nil {
+		return candidates
+	}
+	unlocked, err := identity.Candidates("unlocked key")
+	if err != nil {
+		return candidates
+	}
+	return age.AppendCandidates(candidates, unlocked...)
 }
 
 // OperationCompleteMsg is sent when an operation completes successfully
@@ -8,10 +8,15 @@ import (
 	"time"
 
 	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/clipboard"
+	"github.com/bxtal-lsn/supper/internal/config"
 	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/sops"
 	"github.com/bxtal-lsn/supper/internal/ui/components"
+	"github.com/bxtal-lsn/supper/internal/utils"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -25,6 +30,8 @@ const (
 	StateConfirmPassphrase
 	StateDecryptingKey
 	StateDeletingKey
+	StateSnippets
+	StateKeyGenerated
 )
 
 // Key manager events
@@ -38,8 +45,28 @@ type keyDecrypted struct {
 	err error // Add error field to event
 }
 
+// keyUnlocked is sent when the passphrase has been checked and cached for the session
+type keyUnlocked struct {
+	publicKey string
+	err       error
+}
+
 type keyDeleted struct {
-	err error // Add error field to event
+	result *utils.WipeResult
+	err    error // Add error field to event
+}
+
+// autoDeleteDue fires when the decrypted key has been kept for the auto-delete
+// interval. Rescheduling bumps the epoch, so timers from an earlier schedule
+// are ignored.
+type autoDeleteDue struct {
+	epoch int
+}
+
+// autoDeleteWarn fires the auto-delete warning's lead time before the
+// decrypted key is due to be deleted
+type autoDeleteWarn struct {
+	epoch int
 }
 
 // KeyManagerView is the view for managing age keys
@@ -50,6 +77,7 @@ type KeyManagerView struct {
 	passphraseInput    *components.PassphraseInput
 	width              int
 	height             int
+	layout             LayoutMsg
 	state              int
 	keyPair            *age.KeyPair
 	encryptedKeyPath   string
@@ -57,7 +85,19 @@ type KeyManagerView struct {
 	hasDecryptedKey    bool
 	keyDecryptedTime   time.Time
 	autoDeleteInterval time.Duration
+	autoDeleteWarning  time.Duration // Lead time of the warning before auto-deletion; 0 for none
+	autoDeleteEpoch    int
+	expiring           bool // The auto-delete warning is showing
+	status             string
 	err                error
+	failedAttempts     int // Wrong passphrases entered at the current prompt
+
+	// Recipient snippets for the key in snippetInput, ours by default
+	snippetInput  textinput.Model
+	snippets      []sops.Snippet
+	snippetCursor int
+	snippetErr    error
+	copyFallback  string
 }
 
 // NewKeyManagerView creates a new key manager view
@@ -66,13 +106,19 @@ func NewKeyManagerView() *KeyManagerView {
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
 	return &KeyManagerView{
 		keys:               DefaultKeyMap(),
 		spinner:            s,
 		state:              StateIdle,
-		encryptedKeyPath:   age.DefaultEncryptedKeyPath(),
-		decryptedKeyPath:   age.DefaultKeyPath(),
-		autoDeleteInterval: 30 * time.Minute, // Auto-delete decrypted key after 30 minutes
+		encryptedKeyPath:   cfg.EncryptedKeyPath,
+		decryptedKeyPath:   cfg.KeyPath,
+		autoDeleteInterval: cfg.AutoDeleteInterval,
+		autoDeleteWarning:  cfg.AutoDeleteWarning,
 	}
 }
 
@@ -95,9 +141,22 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		k.viewport = viewport.New(msg.Width, msg.Height-5)
 		k.viewport.YPosition = 2
 
+	case LayoutMsg:
+		k.layout = msg
+
 	case tea.KeyMsg:
 		// Global key handlers
 		switch {
+		case k.state == StateSnippets:
+			return k, k.updateSnippets(msg)
+
+		case k.state == StateKeyGenerated:
+			return k, k.updateSummary(msg)
+
+		case key.Matches(msg, k.keys.Snippets) && k.state == StateIdle:
+			k.openSnippets()
+			return k, textinput.Blink
+
 		case key.Matches(msg, k.keys.GenerateKey) && k.state == StateIdle:
 			k.state = StateInputPassphrase
 			k.passphraseInput = components.NewPassphraseInput("Enter passphrase for new key", true)
@@ -105,16 +164,31 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, k.keys.DecryptKey) && k.state == StateIdle:
 			if _, err := os.Stat(k.encryptedKeyPath); os.IsNotExist(err) {
-				k.err = errors.Wrap(err, errors.TypeFileOperation, "No encrypted key found")
+				k.err = errors.Wrap(err, errors.TypeFileOperation, "No encrypted key found").WithCode(errors.CodeAgeNoEncryptedKey)
 				return k, nil
 			}
 			k.state = StateDecryptingKey
 			k.passphraseInput = components.NewPassphraseInput("Enter passphrase to decrypt key", false)
+			k.failedAttempts = 0
 			return k, k.passphraseInput.Init()
 
+		case key.Matches(msg, k.keys.DeleteKey) && k.state == StateIdle && k.hasDecryptedKey && !utils.FileExists(k.encryptedKeyPath):
+			// Older setups keep only the plaintext key; deleting it would lose it
+			k.err = errors.New(errors.TypeKeyManagement,
+				"This key has no encrypted copy, so deleting it would lose it. Press 'P' on the Dashboard to encrypt it first").
+				WithCode(errors.CodeAgeNoEncryptedKey).WithData("path", k.decryptedKeyPath)
+			return k, nil
+
 		case key.Matches(msg, k.keys.DeleteKey) && k.state == StateIdle && k.hasDecryptedKey:
+			age.ForgetPassphrase()
 			k.state = StateDeletingKey
 			return k, k.deleteDecryptedKey()
+
+		case key.Matches(msg, k.keys.DeleteKey) && k.state == StateIdle && age.PassphraseCached():
+			age.ForgetPassphrase()
+			k.keyPair = nil
+			k.status = "Cached passphrase wiped from memory"
+			return k, nil
 		}
 
 	case spinner.TickMsg:
@@ -126,9 +200,18 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		k.keyPair = msg.keyPair
 		k.err = msg.err // Handle possible error from key generation
 		k.state = StateIdle
+		if msg.err == nil {
+			// Show the new key once, so it can be shared straight away
+			k.state = StateKeyGenerated
+			k.status = ""
+			k.copyFallback = ""
+		}
 		cmds = append(cmds, k.checkKeyStatus())
 
 	case keyDecrypted:
+		if cmd := k.retryPassphrase(msg.err); cmd != nil {
+			return k, cmd
+		}
 		k.state = StateIdle
 		if msg.err != nil {
 			k.err = msg.err
@@ -136,15 +219,67 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			k.err = nil
 			k.keyDecryptedTime = time.Now()
 			// Set a timer to auto-delete the key
-			cmds = append(cmds, tea.Tick(k.autoDeleteInterval, func(t time.Time) tea.Msg {
-				return tea.KeyMsg{Type: tea.KeyCtrlD}
-			}))
+			cmds = append(cmds, k.scheduleAutoDelete())
 		}
 		cmds = append(cmds, k.checkKeyStatus())
 
+	case keyUnlocked:
+		if cmd := k.retryPassphrase(msg.err); cmd != nil {
+			return k, cmd
+		}
+		k.state = StateIdle
+		k.err = msg.err
+		if msg.err == nil {
+			k.keyPair = &age.KeyPair{PublicKey: msg.publicKey, IsEncrypted: true}
+			k.status = "Passphrase cached in memory; the key stays encrypted on disk"
+		}
+
+	case autoDeleteDue:
+		if msg.epoch != k.autoDeleteEpoch || !k.hasDecryptedKey {
+			break
+		}
+		if k.state != StateIdle {
+			// Don't interrupt a passphrase prompt; try again shortly
+			epoch := msg.epoch
+			cmds = append(cmds, tea.Tick(time.Second, func(time.Time) tea.Msg { return autoDeleteDue{epoch: epoch} }))
+			break
+		}
+		k.expiring = false
+		k.state = StateDeletingKey
+		cmds = append(cmds, k.deleteDecryptedKey())
+
+	case autoDeleteWarn:
+		if msg.epoch == k.autoDeleteEpoch && k.hasDecryptedKey {
+			k.expiring = true
+		}
+
+	case ConfigSavedMsg:
+		if msg.Config.EncryptedKeyPath != k.encryptedKeyPath || msg.Config.KeyPath != k.decryptedKeyPath {
+			k.encryptedKeyPath = msg.Config.EncryptedKeyPath
+			k.decryptedKeyPath = msg.Config.KeyPath
+			k.keyPair = nil
+			cmds = append(cmds, k.checkKeyStatus())
+		}
+		if msg.Config.AutoDeleteInterval == k.autoDeleteInterval && msg.Config.AutoDeleteWarning == k.autoDeleteWarning {
+			break
+		}
+		k.autoDeleteInterval = msg.Config.AutoDeleteInterval
+		k.autoDeleteWarning = msg.Config.AutoDeleteWarning
+		k.expiring = false
+		// Only keys decrypted in this session have a timer to reschedule
+		if k.hasDecryptedKey && !k.keyDecryptedTime.IsZero() {
+			k.status = fmt.Sprintf("Auto-delete interval changed to %s", k.autoDeleteInterval)
+			cmds = append(cmds, k.scheduleAutoDelete())
+		}
+
 	case keyDeleted:
+		k.expiring = false
 		k.state = StateIdle
 		k.err = msg.err // Handle possible error from key deletion
+		k.status = ""
+		if msg.result != nil {
+			k.status = "Key securely deleted (" + msg.result.String() + ")"
+		}
 		cmds = append(cmds, k.checkKeyStatus())
 
 	case components.PassphraseConfirmedMsg:
@@ -155,6 +290,9 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				k.spinner.Tick,
 			)
 		case StateDecryptingKey:
+			if age.PassphraseCachingEnabled() {
+				return k, tea.Batch(k.unlockKey(msg.Passphrase), k.spinner.Tick)
+			}
 			return k, tea.Batch(
 				k.decryptKey(msg.Passphrase),
 				k.spinner.Tick,
@@ -163,9 +301,26 @@ func (k *KeyManagerView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case components.PassphraseCancelledMsg:
 		k.state = StateIdle
+
+	case copyResult:
+		k.copyFallback = ""
+		switch {
+		case msg.err != nil:
+			k.status = fmt.Sprintf("Could not copy %s: %v", msg.what, msg.err)
+			k.copyFallback = components.CopyFallback(msg.what, msg.value)
+		case msg.method == clipboard.MethodOSC52:
+			k.status = fmt.Sprintf("Sent %s to the terminal clipboard (OSC 52)", msg.what)
+		default:
+			k.status = fmt.Sprintf("Copied %s to clipboard", msg.what)
+		}
 	}
 
-	// Update sub-components
+	// Update sub-components; keys for the snippet input were handled above
+	if _, isKey := msg.(tea.KeyMsg); !isKey && k.state == StateSnippets {
+		var cmd tea.Cmd
+		k.snippetInput, cmd = k.snippetInput.Update(msg)
+		cmds = append(cmds, cmd)
+	}
 	if k.passphraseInput != nil && (k.state == StateInputPassphrase || k.state == StateDecryptingKey) {
 		newModel, cmd := k.passphraseInput.Update(msg)
 		if updatedModel, ok := newModel.(*components.PassphraseInput); ok {
@@ -192,6 +347,10 @@ func (k *KeyManagerView) View() string {
 		}
 	case StateDeletingKey:
 		content = fmt.Sprintf("%s Securely deleting key...", k.spinner.View())
+	case StateSnippets:
+		content = k.renderSnippets()
+	case StateKeyGenerated:
+		content = k.renderSummary()
 	}
 
 	return lipgloss.JoinVertical(
@@ -201,11 +360,184 @@ func (k *KeyManagerView) View() string {
 	)
 }
 
+// CapturingInput reports whether the passphrase or snippet input currently has focus
+func (k *KeyManagerView) CapturingInput() bool {
+	if k.state == StateSnippets {
+		return true
+	}
+	return k.passphraseInput != nil && (k.state == StateInputPassphrase || k.state == StateDecryptingKey)
+}
+
+// ShortHelp returns the keys of the current step for the hint bar
+func (k *KeyManagerView) ShortHelp() []key.Binding {
+	switch {
+	case k.state == StateSnippets:
+		return []key.Binding{relabel(k.keys.Enter, "copy"), relabel(k.keys.Cancel, "close")}
+	case k.state == StateKeyGenerated:
+		return []key.Binding{k.keys.CopyKey, k.keys.CopyPrint, relabel(k.keys.Enter, "done")}
+	case k.CapturingInput():
+		return []key.Binding{relabel(k.keys.Enter, "confirm"), k.keys.Cancel}
+	}
+	return []key.Binding{k.keys.GenerateKey, k.keys.DecryptKey, k.keys.DeleteKey, k.keys.Snippets}
+}
+
+// FullHelp returns every key manager key
+func (k *KeyManagerView) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.keys.GenerateKey, k.keys.DecryptKey, k.keys.DeleteKey, k.keys.Snippets}}
+}
+
+// openSnippets shows the recipient snippets, starting with our public key
+func (k *KeyManagerView) openSnippets() {
+	input := textinput.New()
+	input.Prompt = "Public key: "
+	input.Placeholder = "age1... (paste a teammate's key, separate several with commas)"
+	input.Width = 70
+	input.SetValue(k.ownPublicKey())
+	input.Focus()
+
+	k.state = StateSnippets
+	k.snippetInput = input
+	k.snippetCursor = 0
+	k.copyFallback = ""
+	k.status = ""
+	k.refreshSnippets()
+}
+
+// ownPublicKey returns our public key, or "" when there is no key yet
+func (k *KeyManagerView) ownPublicKey() string {
+	if k.keyPair != nil && k.keyPair.PublicKey != "" {
+		return k.keyPair.PublicKey
+	}
+	if publicKey, err := age.LoadPublicKey(k.encryptedKeyPath); err == nil {
+		return publicKey
+	}
+	if publicKey, err := age.PublicKeyFromFile(k.decryptedKeyPath); err == nil {
+		return publicKey
+	}
+	return ""
+}
+
+// refreshSnippets formats the keys currently entered
+func (k *KeyManagerView) refreshSnippets() {
+	k.snippets, k.snippetErr = sops.RecipientSnippets(strings.Split(k.snippetInput.Value(), ","))
+	k.snippetCursor = min(k.snippetCursor, max(0, len(k.snippets)-1))
+}
+
+// updateSnippets chooses a snippet and copies it, passing other keys to the input
+func (k *KeyManagerView) updateSnippets(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, k.keys.Cancel):
+		k.state = StateIdle
+		k.snippets = nil
+		k.copyFallback = ""
+		return nil
+	case msg.String() == "up":
+		k.snippetCursor = max(0, k.snippetCursor-1)
+		return nil
+	case msg.String() == "down":
+		k.snippetCursor = min(len(k.snippets)-1, k.snippetCursor+1)
+		return nil
+	case key.Matches(msg, k.keys.Enter):
+		if len(k.snippets) == 0 {
+			return nil
+		}
+		snippet := k.snippets[k.snippetCursor]
+		return copyToClipboard(strings.ToLower(snippet.Name), snippet.Text)
+	}
+
+	var cmd tea.Cmd
+	k.snippetInput, cmd = k.snippetInput.Update(msg)
+	k.refreshSnippets()
+	return cmd
+}
+
+// renderSnippets renders the snippet chooser
+func (k *KeyManagerView) renderSnippets() string {
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	nameStyle := lipgloss.NewStyle().Bold(true)
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#1E88E5"))
+	boxStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+
+	lines := []string{"Recipient snippets", "", k.snippetInput.View(), ""}
+
+	if k.snippetErr != nil {
+		lines = append(lines, errors.FormatErrorForDisplay(k.snippetErr))
+	}
+	for i, snippet := range k.snippets {
+		name := "  " + nameStyle.Render(snippet.Name)
+		if i == k.snippetCursor {
+			name = selectedStyle.Render("▸ " + snippet.Name)
+		}
+		lines = append(lines, name, boxStyle.Render(snippet.Text))
+	}
+
+	if k.status != "" {
+		lines = append(lines, "", hintStyle.Render(k.status))
+	}
+	if k.copyFallback != "" {
+		lines = append(lines, "", k.copyFallback)
+	}
+	lines = append(lines, "", hintStyle.Render("↑/↓: Choose format • Enter: Copy • Esc: Back"))
+
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// updateSummary handles keys on the summary shown after a key is generated
+func (k *KeyManagerView) updateSummary(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, k.keys.CopyKey) && k.keyPair != nil:
+		return copyToClipboard("public key", k.keyPair.PublicKey)
+	case key.Matches(msg, k.keys.CopyPrint) && k.keyPair != nil:
+		return copyToClipboard("fingerprint", age.Fingerprint(k.keyPair.PublicKey))
+	case key.Matches(msg, k.keys.Enter), key.Matches(msg, k.keys.Cancel):
+		k.state = StateIdle
+		k.status = ""
+		k.copyFallback = ""
+	}
+	return nil
+}
+
+// renderSummary renders the summary shown once after a key is generated
+func (k *KeyManagerView) renderSummary() string {
+	if k.keyPair == nil {
+		return ""
+	}
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	warnStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFA500"))
+	boxStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#00AA00")).Render("✓ New age key generated"),
+		"",
+		"Public key (share this with anyone who encrypts files for you):",
+		boxStyle.Render(k.keyPair.PublicKey),
+		fmt.Sprintf("Fingerprint:     %s", age.Fingerprint(k.keyPair.PublicKey)),
+		fmt.Sprintf("Algorithm:       %s", age.KeyAlgorithm),
+		fmt.Sprintf("Encrypted key:   %s", k.encryptedKeyPath),
+		fmt.Sprintf("Public key file: %s", age.PublicKeyPath(k.encryptedKeyPath)),
+		fmt.Sprintf("Decrypted key:   %s", k.decryptedKeyPath),
+		"",
+		warnStyle.Render("Back up the encrypted key and remember its passphrase."),
+		"Without both, files encrypted only to this key cannot be recovered.",
+	}
+
+	if k.status != "" {
+		lines = append(lines, "", hintStyle.Render(k.status))
+	}
+	if k.copyFallback != "" {
+		lines = append(lines, "", k.copyFallback)
+	}
+	lines = append(lines, "", hintStyle.Render("y: Copy public key • Y: Copy fingerprint • Enter: Done"))
+
+	return lipgloss.NewStyle().Width(k.layout.boxWidth(80)).Border(lipgloss.RoundedBorder()).Padding(1).Render(
+		lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
 // renderIdleState renders the idle state view
 func (k *KeyManagerView) renderIdleState() string {
 	var content string
 
-	keyStyle := lipgloss.NewStyle().Width(60).Border(lipgloss.RoundedBorder()).Padding(1)
+	keyStyle := lipgloss.NewStyle().Width(k.layout.boxWidth(60)).Border(lipgloss.RoundedBorder()).Padding(1)
 	infoStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00"))
 
 	// Display error if one exists
@@ -213,7 +545,18 @@ func (k *KeyManagerView) renderIdleState() string {
 		content += errors.FormatErrorForDisplay(k.err) + "\n\n"
 	}
 
-	if k.hasDecryptedKey {
+	if k.status != "" {
+		content += lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render(k.status) + "\n\n"
+	}
+
+	if k.hasDecryptedKey && !utils.FileExists(k.encryptedKeyPath) {
+		content += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("Key Status: Plaintext only (no encrypted copy)") + "\n"
+		content += fmt.Sprintf("Decrypted Key Path: %s\n\n", k.decryptedKeyPath)
+		if k.keyPair != nil {
+			content += fmt.Sprintf("Public Key: %s\n\n", k.keyPair.PublicKey)
+		}
+		content += "Press 'P' on the Dashboard to encrypt it with a passphrase to " + k.encryptedKeyPath + ".\n\n"
+	} else if k.hasDecryptedKey {
 		elapsedTime := time.Since(k.keyDecryptedTime)
 		remainingTime := k.autoDeleteInterval - elapsedTime
 		if remainingTime < 0 {
@@ -225,21 +568,100 @@ func (k *KeyManagerView) renderIdleState() string {
 		content += fmt.Sprintf("Auto-Delete In: %s\n\n", remainingTime.Round(time.Second))
 		content += fmt.Sprintf("Public Key: %s\n\n", k.keyPair.PublicKey)
 		content += "Press 'x' to securely delete the decrypted key now.\n\n"
+	} else if age.PassphraseCached() {
+		content += infoStyle.Render("Key Status: Unlocked (passphrase cached in memory)") + "\n"
+		content += fmt.Sprintf("Encrypted Key Path: %s\n", k.encryptedKeyPath)
+		content += "The passphrase is wiped after it goes unused for the idle timeout.\n\n"
+		if k.keyPair != nil {
+			content += fmt.Sprintf("Public Key: %s\n\n", k.keyPair.PublicKey)
+		}
+		content += "Press 'x' to wipe the cached passphrase now.\n\n"
 	} else {
 		content += "Key Status: " + lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render("Not Decrypted") + "\n\n"
 
 		if _, err := os.Stat(k.encryptedKeyPath); err == nil {
 			content += fmt.Sprintf("Encrypted Key Path: %s\n", k.encryptedKeyPath)
-			content += "Press 'd' to decrypt the key.\n\n"
+			if age.PassphraseCachingEnabled() {
+				content += "Press 'd' to unlock the key for this session.\n\n"
+			} else {
+				content += "Press 'd' to decrypt the key.\n\n"
+			}
 		} else {
 			content += "No encrypted key found.\n"
 			content += "Press 'g' to generate a new key.\n\n"
 		}
 	}
 
+	if k.ownPublicKey() != "" {
+		content += "Press 's' for snippets that add your key, or a teammate's, as a sops recipient.\n"
+	}
+
 	return keyStyle.Render(content)
 }
 
+// scheduleAutoDelete starts the auto-delete timer for the time left of the
+// current interval, replacing any earlier timer. A key that has already been
+// kept longer than the interval is deleted straight away.
+func (k *KeyManagerView) scheduleAutoDelete() tea.Cmd {
+	k.autoDeleteEpoch++
+	epoch := k.autoDeleteEpoch
+
+	remaining := k.autoDeleteInterval - time.Since(k.keyDecryptedTime)
+	if remaining <= 0 {
+		return func() tea.Msg { return autoDeleteDue{epoch: epoch} }
+	}
+	due := tea.Tick(remaining, func(time.Time) tea.Msg {
+		return autoDeleteDue{epoch: epoch}
+	})
+	if k.autoDeleteWarning <= 0 {
+		return due
+	}
+	lead := remaining - k.autoDeleteWarning
+	if lead < 0 {
+		lead = 0
+	}
+	warn := tea.Tick(lead, func(time.Time) tea.Msg {
+		return autoDeleteWarn{epoch: epoch}
+	})
+	return tea.Batch(warn, due)
+}
+
+// ExpiryWarning reports when the decrypted key is due to be auto-deleted,
+// while the warning before that is showing
+func (k *KeyManagerView) ExpiryWarning() (expiry time.Time, ok bool) {
+	if !k.expiring || !k.hasDecryptedKey {
+		return time.Time{}, false
+	}
+	return k.keyDecryptedTime.Add(k.autoDeleteInterval), true
+}
+
+// ExtendSession restarts the auto-delete interval of the decrypted key from
+// now. The key file's modification time is updated too, since the other
+// views count the time left from it.
+func (k *KeyManagerView) ExtendSession() tea.Cmd {
+	k.expiring = false
+	k.keyDecryptedTime = time.Now()
+	if err := os.Chtimes(k.decryptedKeyPath, k.keyDecryptedTime, k.keyDecryptedTime); err != nil {
+		k.err = errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to update the decrypted key's time; the other views may show the old expiry").
+			WithCode(errors.CodeFileWriteFailed).WithData("path", k.decryptedKeyPath)
+	}
+	k.status = fmt.Sprintf("Session extended; the decrypted key is deleted in %s", k.autoDeleteInterval)
+	return tea.Batch(k.scheduleAutoDelete(), func() tea.Msg { return CheckKeyStatusMsg{} })
+}
+
+// DeleteNow securely deletes the decrypted key without waiting for the
+// auto-delete timer. It does nothing while a passphrase prompt is open.
+func (k *KeyManagerView) DeleteNow() tea.Cmd {
+	if k.state != StateIdle || !k.hasDecryptedKey {
+		return nil
+	}
+	k.expiring = false
+	age.ForgetPassphrase()
+	k.state = StateDeletingKey
+	return k.deleteDecryptedKey()
+}
+
 // checkKeyStatus checks if a decrypted key exists
 func (k *KeyManagerView) checkKeyStatus() tea.Cmd {
 	return func() tea.Msg {
@@ -249,10 +671,8 @@ func (k *KeyManagerView) checkKeyStatus() tea.Cmd {
 		if k.hasDecryptedKey && k.keyPair == nil {
 			data, err := os.ReadFile(k.decryptedKeyPath)
 			if err == nil {
-				// This is a simplification - proper parsing would be more complex
 				privateKey := string(data)
-				// Extract public key from private key (would require proper age key parsing)
-				publicKey := "age1..." // Placeholder
+				publicKey, _ := age.PublicKey(privateKey)
 				k.keyPair = &age.KeyPair{
 					PrivateKey:  privateKey,
 					PublicKey:   publicKey,
@@ -271,42 +691,9 @@ func (k *KeyManagerView) generateKey(passphrase string) tea.Cmd {
 	k.err = nil
 
 	return func() tea.Msg {
-		// Generate key
-		keyPair, err := age.GenerateKey()
+		keyPair, err := createEncryptedKey(passphrase, k.encryptedKeyPath)
 		if err != nil {
-			return keyGenerated{
-				keyPair: nil,
-				err: errors.Wrap(err, errors.TypeKeyManagement,
-					"Failed to generate key"),
-			}
-		}
-
-		// Encrypt with passphrase
-		encryptedKey, err := age.EncryptKey(keyPair, passphrase)
-		if err != nil {
-			return keyGenerated{
-				keyPair: nil,
-				err: errors.Wrap(err, errors.TypeKeyManagement,
-					"Failed to encrypt key"),
-			}
-		}
-
-		// Ensure directory exists
-		if err := os.MkdirAll(filepath.Dir(k.encryptedKeyPath), 0o700); err != nil {
-			return keyGenerated{
-				keyPair: nil,
-				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to create directory").WithData("path", k.encryptedKeyPath),
-			}
-		}
-
-		// Save encrypted key
-		if err := age.SaveEncryptedKey(encryptedKey, k.encryptedKeyPath); err != nil {
-			return keyGenerated{
-				keyPair: nil,
-				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to save encrypted key").WithData("path", k.encryptedKeyPath),
-			}
+			return keyGenerated{keyPair: nil, err: err}
 		}
 
 		// Save decrypted key
@@ -314,7 +701,7 @@ func (k *KeyManagerView) generateKey(passphrase string) tea.Cmd {
 			return keyGenerated{
 				keyPair: nil,
 				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to save decrypted key").WithData("path", k.decryptedKeyPath),
+					"Failed to save decrypted key").WithCode(errors.CodeFileWriteFailed).WithData("path", k.decryptedKeyPath),
 			}
 		}
 
@@ -322,40 +709,53 @@ func (k *KeyManagerView) generateKey(passphrase string) tea.Cmd {
 	}
 }
 
+// createEncryptedKey generates a new key pair and stores it encrypted with
+// passphrase at encryptedKeyPath, with its public key alongside
+func createEncryptedKey(passphrase, encryptedKeyPath string) (*age.KeyPair, error) {
+	// Generate key
+	keyPair, err := age.GenerateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeKeyManagement,
+			"Failed to generate key").WithCode(errors.CodeAgeKeygenFailed)
+	}
+
+	// Encrypt with passphrase
+	encryptedKey, err := age.EncryptKey(keyPair, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.TypeKeyManagement,
+			"Failed to encrypt key").WithCode(errors.CodeAgeEncryptFailed)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(encryptedKeyPath), 0o700); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to create directory").WithCode(errors.CodeFileWriteFailed).WithData("path", encryptedKeyPath)
+	}
+
+	// Save encrypted key
+	if err := age.SaveEncryptedKey(encryptedKey, encryptedKeyPath); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to save encrypted key").WithCode(errors.CodeFileWriteFailed).WithData("path", encryptedKeyPath)
+	}
+
+	// Keep the public key next to the encrypted key so it can be shown while locked
+	if err := age.SavePublicKey(encryptedKeyPath, keyPair.PublicKey); err != nil {
+		return nil, errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to save public key").WithCode(errors.CodeFileWriteFailed).WithData("path", age.PublicKeyPath(encryptedKeyPath))
+	}
+
+	return keyPair, nil
+}
+
 // decryptKey decrypts an age key
 func (k *KeyManagerView) decryptKey(passphrase string) tea.Cmd {
 	k.state = StateDecryptingKey
 	k.err = nil
 
 	return func() tea.Msg {
-		// Load encrypted key
-		encryptedKey, err := age.LoadEncryptedKey(k.encryptedKeyPath)
-		if err != nil {
-			return keyDecrypted{
-				key: "",
-				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to load encrypted key").WithData("path", k.encryptedKeyPath),
-			}
-		}
-
-		// Decrypt key with passphrase
-		decryptedKey, err := age.DecryptKey(encryptedKey, passphrase)
+		decryptedKey, err := k.decryptStoredKey(passphrase)
 		if err != nil {
-			// Check for common errors
-			if strings.Contains(err.Error(), "incorrect passphrase") ||
-				strings.Contains(err.Error(), "failed to decrypt") {
-				return keyDecrypted{
-					key: "",
-					err: errors.New(errors.TypeSecurity,
-						"Incorrect passphrase provided"),
-				}
-			}
-
-			return keyDecrypted{
-				key: "",
-				err: errors.Wrap(err, errors.TypeSecurity,
-					"Failed to decrypt key"),
-			}
+			return keyDecrypted{key: "", err: err}
 		}
 
 		// Save decrypted key
@@ -363,7 +763,7 @@ func (k *KeyManagerView) decryptKey(passphrase string) tea.Cmd {
 			return keyDecrypted{
 				key: "",
 				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to create directory for decrypted key").WithData("path", k.decryptedKeyPath),
+					"Failed to create directory for decrypted key").WithCode(errors.CodeFileWriteFailed).WithData("path", k.decryptedKeyPath),
 			}
 		}
 
@@ -371,12 +771,12 @@ func (k *KeyManagerView) decryptKey(passphrase string) tea.Cmd {
 			return keyDecrypted{
 				key: "",
 				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to save decrypted key").WithData("path", k.decryptedKeyPath),
+					"Failed to save decrypted key").WithCode(errors.CodeFileWriteFailed).WithData("path", k.decryptedKeyPath),
 			}
 		}
 
 		// Extract public key from private key
-		publicKey := "age1..." // Placeholder - implement proper extraction
+		publicKey, _ := age.PublicKey(decryptedKey)
 		k.keyPair = &age.KeyPair{
 			PrivateKey:  decryptedKey,
 			PublicKey:   publicKey,
@@ -387,19 +787,76 @@ func (k *KeyManagerView) decryptKey(passphrase string) tea.Cmd {
 	}
 }
 
+// retryPassphrase keeps the prompt open after a wrong passphrase, cleared and
+// with the error inline, so the user can try again straight away. It returns
+// nil when err is anything else, leaving the result to be handled as usual.
+func (k *KeyManagerView) retryPassphrase(err error) tea.Cmd {
+	if errors.Code(err) != errors.CodeAgeBadPassphrase || k.passphraseInput == nil || k.state != StateDecryptingKey {
+		return nil
+	}
+	k.failedAttempts++
+	return k.passphraseInput.Retry(fmt.Sprintf("Incorrect passphrase (%d failed attempt(s)); try again or press Esc to cancel", k.failedAttempts))
+}
+
+// unlockKey checks the passphrase and caches it for the session, so operations
+// can decrypt the key in memory without it being written to disk
+func (k *KeyManagerView) unlockKey(passphrase string) tea.Cmd {
+	k.err = nil
+
+	return func() tea.Msg {
+		decryptedKey, err := k.decryptStoredKey(passphrase)
+		if err != nil {
+			return keyUnlocked{err: err}
+		}
+		publicKey, _ := age.PublicKey(decryptedKey)
+
+		age.CachePassphrase([]byte(passphrase))
+		return keyUnlocked{publicKey: publicKey}
+	}
+}
+
+// decryptStoredKey decrypts the encrypted key with passphrase
+func (k *KeyManagerView) decryptStoredKey(passphrase string) (string, error) {
+	// Load encrypted key
+	encryptedKey, err := age.LoadEncryptedKey(k.encryptedKeyPath)
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeFileOperation,
+			"Failed to load encrypted key").WithCode(errors.CodeAgeNoEncryptedKey).WithData("path", k.encryptedKeyPath)
+	}
+
+	// Decrypt key with passphrase
+	// A wrong passphrase, and invalid key material, come back coded as such
+	decryptedKey, err := age.DecryptKey(encryptedKey, passphrase)
+	switch errors.Code(err) {
+	case errors.CodeAgeBadPassphrase, errors.CodeAgeInvalidKey:
+		return "", err
+	}
+	if err != nil {
+		return "", errors.Wrap(err, errors.TypeSecurity,
+			"Failed to decrypt key").WithCode(errors.CodeAgeDecryptFailed)
+	}
+	return decryptedKey, nil
+}
+
 // deleteDecryptedKey securely deletes the decrypted key
 func (k *KeyManagerView) deleteDecryptedKey() tea.Cmd {
 	k.err = nil
 
 	return func() tea.Msg {
-		if err := age.SecurelyDeleteKey(k.decryptedKeyPath); err != nil {
+		cfg, err := config.Load()
+		if err != nil {
+			cfg = config.DefaultConfig()
+		}
+
+		result, err := age.SecurelyDeleteKeyWithOptions(k.decryptedKeyPath, cfg.WipeOptions())
+		if err != nil {
 			return keyDeleted{
 				err: errors.Wrap(err, errors.TypeFileOperation,
-					"Failed to securely delete key").WithData("path", k.decryptedKeyPath),
+					"Failed to securely delete key").WithCode(errors.CodeFileDeleteFailed).WithData("path", k.decryptedKeyPath),
 			}
 		}
 		k.keyPair = nil
-		return keyDeleted{err: nil}
+		return keyDeleted{result: result, err: nil}
 	}
 }
 
@@ -0,0 +1,43 @@
+package views
+
+import (
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// LayoutMsg tells the views how to arrange their boxes for the terminal's
+// width. MainView sends it after every resize and configuration change.
+type LayoutMsg struct {
+	Width   int
+	Compact bool // Narrower than compact_width: stack boxes in one column
+}
+
+// newLayout returns the layout for a terminal width columns wide
+func newLayout(width int, cfg *config.Config) LayoutMsg {
+	threshold := config.DefaultCompactWidth
+	if cfg != nil {
+		threshold = cfg.CompactWidth
+	}
+	return LayoutMsg{Width: width, Compact: threshold > 0 && width < threshold}
+}
+
+// boxWidth returns the width of a box that is wide columns across in the
+// regular layout; in the compact one it spans the terminal. The width
+// excludes the border, which lipgloss draws outside it.
+func (l LayoutMsg) boxWidth(wide int) int {
+	if l.Compact && l.Width > 2 {
+		return l.Width - 2
+	}
+	return wide
+}
+
+// box returns the bordered style of a panel sized by its content. In the
+// compact layout it loses its vertical padding and wraps at the terminal's
+// width instead of running past it.
+func (l LayoutMsg) box() lipgloss.Style {
+	style := lipgloss.NewStyle().Border(lipgloss.RoundedBorder())
+	if l.Compact && l.Width > 2 {
+		return style.Padding(0, 1).Width(l.Width - 2)
+	}
+	return style.Padding(1)
+}
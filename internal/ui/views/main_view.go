@@ -1,7 +1,14 @@
 package views
 
 import (
-	"github.com/charmbracelet/bubbles/help"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/history"
+	"github.com/bxtal-lsn/supper/internal/ui/components"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -13,7 +20,9 @@ const (
 	ViewDashboard = iota
 	ViewKeyManager
 	ViewFileBrowser
+	ViewRules
 	ViewSettings
+	tabCount // The number of tabs
 )
 
 // KeyMap defines the keybindings for the application
@@ -33,6 +42,56 @@ type KeyMap struct {
 	DecryptFile key.Binding
 	EditFile    key.Binding
 	DeleteKey   key.Binding
+	Doctor      key.Binding
+	Format      key.Binding
+	Cancel      key.Binding
+	Search      key.Binding
+	Toggle      key.Binding
+	Prune       key.Binding
+	Purge       key.Binding
+	CopyFile    key.Binding
+	Audit       key.Binding
+	Rekey       key.Binding
+	SaveReport  key.Binding
+	SkipBackup  key.Binding
+	Watch       key.Binding
+	NewRule     key.Binding
+	CopyKey     key.Binding
+	CopyPrint   key.Binding
+	ViewFile    key.Binding
+	SkipConfirm key.Binding
+	History     key.Binding
+	Label       key.Binding
+	InPlace     key.Binding
+	Reload      key.Binding
+	Snippets    key.Binding
+	Repair      key.Binding
+	Verify      key.Binding
+	Recipients  key.Binding
+	Identities  key.Binding
+	Extract     key.Binding
+	CopyValue   key.Binding
+	ProtectKey  key.Binding
+	Archive     key.Binding
+	Reseal      key.Binding
+	Coverage    key.Binding
+	EncryptAll  key.Binding
+	Metadata    key.Binding
+	Raw         key.Binding
+	Export      key.Binding
+	Overwrite   key.Binding
+	TestKey     key.Binding
+	Results     key.Binding
+	CopyFrom    key.Binding
+	MoveUp      key.Binding
+	MoveDown    key.Binding
+	Preview     key.Binding
+	Revert      key.Binding
+	Extend      key.Binding
+	DeleteNow   key.Binding
+	Reveal      key.Binding
+	Accesses    key.Binding
+	FindKey     key.Binding
 }
 
 // DefaultKeyMap returns the default key bindings
@@ -56,7 +115,7 @@ func DefaultKeyMap() KeyMap {
 		),
 		Help: key.NewBinding(
 			key.WithKeys("?"),
-			key.WithHelp("?", "toggle help"),
+			key.WithHelp("?", "more help"),
 		),
 		Quit: key.NewBinding(
 			key.WithKeys("q", "ctrl+c"),
@@ -98,13 +157,227 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("x"),
 			key.WithHelp("x", "delete key"),
 		),
+		Prune: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", "prune backups"),
+		),
+		Purge: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "toggle purge"),
+		),
+		CopyFile: key.NewBinding(
+			key.WithKeys("w"),
+			key.WithHelp("w", "writable copy"),
+		),
+		Audit: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "audit recipients"),
+		),
+		Rekey: key.NewBinding(
+			key.WithKeys("R"),
+			key.WithHelp("R", "re-key directory"),
+		),
+		SaveReport: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "save report"),
+		),
+		SkipBackup: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", "toggle backup"),
+		),
+		Watch: key.NewBinding(
+			key.WithKeys("W"),
+			key.WithHelp("W", "toggle watch"),
+		),
+		NewRule: key.NewBinding(
+			key.WithKeys("N"),
+			key.WithHelp("N", "new .sops.yaml rule"),
+		),
+		CopyKey: key.NewBinding(
+			key.WithKeys("y"),
+			key.WithHelp("y", "copy public key"),
+		),
+		CopyPrint: key.NewBinding(
+			key.WithKeys("Y"),
+			key.WithHelp("Y", "copy fingerprint"),
+		),
+		ViewFile: key.NewBinding(
+			key.WithKeys("v"),
+			key.WithHelp("v", "view decrypted"),
+		),
+		SkipConfirm: key.NewBinding(
+			key.WithKeys("C"),
+			key.WithHelp("C", "toggle confirmations"),
+		),
+		History: key.NewBinding(
+			key.WithKeys("H"),
+			key.WithHelp("H", "operation history"),
+		),
+		Label: key.NewBinding(
+			key.WithKeys("L"),
+			key.WithHelp("L", "edit label"),
+		),
+		InPlace: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "toggle in place"),
+		),
+		Snippets: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "recipient snippets"),
+		),
+		Repair: key.NewBinding(
+			key.WithKeys("F"),
+			key.WithHelp("F", "repair recipients"),
+		),
+		Verify: key.NewBinding(
+			key.WithKeys("V"),
+			key.WithHelp("V", "verify all files"),
+		),
+		Recipients: key.NewBinding(
+			key.WithKeys("M"),
+			key.WithHelp("M", "manage recipients"),
+		),
+		Identities: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "try every identity"),
+		),
+		Extract: key.NewBinding(
+			key.WithKeys("X"),
+			key.WithHelp("X", "view one value"),
+		),
+		CopyValue: key.NewBinding(
+			key.WithKeys("ctrl+y"),
+			key.WithHelp("ctrl+y", "copy value"),
+		),
+		ProtectKey: key.NewBinding(
+			key.WithKeys("P"),
+			key.WithHelp("P", "encrypt plaintext key"),
+		),
+		Archive: key.NewBinding(
+			key.WithKeys("A"),
+			key.WithHelp("A", "seal directory"),
+		),
+		Reseal: key.NewBinding(
+			key.WithKeys("S"),
+			key.WithHelp("S", "re-encrypt stale files"),
+		),
+		Coverage: key.NewBinding(
+			key.WithKeys("U"),
+			key.WithHelp("U", "uncovered files"),
+		),
+		EncryptAll: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "encrypt every value"),
+		),
+		Metadata: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", "sops metadata"),
+		),
+		Raw: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", "raw encrypted content"),
+		),
+		Export: key.NewBinding(
+			key.WithKeys("O"),
+			key.WithHelp("O", "export to formats"),
+		),
+		Overwrite: key.NewBinding(
+			key.WithKeys("ctrl+w"),
+			key.WithHelp("ctrl+w", "overwrite existing"),
+		),
+		TestKey: key.NewBinding(
+			key.WithKeys("T"),
+			key.WithHelp("T", "test recipient"),
+		),
+		Results: key.NewBinding(
+			key.WithKeys("ctrl+l"),
+			key.WithHelp("ctrl+l", "operation results"),
+		),
+		CopyFrom: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "use recipients from…"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("K"),
+			key.WithHelp("K", "move rule up"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("J"),
+			key.WithHelp("J", "move rule down"),
+		),
+		Preview: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "preview matches"),
+		),
+		Revert: key.NewBinding(
+			key.WithKeys("R"),
+			key.WithHelp("R", "revert to saved"),
+		),
+		Extend: key.NewBinding(
+			key.WithKeys("ctrl+e"),
+			key.WithHelp("ctrl+e", "extend session"),
+		),
+		DeleteNow: key.NewBinding(
+			key.WithKeys("ctrl+x"),
+			key.WithHelp("ctrl+x", "delete key now"),
+		),
+		Reveal: key.NewBinding(
+			key.WithKeys("ctrl+f"),
+			key.WithHelp("ctrl+f", "show in file manager"),
+		),
+		Accesses: key.NewBinding(
+			key.WithKeys("ctrl+t"),
+			key.WithHelp("ctrl+t", "decrypt history"),
+		),
+		FindKey: key.NewBinding(
+			key.WithKeys("ctrl+k"),
+			key.WithHelp("ctrl+k", "search key names"),
+		),
+		Reload: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "reload config"),
+		),
+		Doctor: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "check environment"),
+		),
+		Format: key.NewBinding(
+			key.WithKeys("f"),
+			key.WithHelp("f", "cycle output format"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+		Search: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "search"),
+		),
+		Toggle: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "toggle"),
+		),
 	}
 }
 
+// inputCapturer is implemented by views that can have a focused text input.
+// While input is captured, global keybindings other than ctrl+c are not handled.
+type inputCapturer interface {
+	CapturingInput() bool
+}
+
+// HelpProvider is implemented by the view of every tab so the footer can
+// show its keys. ShortHelp lists the keys of what the view is showing for the
+// hint bar, and FullHelp groups every key the view handles.
+type HelpProvider interface {
+	ShortHelp() []key.Binding
+	FullHelp() [][]key.Binding
+}
+
 // MainView represents the main view of the application
 type MainView struct {
 	keys           KeyMap
-	help           help.Model
+	footer         *components.Footer
 	viewport       viewport.Model
 	currentTab     int
 	width          int
@@ -113,63 +386,196 @@ type MainView struct {
 	dashboardView  *DashboardView
 	keyManagerView *KeyManagerView
 	fileEditorView *FileEditorView
+	rulesView      *RulesView
 	settingsView   *SettingsView
+	onboardingView *OnboardingView // Set while the first-run wizard is shown
+	lock           lockStatus
+	windowTitle    string
+	layout         LayoutMsg      // How the views were last told to arrange themselves
+	cfg            *config.Config // The configuration the views were last given
+	notice         string         // Shown next to the tabs until the next key press
+}
+
+// ReloadConfigMsg asks for the configuration file to be read again, for
+// example after it was edited outside the application
+type ReloadConfigMsg struct{}
+
+// NotifyMsg brings something that needs attention to the user whichever tab
+// is open: the message is shown next to the tabs, and the bell or a desktop
+// notification follows Notify On Completion
+type NotifyMsg struct {
+	Message string
+}
+
+// configReloaded carries the result of reloading the configuration
+type configReloaded struct {
+	cfg *config.Config
+	err error
+}
+
+// lockStatus describes whether the age key is currently decrypted on disk,
+// and how many checked out files are
+type lockStatus struct {
+	hasKey    bool
+	unlocked  bool
+	expiry    time.Time
+	checkouts int
+}
+
+// readLockStatus checks the configured key paths
+func readLockStatus() lockStatus {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	var status lockStatus
+	if info, err := os.Stat(cfg.KeyPath); err == nil {
+		status.hasKey = true
+		status.unlocked = true
+		status.expiry = info.ModTime().Add(cfg.AutoDeleteInterval)
+	} else if _, err := os.Stat(cfg.EncryptedKeyPath); err == nil {
+		status.hasKey = true
+	}
+	status.checkouts = len(history.Outstanding())
+	return status
+}
+
+// label returns a short description of the lock state
+func (l lockStatus) label() string {
+	if l.checkouts > 0 {
+		return fmt.Sprintf("%s · %d CHECKED OUT", l.keyLabel(), l.checkouts)
+	}
+	return l.keyLabel()
+}
+
+// keyLabel describes the lock state of the key alone
+func (l lockStatus) keyLabel() string {
+	switch {
+	case l.unlocked:
+		remaining := time.Until(l.expiry)
+		if remaining < time.Minute {
+			return "UNLOCKED (deleting soon)"
+		}
+		return fmt.Sprintf("UNLOCKED (%dm left)", int(remaining.Minutes()))
+	case l.hasKey:
+		return "Locked"
+	default:
+		return "No key"
+	}
+}
+
+// style returns the header style for the lock state; unlocked stands out
+func (l lockStatus) style() lipgloss.Style {
+	base := lipgloss.NewStyle().Padding(0, 1).Bold(true)
+	switch {
+	case l.unlocked, l.checkouts > 0:
+		return base.Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#D32F2F"))
+	case l.hasKey:
+		return base.Foreground(lipgloss.Color("#00AA00"))
+	default:
+		return base.Foreground(lipgloss.Color("#AAAAAA"))
+	}
 }
 
 // NewMainView creates a new main view
 func NewMainView() *MainView {
 	keys := DefaultKeyMap()
-	h := help.New()
 
 	// Initialize sub-views
 	dashboardView := NewDashboardView()
 	keyManagerView := NewKeyManagerView()
 	fileEditorView := NewFileEditorView()
+	rulesView := NewRulesView()
 	settingsView := NewSettingsView()
 
+	// Greet first-time users with the setup wizard
+	var onboardingView *OnboardingView
+	if NeedsOnboarding() {
+		onboardingView = NewOnboardingView()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
 	return &MainView{
+		cfg:            cfg,
 		keys:           keys,
-		help:           h,
+		footer:         components.NewFooter(),
 		currentTab:     ViewDashboard,
 		dashboardView:  dashboardView,
 		keyManagerView: keyManagerView,
 		fileEditorView: fileEditorView,
+		rulesView:      rulesView,
 		settingsView:   settingsView,
+		onboardingView: onboardingView,
 	}
 }
 
-// ShortHelp returns keybindings to be shown in the mini help view.
+// ShortHelp returns the global keybindings, which the footer's hint bar
+// shows after those of the active tab
 func (m MainView) ShortHelp() []key.Binding {
-	kb := []key.Binding{
-		m.keys.Help,
-		m.keys.Quit,
-		m.keys.Tab,
+	if _, ok := m.keyManagerView.ExpiryWarning(); ok {
+		return []key.Binding{m.keys.Extend, m.keys.DeleteNow, m.keys.Tab, m.helpKey(), m.keys.Quit}
 	}
-
-	// Add view-specific keybindings based on current tab
-	switch m.currentTab {
-	case ViewDashboard:
-		kb = append(kb, m.keys.GenerateKey, m.keys.DecryptKey)
-	case ViewKeyManager:
-		kb = append(kb, m.keys.GenerateKey, m.keys.DecryptKey, m.keys.DeleteKey)
-	case ViewFileBrowser:
-		kb = append(kb, m.keys.EncryptFile, m.keys.DecryptFile, m.keys.EditFile)
-	}
-
-	return kb
+	return []key.Binding{m.keys.Tab, m.helpKey(), m.keys.Quit}
 }
 
-// FullHelp returns keybindings for the expanded help view
+// FullHelp returns the global keybindings for the expanded help, grouped
+// after those of the active tab. The bindings come from the key map, so a
+// remapped key shows as it is bound.
 func (m MainView) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{m.keys.Up, m.keys.Down, m.keys.Left, m.keys.Right},
-		{m.keys.Tab, m.keys.ShiftTab, m.keys.Enter},
-		{m.keys.GenerateKey, m.keys.DecryptKey, m.keys.DeleteKey},
-		{m.keys.EncryptFile, m.keys.DecryptFile, m.keys.EditFile},
-		{m.keys.Help, m.keys.Quit},
+		{m.keys.Tab, m.keys.ShiftTab, m.keys.Enter, m.keys.Cancel},
+		{m.keys.Reload, m.helpKey(), m.keys.Quit},
+		{m.keys.Extend, m.keys.DeleteNow},
+	}
+}
+
+// helpKey returns the help binding described by what pressing it does next
+func (m MainView) helpKey() key.Binding {
+	switch config.NextHelpMode(m.helpMode()) {
+	case config.HelpFull:
+		return relabel(m.keys.Help, "more help")
+	case config.HelpHidden:
+		return relabel(m.keys.Help, "hide help")
+	default:
+		return relabel(m.keys.Help, "show help")
 	}
 }
 
+// helpMode returns how much help is shown
+func (m MainView) helpMode() string {
+	if m.cfg == nil {
+		return config.HelpShort
+	}
+	return m.cfg.HelpMode
+}
+
+// cycleHelp switches to the next help mode and saves it, so the next start
+// opens with the same help. Every view is given the saved configuration
+// straight away, so none holds on to the previous mode.
+func (m *MainView) cycleHelp() tea.Cmd {
+	cfg := *m.cfg
+	cfg.HelpMode = config.NextHelpMode(cfg.HelpMode)
+	if err := config.Save(&cfg); err != nil {
+		m.notice = fmt.Sprintf("Help mode not saved: %v", err)
+	}
+	m.cfg = &cfg
+
+	msg := ConfigSavedMsg{Config: &cfg}
+	return tea.Batch(m.updateInactive(msg), m.updateActive(msg))
+}
+
+// relabel returns a copy of b described as desc, keeping its keys
+func relabel(b key.Binding, desc string) key.Binding {
+	b.SetHelp(b.Help().Key, desc)
+	return b
+}
+
 // tabStyle returns the style for tab headings
 func (m MainView) tabStyle(selected bool) lipgloss.Style {
 	base := lipgloss.NewStyle().
@@ -188,20 +594,31 @@ func (m MainView) tabStyle(selected bool) lipgloss.Style {
 
 // Init initializes the main view
 func (m MainView) Init() tea.Cmd {
+	if m.onboardingView != nil {
+		return m.onboardingView.Init()
+	}
+	return tea.Batch(m.initViews(), func() tea.Msg { return CheckKeyStatusMsg{} })
+}
+
+// initViews initializes the sub-views
+func (m MainView) initViews() tea.Cmd {
 	return tea.Batch(
 		m.dashboardView.Init(),
 		m.keyManagerView.Init(),
 		m.fileEditorView.Init(),
+		m.rulesView.Init(),
 		m.settingsView.Init(),
 	)
 }
 
 // Update handles events and updates the model
 func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var (
-		cmd  tea.Cmd
-		cmds []tea.Cmd
-	)
+	var cmds []tea.Cmd
+
+	// The first-run wizard takes over until it is finished or skipped
+	if m.onboardingView != nil {
+		return m.updateOnboarding(msg)
+	}
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -212,6 +629,7 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		footerHeight := 3
 		m.viewport = viewport.New(msg.Width, msg.Height-headerHeight-footerHeight)
 		m.viewport.YPosition = headerHeight
+		m.footer.SetWidth(msg.Width)
 		m.ready = true
 
 		// Propagate window size to sub-views
@@ -238,35 +656,103 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		cmds = append(cmds, fileCmd)
 
+		// Update rules view
+		rulesModel, rulesCmd := m.rulesView.Update(subMsg)
+		if updatedModel, ok := rulesModel.(*RulesView); ok {
+			m.rulesView = updatedModel
+		}
+		cmds = append(cmds, rulesCmd)
+
 		// Update settings view
 		settingsModel, settingsCmd := m.settingsView.Update(subMsg)
 		if updatedModel, ok := settingsModel.(*SettingsView); ok {
 			m.settingsView = updatedModel
 		}
-		cmds = append(cmds, settingsCmd)
+		cmds = append(cmds, settingsCmd, m.relayout())
 
 	case tea.KeyMsg:
+		m.notice = ""
+
+		// The auto-delete warning is answered from any tab, even while typing
+		if _, ok := m.keyManagerView.ExpiryWarning(); ok {
+			switch {
+			case key.Matches(msg, m.keys.Extend):
+				return m, tea.Batch(m.keyManagerView.ExtendSession(), m.refreshLockStatus())
+			case key.Matches(msg, m.keys.DeleteNow):
+				return m, m.keyManagerView.DeleteNow()
+			}
+		}
+
+		// Let a focused text input receive every key except ctrl+c
+		if m.capturingInput() && msg.String() != "ctrl+c" {
+			break
+		}
+
 		// Global key handlers
 		switch {
 		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
 
 		case key.Matches(msg, m.keys.Tab):
-			m.currentTab = (m.currentTab + 1) % 4 // Cycle through tabs
+			m.currentTab = (m.currentTab + 1) % tabCount // Cycle through tabs
 
 		case key.Matches(msg, m.keys.ShiftTab):
-			m.currentTab = (m.currentTab - 1 + 4) % 4 // Cycle backwards
+			m.currentTab = (m.currentTab - 1 + tabCount) % tabCount // Cycle backwards
 
 		case key.Matches(msg, m.keys.Help):
-			m.help.ShowAll = !m.help.ShowAll
+			return m, m.cycleHelp()
+
+		case key.Matches(msg, m.keys.Reload):
+			return m, reloadConfig
+		}
+
+	case ReloadConfigMsg:
+		return m, reloadConfig
+
+	case configReloaded:
+		if msg.err != nil {
+			m.notice = fmt.Sprintf("Config not reloaded: %v", msg.err)
+			return m, nil
 		}
+		changes := config.Changes(m.cfg, msg.cfg)
+		if len(changes) == 0 {
+			m.notice = "Config reloaded, nothing changed"
+		} else {
+			m.notice = "Config reloaded, changed: " + strings.Join(changes, ", ")
+		}
+		// Apply it through the same path as settings saved in the app
+		cfg := msg.cfg
+		return m, func() tea.Msg { return ConfigSavedMsg{Config: cfg} }
 
 	case SwitchTabMsg:
 		// Handle tab switching from sub-views
 		m.currentTab = msg.Tab
 		return m, nil
 
+	case keyGenerated, keyDecrypted:
+		cmds = append(cmds, m.refreshLockStatus())
+
+	case keyDeleted:
+		cmds = append(cmds, m.refreshLockStatus(), m.updateKeyManager(msg))
+
+	case autoDeleteDue, autoDeleteWarn:
+		cmds = append(cmds, m.updateKeyManager(msg))
+
+	case verifyScanned, verifyProgress, verifyComplete, backgroundSweepDue, backgroundSweepDone:
+		cmds = append(cmds, m.updateDashboard(msg))
+
+	case NotifyMsg:
+		m.notice = msg.Message
+		cmds = append(cmds, notifyAlert(m.cfg, msg.Message))
+
+	case ConfigSavedMsg:
+		// Every view holds values derived from the configuration
+		m.cfg = msg.Config
+		cmds = append(cmds, m.updateInactive(msg), m.refreshLockStatus(), m.relayout())
+
 	case CheckKeyStatusMsg:
+		cmds = append(cmds, m.refreshLockStatus())
+
 		// Propagate key status check to all views
 		dashModel, dashCmd := m.dashboardView.Update(msg)
 		if updatedModel, ok := dashModel.(*DashboardView); ok {
@@ -288,6 +774,14 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	// Update the active sub-view
+	cmds = append(cmds, m.updateActive(msg))
+
+	return m, tea.Batch(cmds...)
+}
+
+// updateActive delivers a message to the active tab's view
+func (m *MainView) updateActive(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
 	switch m.currentTab {
 	case ViewDashboard:
 		var dashModel tea.Model
@@ -295,7 +789,6 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if updatedModel, ok := dashModel.(*DashboardView); ok {
 			m.dashboardView = updatedModel
 		}
-		cmds = append(cmds, cmd)
 
 	case ViewKeyManager:
 		var keyModel tea.Model
@@ -303,7 +796,6 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if updatedModel, ok := keyModel.(*KeyManagerView); ok {
 			m.keyManagerView = updatedModel
 		}
-		cmds = append(cmds, cmd)
 
 	case ViewFileBrowser:
 		var fileModel tea.Model
@@ -311,7 +803,13 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if updatedModel, ok := fileModel.(*FileEditorView); ok {
 			m.fileEditorView = updatedModel
 		}
-		cmds = append(cmds, cmd)
+
+	case ViewRules:
+		var rulesModel tea.Model
+		rulesModel, cmd = m.rulesView.Update(msg)
+		if updatedModel, ok := rulesModel.(*RulesView); ok {
+			m.rulesView = updatedModel
+		}
 
 	case ViewSettings:
 		var settingsModel tea.Model
@@ -319,10 +817,173 @@ func (m *MainView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if updatedModel, ok := settingsModel.(*SettingsView); ok {
 			m.settingsView = updatedModel
 		}
+	}
+	return cmd
+}
+
+// updateKeyManager delivers a message to the key manager when it is not the
+// active tab. The key manager owns the auto-delete timer, so it has to see
+// the timer and its result whichever tab is open.
+func (m *MainView) updateKeyManager(msg tea.Msg) tea.Cmd {
+	if m.currentTab == ViewKeyManager {
+		return nil
+	}
+	keyModel, cmd := m.keyManagerView.Update(msg)
+	if updatedModel, ok := keyModel.(*KeyManagerView); ok {
+		m.keyManagerView = updatedModel
+	}
+	return cmd
+}
+
+// updateDashboard delivers a message to the dashboard when it is not the
+// active tab, so an integrity sweep keeps going while another tab is open
+func (m *MainView) updateDashboard(msg tea.Msg) tea.Cmd {
+	if m.currentTab == ViewDashboard {
+		return nil
+	}
+	dashModel, cmd := m.dashboardView.Update(msg)
+	if updatedModel, ok := dashModel.(*DashboardView); ok {
+		m.dashboardView = updatedModel
+	}
+	return cmd
+}
+
+// relayout tells every view the layout for the current width, so a change
+// of compact_width takes effect without a resize
+func (m *MainView) relayout() tea.Cmd {
+	m.layout = newLayout(m.width, m.cfg)
+	return tea.Batch(m.updateActive(m.layout), m.updateInactive(m.layout))
+}
+
+// updateInactive delivers a message to every view except the active tab,
+// which receives it with the other messages
+func (m *MainView) updateInactive(msg tea.Msg) tea.Cmd {
+	var cmds []tea.Cmd
+	if m.currentTab != ViewDashboard {
+		dashModel, cmd := m.dashboardView.Update(msg)
+		if updatedModel, ok := dashModel.(*DashboardView); ok {
+			m.dashboardView = updatedModel
+		}
+		cmds = append(cmds, cmd)
+	}
+	if m.currentTab != ViewKeyManager {
+		cmds = append(cmds, m.updateKeyManager(msg))
+	}
+	if m.currentTab != ViewFileBrowser {
+		fileModel, cmd := m.fileEditorView.Update(msg)
+		if updatedModel, ok := fileModel.(*FileEditorView); ok {
+			m.fileEditorView = updatedModel
+		}
+		cmds = append(cmds, cmd)
+	}
+	if m.currentTab != ViewRules {
+		rulesModel, cmd := m.rulesView.Update(msg)
+		if updatedModel, ok := rulesModel.(*RulesView); ok {
+			m.rulesView = updatedModel
+		}
+		cmds = append(cmds, cmd)
+	}
+	if m.currentTab != ViewSettings {
+		settingsModel, cmd := m.settingsView.Update(msg)
+		if updatedModel, ok := settingsModel.(*SettingsView); ok {
+			m.settingsView = updatedModel
+		}
 		cmds = append(cmds, cmd)
 	}
+	return tea.Batch(cmds...)
+}
 
-	return m, tea.Batch(cmds...)
+// reloadConfig reads and validates the configuration file again
+func reloadConfig() tea.Msg {
+	cfg, err := config.Load()
+	if err == nil {
+		err = config.Validate(cfg)
+	}
+	return configReloaded{cfg: cfg, err: err}
+}
+
+// updateOnboarding forwards messages to the first-run wizard and switches to
+// the regular views once it is done
+func (m *MainView) updateOnboarding(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.ready = true
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+
+	case OnboardingDoneMsg:
+		// Recreate the views so they pick up the configuration the wizard wrote
+		m.onboardingView = nil
+		m.dashboardView = NewDashboardView()
+		m.keyManagerView = NewKeyManagerView()
+		m.fileEditorView = NewFileEditorView()
+		m.rulesView = NewRulesView()
+		m.settingsView = NewSettingsView()
+		size := tea.WindowSizeMsg{Width: m.width, Height: m.height}
+		return m, tea.Batch(m.initViews(), func() tea.Msg { return size }, func() tea.Msg { return CheckKeyStatusMsg{} })
+	}
+
+	model, cmd := m.onboardingView.Update(msg)
+	if updatedModel, ok := model.(*OnboardingView); ok {
+		m.onboardingView = updatedModel
+	}
+	return m, cmd
+}
+
+// refreshLockStatus re-reads the key's lock state and updates the terminal
+// title when it changes
+func (m *MainView) refreshLockStatus() tea.Cmd {
+	m.lock = readLockStatus()
+
+	title := "supper"
+	switch {
+	case m.lock.unlocked:
+		title = "supper - key unlocked"
+	case m.lock.hasKey:
+		title = "supper - key locked"
+	}
+	if title == m.windowTitle {
+		return nil
+	}
+	m.windowTitle = title
+	return tea.SetWindowTitle(title)
+}
+
+// activeView returns the model of the current tab
+func (m MainView) activeView() tea.Model {
+	switch m.currentTab {
+	case ViewKeyManager:
+		return m.keyManagerView
+	case ViewFileBrowser:
+		return m.fileEditorView
+	case ViewRules:
+		return m.rulesView
+	case ViewSettings:
+		return m.settingsView
+	default:
+		return m.dashboardView
+	}
+}
+
+// activeHelp returns the keys of the current tab for the footer
+func (m MainView) activeHelp() HelpProvider {
+	if h, ok := m.activeView().(HelpProvider); ok {
+		return h
+	}
+	return nil
+}
+
+// capturingInput reports whether the active view has a focused text input
+func (m MainView) capturingInput() bool {
+	if c, ok := m.activeView().(inputCapturer); ok {
+		return c.CapturingInput()
+	}
+	return false
 }
 
 // View renders the application UI
@@ -331,15 +992,39 @@ func (m MainView) View() string {
 		return "Initializing..."
 	}
 
+	if m.onboardingView != nil {
+		return m.onboardingView.View()
+	}
+
 	// Create tab bar
-	tabs := []string{"Dashboard", "Key Manager", "Files", "Settings"}
+	tabs := []string{"Dashboard", "Key Manager", "Files", "Rules", "Settings"}
 	tabsView := lipgloss.JoinHorizontal(
 		lipgloss.Top,
 		m.tabStyle(m.currentTab == ViewDashboard).Render(tabs[0]),
 		m.tabStyle(m.currentTab == ViewKeyManager).Render(tabs[1]),
 		m.tabStyle(m.currentTab == ViewFileBrowser).Render(tabs[2]),
-		m.tabStyle(m.currentTab == ViewSettings).Render(tabs[3]),
+		m.tabStyle(m.currentTab == ViewRules).Render(tabs[3]),
+		m.tabStyle(m.currentTab == ViewSettings).Render(tabs[4]),
 	)
+	status := m.lock.style().Render(m.lock.label())
+	if m.cfg != nil && !m.cfg.EnableBackups {
+		status = lipgloss.JoinHorizontal(lipgloss.Top, status, "  ",
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("BACKUPS OFF"))
+	}
+	if profile := config.ActiveProfile(); profile != "" {
+		status = lipgloss.JoinHorizontal(lipgloss.Top, status, "  ",
+			lipgloss.NewStyle().Bold(true).Render("Profile: "+profile))
+	}
+	if m.notice != "" {
+		status = lipgloss.JoinHorizontal(lipgloss.Top, status, "  ",
+			lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render(m.notice))
+	}
+	// A narrow terminal gets the status on a line of its own
+	if m.layout.Compact {
+		tabsView = lipgloss.JoinVertical(lipgloss.Left, tabsView, status)
+	} else {
+		tabsView = lipgloss.JoinHorizontal(lipgloss.Top, tabsView, "  ", status)
+	}
 
 	// Render content based on current tab
 	var content string
@@ -350,14 +1035,25 @@ func (m MainView) View() string {
 		content = m.keyManagerView.View()
 	case ViewFileBrowser:
 		content = m.fileEditorView.View()
+	case ViewRules:
+		content = m.rulesView.View()
 	case ViewSettings:
 		content = m.settingsView.View()
 	}
 
+	// Keep the warning before auto-deletion in sight whichever tab is open
+	if expiry, ok := m.keyManagerView.ExpiryWarning(); ok {
+		warning := fmt.Sprintf("⚠ The decrypted key will be deleted at %s • %s: extend session • %s: delete now",
+			expiry.Format("15:04:05"), m.keys.Extend.Help().Key, m.keys.DeleteNow.Help().Key)
+		content = lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render(warning),
+			content)
+	}
+
 	// Combine all elements
 	var helpView string
-	if m.help.ShowAll {
-		helpView = m.help.View(m)
+	if mode := m.helpMode(); mode != config.HelpHidden {
+		helpView = m.footer.View(m.activeHelp(), m, mode == config.HelpFull)
 	}
 
 	return lipgloss.JoinVertical(
@@ -0,0 +1,444 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/doctor"
+	"github.com/bxtal-lsn/supper/internal/ui/components"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Onboarding steps
+const (
+	stepChecks = iota
+	stepKeyPaths
+	stepPassphrase
+	stepGenerating
+	stepRecipients
+	stepDone
+)
+
+// Onboarding events
+type onboardingChecked struct {
+	checks []doctor.Check
+}
+
+type onboardingKeyCreated struct {
+	publicKey string
+	err       error
+}
+
+type onboardingSaved struct {
+	err error
+}
+
+// OnboardingDoneMsg is sent when the first-run wizard is finished or skipped
+type OnboardingDoneMsg struct{}
+
+// OnboardingView walks a first-time user through setting up supper
+type OnboardingView struct {
+	keys            KeyMap
+	spinner         spinner.Model
+	step            int
+	checks          []doctor.Check
+	pathInputs      []textinput.Model
+	pathFocus       int
+	passphraseInput *components.PassphraseInput
+	recipientInput  textinput.Model
+	publicKey       string
+	keyExisted      bool
+	skipped         bool
+	err             error
+	width           int
+	height          int
+}
+
+// NeedsOnboarding reports whether this is a first run of the active profile:
+// there is no configuration file and no key at the default locations
+func NeedsOnboarding() bool {
+	if path, err := config.ConfigPath(); err != nil || utils.FileExists(path) {
+		return false
+	}
+	// Without default key paths the wizard is where they get chosen
+	defaults := config.DefaultConfig()
+	if defaults.KeyPath == "" || defaults.EncryptedKeyPath == "" {
+		return true
+	}
+	return !utils.FileExists(defaults.EncryptedKeyPath) && !utils.FileExists(defaults.KeyPath)
+}
+
+// NewOnboardingView creates a new first-run wizard
+func NewOnboardingView() *OnboardingView {
+	defaults := config.DefaultConfig()
+
+	encrypted := textinput.New()
+	encrypted.Prompt = "Encrypted key: "
+	encrypted.SetValue(defaults.EncryptedKeyPath)
+	encrypted.Width = 60
+
+	decrypted := textinput.New()
+	decrypted.Prompt = "Decrypted key: "
+	decrypted.SetValue(defaults.KeyPath)
+	decrypted.Width = 60
+
+	recipients := textinput.New()
+	recipients.Placeholder = "age1..., github:username"
+	recipients.Width = 60
+
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+
+	return &OnboardingView{
+		keys:           DefaultKeyMap(),
+		spinner:        s,
+		step:           stepChecks,
+		pathInputs:     []textinput.Model{encrypted, decrypted},
+		recipientInput: recipients,
+	}
+}
+
+// Init initializes the view
+func (o *OnboardingView) Init() tea.Cmd {
+	return tea.Batch(o.spinner.Tick, o.runChecks())
+}
+
+// Update handles events and updates the model
+func (o *OnboardingView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		o.width = msg.Width
+		o.height = msg.Height
+		return o, nil
+
+	case spinner.TickMsg:
+		o.spinner, cmd = o.spinner.Update(msg)
+		return o, cmd
+
+	case onboardingChecked:
+		o.checks = msg.checks
+		return o, nil
+
+	case onboardingKeyCreated:
+		if msg.err != nil {
+			// Let the user pick another passphrase or path and try again
+			o.err = msg.err
+			o.step = stepKeyPaths
+			o.pathInputs[o.pathFocus].Focus()
+			return o, textinput.Blink
+		}
+		o.err = nil
+		o.publicKey = msg.publicKey
+		return o, o.enterRecipients()
+
+	case onboardingSaved:
+		if msg.err != nil {
+			o.err = msg.err
+			return o, nil
+		}
+		o.err = nil
+		if o.skipped {
+			return o, func() tea.Msg { return OnboardingDoneMsg{} }
+		}
+		o.step = stepDone
+		return o, nil
+
+	case components.PassphraseConfirmedMsg:
+		if msg.Passphrase == "" {
+			o.err = fmt.Errorf("passphrase must not be empty")
+			o.passphraseInput = components.NewPassphraseInput("Choose a passphrase for your key", true)
+			return o, textinput.Blink
+		}
+		o.err = nil
+		o.step = stepGenerating
+		return o, o.createKey(msg.Passphrase)
+
+	case components.PassphraseCancelledMsg:
+		return o, o.skip()
+
+	case tea.KeyMsg:
+		return o.handleKey(msg)
+	}
+
+	return o, nil
+}
+
+// handleKey handles key presses for the current step
+func (o *OnboardingView) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch o.step {
+	case stepChecks:
+		switch msg.String() {
+		case "enter":
+			o.step = stepKeyPaths
+			o.pathInputs[o.pathFocus].Focus()
+			return o, textinput.Blink
+		case "r":
+			o.checks = nil
+			return o, o.runChecks()
+		case "esc":
+			return o, o.skip()
+		}
+
+	case stepKeyPaths:
+		switch msg.String() {
+		case "tab", "shift+tab", "up", "down":
+			o.pathInputs[o.pathFocus].Blur()
+			o.pathFocus = (o.pathFocus + 1) % len(o.pathInputs)
+			o.pathInputs[o.pathFocus].Focus()
+			return o, textinput.Blink
+		case "enter":
+			return o, o.confirmPaths()
+		case "esc":
+			return o, o.skip()
+		}
+		o.pathInputs[o.pathFocus], cmd = o.pathInputs[o.pathFocus].Update(msg)
+		return o, cmd
+
+	case stepPassphrase:
+		var model tea.Model
+		model, cmd = o.passphraseInput.Update(msg)
+		if input, ok := model.(*components.PassphraseInput); ok {
+			o.passphraseInput = input
+		}
+		return o, cmd
+
+	case stepRecipients:
+		switch msg.String() {
+		case "enter":
+			recipients := strings.TrimSpace(o.recipientInput.Value())
+			if err := validateRecipients(recipients); err != nil {
+				o.err = err
+				return o, nil
+			}
+			o.err = nil
+			o.recipientInput.Blur()
+			return o, o.save(recipients)
+		case "esc":
+			return o, o.skip()
+		}
+		o.recipientInput, cmd = o.recipientInput.Update(msg)
+		return o, cmd
+
+	case stepDone:
+		if msg.String() == "enter" || msg.String() == "esc" {
+			return o, func() tea.Msg { return OnboardingDoneMsg{} }
+		}
+	}
+
+	return o, nil
+}
+
+// CapturingInput reports whether a text input currently has focus
+func (o *OnboardingView) CapturingInput() bool {
+	return o.step == stepKeyPaths || o.step == stepPassphrase || o.step == stepRecipients
+}
+
+// encryptedKeyPath returns the chosen path of the encrypted key
+func (o *OnboardingView) encryptedKeyPath() string {
+	return normalizedInput(o.pathInputs[0].Value())
+}
+
+// decryptedKeyPath returns the chosen path of the decrypted key
+func (o *OnboardingView) decryptedKeyPath() string {
+	return normalizedInput(o.pathInputs[1].Value())
+}
+
+// normalizedInput normalizes an entered path, see utils.NormalizePath.
+// confirmPaths reports paths that cannot be normalized, so they are only
+// expanded here.
+func normalizedInput(value string) string {
+	path, err := utils.NormalizePath(value)
+	if err != nil {
+		return utils.ExpandPath(strings.TrimSpace(value))
+	}
+	return path
+}
+
+// confirmPaths validates the key paths and moves on to key generation, or
+// straight to recipients if a key already exists at the chosen path
+func (o *OnboardingView) confirmPaths() tea.Cmd {
+	for _, input := range o.pathInputs {
+		if _, err := utils.NormalizePath(input.Value()); err != nil {
+			o.err = err
+			return nil
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.EncryptedKeyPath = o.encryptedKeyPath()
+	cfg.KeyPath = o.decryptedKeyPath()
+	if err := config.Validate(cfg); err != nil {
+		o.err = err
+		return nil
+	}
+	o.err = nil
+	o.pathInputs[o.pathFocus].Blur()
+
+	if utils.FileExists(cfg.EncryptedKeyPath) {
+		o.keyExisted = true
+		o.publicKey, _ = age.LoadPublicKey(cfg.EncryptedKeyPath)
+		return o.enterRecipients()
+	}
+
+	o.keyExisted = false
+	o.step = stepPassphrase
+	o.passphraseInput = components.NewPassphraseInput("Choose a passphrase for your key", true)
+	return textinput.Blink
+}
+
+// enterRecipients moves to the recipients step, suggesting the new public key
+func (o *OnboardingView) enterRecipients() tea.Cmd {
+	o.step = stepRecipients
+	if o.recipientInput.Value() == "" {
+		o.recipientInput.SetValue(o.publicKey)
+	}
+	o.recipientInput.Focus()
+	return textinput.Blink
+}
+
+// validateRecipients checks that the recipients can be used for encryption
+func validateRecipients(recipients string) error {
+	tokens := age.SplitRecipientInput(recipients)
+	if len(tokens) == 0 || age.NeedsFetch(tokens) {
+		// Remote recipients are resolved when they are used
+		return nil
+	}
+	_, err := age.ResolveRecipients(tokens)
+	return err
+}
+
+// runChecks checks that the required tools are installed
+func (o *OnboardingView) runChecks() tea.Cmd {
+	return func() tea.Msg {
+		return onboardingChecked{checks: doctor.Run()}
+	}
+}
+
+// createKey generates the first key, encrypted with the passphrase
+func (o *OnboardingView) createKey(passphrase string) tea.Cmd {
+	encryptedKeyPath := o.encryptedKeyPath()
+	return tea.Batch(o.spinner.Tick, func() tea.Msg {
+		keyPair, err := createEncryptedKey(passphrase, encryptedKeyPath)
+		if err != nil {
+			return onboardingKeyCreated{err: err}
+		}
+		return onboardingKeyCreated{publicKey: keyPair.PublicKey}
+	})
+}
+
+// save writes the configuration chosen in the wizard
+func (o *OnboardingView) save(recipients string) tea.Cmd {
+	cfg := config.DefaultConfig()
+	cfg.EncryptedKeyPath = o.encryptedKeyPath()
+	cfg.KeyPath = o.decryptedKeyPath()
+	cfg.DefaultRecipients = recipients
+
+	return func() tea.Msg {
+		return onboardingSaved{err: config.Save(cfg)}
+	}
+}
+
+// skip ends the wizard, saving the default configuration so it is not shown again
+func (o *OnboardingView) skip() tea.Cmd {
+	o.skipped = true
+	return func() tea.Msg {
+		return onboardingSaved{err: config.Save(config.DefaultConfig())}
+	}
+}
+
+// View renders the view
+func (o *OnboardingView) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5")).Padding(0, 1)
+	headerStyle := lipgloss.NewStyle().Bold(true).MarginTop(1).MarginBottom(1)
+	passStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00"))
+	warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00"))
+	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	var content, help string
+
+	switch o.step {
+	case stepChecks:
+		content = headerStyle.Render("Step 1 of 4: Check dependencies") + "\n"
+		if o.checks == nil {
+			content += o.spinner.View() + " Checking environment...\n"
+		}
+		for _, check := range o.checks {
+			style := passStyle
+			switch check.Status {
+			case doctor.StatusWarn:
+				style = warnStyle
+			case doctor.StatusFail:
+				style = failStyle
+			}
+			content += fmt.Sprintf("%s %s: %s\n", style.Render("["+check.Status.String()+"]"), check.Name, check.Message)
+			if check.Fix != "" && check.Status != doctor.StatusPass {
+				content += helpStyle.Render("       fix: "+check.Fix) + "\n"
+			}
+		}
+		if doctor.HasFailures(o.checks) {
+			content += "\n" + warnStyle.Render("Some checks failed. Key generation needs age and encryption needs sops.") + "\n"
+		}
+		help = "Enter: Continue • r: Re-run checks • Esc: Skip setup"
+
+	case stepKeyPaths:
+		content = headerStyle.Render("Step 2 of 4: Choose key paths") + "\n"
+		content += "The encrypted key is kept on disk; the decrypted key only exists while unlocked.\n\n"
+		for _, input := range o.pathInputs {
+			content += input.View() + "\n"
+		}
+		help = "Tab: Switch field • Enter: Continue • Esc: Skip setup"
+
+	case stepPassphrase:
+		content = headerStyle.Render("Step 3 of 4: Generate your key") + "\n"
+		content += o.passphraseInput.View() + "\n"
+		help = "Esc: Skip setup"
+
+	case stepGenerating:
+		content = headerStyle.Render("Step 3 of 4: Generate your key") + "\n"
+		content += o.spinner.View() + " Generating and encrypting key...\n"
+
+	case stepRecipients:
+		content = headerStyle.Render("Step 4 of 4: Default recipients") + "\n"
+		if o.keyExisted {
+			content += fmt.Sprintf("Using the existing key at %s\n", o.encryptedKeyPath())
+		} else if o.publicKey != "" {
+			content += passStyle.Render("Key generated: "+o.publicKey) + "\n"
+		}
+		content += "\nFiles are encrypted to these recipients unless you choose others. Leave empty to be asked each time.\n\n"
+		content += o.recipientInput.View() + "\n"
+		help = "Enter: Save configuration • Esc: Skip setup"
+
+	case stepDone:
+		content = headerStyle.Render("Setup complete") + "\n"
+		path, _ := config.ConfigPath()
+		content += fmt.Sprintf("Configuration saved to %s\n", path)
+		if o.publicKey != "" {
+			content += fmt.Sprintf("Your public key: %s\n", o.publicKey)
+		}
+		content += "\nUnlock your key in the Key Manager tab, then encrypt files from the Files tab.\n"
+		help = "Enter: Start using supper"
+	}
+
+	if o.err != nil {
+		content += "\n" + failStyle.Render(fmt.Sprintf("Error: %v", o.err)) + "\n"
+	}
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		titleStyle.Render("Welcome to supper"),
+		content,
+		helpStyle.Render(help),
+	)
+}
+
@@ -0,0 +1,749 @@
+package views
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/config"
+	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Rules view states
+const (
+	rulesList int = iota
+	rulesEditing
+	rulesConfirmDelete
+)
+
+// Fields of the rule form, in the order they are shown
+const (
+	ruleFieldRegex int = iota
+	ruleFieldAge
+	ruleFieldGroups
+	ruleFieldThreshold
+	ruleFieldEncryptedRegex
+	ruleFieldUnencryptedRegex
+	ruleFieldEncryptedSuffix
+	ruleFieldUnencryptedSuffix
+	ruleFieldCount
+)
+
+// ruleFieldLabels names the fields of the rule form
+var ruleFieldLabels = [ruleFieldCount]string{
+	"Path regex",
+	"Age recipients",
+	"Key groups",
+	"Shamir threshold",
+	"Encrypted regex",
+	"Unencrypted regex",
+	"Encrypted suffix",
+	"Unencrypted suffix",
+}
+
+// rulesLoaded carries the creation rules read from .sops.yaml
+type rulesLoaded struct {
+	path  string
+	found bool // Whether the .sops.yaml exists yet
+	rules []sops.CreationRule
+	err   error
+}
+
+// rulesSaved is sent once the rules have been written to .sops.yaml
+type rulesSaved struct {
+	path  string
+	count int
+	err   error
+}
+
+// rulesPreviewTick fires once typing in the rule form has paused
+type rulesPreviewTick struct {
+	seq int
+}
+
+// rulesPreviewed carries the files a rule matches
+type rulesPreviewed struct {
+	seq      int
+	files    []string
+	shadowed []string // Matched first by an earlier rule
+	err      error
+}
+
+// rulesCovered carries the files the rules being edited cover and miss
+type rulesCovered struct {
+	covered   []string
+	uncovered []string
+	err       error
+}
+
+// RulesView lists and edits the creation rules of the nearest .sops.yaml.
+// Changes are kept in memory, previewed against the files around the
+// .sops.yaml and only written when saved.
+type RulesView struct {
+	keys    KeyMap
+	layout  LayoutMsg
+	width   int
+	height  int
+	state   int
+	path    string // The .sops.yaml the rules are saved to
+	found   bool
+	rules   []sops.CreationRule
+	cursor  int
+	dirty   bool // Rules were changed since they were loaded or saved
+	err     error
+	notice  string
+	editing int // Index of the rule in the form; len(rules) for a new one
+	inputs  []textinput.Model
+	focus   int
+	formErr string
+	// Which files of a git repository the coverage check covers
+	gitScope string
+
+	previewSeq      int
+	previewFiles    []string
+	previewShadowed []string
+	previewErr      error
+	coverage        *rulesCovered
+}
+
+// NewRulesView creates a new rules view
+func NewRulesView() *RulesView {
+	inputs := make([]textinput.Model, ruleFieldCount)
+	for i := range inputs {
+		input := textinput.New()
+		input.Width = 60
+		inputs[i] = input
+	}
+	inputs[ruleFieldAge].Placeholder = "age1..., comma-separated; self and recipient_aliases work"
+	inputs[ruleFieldGroups].Placeholder = "age1a,age1b; age1c (instead of age recipients)"
+	inputs[ruleFieldThreshold].Placeholder = "groups needed to decrypt"
+
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	return &RulesView{
+		keys:     DefaultKeyMap(),
+		inputs:   inputs,
+		gitScope: cfg.GitScope,
+	}
+}
+
+// Init initializes the view
+func (r *RulesView) Init() tea.Cmd {
+	return loadRules
+}
+
+// loadRules reads the .sops.yaml sops would use from the working directory
+func loadRules() tea.Msg {
+	dir, err := os.Getwd()
+	if err != nil {
+		return rulesLoaded{err: err}
+	}
+	path, found := sops.FindConfig(dir)
+	if !found {
+		path = filepath.Join(dir, sops.ConfigFileName)
+	}
+	cfg, err := sops.LoadConfig(path)
+	if err != nil {
+		return rulesLoaded{path: path, found: found, err: err}
+	}
+	return rulesLoaded{path: path, found: found, rules: cfg.CreationRules}
+}
+
+// CapturingInput reports whether a text input currently has focus
+func (r *RulesView) CapturingInput() bool {
+	return r.state == rulesEditing
+}
+
+// ShortHelp returns the keys of what the view is showing for the hint bar
+func (r *RulesView) ShortHelp() []key.Binding {
+	switch r.state {
+	case rulesEditing:
+		return []key.Binding{relabel(r.keys.Enter, "apply"), relabel(r.keys.Tab, "next field"), r.keys.Cancel}
+	case rulesConfirmDelete:
+		return []key.Binding{relabel(r.keys.Enter, "delete"), relabel(r.keys.Cancel, "keep")}
+	}
+	kb := []key.Binding{relabel(r.keys.Enter, "edit"), relabel(r.keys.Audit, "add rule"), relabel(r.keys.DeleteKey, "delete rule"), r.keys.MoveUp, r.keys.MoveDown}
+	if r.dirty {
+		kb = append(kb, relabel(r.keys.SaveReport, "save"))
+	}
+	return kb
+}
+
+// FullHelp returns every key of the rules list
+func (r *RulesView) FullHelp() [][]key.Binding {
+	if r.state != rulesList {
+		return [][]key.Binding{r.ShortHelp()}
+	}
+	return [][]key.Binding{
+		{relabel(r.keys.Enter, "edit"), relabel(r.keys.Audit, "add rule"), relabel(r.keys.DeleteKey, "delete rule"), r.keys.MoveUp, r.keys.MoveDown},
+		{r.keys.Preview, relabel(r.keys.Coverage, "coverage"), relabel(r.keys.SaveReport, "save"), r.keys.Revert},
+	}
+}
+
+// Update handles events and updates the model
+func (r *RulesView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		r.width = msg.Width
+		r.height = msg.Height
+
+	case LayoutMsg:
+		r.layout = msg
+
+	case ConfigSavedMsg:
+		r.gitScope = msg.Config.GitScope
+
+	case rulesLoaded:
+		r.path = msg.path
+		r.found = msg.found
+		r.err = msg.err
+		if msg.err == nil {
+			r.rules = msg.rules
+			r.dirty = false
+		}
+		r.cursor = max(0, min(len(r.rules)-1, r.cursor))
+		r.clearChecks()
+
+	case rulesSaved:
+		if msg.err != nil {
+			r.err = msg.err
+			break
+		}
+		r.err = nil
+		r.found = true
+		r.dirty = false
+		r.notice = fmt.Sprintf("Saved %d rule(s) to %s", msg.count, msg.path)
+
+	case rulesPreviewTick:
+		if msg.seq == r.previewSeq && r.state == rulesEditing {
+			return r, r.previewForm(msg.seq)
+		}
+
+	case rulesPreviewed:
+		// Drop results for a regex that has since been edited
+		if msg.seq == r.previewSeq {
+			r.previewFiles = msg.files
+			r.previewShadowed = msg.shadowed
+			r.previewErr = msg.err
+		}
+
+	case rulesCovered:
+		r.coverage = &msg
+
+	case tea.KeyMsg:
+		switch r.state {
+		case rulesEditing:
+			return r, r.updateForm(msg)
+		case rulesConfirmDelete:
+			return r, r.updateConfirmDelete(msg)
+		}
+		return r, r.updateList(msg)
+	}
+	return r, nil
+}
+
+// updateList handles keys while the rules are listed
+func (r *RulesView) updateList(msg tea.KeyMsg) tea.Cmd {
+	r.notice = ""
+	switch {
+	case key.Matches(msg, r.keys.Up):
+		r.cursor = max(0, r.cursor-1)
+		r.previewFiles, r.previewShadowed, r.previewErr = nil, nil, nil
+
+	case key.Matches(msg, r.keys.Down):
+		r.cursor = max(0, min(len(r.rules)-1, r.cursor+1))
+		r.previewFiles, r.previewShadowed, r.previewErr = nil, nil, nil
+
+	case key.Matches(msg, r.keys.Enter) && len(r.rules) > 0:
+		return r.openForm(r.cursor)
+
+	case key.Matches(msg, r.keys.Audit):
+		return r.openForm(len(r.rules))
+
+	case key.Matches(msg, r.keys.DeleteKey) && len(r.rules) > 0:
+		r.state = rulesConfirmDelete
+
+	case key.Matches(msg, r.keys.MoveUp) && r.cursor > 0:
+		r.rules[r.cursor-1], r.rules[r.cursor] = r.rules[r.cursor], r.rules[r.cursor-1]
+		r.cursor--
+		r.changed()
+
+	case key.Matches(msg, r.keys.MoveDown) && r.cursor < len(r.rules)-1:
+		r.rules[r.cursor+1], r.rules[r.cursor] = r.rules[r.cursor], r.rules[r.cursor+1]
+		r.cursor++
+		r.changed()
+
+	case key.Matches(msg, r.keys.Preview) && len(r.rules) > 0:
+		r.previewSeq++
+		return r.preview(r.previewSeq, r.rules, r.cursor)
+
+	case key.Matches(msg, r.keys.Coverage):
+		return r.checkCoverage()
+
+	case key.Matches(msg, r.keys.SaveReport) && r.dirty:
+		return r.save()
+
+	case key.Matches(msg, r.keys.Revert):
+		return loadRules
+	}
+	return nil
+}
+
+// updateConfirmDelete handles keys while a deletion waits for confirmation
+func (r *RulesView) updateConfirmDelete(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, r.keys.Enter) || msg.String() == "y":
+		r.rules = append(r.rules[:r.cursor], r.rules[r.cursor+1:]...)
+		r.cursor = max(0, min(len(r.rules)-1, r.cursor))
+		r.changed()
+		r.state = rulesList
+	case key.Matches(msg, r.keys.Cancel) || msg.String() == "n":
+		r.state = rulesList
+	}
+	return nil
+}
+
+// changed marks the rules as edited; earlier checks no longer apply
+func (r *RulesView) changed() {
+	r.dirty = true
+	r.clearChecks()
+}
+
+// clearChecks drops the preview and coverage of rules that have changed
+func (r *RulesView) clearChecks() {
+	r.previewFiles, r.previewShadowed, r.previewErr = nil, nil, nil
+	r.coverage = nil
+}
+
+// openForm starts editing the rule at index, or a new one at len(rules)
+func (r *RulesView) openForm(index int) tea.Cmd {
+	var rule sops.CreationRule
+	if index < len(r.rules) {
+		rule = r.rules[index]
+	}
+
+	var groups []string
+	for _, g := range rule.KeyGroups {
+		groups = append(groups, strings.Join(g.Keys(), ","))
+	}
+	values := [ruleFieldCount]string{
+		ruleFieldRegex:             rule.PathRegex,
+		ruleFieldAge:               rule.Age,
+		ruleFieldGroups:            strings.Join(groups, "; "),
+		ruleFieldEncryptedRegex:    rule.EncryptedRegex,
+		ruleFieldUnencryptedRegex:  rule.UnencryptedRegex,
+		ruleFieldEncryptedSuffix:   rule.EncryptedSuffix,
+		ruleFieldUnencryptedSuffix: rule.UnencryptedSuffix,
+	}
+	if rule.ShamirThreshold > 0 {
+		values[ruleFieldThreshold] = strconv.Itoa(rule.ShamirThreshold)
+	}
+	for i := range r.inputs {
+		r.inputs[i].SetValue(values[i])
+		r.inputs[i].Blur()
+	}
+
+	r.editing = index
+	r.focus = ruleFieldRegex
+	r.formErr = ""
+	r.state = rulesEditing
+	r.clearChecks()
+	return tea.Batch(r.inputs[r.focus].Focus(), r.schedulePreview())
+}
+
+// updateForm handles keys while a rule is edited
+func (r *RulesView) updateForm(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		r.state = rulesList
+		r.clearChecks()
+		return nil
+	case tea.KeyEnter:
+		return r.applyForm()
+	case tea.KeyTab, tea.KeyDown:
+		return r.focusField((r.focus + 1) % ruleFieldCount)
+	case tea.KeyShiftTab, tea.KeyUp:
+		return r.focusField((r.focus - 1 + ruleFieldCount) % ruleFieldCount)
+	}
+
+	before := r.inputs[r.focus].Value()
+	var cmd tea.Cmd
+	r.inputs[r.focus], cmd = r.inputs[r.focus].Update(msg)
+	if r.inputs[r.focus].Value() != before {
+		return tea.Batch(cmd, r.schedulePreview())
+	}
+	return cmd
+}
+
+// focusField moves the cursor to another field of the form
+func (r *RulesView) focusField(field int) tea.Cmd {
+	r.inputs[r.focus].Blur()
+	r.focus = field
+	return r.inputs[r.focus].Focus()
+}
+
+// formRule builds the rule the form describes, keeping the settings of the
+// rule being edited that the form does not show
+func (r *RulesView) formRule() (sops.CreationRule, error) {
+	var rule sops.CreationRule
+	if r.editing < len(r.rules) {
+		rule = r.rules[r.editing]
+	}
+	value := func(field int) string { return strings.TrimSpace(r.inputs[field].Value()) }
+
+	rule.PathRegex = value(ruleFieldRegex)
+	rule.EncryptedRegex = value(ruleFieldEncryptedRegex)
+	rule.UnencryptedRegex = value(ruleFieldUnencryptedRegex)
+	rule.EncryptedSuffix = value(ruleFieldEncryptedSuffix)
+	rule.UnencryptedSuffix = value(ruleFieldUnencryptedSuffix)
+
+	// .sops.yaml holds the keys themselves, so aliases are expanded here
+	rule.Age = ""
+	if tokens := age.SplitRecipientInput(value(ruleFieldAge)); len(tokens) > 0 {
+		recipients, err := age.ResolveRecipients(tokens)
+		if err != nil {
+			return rule, err
+		}
+		if err := onlyAge(recipients); err != nil {
+			return rule, err
+		}
+		rule.Age = strings.Join(age.RecipientKeys(recipients), ",")
+	}
+
+	rule.KeyGroups = nil
+	rule.ShamirThreshold = 0
+	if groups := value(ruleFieldGroups); groups != "" {
+		if rule.Age != "" {
+			return rule, fmt.Errorf("give either age recipients or key groups, not both")
+		}
+		parsed, err := sops.ParseKeyGroups(groups)
+		if err != nil {
+			return rule, err
+		}
+		for i := range parsed {
+			if err := onlyAge(parsed[i].Recipients); err != nil {
+				return rule, err
+			}
+			// Keys of other kinds stay with the group in the same place
+			if r.editing < len(r.rules) && i < len(r.rules[r.editing].KeyGroups) {
+				parsed[i].KeepOtherKeys(r.rules[r.editing].KeyGroups[i])
+			}
+		}
+		rule.KeyGroups = parsed
+	}
+	if threshold := value(ruleFieldThreshold); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 1 {
+			return rule, fmt.Errorf("the Shamir threshold must be a positive number")
+		}
+		rule.ShamirThreshold = n
+	}
+
+	return rule, rule.Validate()
+}
+
+// onlyAge rejects recipients of other kinds, which the form cannot write to
+// .sops.yaml
+func onlyAge(recipients []age.Recipient) error {
+	for _, rec := range recipients {
+		if !rec.IsAge() {
+			return fmt.Errorf("only age recipients can be edited here; add %s keys to .sops.yaml by hand", rec.KindOrAge())
+		}
+	}
+	return nil
+}
+
+// applyForm puts the edited rule in the list, unsaved
+func (r *RulesView) applyForm() tea.Cmd {
+	rule, err := r.formRule()
+	if err != nil {
+		r.formErr = err.Error()
+		return nil
+	}
+
+	if r.editing < len(r.rules) {
+		r.rules[r.editing] = rule
+	} else {
+		r.rules = append(r.rules, rule)
+	}
+	r.cursor = r.editing
+	r.state = rulesList
+	r.changed()
+	return nil
+}
+
+// schedulePreview refreshes the form's match preview after typing pauses
+func (r *RulesView) schedulePreview() tea.Cmd {
+	r.previewSeq++
+	seq := r.previewSeq
+	return tea.Tick(rulePreviewDelay, func(time.Time) tea.Msg {
+		return rulesPreviewTick{seq: seq}
+	})
+}
+
+// previewForm lists the files the path regex of the form matches, in place
+// of the rule being edited
+func (r *RulesView) previewForm(seq int) tea.Cmd {
+	rules := append([]sops.CreationRule(nil), r.rules...)
+	rule := sops.CreationRule{PathRegex: strings.TrimSpace(r.inputs[ruleFieldRegex].Value())}
+	if r.editing < len(rules) {
+		rules[r.editing] = rule
+	} else {
+		rules = append(rules, rule)
+	}
+	return r.preview(seq, rules, r.editing)
+}
+
+// preview lists the files the rule at index of rules matches
+func (r *RulesView) preview(seq int, rules []sops.CreationRule, index int) tea.Cmd {
+	root := filepath.Dir(r.path)
+	return func() tea.Msg {
+		files, shadowed, err := sops.RuleMatches(rules, index, root)
+		return rulesPreviewed{seq: seq, files: files, shadowed: shadowed, err: err}
+	}
+}
+
+// checkCoverage compares the files around .sops.yaml with the rules as
+// edited, saved or not
+func (r *RulesView) checkCoverage() tea.Cmd {
+	rules := append([]sops.CreationRule(nil), r.rules...)
+	root := filepath.Dir(r.path)
+	scope := r.gitScope
+	return func() tea.Msg {
+		covered, uncovered, err := sops.RuleCoverage(root, root, rules, sops.WithGitScope(scope))
+		return rulesCovered{covered: covered, uncovered: uncovered, err: err}
+	}
+}
+
+// save writes the rules to .sops.yaml, backing up the previous file
+func (r *RulesView) save() tea.Cmd {
+	path := r.path
+	rules := append([]sops.CreationRule(nil), r.rules...)
+	return func() tea.Msg {
+		err := sops.WriteCreationRules(path, rules)
+		return rulesSaved{path: path, count: len(rules), err: err}
+	}
+}
+
+// View renders the view
+func (r *RulesView) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5")).Padding(0, 1)
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+
+	header := r.path
+	if !r.found {
+		header += dim.Render(" (not created yet; saving creates it)")
+	}
+	if r.dirty {
+		header += lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render("  unsaved changes")
+	}
+	lines := []string{header, ""}
+
+	switch r.state {
+	case rulesEditing:
+		lines = append(lines, r.formView()...)
+	case rulesConfirmDelete:
+		lines = append(lines, r.tableView()...)
+		lines = append(lines, "", lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFAA00")).Render(
+			fmt.Sprintf("Delete rule %d (%s)? Enter or y to delete, Esc to keep it", r.cursor+1, ruleRegex(r.rules[r.cursor]))))
+	default:
+		lines = append(lines, r.tableView()...)
+		if len(r.rules) > 0 {
+			lines = append(lines, "", r.detailView())
+		}
+		if r.previewFiles != nil || r.previewShadowed != nil || r.previewErr != nil {
+			lines = append(lines, "", r.previewView())
+		}
+		if r.coverage != nil {
+			lines = append(lines, "", r.coverageView())
+		}
+	}
+
+	if r.notice != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00")).Render(r.notice))
+	}
+	if r.err != nil {
+		lines = append(lines, "", errorStyle.Render(fmt.Sprintf("Error: %v", r.err)))
+	}
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		titleStyle.Render("Creation Rules"),
+		r.layout.box().Render(lipgloss.JoinVertical(lipgloss.Left, lines...)),
+	)
+}
+
+// tableView renders the rules as a table, in the order sops tries them
+func (r *RulesView) tableView() []string {
+	if len(r.rules) == 0 {
+		return []string{lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render("No creation rules; press a to add one")}
+	}
+
+	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
+	row := func(n, regex, recipients, groups, options string) string {
+		return fmt.Sprintf("%-3s %-32s %-22s %-14s %s", n, regex, recipients, groups, options)
+	}
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(row("#", "Path regex", "Recipients", "Key groups", "Regex options"))}
+	for i, rule := range r.rules {
+		groups := "-"
+		if len(rule.KeyGroups) > 0 {
+			groups = fmt.Sprintf("%d", len(rule.KeyGroups))
+			if rule.ShamirThreshold > 0 {
+				groups += fmt.Sprintf(", %d needed", rule.ShamirThreshold)
+			}
+		}
+		line := row(strconv.Itoa(i+1), truncateKey(ruleRegex(rule), 32), truncateKey(ruleRecipients(rule), 22), groups, truncateKey(ruleOptions(rule), 30))
+		if i == r.cursor {
+			line = selectedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// detailView shows the selected rule in full
+func (r *RulesView) detailView() string {
+	rule := r.rules[r.cursor]
+	lines := []string{fmt.Sprintf("Rule %d: %s", r.cursor+1, ruleRegex(rule))}
+	for _, key := range age.SplitRecipientInput(rule.Age) {
+		lines = append(lines, "  "+truncateKey(key, 70))
+	}
+	for i, g := range rule.KeyGroups {
+		lines = append(lines, fmt.Sprintf("  Group %d:", i+1))
+		for _, key := range g.Keys() {
+			lines = append(lines, "    "+truncateKey(key, 68))
+		}
+		if n := g.OtherKeys(); n > 0 {
+			lines = append(lines, fmt.Sprintf("    + %d key(s) of other kinds, kept as written", n))
+		}
+	}
+	if len(rule.Other) > 0 {
+		var names []string
+		for name := range rule.Other {
+			names = append(names, name)
+		}
+		lines = append(lines, fmt.Sprintf("  Also sets %s, kept as written", strings.Join(names, ", ")))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// formView renders the rule form with the live match preview
+func (r *RulesView) formView() []string {
+	title := "New rule"
+	if r.editing < len(r.rules) {
+		title = fmt.Sprintf("Edit rule %d", r.editing+1)
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(title), ""}
+	for i, input := range r.inputs {
+		label := fmt.Sprintf("%-19s", ruleFieldLabels[i]+":")
+		if i == r.focus {
+			label = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#1E88E5")).Render(label)
+		}
+		lines = append(lines, label+" "+input.View())
+	}
+	lines = append(lines, "",
+		lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Render(
+			"Give age recipients or key groups; set at most one regex or suffix option. An empty path regex matches every file."))
+	if r.formErr != "" {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(r.formErr))
+	}
+	return append(lines, "", r.previewView())
+}
+
+// previewView renders the files matched by the previewed rule
+func (r *RulesView) previewView() string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+	if r.previewErr != nil {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(r.previewErr.Error())
+	}
+	if len(r.previewFiles) == 0 && len(r.previewShadowed) == 0 {
+		return dim.Render(fmt.Sprintf("No files under %s match", filepath.Dir(r.path)))
+	}
+
+	lines := []string{fmt.Sprintf("Matches %d file(s):", len(r.previewFiles))}
+	for i, file := range r.previewFiles {
+		if i == rulePreviewLimit {
+			lines = append(lines, dim.Render(fmt.Sprintf("  ... and %d more", len(r.previewFiles)-rulePreviewLimit)))
+			break
+		}
+		lines = append(lines, "  "+file)
+	}
+	if len(r.previewShadowed) > 0 {
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render(
+			fmt.Sprintf("%d more file(s) match an earlier rule first, so sops uses that rule for them", len(r.previewShadowed))))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// coverageView renders the files the rules as edited leave uncovered
+func (r *RulesView) coverageView() string {
+	if r.coverage.err != nil {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(r.coverage.err.Error())
+	}
+	lines := []string{fmt.Sprintf("Coverage: %d file(s) covered, %d not covered by any rule", len(r.coverage.covered), len(r.coverage.uncovered))}
+	for i, file := range r.coverage.uncovered {
+		if i == rulePreviewLimit {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(r.coverage.uncovered)-rulePreviewLimit))
+			break
+		}
+		marker := "  "
+		if sops.LooksLikeSecret(filepath.Join(filepath.Dir(r.path), file)) {
+			marker = "⚠ "
+		}
+		lines = append(lines, marker+file)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// ruleRegex describes a rule's path regex; an empty one matches every file
+func ruleRegex(rule sops.CreationRule) string {
+	if rule.PathRegex == "" {
+		return "(every file)"
+	}
+	return rule.PathRegex
+}
+
+// ruleRecipients summarizes the keys a rule encrypts to
+func ruleRecipients(rule sops.CreationRule) string {
+	summary := fmt.Sprintf("%d age", len(rule.Recipients()))
+	other := 0
+	for _, g := range rule.KeyGroups {
+		other += g.OtherKeys()
+	}
+	if other > 0 {
+		summary += fmt.Sprintf(", %d other", other)
+	}
+	return summary
+}
+
+// ruleOptions lists the options choosing which values a rule encrypts
+func ruleOptions(rule sops.CreationRule) string {
+	var options []string
+	for _, opt := range []struct{ name, value string }{
+		{"encrypted_regex", rule.EncryptedRegex},
+		{"unencrypted_regex", rule.UnencryptedRegex},
+		{"encrypted_suffix", rule.EncryptedSuffix},
+		{"unencrypted_suffix", rule.UnencryptedSuffix},
+	} {
+		if opt.value != "" {
+			options = append(options, opt.name+"="+opt.value)
+		}
+	}
+	if len(options) == 0 {
+		return "-"
+	}
+	return strings.Join(options, " ")
+}
@@ -2,9 +2,9 @@ package views
 
 import (
 	"fmt"
-	"time"
+	"strconv"
+	"strings"
 
-	"github.com/bxtal-lsn/supper/internal/age"
 	"github.com/bxtal-lsn/supper/internal/config"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -13,66 +13,57 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+// SettingKind describes how a setting is edited
+type SettingKind int
+
+const (
+	SettingText SettingKind = iota
+	SettingBool
+)
+
 // SettingItem represents a setting in the settings view
 type SettingItem struct {
 	Name        string
 	Description string
+	Group       string
+	Kind        SettingKind
 	Value       string
 	Editable    bool
 	InputField  textinput.Model
+	Err         string
+
+	// field is the setting's key in config.json
+	field string
+	// path marks settings that hold a file path, which are stored normalized
+	path bool
+	// load reads the setting's value from the configuration
+	load func(cfg *config.Config) string
+	// apply parses value into the configuration, returning a validation error
+	apply func(cfg *config.Config, value string) error
 }
 
 // SettingsView is the view for application settings
 type SettingsView struct {
-	keys       KeyMap
-	viewport   viewport.Model
-	width      int
-	height     int
-	settings   []SettingItem
-	cursor     int
-	editingIdx int
-	err        error
+	keys        KeyMap
+	viewport    viewport.Model
+	width       int
+	height      int
+	settings    []SettingItem
+	cursor      int
+	editingIdx  int
+	searchInput textinput.Model
+	searching   bool
+	err         error
+	notice      string
 }
 
 // NewSettingsView creates a new settings view
 func NewSettingsView() *SettingsView {
-	// Create settings
-	settings := []SettingItem{
-		{
-			Name:        "Age Key Path",
-			Description: "Path to the age key file",
-			Value:       age.DefaultKeyPath(),
-			Editable:    true,
-		},
-		{
-			Name:        "Encrypted Key Path",
-			Description: "Path to the encrypted age key file",
-			Value:       age.DefaultEncryptedKeyPath(),
-			Editable:    true,
-		},
-		{
-			Name:        "Auto-Delete Interval",
-			Description: "Automatically delete decrypted key after this time",
-			Value:       "30m",
-			Editable:    true,
-		},
-		{
-			Name:        "Editor Command",
-			Description: "Command to use for editing files",
-			Value:       "default",
-			Editable:    true,
-		},
-		{
-			Name:        "Default Recipients",
-			Description: "Default age recipients for new files",
-			Value:       "",
-			Editable:    true,
-		},
-	}
+	settings := defaultSettings()
 
 	// Initialize input fields
 	for i := range settings {
-		if settings[i].Editable {
+		if settings[i].Editable && settings[i].Kind == SettingText {
 			input := textinput.New()
 			input.Placeholder = settings[i].Value
 			input.Width = 40
@@ -80,19 +71,113 @@ func NewSettingsView() *SettingsView {
 		}
 	}
 
+	search := textinput.New()
+	search.Placeholder = "Type to filter settings"
+	search.Prompt = "/ "
+	search.Width = 40
+
 	return &SettingsView{
-		keys:       DefaultKeyMap(),
-		settings:   settings,
-		cursor:     0,
-		editingIdx: -1,
+		keys:        DefaultKeyMap(),
+		settings:    settings,
+		cursor:      0,
+		editingIdx:  -1,
+		searchInput: search,
 	}
 }
 
+// defaultSettings returns the settings shown in the view
+func defaultSettings() []SettingItem {
+	defaults := config.DefaultConfig()
+
+	var settings []SettingItem
+	for _, field := range config.Schema() {
+		kind := SettingText
+		if field.Type == "bool" {
+			kind = SettingBool
+		}
+		settings = append(settings, SettingItem{
+			Name:        field.Label,
+			Description: field.Description,
+			Group:       field.Group,
+			Kind:        kind,
+			field:       field.Name,
+			path:        field.Type == "path",
+			load:        field.Get,
+			apply:       field.Set,
+		})
+	}
+
+	// Show the defaults until the configuration has been loaded
+	for i := range settings {
+		settings[i].Editable = true
+		settings[i].Value = settings[i].load(defaults)
+	}
+
+	// Keep the settings ordered by group so headers are rendered once
+	ordered := make([]SettingItem, 0, len(settings))
+	for _, group := range config.Groups {
+		for _, setting := range settings {
+			if setting.Group == group {
+				ordered = append(ordered, setting)
+			}
+		}
+	}
+
+	return ordered
+}
+
 // Init initializes the view
 func (s *SettingsView) Init() tea.Cmd {
 	return s.loadSettings()
 }
 
+// CapturingInput reports whether a text input currently has focus
+func (s *SettingsView) CapturingInput() bool {
+	return s.searching || s.editingIdx >= 0
+}
+
+// ShortHelp returns the keys of what the settings are showing for the hint bar
+func (s *SettingsView) ShortHelp() []key.Binding {
+	switch {
+	case s.editingIdx >= 0:
+		return []key.Binding{relabel(s.keys.Enter, "save"), s.keys.Cancel}
+	case s.searching:
+		return []key.Binding{relabel(s.keys.Enter, "keep filter"), relabel(s.keys.Cancel, "clear")}
+	}
+	return []key.Binding{relabel(s.keys.Enter, "edit"), s.keys.Search, s.keys.Toggle}
+}
+
+// FullHelp returns every settings key
+func (s *SettingsView) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{relabel(s.keys.Enter, "edit"), s.keys.Search, s.keys.Toggle}}
+}
+
+// visibleSettings returns the indexes of settings matching the search filter
+func (s *SettingsView) visibleSettings() []int {
+	query := strings.ToLower(strings.TrimSpace(s.searchInput.Value()))
+
+	var visible []int
+	for i, setting := range s.settings {
+		if query == "" ||
+			strings.Contains(strings.ToLower(setting.Name), query) ||
+			strings.Contains(strings.ToLower(setting.Description), query) ||
+			strings.Contains(strings.ToLower(setting.Group), query) {
+			visible = append(visible, i)
+		}
+	}
+	return visible
+}
+
+// selectedSetting returns the index of the setting under the cursor, or -1
+func (s *SettingsView) selectedSetting() int {
+	visible := s.visibleSettings()
+	if len(visible) == 0 {
+		return -1
+	}
+	s.cursor = max(0, min(len(visible)-1, s.cursor))
+	return visible[s.cursor]
+}
+
 // Update handles events and updates the model
 func (s *SettingsView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
@@ -105,19 +190,32 @@ func (s *SettingsView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		s.viewport = viewport.New(msg.Width, msg.Height-5)
 		s.viewport.YPosition = 2
 
-	case tea.KeyMsg:
-		// If currently editing a setting
+	case ConfigSavedMsg:
+		// Show reloaded values, unless one is being edited
 		if s.editingIdx >= 0 {
+			break
+		}
+		for i := range s.settings {
+			s.settings[i].Value = s.settings[i].load(msg.Config)
+			s.settings[i].Err = ""
+		}
+
+	case tea.KeyMsg:
+		switch {
+		case s.editingIdx >= 0:
+			// If currently editing a setting
 			switch msg.Type {
 			case tea.KeyEnter:
 				// Save the edited value
 				s.settings[s.editingIdx].Value = s.settings[s.editingIdx].InputField.Value()
+				s.settings[s.editingIdx].InputField.Blur()
 				s.editingIdx = -1
 				// Save all settings
 				return s, s.saveSettings()
 
 			case tea.KeyEsc:
 				// Cancel editing
+				s.settings[s.editingIdx].InputField.Blur()
 				s.editingIdx = -1
 				return s, nil
 			}
@@ -125,20 +223,61 @@ func (s *SettingsView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Update the input field
 			s.settings[s.editingIdx].InputField, cmd = s.settings[s.editingIdx].InputField.Update(msg)
 			cmds = append(cmds, cmd)
-		} else {
+
+		case s.searching:
+			// Typing filters the settings until Enter keeps or Esc clears the filter
+			switch msg.Type {
+			case tea.KeyEnter:
+				s.searching = false
+				s.searchInput.Blur()
+				return s, nil
+
+			case tea.KeyEsc:
+				s.searching = false
+				s.searchInput.Blur()
+				s.searchInput.SetValue("")
+				return s, nil
+			}
+
+			s.searchInput, cmd = s.searchInput.Update(msg)
+			s.cursor = 0
+			cmds = append(cmds, cmd)
+
+		default:
 			// Regular navigation
 			switch {
+			case key.Matches(msg, s.keys.Search):
+				s.searching = true
+				s.searchInput.Focus()
+				return s, textinput.Blink
+
+			case key.Matches(msg, s.keys.Cancel) && s.searchInput.Value() != "":
+				s.searchInput.SetValue("")
+				s.cursor = 0
+
 			case key.Matches(msg, s.keys.Up):
 				s.cursor = max(0, s.cursor-1)
 
 			case key.Matches(msg, s.keys.Down):
-				s.cursor = min(len(s.settings)-1, s.cursor+1)
+				s.cursor = min(len(s.visibleSettings())-1, s.cursor+1)
+
+			case key.Matches(msg, s.keys.Enter), key.Matches(msg, s.keys.Toggle):
+				idx := s.selectedSetting()
+				if idx < 0 || !s.settings[idx].Editable {
+					break
+				}
 
-			case key.Matches(msg, s.keys.Enter):
-				if s.settings[s.cursor].Editable {
-					s.editingIdx = s.cursor
-					s.settings[s.editingIdx].InputField.SetValue(s.settings[s.editingIdx].Value)
-					s.settings[s.editingIdx].InputField.Focus()
+				// Boolean settings toggle in place and save immediately
+				if s.settings[idx].Kind == SettingBool {
+					value, _ := strconv.ParseBool(s.settings[idx].Value)
+					s.settings[idx].Value = strconv.FormatBool(!value)
+					return s, s.saveSettings()
+				}
+
+				if key.Matches(msg, s.keys.Enter) {
+					s.editingIdx = idx
+					s.settings[idx].InputField.SetValue(s.settings[idx].Value)
+					s.settings[idx].InputField.Focus()
 					return s, textinput.Blink
 				}
 			}
@@ -159,16 +298,35 @@ func (s *SettingsView) View() string {
 	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5")).Padding(0, 1)
 	selectedStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#1E88E5"))
 	normalStyle := lipgloss.NewStyle()
+	groupStyle := lipgloss.NewStyle().Bold(true).Underline(true).Foreground(lipgloss.Color("#1E88E5"))
 	descriptionStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
 	valueStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#00AA00"))
 	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
 
 	content := ""
 
-	// Render each setting
-	for i, setting := range s.settings {
+	// Show the search filter when active or set
+	if s.searching || s.searchInput.Value() != "" {
+		content += s.searchInput.View() + "\n\n"
+	}
+
+	visible := s.visibleSettings()
+	if len(visible) == 0 {
+		content += descriptionStyle.Render("No settings match the filter") + "\n\n"
+	}
+	selected := s.selectedSetting()
+
+	// Render each setting, with a header whenever the group changes
+	group := ""
+	for _, i := range visible {
+		setting := s.settings[i]
+		if setting.Group != group {
+			group = setting.Group
+			content += groupStyle.Render(group) + "\n\n"
+		}
+
 		var row string
-		isSelected := i == s.cursor
+		isSelected := i == selected
 		isEditing := i == s.editingIdx
 
 		// Format the row
@@ -188,9 +346,18 @@ func (s *SettingsView) View() string {
 				style = normalStyle
 			}
 
+			value := setting.Value
+			if setting.Kind == SettingBool {
+				if v, _ := strconv.ParseBool(value); v {
+					value = "[x] on"
+				} else {
+					value = "[ ] off"
+				}
+			}
+
 			row = fmt.Sprintf("%s: %s",
 				style.Render(setting.Name),
-				valueStyle.Render(setting.Value),
+				valueStyle.Render(value),
 			)
 		}
 
@@ -199,13 +366,24 @@ func (s *SettingsView) View() string {
 			row += "\n" + descriptionStyle.Render("  "+setting.Description)
 		}
 
+		// Add the field's validation error
+		if setting.Err != "" {
+			row += "\n" + errorStyle.Render("  "+setting.Err)
+		}
+
 		content += row + "\n\n"
 	}
 
 	// Add help text
-	helpText := "↑/↓: Navigate • Enter: Edit • Esc: Cancel"
+	helpText := "↑/↓: Navigate • Enter: Edit • Space: Toggle • /: Search"
 	if s.editingIdx >= 0 {
 		helpText = "Enter: Save • Esc: Cancel"
+	} else if s.searching {
+		helpText = "Type to filter • Enter: Keep filter • Esc: Clear"
+	}
+
+	if s.notice != "" {
+		content += valueStyle.Render(s.notice) + "\n\n"
 	}
 
 	// Add error message if present
@@ -225,7 +403,6 @@ func (s *SettingsView) View() string {
 // loadSettings loads settings from the configuration
 func (s *SettingsView) loadSettings() tea.Cmd {
 	return func() tea.Msg {
-		// This would be replaced with actual configuration loading logic
 		cfg, err := config.Load()
 		if err != nil {
 			s.err = fmt.Errorf("failed to load settings: %w", err)
@@ -233,51 +410,56 @@ func (s *SettingsView) loadSettings() tea.Cmd {
 		}
 
 		// Update settings with loaded values
-		for i, setting := range s.settings {
-			switch setting.Name {
-			case "Age Key Path":
-				s.settings[i].Value = cfg.KeyPath
-			case "Encrypted Key Path":
-				s.settings[i].Value = cfg.EncryptedKeyPath
-			case "Auto-Delete Interval":
-				s.settings[i].Value = cfg.AutoDeleteInterval.String()
-			case "Editor Command":
-				s.settings[i].Value = cfg.EditorCommand
-			case "Default Recipients":
-				s.settings[i].Value = cfg.DefaultRecipients
-			}
+		for i := range s.settings {
+			s.settings[i].Value = s.settings[i].load(cfg)
 		}
 
 		return nil
 	}
 }
 
-// saveSettings saves the current settings
+// ConfigSavedMsg is sent after the settings were saved so other views can
+// apply the new configuration without a restart
+type ConfigSavedMsg struct {
+	Config *config.Config
+}
+
+// saveSettings validates and saves the current settings
 func (s *SettingsView) saveSettings() tea.Cmd {
 	return func() tea.Msg {
-		// Create a configuration object
-		cfg := &config.Config{}
+		// Start from the stored configuration so fields without a setting are kept
+		cfg, err := config.Load()
+		if err != nil {
+			cfg = config.DefaultConfig()
+		}
 
-		// Update with current values
-		for _, setting := range s.settings {
-			switch setting.Name {
-			case "Age Key Path":
-				cfg.KeyPath = setting.Value
-			case "Encrypted Key Path":
-				cfg.EncryptedKeyPath = setting.Value
-			case "Auto-Delete Interval":
-				duration, err := time.ParseDuration(setting.Value)
-				if err != nil {
-					s.err = fmt.Errorf("invalid duration format for Auto-Delete Interval: %w", err)
-					return nil
-				}
-				cfg.AutoDeleteInterval = duration
-			case "Editor Command":
-				cfg.EditorCommand = setting.Value
-			case "Default Recipients":
-				cfg.DefaultRecipients = setting.Value
+		// Apply each setting, recording validation errors per field
+		before := *cfg
+		valid := true
+		s.notice = ""
+		for i := range s.settings {
+			s.settings[i].Err = ""
+			if err := s.settings[i].apply(cfg, s.settings[i].Value); err != nil {
+				s.settings[i].Err = err.Error()
+				valid = false
+			}
+		}
+		pathErrs := config.CheckKeyPaths(&before, cfg)
+		for i := range s.settings {
+			if err, ok := pathErrs[s.settings[i].field]; ok && s.settings[i].Err == "" {
+				s.settings[i].Err = err.Error()
+				valid = false
 			}
 		}
+		if !valid {
+			s.err = fmt.Errorf("settings not saved, fix the highlighted fields")
+			return nil
+		}
+
+		if err := config.Validate(cfg); err != nil {
+			s.err = fmt.Errorf("invalid settings: %w", err)
+			return nil
+		}
 
 		// Save the configuration
 		if err := config.Save(cfg); err != nil {
@@ -285,7 +467,17 @@ func (s *SettingsView) saveSettings() tea.Cmd {
 			return nil
 		}
 
-		return nil
+		// Show what was stored where a path was expanded or made absolute
+		var normalized []string
+		for _, setting := range s.settings {
+			if stored := setting.load(cfg); setting.path && strings.TrimSpace(setting.Value) != stored {
+				normalized = append(normalized, fmt.Sprintf("%s saved as %s", setting.Name, stored))
+			}
+		}
+		s.notice = strings.Join(normalized, "\n")
+
+		s.err = nil
+		return ConfigSavedMsg{Config: cfg}
 	}
 }
 
@@ -304,4 +496,3 @@ func max(a, b int) int {
 	}
 	return b
 }
-
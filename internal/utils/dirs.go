@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// HomeDir returns the user's home directory. When $HOME is unset, as in some
+// containers and service managers, the account database is asked instead.
+func HomeDir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil && filepath.IsAbs(home) {
+		return home, nil
+	}
+	if u, err := user.Current(); err == nil && filepath.IsAbs(u.HomeDir) {
+		return u.HomeDir, nil
+	}
+	return "", fmt.Errorf("cannot determine the home directory: $HOME is not set and the current user has none")
+}
+
+// ConfigDir returns the user's configuration directory: $XDG_CONFIG_HOME or
+// the platform default, then ~/.config under the home directory HomeDir finds
+func ConfigDir() (string, error) {
+	if dir, err := os.UserConfigDir(); err == nil && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := HomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine the config directory: %w", err)
+	}
+	return filepath.Join(home, ".config"), nil
+}
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // FileExists checks if a file exists and is not a directory
@@ -25,48 +29,58 @@ func DirExists(path string) bool {
 	return info.IsDir()
 }
 
-// EnsureDir ensures a directory exists, creating it if necessary
-func EnsureDir(path string) error {
-	if DirExists(path) {
-		return nil
+// ExpandPath expands a leading ~ to the user's home directory
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
 	}
-	return os.MkdirAll(path, 0o700)
+	home, err := HomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
 }
 
-// SecurelyDeleteFile securely deletes a file
-func SecurelyDeleteFile(path string) error {
-	// Check if shred is available
-	_, err := exec.LookPath("shred")
-	if err == nil {
-		cmd := exec.Command("shred", "-u", path)
-		return cmd.Run()
+// NormalizePath expands environment variables and a leading ~ in path and
+// makes it absolute, so it names the same file whatever the working
+// directory. A variable that is not set is an error rather than dropped.
+func NormalizePath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", nil
 	}
 
-	// Fallback to overwriting with zeros
-	file, err := os.OpenFile(path, os.O_WRONLY, 0)
-	if err != nil {
-		return err
+	var missing []string
+	path = os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	abs, err := filepath.Abs(ExpandPath(path))
 	if err != nil {
-		return err
+		return "", fmt.Errorf("cannot make %s absolute: %w", path, err)
 	}
+	return abs, nil
+}
 
-	size := fileInfo.Size()
-	zeros := make([]byte, 4096)
-
-	for written := int64(0); written < size; {
-		n, err := file.Write(zeros)
-		if err != nil {
-			return err
-		}
-		written += int64(n)
+// EnsureDir ensures a directory exists, creating it if necessary
+func EnsureDir(path string) error {
+	if DirExists(path) {
+		return nil
 	}
+	return os.MkdirAll(path, 0o700)
+}
 
-	// Finally, remove the file
-	return os.Remove(path)
+// SecurelyDeleteFile securely deletes a file using the default wipe options
+func SecurelyDeleteFile(path string) error {
+	_, err := SecureDelete(path, DefaultWipeOptions())
+	return err
 }
 
 // CopyFile copies a file from src to dst
@@ -87,6 +101,15 @@ func CopyFile(src, dst string) error {
 	return os.WriteFile(dst, data, 0o600)
 }
 
+// FileChecksum returns the hex-encoded SHA-256 checksum of a file's content
+func FileChecksum(path string) (string, error) {
+	sum, err := fileSum(path)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
 // GetFileSize returns the size of a file in a human-readable format
 func GetFileSize(path string) (string, error) {
 	info, err := os.Stat(path)
@@ -94,16 +117,102 @@ func GetFileSize(path string) (string, error) {
 		return "", err
 	}
 
-	size := info.Size()
+	return FormatSize(info.Size()), nil
+}
+
+// sizeUnits are the units used when formatting and parsing sizes
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
 
-	units := []string{"B", "KB", "MB", "GB", "TB"}
+// FormatSize formats a size in bytes in a human-readable format
+func FormatSize(size int64) string {
 	unitIndex := 0
 	sizef := float64(size)
 
-	for sizef >= 1024 && unitIndex < len(units)-1 {
+	for sizef >= 1024 && unitIndex < len(sizeUnits)-1 {
 		sizef /= 1024
 		unitIndex++
 	}
 
-	return fmt.Sprintf("%.1f %s", sizef, units[unitIndex]), nil
+	return fmt.Sprintf("%.1f %s", sizef, sizeUnits[unitIndex])
+}
+
+// ParseSize parses a human-readable size such as "100MB" or "1.5 GB" into bytes
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	// Find the longest matching unit suffix
+	multiplier := float64(1)
+	number := value
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		if strings.HasSuffix(value, sizeUnits[i]) {
+			number = strings.TrimSpace(strings.TrimSuffix(value, sizeUnits[i]))
+			multiplier = math.Pow(1024, float64(i))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(n * multiplier), nil
+}
+
+// ShredAvailable reports whether the shred command is available on the PATH
+func ShredAvailable() bool {
+	_, err := exec.LookPath("shred")
+	return err == nil
+}
+
+// IsReadOnly reports whether an existing file cannot be opened for writing
+func IsReadOnly(path string) bool {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return os.IsPermission(err)
+	}
+	file.Close()
+	return false
+}
+
+// WritableCopy copies a file next to the original under a free name such as
+// secrets.copy.yaml. The copy is writable by its owner
+func WritableCopy(path string) (string, error) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+
+	copyPath := stem + ".copy" + ext
+	for i := 2; FileExists(copyPath); i++ {
+		copyPath = fmt.Sprintf("%s.copy%d%s", stem, i, ext)
+	}
+
+	if err := CopyFile(path, copyPath); err != nil {
+		return "", err
+	}
+	return copyPath, nil
+}
+
+// CheckWritable checks that a file could be created at path. Missing parent
+// directories are acceptable as long as the nearest existing ancestor is writable.
+func CheckWritable(path string) error {
+	dir := filepath.Dir(path)
+	for !DirExists(dir) {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("no existing parent directory for %s", path)
+		}
+		dir = parent
+	}
+
+	// Try creating a temporary file to confirm write access
+	tmpFile, err := os.CreateTemp(dir, ".supper-write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	return os.Remove(tmpPath)
 }
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// IsSymlink reports whether path itself is a symbolic link
+func IsSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// RealPath returns the file a path ultimately refers to, following any
+// symlinks. Paths that do not exist yet are returned unchanged.
+func RealPath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// WipeMode selects the data written by each overwrite pass
+type WipeMode string
+
+const (
+	WipeZeros  WipeMode = "zeros"
+	WipeRandom WipeMode = "random"
+)
+
+// wipeLimitations explains why overwriting cannot guarantee data destruction
+const wipeLimitations = "overwriting in place may not destroy the original data on copy-on-write filesystems (btrfs, ZFS, APFS) or SSDs with wear levelling"
+
+// WipeOptions configures how a file is securely deleted
+type WipeOptions struct {
+	Passes int      // Number of overwrite passes (at least 1)
+	Mode   WipeMode // Data to overwrite with
+	Verify bool     // Read the file back after overwriting to confirm it changed
+}
+
+// DefaultWipeOptions returns the default secure deletion options
+func DefaultWipeOptions() WipeOptions {
+	return WipeOptions{
+		Passes: 1,
+		Mode:   WipeZeros,
+		Verify: true,
+	}
+}
+
+// WipeResult describes how a file was securely deleted
+type WipeResult struct {
+	Method   string // "shred" or "overwrite"
+	Passes   int
+	Mode     WipeMode
+	Verified bool
+	Note     string
+}
+
+// String summarises the result for display
+func (r *WipeResult) String() string {
+	verified := "not verified"
+	if r.Verified {
+		verified = "verified"
+	}
+	return fmt.Sprintf("%s, %d %s pass(es), %s; note: %s", r.Method, r.Passes, r.Mode, verified, r.Note)
+}
+
+// WipeBytes overwrites a buffer holding sensitive data with zeros
+func WipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// SecureDelete overwrites a file according to opts, optionally verifies that
+// its contents changed, and then removes it
+func SecureDelete(path string, opts WipeOptions) (*WipeResult, error) {
+	if opts.Passes < 1 {
+		opts.Passes = 1
+	}
+	if opts.Mode != WipeRandom {
+		opts.Mode = WipeZeros
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// Hash the original content so verification can confirm it was replaced
+	var originalSum []byte
+	if opts.Verify {
+		originalSum, err = fileSum(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &WipeResult{Passes: opts.Passes, Mode: opts.Mode, Note: wipeLimitations}
+
+	if ShredAvailable() {
+		result.Method = "shred"
+		if err := shredFile(path, opts); err != nil {
+			return nil, err
+		}
+	} else {
+		result.Method = "overwrite"
+		if err := overwriteFile(path, size, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Verify && size > 0 {
+		if err := verifyWiped(path, originalSum, opts.Mode); err != nil {
+			return nil, err
+		}
+		result.Verified = true
+	}
+
+	// Finally, remove the file
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// shredFile overwrites a file with shred without removing it. In zeros mode
+// the final pass writes zeros.
+func shredFile(path string, opts WipeOptions) error {
+	args := []string{}
+	if opts.Mode == WipeZeros {
+		args = append(args, "-n", strconv.Itoa(opts.Passes-1), "-z")
+	} else {
+		args = append(args, "-n", strconv.Itoa(opts.Passes))
+	}
+	args = append(args, path)
+
+	var errOut bytes.Buffer
+	cmd := exec.Command("shred", args...)
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("shred failed: %s - %w", errOut.String(), err)
+	}
+	return nil
+}
+
+// overwriteFile overwrites a file in place for the configured number of passes
+func overwriteFile(path string, size int64, opts WipeOptions) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 4096)
+	for pass := 0; pass < opts.Passes; pass++ {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		for written := int64(0); written < size; {
+			chunk := buf
+			if remaining := size - written; remaining < int64(len(chunk)) {
+				chunk = chunk[:remaining]
+			}
+			if opts.Mode == WipeRandom {
+				if _, err := rand.Read(chunk); err != nil {
+					return err
+				}
+			} else {
+				clear(chunk)
+			}
+
+			n, err := file.Write(chunk)
+			if err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+
+		// Make sure each pass reaches the disk before the next one
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyWiped reads a file back and confirms its content was replaced
+func verifyWiped(path string, originalSum []byte, mode WipeMode) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read back wiped file: %w", err)
+	}
+
+	if mode == WipeZeros {
+		for _, b := range data {
+			if b != 0 {
+				return fmt.Errorf("verification failed: file still contains non-zero bytes")
+			}
+		}
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	if bytes.Equal(sum[:], originalSum) {
+		return fmt.Errorf("verification failed: file content is unchanged")
+	}
+	return nil
+}
+
+// fileSum returns the SHA-256 checksum of a file's content
+func fileSum(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,214 @@
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/supper/internal/age"
+	"github.com/bxtal-lsn/supper/internal/audit"
+	"github.com/bxtal-lsn/supper/internal/errors"
+	"github.com/bxtal-lsn/supper/internal/sops"
+	"github.com/bxtal-lsn/supper/internal/utils"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a file must stay unchanged before it is re-encrypted
+const DefaultDebounce = 500 * time.Millisecond
+
+// Options configures a watch
+type Options struct {
+	Recipients []age.Recipient // Recipients of any kind the files are encrypted to
+	Debounce   time.Duration   // Quiet period before re-encrypting, DefaultDebounce if zero
+	Workers    int             // Files re-encrypted at once, sops.DefaultBatchWorkers if zero
+	SOPS       []sops.Option   // Passed to every sops run
+}
+
+// Event reports the outcome of re-encrypting a changed file
+type Event struct {
+	Path   string
+	Output string
+	Time   time.Time
+	Err    error
+}
+
+// EncryptedPath returns where the encrypted copy of a plaintext file is written
+func EncryptedPath(path string) string {
+	return sops.SidecarPath(path)
+}
+
+// Run watches the targets until ctx is cancelled. Files given explicitly are
+// always tracked; in directories, a plaintext file is tracked when its
+// encrypted copy (see EncryptedPath) already exists. Encrypted outputs are
+// never tracked, so the watcher's own writes do not trigger it again.
+// onEvent may be called from several goroutines at once; Run returns once
+// the files being re-encrypted are done.
+func Run(ctx context.Context, targets []string, opts Options, onEvent func(Event)) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if len(opts.Recipients) == 0 {
+		return errors.New(errors.TypeConfig, "No recipients to encrypt to").WithCode(errors.CodeConfigInvalid)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, errors.TypeFileOperation, "Failed to start file watcher").WithCode(errors.CodeWatchFailed)
+	}
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, target := range targets {
+		path, err := filepath.Abs(target)
+		if err != nil {
+			return errors.Wrap(err, errors.TypeFileOperation, "Invalid watch target").
+				WithCode(errors.CodeFileNotFound).WithData("path", target)
+		}
+
+		switch {
+		case utils.DirExists(path):
+			dirs[path] = true
+		case utils.FileExists(path):
+			if isOutput(path) {
+				return errors.New(errors.TypeFileOperation, "Cannot watch an encrypted output file").
+					WithCode(errors.CodeWatchFailed).WithData("path", path)
+			}
+			files[path] = true
+		default:
+			return errors.New(errors.TypeFileOperation, "Watch target does not exist").
+				WithCode(errors.CodeFileNotFound).WithData("path", path)
+		}
+	}
+
+	// Watch parent directories of files too, since editors often replace files by renaming
+	watched := make(map[string]bool)
+	for path := range files {
+		watched[filepath.Dir(path)] = true
+	}
+	for dir := range dirs {
+		watched[dir] = true
+	}
+	for dir := range watched {
+		if err := watcher.Add(dir); err != nil {
+			return errors.Wrap(err, errors.TypeFileOperation, "Failed to watch directory").
+				WithCode(errors.CodeWatchFailed).WithData("directory", dir)
+		}
+	}
+
+	tracked := func(path string) bool {
+		if files[path] {
+			return true
+		}
+		name := filepath.Base(path)
+		if !dirs[filepath.Dir(path)] || strings.HasPrefix(name, sops.TempPrefix) {
+			return false
+		}
+		return utils.FileExists(EncryptedPath(path)) && !isOutput(path)
+	}
+
+	timers := make(map[string]*time.Timer)
+	due := make(chan string, 16)
+	// Closed on return, so a timer that already fired does not wait on due
+	done := make(chan struct{})
+	defer close(done)
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}()
+
+	// Changed files are sealed in parallel, each one after any other
+	// operation on it or its copy has finished
+	queue := sops.NewQueue(opts.Workers, nil)
+	defer queue.Wait()
+	var mu sync.Mutex
+	waiting := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			path := filepath.Clean(event.Name)
+			if !tracked(path) {
+				continue
+			}
+
+			// Restart the quiet period so partial writes are never encrypted
+			if t, ok := timers[path]; ok {
+				t.Reset(opts.Debounce)
+			} else {
+				timers[path] = time.AfterFunc(opts.Debounce, func() {
+					select {
+					case due <- path:
+					case <-done:
+					}
+				})
+			}
+
+		case path := <-due:
+			delete(timers, path)
+			if !utils.FileExists(path) {
+				continue
+			}
+
+			// A seal that has not started yet will read the latest content anyway
+			mu.Lock()
+			already := waiting[path]
+			waiting[path] = true
+			mu.Unlock()
+			if already {
+				continue
+			}
+			queue.Submit(ctx, sops.Task{Operation: "watch-encrypt", Path: path, Also: []string{EncryptedPath(path)}, Run: func(ctx context.Context) error {
+				mu.Lock()
+				delete(waiting, path)
+				mu.Unlock()
+
+				ev := seal(ctx, path, opts)
+				if ctx.Err() != nil {
+					return ev.Err
+				}
+				audit.Record("watch-encrypt", path, ev.Err, "output="+ev.Output)
+				onEvent(ev)
+				return ev.Err
+			}})
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			onEvent(Event{Time: time.Now(), Err: errors.Wrap(err, errors.TypeFileOperation, "File watcher error").
+				WithCode(errors.CodeWatchFailed)})
+		}
+	}
+}
+
+// seal encrypts path to its encrypted copy
+func seal(ctx context.Context, path string, opts Options) Event {
+	ev := Event{Path: path, Output: EncryptedPath(path), Time: time.Now()}
+	sopsOpts := append(append([]sops.Option(nil), opts.SOPS...), sops.WithContext(ctx), sops.WithCreateOutputDir())
+	ev.Err = sops.EncryptToFile(path, ev.Output, opts.Recipients, sopsOpts...)
+	return ev
+}
+
+// isOutput reports whether path is an encrypted copy rather than plaintext.
+// The output template may give copies any name, so besides the default .enc
+// the file itself is checked for sops metadata.
+func isOutput(path string) bool {
+	if strings.HasSuffix(path, ".enc") {
+		return true
+	}
+	_, err := sops.ReadMetadata(path)
+	return err == nil
+}